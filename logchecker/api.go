@@ -0,0 +1,110 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// HTTP API of LogChecker
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// Handler returns HTTP handler of LogChecker API:
+//
+//     POST /reload - reload configuration
+//     GET /status - statistics snapshot in JSON format
+//     GET /tail?file=PATH&n=100 - last lines of a watched file
+//     GET /decision?service=NAME&file=PATH - why the last check did or didn't notify
+//
+func (logger *LogChecker) Handler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/reload", logger.handleReload)
+    mux.HandleFunc("/status", logger.handleStatus)
+    mux.HandleFunc("/tail", logger.handleTail)
+    mux.HandleFunc("/decision", logger.handleDecision)
+    return mux
+}
+
+// ListenAPI starts HTTP API server if API address is set.
+func (logger *LogChecker) ListenAPI() {
+    if len(logger.Cfg.API) == 0 {
+        return
+    }
+    go func(addr string) {
+        LoggerInfo.Printf("API is listening on %v\n", addr)
+        if err := http.ListenAndServe(addr, logger.Handler()); err != nil {
+            LoggerError.Printf("API server error: %v\n", err)
+        }
+    }(logger.Cfg.API)
+}
+
+func (logger *LogChecker) handleReload(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "POST" {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    logger.TriggerReload()
+    w.WriteHeader(http.StatusAccepted)
+    fmt.Fprintln(w, "reload is requested")
+}
+
+func (logger *LogChecker) handleStatus(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "GET" {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(logger.Stats()); err != nil {
+        LoggerError.Printf("status encoding error: %v\n", err)
+    }
+}
+
+func (logger *LogChecker) handleTail(w http.ResponseWriter, r *http.Request) {
+    n := 100
+    if r.Method != "GET" {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if value := r.URL.Query().Get("n"); len(value) > 0 {
+        number, err := strconv.Atoi(value)
+        if err != nil {
+            http.Error(w, "incorrect number of lines", http.StatusBadRequest)
+            return
+        }
+        n = number
+    }
+    logPath := r.URL.Query().Get("file")
+    if !logger.IsWatched(logPath) {
+        http.Error(w, "file is not watched", http.StatusForbidden)
+        return
+    }
+    lines, err := logger.Tail(logPath, n)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    if len(lines) > 0 {
+        fmt.Fprintln(w, strings.Join(lines, "\n"))
+    }
+}
+
+// FetchStats requests a statistics snapshot from the status endpoint.
+func FetchStats(url string) (Stats, error) {
+    var stats Stats
+    resp, err := http.Get(url)
+    if err != nil {
+        return stats, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return stats, fmt.Errorf("status request error: %v", resp.Status)
+    }
+    err = json.NewDecoder(resp.Body).Decode(&stats)
+    return stats, err
+}
@@ -0,0 +1,252 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// HTTP API testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestReloadAPI(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_api_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_api_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_api_syslog"),
+    }
+    oldexample := filepath.Join(testdir, "config.example.json")
+    example := filepath.Join(testdir, "config.api.json")
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer rm(example)
+    for _, v := range newvalues {
+        if err := createFile(v, 0666); err != nil {
+            t.Errorf("test file preparation error [%v]: %v", v, err)
+        }
+        defer rm(v)
+    }
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatal(err)
+    }
+    err := logger.Start(context.Background(), &group)
+    if err != nil {
+        t.Fatal(err)
+    }
+    server := httptest.NewServer(logger.Handler())
+    defer server.Close()
+
+    resp, err := http.Get(server.URL + "/reload")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusMethodNotAllowed {
+        t.Errorf("incorrect status code: %v", resp.StatusCode)
+    }
+    // rename a service and request a reload
+    newvalues["My service #2"] = "Reloaded service"
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    resp, err = http.Post(server.URL + "/reload", "text/plain", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusAccepted {
+        t.Errorf("incorrect status code: %v", resp.StatusCode)
+    }
+    select {
+        case <-logger.ReloadRequests():
+            err = logger.Reload(context.Background(), &group)
+            if err != nil {
+                t.Errorf("reload error: %v", err)
+            }
+        case <-time.After(time.Second):
+            t.Fatalf("reload request is not received")
+    }
+    if name := logger.Cfg.Observed[1].Name; name != "Reloaded service" {
+        t.Errorf("config is not reloaded: %v", name)
+    }
+    // incorrect configuration is rejected
+    if err := updateFile(example, "{"); err != nil {
+        t.Fatal(err)
+    }
+    err = logger.Reload(context.Background(), &group)
+    if _, ok := err.(*ConfigError); !ok {
+        t.Errorf("need config error: %v", err)
+    }
+    if !logger.IsWorking() {
+        t.Errorf("process should be still running")
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestStatus(t *testing.T) {
+    logger := New()
+    logger.Name = "Test-LogChecker"
+    logger.Cfg.Observed = []Service{{
+        Name: "TestSrv",
+        Files: []File{
+            {Log: "/tmp/test_status.log", Found: 3, ExtBoundary: 2, Counter: 1, Limit: 5, LastCheck: time.Now()},
+            {Log: "/tmp/test_status_new.log"},
+        },
+    }}
+    server := httptest.NewServer(logger.Handler())
+    defer server.Close()
+
+    stats, err := FetchStats(server.URL + "/status")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if (len(stats.Files) != 2) || (stats.Files[0].Found != 3) || (stats.Files[0].Service != "TestSrv") {
+        t.Errorf("incorrect stats: %v", stats)
+    }
+    report := RenderStats(stats, "")
+    if report != logger.StatsReport() {
+        t.Errorf("remote and local reports are different:\n%v\n%v", report, logger.StatsReport())
+    }
+    if !strings.Contains(report, "/tmp/test_status.log: matches=3, boundary=2, sent=1/5, last check=0s ago") {
+        t.Errorf("incorrect report: %v", report)
+    }
+    if !strings.Contains(report, "last check=never") {
+        t.Errorf("incorrect report: %v", report)
+    }
+    if report := RenderStats(stats, "{{.Name}} {{len .Files}}"); report != "Test-LogChecker 2" {
+        t.Errorf("incorrect custom report: %v", report)
+    }
+    // incorrect templates
+    for _, tmpl := range []string{"{{.Name", "{{.Unknown}}"} {
+        if report := RenderStats(stats, tmpl); report != RenderStats(stats, "") {
+            t.Errorf("default template should be used: %v", report)
+        }
+    }
+}
+
+func TestTail(t *testing.T) {
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_tail.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    logger := New()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{{Log: filename}}}}
+    if lines, err := logger.Tail(filename, 10); (err != nil) || (len(lines) != 0) {
+        t.Errorf("incorrect empty tail: %v %v", lines, err)
+    }
+    // lines are longer than a read chunk in total
+    lines := make([]string, 5000)
+    for i := range lines {
+        lines[i] = fmt.Sprintf("line %v %v", i, strings.Repeat("x", 20))
+    }
+    if err := updateFile(filename, lines...); err != nil {
+        t.Fatal(err)
+    }
+    for _, n := range []int{1, 3, 4000, 5000, 6000} {
+        tail, err := logger.Tail(filename, n)
+        if err != nil {
+            t.Fatal(err)
+        }
+        expected := lines
+        if n < len(lines) {
+            expected = lines[len(lines)-n:]
+        }
+        if strings.Join(tail, "\n") != strings.Join(expected, "\n") {
+            t.Errorf("incorrect tail [%v]: %v lines", n, len(tail))
+        }
+    }
+    if _, err := logger.Tail("/etc/passwd", 1); err == nil {
+        t.Errorf("only watched files can be read")
+    }
+    if _, err := logger.Tail(filename, 0); err == nil {
+        t.Errorf("need lines number error")
+    }
+    server := httptest.NewServer(logger.Handler())
+    defer server.Close()
+    resp, err := http.Get(server.URL + "/tail?n=2&file=" + url.QueryEscape(filename))
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, err := ioutil.ReadAll(resp.Body)
+    resp.Body.Close()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(body) != strings.Join(lines[len(lines)-2:], "\n") + "\n" {
+        t.Errorf("incorrect tail response: %v", string(body))
+    }
+    resp, err = http.Get(server.URL + "/tail?file=/etc/passwd")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusForbidden {
+        t.Errorf("incorrect status code: %v", resp.StatusCode)
+    }
+}
+
+func TestTailGlob(t *testing.T) {
+    var group sync.WaitGroup
+    dir, err := ioutil.TempDir(buildDir(), "test_tail_glob")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    filename := filepath.Join(dir, "app.log")
+    if err := ioutil.WriteFile(filename, []byte("line 1\nline 2\n"), 0666); err != nil {
+        t.Fatal(err)
+    }
+    pattern := filepath.Join(dir, "*.log")
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: pattern, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    if _, err := logger.Tail(filename, 1); err == nil {
+        t.Error("file of not started pattern is read")
+    }
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    if lines, err := logger.Tail(filename, 1); (err != nil) || (len(lines) != 1) || (lines[0] != "line 2") {
+        t.Errorf("incorrect tail of glob file: %v, %v", lines, err)
+    }
+    if _, err := logger.Tail(pattern, 1); (err == nil) || !strings.Contains(err.Error(), "not watched") {
+        t.Errorf("glob pattern is read: %v", err)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := logger.Tail(filename, 1); err == nil {
+        t.Error("file of stopped pattern is read")
+    }
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Compressed and archived logs
+//
+package logchecker
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// gzipMagic is a header of gzip files.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzip checks that the file is gzip compressed by its suffix or header.
+func isGzip(file *os.File) (bool, error) {
+    if strings.HasSuffix(file.Name(), ".gz") {
+        return true, nil
+    }
+    header := make([]byte, len(gzipMagic))
+    n, err := file.ReadAt(header, 0)
+    if (err != nil) && (err != io.EOF) {
+        return false, err
+    }
+    return (n == len(gzipMagic)) && bytes.Equal(header, gzipMagic), nil
+}
+
+// ArchivedFiles returns sorted paths of archived files found by
+// File.Archived patterns, the watched file is excluded.
+func (f *File) ArchivedFiles() []string {
+    var result []string
+    found := map[string]bool{f.Log: true}
+    for _, pattern := range f.Archived {
+        paths, err := filepath.Glob(pattern)
+        if err != nil {
+            LoggerError.Printf("archived pattern error [%v]: %v", pattern, err)
+            continue
+        }
+        for _, path := range paths {
+            if !found[path] {
+                found[path] = true
+                result = append(result, path)
+            }
+        }
+    }
+    sort.Strings(result)
+    return result
+}
+
+// sweepArchived reads all lines of archived files,
+// gzip compressed files are decompressed.
+func (f *File) sweepArchived(match func(line, source string, number uint64)) {
+    for _, path := range f.ArchivedFiles() {
+        if err := readArchived(path, func(line string, number uint64) {
+            match(line, filepath.Base(path), number)
+        }); err != nil {
+            LoggerError.Printf("archived file error [%v]: %v", path, err)
+        }
+    }
+}
+
+// readArchived calls handler for every line of the file.
+func readArchived(path string, handler func(string, uint64)) error {
+    var (
+        reader io.Reader
+        number uint64
+    )
+    file, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    compressed, err := isGzip(file)
+    if err != nil {
+        return err
+    }
+    reader = file
+    if compressed {
+        gz, err := gzip.NewReader(file)
+        if err != nil {
+            return err
+        }
+        defer gz.Close()
+        reader = gz
+    }
+    scanner := bufio.NewScanner(reader)
+    for scanner.Scan() {
+        number++
+        handler(scanner.Text(), number)
+    }
+    return scanner.Err()
+}
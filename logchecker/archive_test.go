@@ -0,0 +1,106 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Archived logs testing methods
+//
+package logchecker
+
+import (
+    "compress/gzip"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func writeGzip(name string, lines ...string) error {
+    file, err := os.Create(name)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    writer := gzip.NewWriter(file)
+    if _, err := writer.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+        return err
+    }
+    return writer.Close()
+}
+
+func TestArchived(t *testing.T) {
+    var group sync.WaitGroup
+    testdir := buildDir()
+    filename := filepath.Join(testdir, "test_archive.log")
+    archived := filepath.Join(testdir, "test_archive.log.1.gz")
+    // gzip file without suffix is detected by its header
+    renamed := filepath.Join(testdir, "test_archive.log.2")
+    for _, name := range []string{filename, archived, renamed} {
+        defer os.Remove(name)
+    }
+    if err := writeGzip(archived, "ERROR 1", "OK", "ERROR 2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := writeGzip(renamed, "ERROR 0"); err != nil {
+        t.Fatal(err)
+    }
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "ERROR 3"); err != nil {
+        t.Fatal(err)
+    }
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Archived: []string{filename + ".*"}}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    if files := f.ArchivedFiles(); len(files) != 2 {
+        t.Errorf("incorrect archived files: %v", files)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if f.Found != 4 {
+        t.Errorf("incorrect found lines: %v", f.Found)
+    }
+    msg := notifier.wait(time.Second)
+    for _, line := range []string{"test_archive.log.1.gz:3: ERROR 2", "test_archive.log.2:1: ERROR 0", "\n1: ERROR 3"} {
+        if !strings.Contains(msg, line) {
+            t.Errorf("notification doesn't contain [%v]: %v", line, msg)
+        }
+    }
+    // archived files are checked once
+    if err := updateFile(filename, "ERROR 4"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if f.Found != 5 {
+        t.Errorf("incorrect found lines: %v", f.Found)
+    }
+
+    // compressed watched file
+    gz := &File{Log: archived, Pattern: "ERROR", Boundary: 10, Period: 3600, Limit: 10}
+    if err := gz.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    gz.LogStart, gz.ExtBoundary = time.Now(), gz.Boundary
+    for i := 0; i < 2; i++ {
+        if err := gz.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        if (gz.Found != 2) || (gz.Pos != 3) {
+            t.Errorf("incorrect compressed file check: found=%v, pos=%v", gz.Found, gz.Pos)
+        }
+    }
+    gz.Archived = []string{"relative/path.*"}
+    if err := gz.Validate(); err == nil {
+        t.Errorf("need archived path error")
+    }
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Attachments of full reports
+//
+package logchecker
+
+import (
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "mime/multipart"
+    "net/textproto"
+    "strings"
+)
+
+const (
+    // DefaultAttachMaxSize is a default maximum size of a report attachment in bytes.
+    DefaultAttachMaxSize int64 = 1 << 20
+    // AttachmentName is a file name of a report attachment.
+    AttachmentName string = "report.txt"
+    attachLineLength int = 76
+)
+
+// AttachmentNotifier is a notifier that can send a full report as an attachment.
+type AttachmentNotifier interface {
+    Notifier
+    NotifyAttachment(string, string, string, []string) error
+}
+
+// reportAttachment collects all report lines of one check,
+// their size is limited.
+type reportAttachment struct {
+    lines []string
+    size int64
+    limit int64
+    truncated bool
+}
+
+// add appends a line if the size limit is not reached,
+// it returns an index of the line or -1.
+func (ra *reportAttachment) add(line string) int {
+    if ra.truncated {
+        return -1
+    }
+    if ra.size + int64(len(line)) + 1 > ra.limit {
+        ra.truncated = true
+        return -1
+    }
+    ra.lines = append(ra.lines, line)
+    ra.size += int64(len(line)) + 1
+    return len(ra.lines) - 1
+}
+
+// String returns a text of the attachment.
+func (ra *reportAttachment) String() string {
+    text := strings.Join(ra.lines, "\n") + "\n"
+    if ra.truncated {
+        text += fmt.Sprintf("...\nThe report is truncated to %v bytes.\n", ra.limit)
+    }
+    return text
+}
+
+// attachMaxSize returns a maximum size of the file's report attachment.
+func (f *File) attachMaxSize() int64 {
+    if f.AttachMaxSize > 0 {
+        return f.AttachMaxSize
+    }
+    return DefaultAttachMaxSize
+}
+
+// validateAttach checks attachment settings of the file.
+func (f *File) validateAttach() error {
+    if f.AttachMaxSize < 0 {
+        return fmt.Errorf("attach_max_size should not be negative")
+    }
+    if f.AttachReport && f.CountOnly {
+        return fmt.Errorf("attach_report is not supported in count only mode")
+    }
+    return nil
+}
+
+// emailContent returns MIME headers and a body of an email message,
+// a not empty attachment is added as a text file to a multipart message.
+func (logger *LogChecker) emailContent(msg, attachment string) string {
+    if len(attachment) == 0 {
+        return logger.emailBody(msg)
+    }
+    var buf bytes.Buffer
+    contentType, text := "text/plain; charset=\"UTF-8\"", msg
+    if body, ok := logger.htmlEmail(msg); ok {
+        contentType, text = "text/html; charset=\"UTF-8\"", body
+    }
+    writer := multipart.NewWriter(&buf)
+    part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+    if err == nil {
+        _, err = part.Write([]byte(text))
+    }
+    if err == nil {
+        part, err = writer.CreatePart(textproto.MIMEHeader{
+            "Content-Type": {"text/plain; charset=\"UTF-8\""},
+            "Content-Disposition": {fmt.Sprintf("attachment; filename=\"%v\"", AttachmentName)},
+            "Content-Transfer-Encoding": {"base64"},
+        })
+    }
+    if err == nil {
+        encoded := base64.StdEncoding.EncodeToString([]byte(attachment))
+        for len(encoded) > attachLineLength {
+            part.Write([]byte(encoded[:attachLineLength] + "\r\n"))
+            encoded = encoded[attachLineLength:]
+        }
+        _, err = part.Write([]byte(encoded + "\r\n"))
+    }
+    if err == nil {
+        err = writer.Close()
+    }
+    if err != nil {
+        LoggerError.Printf("attachment error, it is skipped: %v", err)
+        return logger.emailBody(msg)
+    }
+    return "MIME-version: 1.0;\nContent-Type: multipart/mixed; boundary=\"" + writer.Boundary() + "\";\n\n" + buf.String()
+}
+
+// NotifyAttachment sends a prepared email message with a subject
+// and a full report as an attachment.
+func (logger *LogChecker) NotifyAttachment(subject, msg, attachment string, to []string) error {
+    return logger.deliver(subject, msg, attachment, to, logger.Cfg.Sender["delivery"])
+}
+
+// NotifyAttachment sends an email message with an attachment using the delivery mode.
+func (es *emailSender) NotifyAttachment(subject, msg, attachment string, to []string) error {
+    return es.logger.deliver(subject, msg, attachment, to, es.delivery)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Attachments of full reports testing methods
+//
+package logchecker
+
+import (
+    "bufio"
+    "context"
+    "encoding/base64"
+    "io/ioutil"
+    "mime"
+    "mime/multipart"
+    "net/mail"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// attachNotifier is a test notifier that saves messages and attachments.
+type attachNotifier struct {
+    messages chan string
+    attachments chan string
+}
+
+func (an *attachNotifier) String() string {
+    return "attachNotifier"
+}
+
+func (an *attachNotifier) Notify(msg string, to []string) error {
+    return an.NotifyAttachment("", msg, "", to)
+}
+
+func (an *attachNotifier) NotifyAttachment(subject, msg, attachment string, to []string) error {
+    an.messages <- msg
+    an.attachments <- attachment
+    return nil
+}
+
+func TestAttachReport(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_attach_report.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, MaxLines: 2, AttachReport: true, Dedup: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := &attachNotifier{make(chan string, 10), make(chan string, 10)}
+    logger := New()
+    logger.Cfg.DuplicateWindow = -1
+    logger.notifier = notifier
+    check := func(lines ...string) (string, string) {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        return <-notifier.messages, <-notifier.attachments
+    }
+    msg, attachment := check("ERROR 1", "ERROR 2", "ERROR 3", "ERROR 2", "ERROR 4")
+    if !strings.Contains(msg, "1: ERROR 1\n2: ERROR 2 (x2)\n...\n") || strings.Contains(msg, "ERROR 4") {
+        t.Errorf("incorrect short report: %v", msg)
+    }
+    if attachment != "1: ERROR 1\n2: ERROR 2 (x2)\n3: ERROR 3\n5: ERROR 4\n" {
+        t.Errorf("incorrect attachment: %q", attachment)
+    }
+    // a not truncated report has no attachment
+    if _, attachment = check("ERROR 6"); len(attachment) > 0 {
+        t.Errorf("attachment of a short report: %v", attachment)
+    }
+    // the attachment size is limited
+    f.AttachMaxSize = 30
+    if _, attachment = check("ERROR 7", "ERROR 8", "ERROR 9", "ERROR 10"); attachment != "7: ERROR 7\n8: ERROR 8\n...\nThe report is truncated to 30 bytes.\n" {
+        t.Errorf("incorrect truncated attachment: %q", attachment)
+    }
+    for _, invalid := range []File{
+        {Log: filename, Pattern: "ERROR", AttachMaxSize: -1},
+        {Log: filename, Pattern: "ERROR", AttachReport: true, CountOnly: true},
+    } {
+        if err := invalid.validate(false); err == nil {
+            t.Errorf("invalid attachment settings are accepted: %+v", invalid)
+        }
+    }
+}
+
+func TestAttachmentMessage(t *testing.T) {
+    var sent string
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        sent = string(msg)
+        return nil
+    }
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com:25", "format": FormatHTML}
+    report := strings.Repeat("1: ERROR line with a long text\n", 10)
+    if err := logger.NotifyAttachment("subject", "preview\n1: ERROR line\n...", report, []string{"admin@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(sent)))
+    if err != nil {
+        t.Fatal(err)
+    }
+    mediaType, params, err := mime.ParseMediaType(strings.TrimSuffix(msg.Header.Get("Content-Type"), ";"))
+    if (err != nil) || (mediaType != "multipart/mixed") {
+        t.Fatalf("incorrect content type: %v, %v", mediaType, err)
+    }
+    reader := multipart.NewReader(msg.Body, params["boundary"])
+    body, err := reader.NextPart()
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, _ := ioutil.ReadAll(body)
+    if !strings.HasPrefix(body.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(data), "<pre") {
+        t.Errorf("incorrect body part: %v", string(data))
+    }
+    part, err := reader.NextPart()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if (part.FileName() != AttachmentName) || (part.Header.Get("Content-Transfer-Encoding") != "base64") {
+        t.Errorf("incorrect attachment headers: %v", part.Header)
+    }
+    data, _ = ioutil.ReadAll(part)
+    decoded, err := base64.StdEncoding.DecodeString(strings.Replace(string(data), "\r\n", "", -1))
+    if (err != nil) || (string(decoded) != report) {
+        t.Errorf("incorrect attachment: %q, %v", decoded, err)
+    }
+    if _, err := reader.NextPart(); err == nil {
+        t.Error("unexpected message part")
+    }
+    // without an attachment a simple message is sent
+    if err := logger.NotifyAttachment("subject", "preview", "", []string{"admin@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    if strings.Contains(sent, "multipart") {
+        t.Errorf("multipart message without attachment: %v", sent)
+    }
+}
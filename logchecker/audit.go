@@ -0,0 +1,147 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Audit log of sent notifications
+//
+package logchecker
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// DefaultAuditMaxSize is a default maximum size of the audit log in bytes.
+const DefaultAuditMaxSize int64 = 10 << 20
+
+// AuditRecord is a sent notification in the audit log,
+// File is empty for digests and summaries of several files.
+type AuditRecord struct {
+    Time time.Time     `json:"time"`
+    Notifier string    `json:"notifier"`
+    Subject string     `json:"subject"`
+    To []string        `json:"to"`
+    File string        `json:"file,omitempty"`
+    Found uint64       `json:"found"`
+}
+
+// validateAudit checks that the audit log path is absolute
+// and its directory exists.
+func validateAudit(path string) error {
+    if !filepath.IsAbs(path) {
+        return fmt.Errorf("audit path should be absolute")
+    }
+    info, err := os.Stat(filepath.Dir(path))
+    if err != nil {
+        return fmt.Errorf("audit error: %v", err)
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("audit directory is not a directory")
+    }
+    return nil
+}
+
+// auditMaxSize returns a maximum size of the audit log.
+func (cfg *Config) auditMaxSize() int64 {
+    if cfg.AuditMaxSize > 0 {
+        return cfg.AuditMaxSize
+    }
+    return DefaultAuditMaxSize
+}
+
+// audit appends a sent notification to the audit log if it's configured.
+// The log is rotated to a file with ".1" suffix if its size is exceeded.
+// Errors are only logged, so the notification is not affected.
+func (logger *LogChecker) audit(alert queuedAlert) {
+    path := logger.Cfg.Audit
+    if len(path) == 0 {
+        return
+    }
+    record := AuditRecord{time.Now(), alert.notifier.String(), alert.subject, alert.to, alert.file, alert.found}
+    data, err := json.Marshal(record)
+    if err != nil {
+        LoggerError.Printf("audit encoding error: %v", err)
+        return
+    }
+    data = append(data, '\n')
+    logger.auditMutex.Lock()
+    defer logger.auditMutex.Unlock()
+    if info, err := os.Stat(path); (err == nil) && (info.Size() + int64(len(data)) > logger.Cfg.auditMaxSize()) {
+        if err := os.Rename(path, path + ".1"); err != nil {
+            LoggerError.Printf("audit rotation error: %v", err)
+        }
+    }
+    file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+    if err != nil {
+        LoggerError.Printf("audit error: %v", err)
+        return
+    }
+    defer file.Close()
+    if _, err := file.Write(data); err != nil {
+        LoggerError.Printf("audit write error: %v", err)
+    }
+}
+
+// ReadAuditTail returns the last n records of the audit log, the rotated
+// file is read too if the current one has fewer records. A negative n
+// returns all records. Incorrect lines are skipped.
+func (logger *LogChecker) ReadAuditTail(n int) ([]AuditRecord, error) {
+    if len(logger.Cfg.Audit) == 0 {
+        return nil, fmt.Errorf("audit log is not configured")
+    }
+    logger.auditMutex.Lock()
+    defer logger.auditMutex.Unlock()
+    records, err := readAudit(logger.Cfg.Audit)
+    if err != nil {
+        return nil, err
+    }
+    if (n < 0) || (len(records) < n) {
+        rotated, err := readAudit(logger.Cfg.Audit + ".1")
+        if err != nil {
+            return nil, err
+        }
+        records = append(rotated, records...)
+    }
+    if (n >= 0) && (len(records) > n) {
+        records = records[len(records) - n:]
+    }
+    return records, nil
+}
+
+// readAudit returns all records of the audit file,
+// a missing file has no records.
+func readAudit(path string) ([]AuditRecord, error) {
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    var records []AuditRecord
+    reader := bufio.NewReader(file)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(line) > 0 {
+            var record AuditRecord
+            if e := json.Unmarshal(line, &record); e != nil {
+                LoggerError.Printf("incorrect audit record: %v", e)
+            } else {
+                records = append(records, record)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    return records, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Audit log testing methods
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestAudit(t *testing.T) {
+    var group sync.WaitGroup
+    dir, err := ioutil.TempDir("", "audit")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    if err := validateAudit("audit.log"); err == nil {
+        t.Error("relative audit path is accepted")
+    }
+    if err := validateAudit(filepath.Join(dir, "unknown", "audit.log")); err == nil {
+        t.Error("audit path without directory is accepted")
+    }
+    filename := filepath.Join(buildDir(), "test_audit.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Emails: []string{"admin@host.com"}}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    logger.Cfg.Audit = filepath.Join(dir, "audit.log")
+    if records, err := logger.ReadAuditTail(10); (err != nil) || (len(records) != 0) {
+        t.Errorf("incorrect empty audit log: %v, %v", records, err)
+    }
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    if err := updateFile(filename, "ERROR 1", "ERROR 2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    notifier.wait(time.Second)
+    records, err := logger.ReadAuditTail(10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(records) != 1 {
+        t.Fatalf("incorrect number of audit records: %v", len(records))
+    }
+    r := records[0]
+    if (r.File != filename) || (r.Found != 2) || (strings.Join(r.To, ",") != "admin@host.com") || (r.Notifier != notifier.String()) {
+        t.Errorf("incorrect audit record: %+v", r)
+    }
+    // failed notifications are not saved
+    if err := logger.send(queuedAlert{notifier: &failNotifier{fail: 1}, subject: "failed"}); err == nil {
+        t.Error("need notification error")
+    }
+    // the log is rotated after every record, so the tail is read from both files
+    data, err := json.Marshal(AuditRecord{time.Now(), notifier.String(), "subject 0", nil, filename, 0})
+    if err != nil {
+        t.Fatal(err)
+    }
+    logger.Cfg.AuditMaxSize = int64(len(data)) * 3 / 2
+    for i := 0; i < 10; i++ {
+        if err := logger.send(queuedAlert{notifier: notifier, subject: fmt.Sprintf("subject %v", i), file: filename}); err != nil {
+            t.Fatal(err)
+        }
+        notifier.wait(time.Second)
+    }
+    if _, err := os.Stat(logger.Cfg.Audit + ".1"); err != nil {
+        t.Errorf("audit log is not rotated: %v", err)
+    }
+    records, err = logger.ReadAuditTail(2)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if (len(records) != 2) || (records[0].Subject != "subject 8") || (records[1].Subject != "subject 9") {
+        t.Errorf("incorrect audit tail: %+v", records)
+    }
+    // a write error doesn't block notifications
+    logger.Cfg.Audit = filepath.Join(dir, "unknown", "audit.log")
+    if err := logger.send(queuedAlert{notifier: notifier, subject: "not audited", msg: "message"}); err != nil {
+        t.Errorf("audit error blocks the notification: %v", err)
+    }
+    if msg := notifier.wait(time.Second); len(msg) == 0 {
+        t.Error("notification is not sent")
+    }
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Slack compatible chat notifier
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+const (
+    // ChatNotifierName is a name of the chat notifier configured by "chat" settings.
+    ChatNotifierName string = "chat"
+    // ChatSlack is a chat flavor of Slack incoming webhooks.
+    ChatSlack string = "slack"
+    // ChatMattermost is a chat flavor of Mattermost incoming webhooks.
+    ChatMattermost string = "mattermost"
+    // ChatDiscord is a chat flavor of Discord webhooks.
+    ChatDiscord string = "discord"
+    chatFence string = "```"
+)
+
+var (
+    // ChatClient is a HTTP client of all chat notifiers.
+    ChatClient = &http.Client{Timeout: 10 * time.Second}
+    // ChatAttempts is a number of chat request attempts for network errors,
+    // 5xx and 429 responses.
+    ChatAttempts = 3
+    // ChatBackoff is a delay before the first repeated chat request,
+    // it is doubled for every next attempt.
+    ChatBackoff = time.Second
+
+    // chatLimits are maximum lengths of messages in symbols by flavors.
+    chatLimits = map[string]int{
+        ChatSlack: 40000,
+        ChatMattermost: 16383,
+        ChatDiscord: 2000,
+    }
+)
+
+// ChatNotifier sends notifications to Slack compatible webhooks,
+// the payload and the message limit depend on Flavor. Matched lines
+// are sent in code blocks, a long message is split to several ones.
+type ChatNotifier struct {
+    WebhookURL string
+    Flavor string
+    Channel string
+    Username string
+    Escape bool
+}
+
+// chatPayload is a message of Slack and Mattermost webhooks.
+type chatPayload struct {
+    Text string      `json:"text"`
+    Channel string   `json:"channel,omitempty"`
+    Username string  `json:"username,omitempty"`
+}
+
+// discordPayload is a message of Discord webhooks.
+type discordPayload struct {
+    Content string   `json:"content"`
+    Username string  `json:"username,omitempty"`
+}
+
+// NewChatNotifier creates ChatNotifier from "chat" config settings:
+// "webhook_url" (mandatory), "flavor" ("slack" by default, "mattermost"
+// or "discord"), "channel" (not supported by Discord) and "username".
+func NewChatNotifier(settings map[string]string) (*ChatNotifier, error) {
+    webhook := settings["webhook_url"]
+    if len(webhook) == 0 {
+        return nil, fmt.Errorf("chat webhook_url should not be empty")
+    }
+    u, err := url.Parse(webhook)
+    if err != nil {
+        return nil, fmt.Errorf("chat webhook_url is incorrect: %v", err)
+    }
+    if ((u.Scheme != "https") && (u.Scheme != "http")) || (len(u.Host) == 0) {
+        return nil, fmt.Errorf("chat webhook_url should be an absolute HTTP(S) URL")
+    }
+    cn := &ChatNotifier{WebhookURL: webhook, Flavor: settings["flavor"], Channel: settings["channel"], Username: settings["username"]}
+    if len(cn.Flavor) == 0 {
+        cn.Flavor = ChatSlack
+    }
+    if _, ok := chatLimits[cn.Flavor]; !ok {
+        return nil, fmt.Errorf("unknown chat flavor [%v]", cn.Flavor)
+    }
+    if (cn.Flavor == ChatDiscord) && (len(cn.Channel) > 0) {
+        return nil, fmt.Errorf("chat channel is not supported by discord")
+    }
+    return cn, nil
+}
+
+// String returns a name of the notifier.
+func (cn *ChatNotifier) String() string {
+    if len(cn.Channel) > 0 {
+        return fmt.Sprintf("chat %v (%v)", cn.Flavor, cn.Channel)
+    }
+    return fmt.Sprintf("chat %v", cn.Flavor)
+}
+
+// Notify posts a message to the chat webhook, recipients are ignored.
+// Parts of a long message are posted in order until the first error.
+func (cn *ChatNotifier) Notify(msg string, to []string) error {
+    return cn.NotifyContext(context.Background(), msg, to)
+}
+
+// NotifyContext posts a message to the chat webhook, requests
+// and retries are cancelled when the context is done.
+func (cn *ChatNotifier) NotifyContext(ctx context.Context, msg string, to []string) error {
+    parts := splitChat(cn.chatLines(truncateReport(msg)), chatLimits[cn.Flavor])
+    for i, part := range parts {
+        if err := cn.post(ctx, part); err != nil {
+            return fmt.Errorf("chat notification is failed, part %v of %v: %v", i + 1, len(parts), err)
+        }
+    }
+    LoggerDebug.Printf("chat notification is sent: %v, %v part(s)", cn, len(parts))
+    return nil
+}
+
+// chatLine is a line of a chat message, report lines are in code blocks.
+type chatLine struct {
+    text string
+    code bool
+}
+
+// chatLines marks report lines of the message, code fences in lines
+// are broken, so they can't close a code block.
+func (cn *ChatNotifier) chatLines(msg string) []chatLine {
+    lines := strings.Split(strings.TrimRight(msg, "\n"), "\n")
+    result := make([]chatLine, len(lines))
+    for i, line := range lines {
+        code := rgWebhookLine.MatchString(line) || (line == "...")
+        if code {
+            line = strings.Replace(line, chatFence, "` ` `", -1)
+        } else if cn.Escape && (cn.Flavor != ChatDiscord) {
+            line = slackEscape(line)
+        }
+        result[i] = chatLine{line, code}
+    }
+    return result
+}
+
+// splitChat joins lines to messages with maximum length in symbols,
+// a code block is closed at the end of a message and opened again
+// in the next one. Too long lines are truncated.
+func splitChat(lines []chatLine, limit int) []string {
+    var (
+        parts []string
+        current strings.Builder
+        size int
+        open bool
+    )
+    fence := utf8.RuneCountInString(chatFence) + 1
+    finish := func() {
+        if open {
+            current.WriteString(chatFence)
+            open = false
+        }
+        parts = append(parts, strings.TrimRight(current.String(), "\n"))
+        current.Reset()
+        size = 0
+    }
+    for _, line := range lines {
+        cost := func() int {
+            n := utf8.RuneCountInString(line.text) + 1
+            if line.code != open {
+                n += fence
+            }
+            if line.code {
+                // reserve for the closing fence at the end
+                n += fence - 1
+            }
+            return n
+        }
+        if (size > 0) && (size + cost() > limit) {
+            finish()
+        }
+        if n := cost(); n > limit {
+            runes := []rune(line.text)
+            line.text = string(runes[:len(runes) - (n - limit) - 1]) + "…"
+        }
+        if line.code != open {
+            current.WriteString(chatFence + "\n")
+            size += fence
+            open = line.code
+        }
+        current.WriteString(line.text + "\n")
+        size += utf8.RuneCountInString(line.text) + 1
+    }
+    if size > 0 {
+        finish()
+    }
+    return parts
+}
+
+// post sends a message, it's repeated with backoff for network errors,
+// 5xx and 429 responses.
+func (cn *ChatNotifier) post(ctx context.Context, text string) error {
+    var payload interface{} = chatPayload{text, cn.Channel, cn.Username}
+    if cn.Flavor == ChatDiscord {
+        payload = discordPayload{text, cn.Username}
+    }
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return fmt.Errorf("chat payload error: %v", err)
+    }
+    backoff := ChatBackoff
+    for i := 0; i < ChatAttempts; i++ {
+        if i > 0 {
+            LoggerDebug.Printf("chat request error, retry %v of %v in %v: %v", i, ChatAttempts - 1, backoff, err)
+            select {
+                case <-ctx.Done():
+                    return fmt.Errorf("chat request error: %v", ctx.Err())
+                case <-time.After(backoff):
+            }
+            backoff *= 2
+        }
+        var (
+            req *http.Request
+            resp *http.Response
+        )
+        req, err = http.NewRequestWithContext(ctx, http.MethodPost, cn.WebhookURL, bytes.NewReader(body))
+        if err != nil {
+            return fmt.Errorf("chat request error: %v", err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+        resp, err = ChatClient.Do(req)
+        if err != nil {
+            err = fmt.Errorf("chat request error: %v", err)
+            continue
+        }
+        resp.Body.Close()
+        switch {
+            case (resp.StatusCode >= 500) || (resp.StatusCode == http.StatusTooManyRequests):
+                err = fmt.Errorf("chat response error: %v", resp.Status)
+                continue
+            case (resp.StatusCode < 200) || (resp.StatusCode > 299):
+                return fmt.Errorf("chat response error: %v", resp.Status)
+        }
+        return nil
+    }
+    return err
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Chat notifier testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+    "unicode/utf8"
+)
+
+func TestChatNotifier(t *testing.T) {
+    var failures int32
+    defer func(backoff time.Duration) {
+        ChatBackoff = backoff
+    }(ChatBackoff)
+    ChatBackoff = 10 * time.Millisecond
+    payloads := make(chan map[string]string, 100)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if atomic.AddInt32(&failures, -1) >= 0 {
+            w.WriteHeader(http.StatusTooManyRequests)
+            return
+        }
+        var payload map[string]string
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            t.Errorf("incorrect payload: %v", err)
+        }
+        payloads <- payload
+    }))
+    defer server.Close()
+
+    for _, settings := range []map[string]string{
+        {},
+        {"webhook_url": "chat.host.com/hooks/test"},
+        {"webhook_url": server.URL, "flavor": "irc"},
+        {"webhook_url": server.URL, "flavor": ChatDiscord, "channel": "ops"},
+    } {
+        if _, err := NewChatNotifier(settings); err == nil {
+            t.Errorf("need settings error: %v", settings)
+        }
+    }
+    lines := []string{"Report for \"app\" service:"}
+    for i := 1; i <= 5; i++ {
+        lines = append(lines, fmt.Sprintf("%v:   ERROR ```%v```", i, i))
+    }
+    msg := strings.Join(lines, "\n") + "\n\n--\nBR, LogChecker"
+
+    cn, err := NewChatNotifier(map[string]string{"webhook_url": server.URL, "flavor": ChatMattermost, "channel": "ops"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    atomic.StoreInt32(&failures, 1)
+    if err := cn.Notify(msg, nil); err != nil {
+        t.Errorf("notification error: %v", err)
+    }
+    payload := <-payloads
+    if payload["channel"] != "ops" {
+        t.Errorf("incorrect channel: %v", payload)
+    }
+    expected := "Report for \"app\" service:\n```\n1:   ERROR ` ` `1` ` `\n"
+    if text := payload["text"]; !strings.HasPrefix(text, expected) || !strings.Contains(text, "5:   ERROR ` ` `5` ` `\n```\n\n--") {
+        t.Errorf("incorrect text: %v", text)
+    }
+
+    cn, err = NewChatNotifier(map[string]string{"webhook_url": server.URL, "flavor": ChatDiscord})
+    if err != nil {
+        t.Fatal(err)
+    }
+    cn.Notify("Report:\n1: " + strings.Repeat("x", 1500) + "\n2: " + strings.Repeat("y", 1500), nil)
+    for i, prefix := range []string{"Report:\n```\n1: x", "```\n2: y"} {
+        payload := <-payloads
+        content := payload["content"]
+        if !strings.HasPrefix(content, prefix) || !strings.HasSuffix(content, "\n```") {
+            t.Errorf("[%v] incorrect part: %v", i, content)
+        }
+        if n := utf8.RuneCountInString(content); n > 2000 {
+            t.Errorf("[%v] part is too long: %v", i, n)
+        }
+    }
+    // a too long line is truncated
+    parts := splitChat([]chatLine{{"1: " + strings.Repeat("z", 3000), true}}, 2000)
+    if (len(parts) != 1) || (utf8.RuneCountInString(parts[0]) != 2000) || !strings.HasSuffix(parts[0], "z…\n```") {
+        t.Errorf("incorrect truncation: %v", len(parts))
+    }
+    // all attempts are failed
+    atomic.StoreInt32(&failures, int32(ChatAttempts))
+    if err := cn.post(context.Background(), "test"); (err == nil) || !strings.Contains(err.Error(), "429") {
+        t.Errorf("need response error: %v", err)
+    }
+    select {
+        case payload := <-payloads:
+            t.Errorf("unexpected payload: %v", payload)
+        default:
+    }
+    cfg := Config{Chat: map[string]string{"webhook_url": server.URL}}
+    if !cfg.hasNotifier(ChatNotifierName) {
+        t.Errorf("chat notifier should be available")
+    }
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Recent lines of watched files
+//
+package logchecker
+
+import (
+    "fmt"
+    "strings"
+)
+
+const (
+    // MaxContextLines is a maximum number of recent lines per file.
+    MaxContextLines int = 100
+    // MaxContextLineLength is a maximum length of a saved recent line,
+    // longer lines are truncated.
+    MaxContextLineLength int = 512
+)
+
+// lineRing is a fixed size buffer of recent lines.
+type lineRing struct {
+    lines []string
+    next int
+    full bool
+}
+
+// newLineRing creates a buffer for size lines.
+func newLineRing(size int) *lineRing {
+    return &lineRing{lines: make([]string, size)}
+}
+
+// Push adds a new line, the oldest one is overwritten if the buffer is full.
+func (r *lineRing) Push(line string) {
+    if len(line) > MaxContextLineLength {
+        line = line[:MaxContextLineLength] + "..."
+    }
+    r.lines[r.next] = line
+    r.next = (r.next + 1) % len(r.lines)
+    if r.next == 0 {
+        r.full = true
+    }
+}
+
+// Lines returns saved lines from the oldest to the newest one.
+func (r *lineRing) Lines() []string {
+    if !r.full {
+        return append([]string{}, r.lines[:r.next]...)
+    }
+    return append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// RecentLines returns the last scanned lines of the file
+// if File.ContextBufferLines is set.
+func (f *File) RecentLines() []string {
+    if f.context == nil {
+        return nil
+    }
+    return f.context.Lines()
+}
+
+// pushContext saves a scanned line to the recent lines buffer.
+func (f *File) pushContext(line string) {
+    if f.ContextBufferLines == 0 {
+        return
+    }
+    if (f.context == nil) || (len(f.context.lines) != f.ContextBufferLines) {
+        f.context = newLineRing(f.ContextBufferLines)
+    }
+    f.context.Push(line)
+}
+
+// contextReport returns recent lines for a notification message.
+func (f *File) contextReport() string {
+    lines := f.RecentLines()
+    if f.CountOnly || (len(lines) == 0) {
+        return ""
+    }
+    return fmt.Sprintf("\n\nRecent lines (%v):\n%v", len(lines), strings.Join(lines, "\n"))
+}
+
+// reportLine is a scanned line of a notification report,
+// source is set for lines of archived files.
+type reportLine struct {
+    source string
+    number uint64
+    text string
+}
+
+// String returns the line with its number.
+func (rl reportLine) String() string {
+    if len(rl.source) > 0 {
+        return fmt.Sprintf("%v:%v: %v", rl.source, rl.number, rl.text)
+    }
+    return fmt.Sprintf("%v: %v", rl.number, rl.text)
+}
+
+// follows returns true if the line is the next one after prev.
+func (rl reportLine) follows(prev reportLine) bool {
+    return (rl.source == prev.source) && (rl.number == prev.number + 1)
+}
+
+// matchContext collects File.Context lines around matched lines
+// of one check, not adjacent groups of lines are separated by "--".
+type matchContext struct {
+    size int
+    before []reportLine
+    after int
+    last reportLine
+    reported bool
+}
+
+// skip handles a not matched line, it's returned if it follows a match.
+func (mc *matchContext) skip(line reportLine) []string {
+    if mc.size == 0 {
+        return nil
+    }
+    if mc.after > 0 {
+        mc.after--
+        return mc.report([]reportLine{line})
+    }
+    mc.before = append(mc.before, line)
+    if len(mc.before) > mc.size {
+        mc.before = mc.before[1:]
+    }
+    return nil
+}
+
+// match returns the matched line with its preceding context.
+func (mc *matchContext) match(line reportLine) []string {
+    if mc.size == 0 {
+        return []string{line.String()}
+    }
+    lines := append(mc.before, line)
+    mc.before, mc.after = nil, mc.size
+    return mc.report(lines)
+}
+
+// report formats lines, the separator is added before a new group.
+func (mc *matchContext) report(lines []reportLine) []string {
+    result := make([]string, 0, len(lines) + 1)
+    if mc.reported && !lines[0].follows(mc.last) {
+        result = append(result, "--")
+    }
+    for _, line := range lines {
+        result = append(result, line.String())
+    }
+    mc.last, mc.reported = lines[len(lines) - 1], true
+    return result
+}
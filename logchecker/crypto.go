@@ -0,0 +1,128 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Encrypted sender settings
+//
+package logchecker
+
+import (
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "strings"
+)
+
+const (
+    // SenderKeyEnv is an environment variable with a base64 encoded sender key.
+    SenderKeyEnv string = "LOGCHECKER_SENDER_KEY"
+    // encryptedField is a sender field that contains encrypted settings.
+    encryptedField string = "encrypted"
+)
+
+// SenderKey returns AES key from SenderKeyEnv environment variable
+// or from the key file if the variable is not set.
+// The key is base64 encoded 16, 24 or 32 bytes.
+func SenderKey(keyFile string) ([]byte, error) {
+    encoded := os.Getenv(SenderKeyEnv)
+    if len(encoded) == 0 {
+        if len(keyFile) == 0 {
+            return nil, fmt.Errorf("sender key is not set, use %v or a key file", SenderKeyEnv)
+        }
+        path, err := FilePath(keyFile)
+        if err != nil {
+            return nil, fmt.Errorf("can't check sender key file: %v", err)
+        }
+        data, err := ioutil.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("can't read sender key file: %v", err)
+        }
+        encoded = string(data)
+    }
+    key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+    if err != nil {
+        return nil, fmt.Errorf("sender key should be base64 encoded")
+    }
+    switch len(key) {
+        case 16, 24, 32:
+            return key, nil
+    }
+    return nil, fmt.Errorf("sender key should be 16, 24 or 32 bytes, not %v", len(key))
+}
+
+// EncryptSender encrypts sender settings by AES-GCM
+// and returns base64 encoded nonce and cipher text.
+func EncryptSender(sender map[string]string, key []byte) (string, error) {
+    plain, err := json.Marshal(sender)
+    if err != nil {
+        return "", err
+    }
+    gcm, err := newGCM(key)
+    if err != nil {
+        return "", err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return "", err
+    }
+    return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// DecryptSender decrypts sender settings prepared by EncryptSender.
+func DecryptSender(blob string, key []byte) (map[string]string, error) {
+    var sender map[string]string
+    data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(blob))
+    if err != nil {
+        return nil, fmt.Errorf("encrypted sender should be base64 encoded")
+    }
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) < gcm.NonceSize() {
+        return nil, fmt.Errorf("encrypted sender is too short")
+    }
+    plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+    if err != nil {
+        return nil, fmt.Errorf("can't decrypt sender: wrong key or tampered data")
+    }
+    if err := json.Unmarshal(plain, &sender); err != nil {
+        return nil, fmt.Errorf("decrypted sender is not a valid JSON object")
+    }
+    return sender, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// decryptSender replaces an encrypted sender block by its plain fields.
+func (cfg *Config) decryptSender() error {
+    blob, ok := cfg.Sender[encryptedField]
+    if !ok {
+        return nil
+    }
+    if len(cfg.Sender) > 1 {
+        return fmt.Errorf("encrypted sender can't be mixed with plain fields")
+    }
+    key, err := SenderKey(cfg.SenderKeyFile)
+    if err != nil {
+        return err
+    }
+    sender, err := DecryptSender(blob, key)
+    if err != nil {
+        return err
+    }
+    cfg.Sender = sender
+    return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Encrypted sender testing methods
+//
+package logchecker
+
+import (
+    "encoding/base64"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestEncryptSender(t *testing.T) {
+    key := []byte("0123456789abcdef0123456789abcdef")
+    sender := map[string]string{
+        "user": "user@host.com",
+        "password": "secret-password",
+        "host": "smtp.host.com",
+        "addr": "smtp.host.com:25",
+    }
+    blob, err := EncryptSender(sender, key)
+    if err != nil {
+        t.Fatalf("encryption error: %v", err)
+    }
+    if strings.Contains(blob, "secret-password") {
+        t.Errorf("blob contains a plain password")
+    }
+    decrypted, err := DecryptSender(blob, key)
+    if err != nil {
+        t.Fatalf("decryption error: %v", err)
+    }
+    for k, v := range sender {
+        if decrypted[k] != v {
+            t.Errorf("incorrect decrypted field [%v]: %v", k, decrypted[k])
+        }
+    }
+    // wrong key
+    if _, err := DecryptSender(blob, []byte("fedcba9876543210fedcba9876543210")); err == nil {
+        t.Errorf("need wrong key error")
+    }
+    // tampered data
+    data, _ := base64.StdEncoding.DecodeString(blob)
+    data[len(data)-1] ^= 0xff
+    if _, err := DecryptSender(base64.StdEncoding.EncodeToString(data), key); err == nil {
+        t.Errorf("need tampered data error")
+    }
+    if _, err := DecryptSender("not base64!", key); err == nil {
+        t.Errorf("need encoding error")
+    }
+}
+
+func TestSenderKey(t *testing.T) {
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    os.Unsetenv(SenderKeyEnv)
+    if _, err := SenderKey(""); err == nil {
+        t.Errorf("need missing key error")
+    }
+    key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+    keyfile := filepath.Join(buildDir(), "test_sender.key")
+    if err := updateFile(keyfile, key); err != nil {
+        t.Fatalf("test file preparation error [%v]: %v", keyfile, err)
+    }
+    defer rm(keyfile)
+    if k, err := SenderKey(keyfile); err != nil || len(k) != 16 {
+        t.Errorf("incorrect key from file: %v", err)
+    }
+    os.Setenv(SenderKeyEnv, base64.StdEncoding.EncodeToString([]byte("short")))
+    defer os.Unsetenv(SenderKeyEnv)
+    if _, err := SenderKey(keyfile); err == nil {
+        t.Errorf("need key length error")
+    }
+    cfg := Config{Sender: map[string]string{"encrypted": "data", "user": "user@host.com"}}
+    if err := cfg.decryptSender(); err == nil {
+        t.Errorf("need mixed fields error")
+    }
+    os.Setenv(SenderKeyEnv, key)
+    blob, err := EncryptSender(map[string]string{"password": "secret-password"}, []byte("0123456789abcdef"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg = Config{Path: "/tmp/config.json", Sender: map[string]string{"encrypted": blob}}
+    if err := cfg.decryptSender(); err != nil {
+        t.Errorf("decryption error: %v", err)
+    }
+    if cfg.Sender["password"] != "secret-password" {
+        t.Errorf("incorrect decrypted sender")
+    }
+    if strings.Contains(cfg.String(), "secret-password") {
+        t.Errorf("config string contains a password")
+    }
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Dead letters of failed emails
+//
+package logchecker
+
+import (
+    "fmt"
+    "time"
+)
+
+const (
+    // DefaultDeadLetterMaxAge is a default maximum age of dead letters.
+    DefaultDeadLetterMaxAge = 24 * time.Hour
+    // DefaultDeadLetterMaxSize is a default maximum number of dead letters.
+    DefaultDeadLetterMaxSize int = 1000
+)
+
+// DeadLetter is an email that was not delivered.
+type DeadLetter struct {
+    Time time.Time
+    Subject string
+    Msg string
+    To []string
+    Delivery string
+    Err string
+}
+
+// String returns a short info about the dead letter.
+func (dl DeadLetter) String() string {
+    return fmt.Sprintf("%v %v recipient(s): %v", dl.Time.Format(time.RFC3339), len(dl.To), dl.Err)
+}
+
+// deadLetterLimits returns maximum age and size of dead letters.
+func (cfg *Config) deadLetterLimits() (time.Duration, int) {
+    age, size := DefaultDeadLetterMaxAge, DefaultDeadLetterMaxSize
+    if cfg.DeadLetterMaxAge > 0 {
+        age = time.Duration(cfg.DeadLetterMaxAge) * time.Second
+    }
+    if cfg.DeadLetterMaxSize > 0 {
+        size = cfg.DeadLetterMaxSize
+    }
+    return age, size
+}
+
+// addDeadLetter saves a failed email, the oldest ones are dropped
+// if the maximum size is exceeded.
+func (logger *LogChecker) addDeadLetter(subject, msg string, to []string, delivery string, err error) {
+    logger.deadMutex.Lock()
+    logger.deadLetters = append(logger.deadLetters, DeadLetter{time.Now(), subject, msg, to, delivery, err.Error()})
+    logger.deadMutex.Unlock()
+    logger.PruneDeadLetters()
+}
+
+// DeadLetters returns a copy of saved dead letters.
+func (logger *LogChecker) DeadLetters() []DeadLetter {
+    logger.deadMutex.Lock()
+    defer logger.deadMutex.Unlock()
+    return append([]DeadLetter{}, logger.deadLetters...)
+}
+
+// DeadLettersDropped returns a number of dropped dead letters.
+func (logger *LogChecker) DeadLettersDropped() uint64 {
+    logger.deadMutex.Lock()
+    defer logger.deadMutex.Unlock()
+    return logger.deadDropped
+}
+
+// PruneDeadLetters drops expired dead letters and the oldest ones
+// over the maximum size, it returns a number of dropped letters.
+func (logger *LogChecker) PruneDeadLetters() int {
+    maxAge, maxSize := logger.Cfg.deadLetterLimits()
+    logger.deadMutex.Lock()
+    defer logger.deadMutex.Unlock()
+    expired, overflow := 0, 0
+    deadline := time.Now().Add(-maxAge)
+    for expired < len(logger.deadLetters) && logger.deadLetters[expired].Time.Before(deadline) {
+        expired++
+    }
+    letters := logger.deadLetters[expired:]
+    if len(letters) > maxSize {
+        overflow = len(letters) - maxSize
+        letters = letters[overflow:]
+    }
+    if (expired + overflow) == 0 {
+        return 0
+    }
+    logger.deadLetters = append([]DeadLetter{}, letters...)
+    logger.deadDropped += uint64(expired + overflow)
+    LoggerError.Printf("dead letters are dropped: %v expired, %v overflow, %v in total", expired, overflow, logger.deadDropped)
+    return expired + overflow
+}
+
+// ReplayDeadLetters prunes dead letters and sends remaining ones again,
+// emails that fail again become new dead letters. It returns numbers
+// of replayed and dropped letters.
+func (logger *LogChecker) ReplayDeadLetters() (int, int) {
+    dropped := logger.PruneDeadLetters()
+    logger.deadMutex.Lock()
+    letters := logger.deadLetters
+    logger.deadLetters = nil
+    logger.deadMutex.Unlock()
+    for _, dl := range letters {
+        logger.deliver(dl.Subject, dl.Msg, "", dl.To, dl.Delivery)
+    }
+    if len(letters) > 0 {
+        LoggerInfo.Printf("dead letters are replayed: %v\n", len(letters))
+    }
+    return len(letters), dropped
+}
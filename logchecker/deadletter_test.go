@@ -0,0 +1,64 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Dead letters testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "testing"
+    "time"
+)
+
+func TestDeadLetters(t *testing.T) {
+    fail := true
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        if fail {
+            return fmt.Errorf("connection refused")
+        }
+        return nil
+    }
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "host": "smtp.host.com"}
+    logger.Cfg.DeadLetterMaxSize = 3
+    logger.Cfg.DeadLetterMaxAge = 60
+    for i := 0; i < 5; i++ {
+        if err := logger.Notify(fmt.Sprintf("msg %v", i), []string{"to@host.com"}); err == nil {
+            t.Errorf("[%v] need delivery error", i)
+        }
+    }
+    letters := logger.DeadLetters()
+    if len(letters) != 3 {
+        t.Fatalf("incorrect number of dead letters: %v", len(letters))
+    }
+    if letters[0].Msg != "msg 2" {
+        t.Errorf("the oldest dead letters are not dropped: %v", letters[0].Msg)
+    }
+    if n := logger.DeadLettersDropped(); n != 2 {
+        t.Errorf("incorrect number of dropped dead letters: %v", n)
+    }
+    // make two letters expired
+    logger.deadMutex.Lock()
+    for i := 0; i < 2; i++ {
+        logger.deadLetters[i].Time = time.Now().Add(-2 * time.Minute)
+    }
+    logger.deadMutex.Unlock()
+    fail = false
+    replayed, dropped := logger.ReplayDeadLetters()
+    if (replayed != 1) || (dropped != 2) {
+        t.Errorf("incorrect replay result: %v, %v", replayed, dropped)
+    }
+    if n := logger.DeadLettersDropped(); n != 4 {
+        t.Errorf("incorrect number of dropped dead letters: %v", n)
+    }
+    if n := len(logger.DeadLetters()); n != 0 {
+        t.Errorf("dead letters are not replayed: %v", n)
+    }
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Decay of the extended boundary
+//
+package logchecker
+
+import (
+    "fmt"
+    "time"
+)
+
+// validateDecay checks decay settings of the file.
+func (f *File) validateDecay() error {
+    if (f.DecayPeriod > 0) && !f.Increase {
+        return fmt.Errorf("decay_period requires increase mode")
+    }
+    return nil
+}
+
+// decayBoundary relaxes the extended boundary after a check without
+// a notification. It's reset to Boundary immediately if DecayPeriod
+// is not set, otherwise it's halved for every DecayPeriod seconds
+// since the last notification or the previous decay.
+func (f *File) decayBoundary(now time.Time) {
+    if (f.DecayPeriod == 0) || f.lastSent.IsZero() {
+        f.ExtBoundary = f.Boundary
+        return
+    }
+    period := time.Duration(f.DecayPeriod) * time.Second
+    since := f.lastSent
+    if f.lastDecay.After(since) {
+        since = f.lastDecay
+    }
+    for (f.ExtBoundary > f.Boundary) && (now.Sub(since) >= period) {
+        f.ExtBoundary /= 2
+        if f.ExtBoundary < f.Boundary {
+            f.ExtBoundary = f.Boundary
+        }
+        since = since.Add(period)
+        f.lastDecay = since
+    }
+}
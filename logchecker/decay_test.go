@@ -0,0 +1,74 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Decay of the extended boundary testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestDecayBoundary(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_decay.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    invalid := File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, DecayPeriod: 60}
+    if err := invalid.Validate(); err == nil {
+        t.Error("decay_period is accepted without increase")
+    }
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 100, Increase: true, DecayPeriod: 60}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    logger.Cfg.DuplicateWindow = -1
+    logger.notifier = newRecordNotifier()
+    check := func(lines ...string) uint64 {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        return f.ExtBoundary
+    }
+    // noisy: every notification doubles the boundary
+    for i, expected := range []uint64{2, 4} {
+        if b := check("ERROR"); b != expected {
+            t.Errorf("incorrect boundary after notification %v: %v", i, b)
+        }
+    }
+    // quiet: a new time period, the boundary is kept during the decay period
+    f.LogStart = f.LogStart.Add(-time.Duration(f.Period) * time.Second)
+    if b := check("ERROR"); (b != 4) || (f.Counter != 0) {
+        t.Errorf("boundary is reset before decay period: %v, counter=%v", b, f.Counter)
+    }
+    // one decay period is elapsed
+    f.lastSent = f.lastSent.Add(-70 * time.Second)
+    if b := check("OK"); b != 2 {
+        t.Errorf("boundary is not halved: %v", b)
+    }
+    if b := check("OK"); b != 2 {
+        t.Errorf("boundary is halved twice during one period: %v", b)
+    }
+    // next period, it's not less than the boundary
+    f.lastSent, f.lastDecay = f.lastSent.Add(-120 * time.Second), f.lastDecay.Add(-120 * time.Second)
+    if b := check("OK"); b != f.Boundary {
+        t.Errorf("boundary is not decayed to the initial value: %v", b)
+    }
+    // without decay period the boundary is reset immediately
+    g := &File{Boundary: 2, ExtBoundary: 16, Increase: true, lastSent: time.Now()}
+    if g.decayBoundary(time.Now()); g.ExtBoundary != g.Boundary {
+        t.Errorf("boundary is not reset: %v", g.ExtBoundary)
+    }
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notification decisions of checks
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "time"
+)
+
+const (
+    // DecisionSent means that the notification was sent.
+    DecisionSent string = "sent"
+    // DecisionBelowBoundary means that found lines are below the boundary.
+    DecisionBelowBoundary string = "below boundary"
+    // DecisionLimit means that the notifications limit of the time period is reached.
+    DecisionLimit string = "limit"
+    // DecisionPeriodLimit means that a limit of hour, day or week period is reached.
+    DecisionPeriodLimit string = "period limit"
+    // DecisionSuppressed means that the same matched lines were notified recently.
+    DecisionSuppressed string = "suppressed"
+    // DecisionCooldown means that the cooldown after the last notification is not elapsed.
+    DecisionCooldown string = "cooldown"
+    // DecisionMaintenance means that the notification is skipped by a maintenance window.
+    DecisionMaintenance string = "maintenance"
+    // DecisionFailed means that no notifier delivered or queued the notification.
+    DecisionFailed string = "failed"
+)
+
+// Decision explains why the last check of a file did or didn't notify.
+type Decision struct {
+    Time time.Time       `json:"time"`
+    Service string       `json:"service"`
+    File string          `json:"file"`
+    Matched uint64       `json:"matched"`
+    Found uint64         `json:"found"`
+    Boundary uint64      `json:"boundary"`
+    Counter uint64       `json:"counter"`
+    Limit uint64         `json:"limit"`
+    Quiet bool           `json:"quiet"`
+    Burst bool           `json:"burst"`
+    Action string        `json:"action"`
+    Reason string        `json:"reason"`
+}
+
+// String returns a description of the decision.
+func (d Decision) String() string {
+    return fmt.Sprintf(
+        "%v [%v / %v] %v: %v (matched=%v, found=%v, boundary=%v, counter=%v, limit=%v, quiet=%v)",
+        d.Time.Format(time.RFC3339), d.Service, d.File, d.Action, d.Reason,
+        d.Matched, d.Found, d.Boundary, d.Counter, d.Limit, d.Quiet,
+    )
+}
+
+// suppressed returns true if the found lines reach the boundary,
+// but the notification is not sent.
+func (d Decision) suppressed() bool {
+    switch d.Action {
+        case DecisionLimit, DecisionPeriodLimit, DecisionSuppressed, DecisionCooldown:
+            return true
+    }
+    return false
+}
+
+// decide returns a decision of the check with matched new lines,
+// its action is empty if the notification is allowed. A burst of
+// matched lines is notified regardless of the boundary and limits.
+func (f *File) decide(matched uint64) Decision {
+    d := Decision{
+        Time: time.Now(),
+        Service: f.serviceName(),
+        File: f.Log,
+        Matched: matched,
+        Found: f.Found,
+        Boundary: f.ExtBoundary,
+        Counter: f.Counter,
+        Limit: f.Limit,
+    }
+    switch {
+        case (f.Burst > 0) && (matched >= f.Burst):
+            d.Burst = true
+        case f.Found < f.ExtBoundary:
+            d.Action = DecisionBelowBoundary
+            d.Reason = fmt.Sprintf("found %v lines is less than boundary %v", f.Found, f.ExtBoundary)
+        case f.Counter > f.Limit:
+            d.Action = DecisionLimit
+            d.Reason = fmt.Sprintf("%v notifications exceed limit %v of the period", f.Counter, f.Limit)
+        default:
+            if pl, reached := f.reachedPeriod(); reached {
+                d.Action = DecisionPeriodLimit
+                d.Reason = fmt.Sprintf("%v notifications reach limit %v of the %v", pl.Counter, pl.Limit, pl.Period)
+            }
+    }
+    return d
+}
+
+// setDecision saves the last decision of the file.
+func (logger *LogChecker) setDecision(d Decision) {
+    logger.decisionMutex.Lock()
+    defer logger.decisionMutex.Unlock()
+    if logger.decisions == nil {
+        logger.decisions = make(map[string]Decision)
+    }
+    logger.decisions[d.Service + "\n" + d.File] = d
+}
+
+// LastDecision returns the decision of the last file's check,
+// its Action is empty if the file was not checked.
+func (logger *LogChecker) LastDecision(serviceName, logPath string) Decision {
+    logger.decisionMutex.Lock()
+    defer logger.decisionMutex.Unlock()
+    return logger.decisions[serviceName + "\n" + logPath]
+}
+
+func (logger *LogChecker) handleDecision(w http.ResponseWriter, r *http.Request) {
+    if r.Method != "GET" {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    d := logger.LastDecision(r.URL.Query().Get("service"), r.URL.Query().Get("file"))
+    if len(d.Action) == 0 {
+        http.Error(w, "file was not checked", http.StatusNotFound)
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(d); err != nil {
+        LoggerError.Printf("decision encoding error: %v\n", err)
+    }
+}
+
+// FetchDecision requests the last decision of a file from the decision endpoint.
+func FetchDecision(address, serviceName, logPath string) (Decision, error) {
+    var d Decision
+    u, err := url.Parse(address)
+    if err != nil {
+        return d, err
+    }
+    u.RawQuery = url.Values{"service": {serviceName}, "file": {logPath}}.Encode()
+    resp, err := http.Get(u.String())
+    if err != nil {
+        return d, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return d, fmt.Errorf("decision request error: %v", resp.Status)
+    }
+    err = json.NewDecoder(resp.Body).Decode(&d)
+    return d, err
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestLastDecision(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_decision.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "app", Files: []File{{Log: filename, Pattern: "ERROR", Boundary: 2, Period: 3600, Limit: 0}}}}
+    f := &logger.Cfg.Observed[0].Files[0]
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.service = &logger.Cfg.Observed[0]
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if d := logger.LastDecision("app", filename); len(d.Action) > 0 {
+        t.Errorf("file was not checked: %v", d)
+    }
+    check := func(action string) Decision {
+        if err := updateFile(filename, "ERROR"); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        d := logger.LastDecision("app", filename)
+        if d.Action != action {
+            t.Errorf("incorrect action [%v]: %v", action, d)
+        }
+        return d
+    }
+    check(DecisionBelowBoundary)
+    check(DecisionSent)
+    d := check(DecisionLimit)
+    if (d.Matched != 1) || (d.Found != 3) || (d.Counter != 1) || (d.Limit != 0) || !strings.Contains(d.Reason, "exceed limit 0") {
+        t.Errorf("incorrect limit decision: %v", d)
+    }
+
+    server := httptest.NewServer(logger.Handler())
+    defer server.Close()
+    fetched, err := FetchDecision(server.URL + "/decision", "app", filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if (fetched.Action != DecisionLimit) || (fetched.Reason != d.Reason) {
+        t.Errorf("incorrect fetched decision: %v", fetched)
+    }
+    resp, err := http.Get(server.URL + "/decision?service=app&file=/unknown.log")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Errorf("incorrect status for unknown file: %v", resp.Status)
+    }
+}
+
+func TestBurst(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_burst.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Cfg.DuplicateWindow = -1
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 0, Burst: 50, Cooldown: 3600}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    check := func(n int) {
+        lines := make([]string, n)
+        for i := range lines {
+            lines[i] = "ERROR crash loop"
+        }
+        if err := updateFile(filename, strings.Join(lines, "\n")); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    check(1)
+    if msg := notifier.wait(time.Second); (len(msg) == 0) || strings.Contains(msg, "Burst alert") {
+        t.Errorf("incorrect first notification: %v", msg)
+    }
+    // the limit is reached, a slow trickle is not notified
+    check(10)
+    if d := logger.LastDecision("", filename); d.Action != DecisionLimit {
+        t.Errorf("incorrect decision: %v", d)
+    }
+    check(100)
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "Burst alert: 100 lines are found by one check.") {
+        t.Errorf("burst notification is not sent: %v", msg)
+    }
+    d := logger.LastDecision("", filename)
+    if (d.Action != DecisionSent) || !d.Burst || (d.Reason != "burst of 100 lines reaches 50") {
+        t.Errorf("incorrect burst decision: %v", d)
+    }
+    <-notifier.subjects
+    if subject := <-notifier.subjects; !strings.HasPrefix(subject, "[BURST] ") {
+        t.Errorf("incorrect burst subject: %v", subject)
+    }
+    if f.Counter != 2 {
+        t.Errorf("incorrect counter: %v", f.Counter)
+    }
+}
+
+// failNotifier is a test notifier that fails while fail is set.
+type failNotifier struct {
+    fail int32
+    sent int32
+}
+
+func (fn *failNotifier) String() string {
+    return "failNotifier"
+}
+
+func (fn *failNotifier) Notify(msg string, to []string) error {
+    if atomic.LoadInt32(&fn.fail) == 1 {
+        return fmt.Errorf("delivery error")
+    }
+    atomic.AddInt32(&fn.sent, 1)
+    return nil
+}
+
+func TestFailedNotification(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_failed.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Cfg.DuplicateWindow = -1
+    notifier := &failNotifier{fail: 1}
+    logger.notifier = notifier
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 1, SuppressWindow: 3600}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    check := func(action string) {
+        if err := updateFile(filename, "ERROR"); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        if d := logger.LastDecision("", filename); d.Action != action {
+            t.Errorf("incorrect action [%v]: %v", action, d)
+        }
+    }
+    check(DecisionFailed)
+    check(DecisionFailed)
+    if (f.Counter != 0) || !f.lastSent.IsZero() {
+        t.Errorf("failed notifications are counted: %v", f.Counter)
+    }
+    // the same lines are not suppressed after failures
+    atomic.StoreInt32(&notifier.fail, 0)
+    check(DecisionSent)
+    if (f.Counter != 1) || (atomic.LoadInt32(&notifier.sent) != 1) {
+        t.Errorf("incorrect counter %v or sent %v", f.Counter, notifier.sent)
+    }
+}
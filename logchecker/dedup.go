@@ -0,0 +1,53 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Identical matched lines of reports
+//
+package logchecker
+
+import (
+    "fmt"
+)
+
+// repeatedLine is a matched line of a report with a number of its copies,
+// indexes are positions of the line in the report and in its attachment.
+type repeatedLine struct {
+    index int
+    attached int
+    count uint64
+}
+
+// lineRepeats collects identical matched lines of one check if File.Dedup
+// is set, only the first copy of a line is reported.
+type lineRepeats map[string]*repeatedLine
+
+// repeat counts a copy of the line, it returns false for a new line.
+func (lr lineRepeats) repeat(line string) bool {
+    rl, ok := lr[line]
+    if ok {
+        rl.count++
+    }
+    return ok
+}
+
+// add saves a new line with its indexes in report and attachment lines,
+// an index is -1 if the line is not included.
+func (lr lineRepeats) add(line string, index, attached int) {
+    lr[line] = &repeatedLine{index, attached, 1}
+}
+
+// annotate adds a number of copies to reported and attached lines, e.g. "(x42)".
+func (lr lineRepeats) annotate(lines, attached []string) {
+    for _, rl := range lr {
+        if rl.count < 2 {
+            continue
+        }
+        if rl.index >= 0 {
+            lines[rl.index] += fmt.Sprintf(" (x%v)", rl.count)
+        }
+        if rl.attached >= 0 {
+            attached[rl.attached] += fmt.Sprintf(" (x%v)", rl.count)
+        }
+    }
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Identical matched lines testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestDedup(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_dedup.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Dedup: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    lines := []string{"ERROR connection is lost", "ERROR disk is full"}
+    for i := 0; i < 41; i++ {
+        lines = append(lines, "ERROR connection is lost")
+    }
+    lines = append(lines, "line", "ERROR disk is full")
+    if err := updateFile(filename, lines...); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "1: ERROR connection is lost (x42)\n2: ERROR disk is full (x2)\n") {
+        t.Errorf("incorrect deduplicated report: %v", msg)
+    }
+    if n := strings.Count(msg, "ERROR connection is lost"); n != 1 {
+        t.Errorf("repeated lines are reported: %v", n)
+    }
+    if f.Found != 44 {
+        t.Errorf("incorrect number of found lines: %v", f.Found)
+    }
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Default settings of watched files
+//
+package logchecker
+
+import (
+    "reflect"
+)
+
+// applyDefaults sets non-zero configuration fields of Config.Defaults
+// to files where these fields are not set. A file path is not inherited,
+// slices are copied, so every file has own ones.
+func (cfg *Config) applyDefaults() {
+    defaults := reflect.ValueOf(cfg.Defaults)
+    fields := defaults.Type()
+    for i := range cfg.Observed {
+        for j := range cfg.Observed[i].Files {
+            f := reflect.ValueOf(&cfg.Observed[i].Files[j]).Elem()
+            for k := 0; k < fields.NumField(); k++ {
+                tag := fields.Field(k).Tag.Get("json")
+                if (len(tag) == 0) || (tag == "-") || (tag == "file") {
+                    continue
+                }
+                value, field := defaults.Field(k), f.Field(k)
+                if value.IsZero() || !field.IsZero() {
+                    continue
+                }
+                if value.Kind() == reflect.Slice {
+                    value = reflect.AppendSlice(reflect.MakeSlice(value.Type(), 0, value.Len()), value)
+                }
+                field.Set(value)
+            }
+        }
+    }
+}
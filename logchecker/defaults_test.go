@@ -0,0 +1,61 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Default file settings testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestDefaults(t *testing.T) {
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "\"storage\": \"memory\",": "\"storage\": \"memory\", \"defaults\": {\"file\": \"/tmp/default.log\", " +
+            "\"limit\": 7, \"period\": 600, \"whole_word\": true, \"archived\": [\"/tmp/default.log.*\"]},",
+        "\"period\": 3600,\n          \"limit\": 6": "\"period\": 3600",
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_syslog"),
+    }
+    example := filepath.Join(testdir, "config.defaults.json")
+    if err := prepareConfig(filepath.Join(testdir, "config.example.json"), example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer os.Remove(example)
+    for k, v := range newvalues {
+        if k[0] != '/' {
+            continue
+        }
+        if err := createFile(v, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]: %v", v, err)
+        }
+        defer os.Remove(v)
+    }
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatalf("error during InitConfig [%v]: %v", example, err)
+    }
+    // explicit values are kept
+    f := logger.Cfg.Observed[0].Files[0]
+    if (f.Log != newvalues["/var/log/nginx/error.log"]) || (f.Limit != 1) || (f.Period != 3600) {
+        t.Errorf("explicit values are overridden: %v, %v, %v", f.Log, f.Limit, f.Period)
+    }
+    if !f.WholeWord || (len(f.Archived) != 1) {
+        t.Errorf("defaults are not applied: %v, %v", f.WholeWord, f.Archived)
+    }
+    // missing value is set
+    f = logger.Cfg.Observed[1].Files[0]
+    if (f.Limit != 7) || (f.Period != 3600) || (f.Boundary != 1) {
+        t.Errorf("incorrect values: %v, %v, %v", f.Limit, f.Period, f.Boundary)
+    }
+    // slices are not shared
+    logger.Cfg.Observed[0].Files[0].Archived[0] = "changed"
+    if a := logger.Cfg.Observed[0].Files[1].Archived[0]; a != "/tmp/default.log.*" {
+        t.Errorf("default slice is shared: %v", a)
+    }
+}
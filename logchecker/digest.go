@@ -0,0 +1,152 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Digests of notifications
+//
+package logchecker
+
+import (
+    "time"
+)
+
+// DigestBuffer is a size of the digest aggregator queue.
+var DigestBuffer = 100
+
+// digestAlert is a notification pushed to the digest aggregator.
+type digestAlert struct {
+    group string
+    interval time.Duration
+    alert queuedAlert
+}
+
+// digestGroup returns a digest group of the file and its flush interval,
+// a service interval has priority over the global one.
+// Zero interval means that digests are disabled.
+func (logger *LogChecker) digestGroup(f *File) (string, time.Duration) {
+    if (f.service != nil) && (f.service.DigestInterval > 0) {
+        return "service:" + f.service.Name, time.Duration(f.service.DigestInterval) * time.Second
+    }
+    return "", time.Duration(logger.Cfg.DigestInterval) * time.Second
+}
+
+// digestEnabled returns true if digests are configured globally or for any service.
+func (cfg *Config) digestEnabled() bool {
+    if cfg.DigestInterval > 0 {
+        return true
+    }
+    for _, serv := range cfg.Observed {
+        if serv.DigestInterval > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// digest pushes a notification to the digest aggregator,
+// it returns false if digests are disabled for the file.
+func (logger *LogChecker) digest(f *File, alert queuedAlert) bool {
+    group, interval := logger.digestGroup(f)
+    if interval <= 0 {
+        return false
+    }
+    logger.digestMutex.RLock()
+    defer logger.digestMutex.RUnlock()
+    if logger.digestQueue == nil {
+        return false
+    }
+    logger.digestQueue <- digestAlert{group, interval, alert}
+    return true
+}
+
+// startDigests runs the digest aggregator if digests are enabled.
+func (logger *LogChecker) startDigests() {
+    if !logger.Cfg.digestEnabled() {
+        return
+    }
+    logger.digestMutex.Lock()
+    defer logger.digestMutex.Unlock()
+    logger.digestQueue = make(chan digestAlert, DigestBuffer)
+    logger.digestDone = make(chan bool)
+    go logger.aggregateDigests(logger.digestQueue, logger.digestDone)
+}
+
+// stopDigests stops the digest aggregator, pending digests are sent.
+func (logger *LogChecker) stopDigests() {
+    logger.digestMutex.Lock()
+    defer logger.digestMutex.Unlock()
+    if logger.digestQueue == nil {
+        return
+    }
+    close(logger.digestQueue)
+    <-logger.digestDone
+    logger.digestQueue, logger.digestDone = nil, nil
+}
+
+// aggregateDigests collects notifications by groups, every group is sent
+// as digests after its interval since the first pending notification.
+// All pending digests are sent when the queue is closed.
+func (logger *LogChecker) aggregateDigests(queue chan digestAlert, done chan bool) {
+    defer close(done)
+    pending := map[string][]queuedAlert{}
+    deadlines := map[string]time.Time{}
+    for {
+        var (
+            wait <-chan time.Time
+            timer *time.Timer
+        )
+        if nearest, ok := nearestDeadline(deadlines); ok {
+            timer = time.NewTimer(time.Until(nearest))
+            wait = timer.C
+        }
+        select {
+            case da, ok := <-queue:
+                if !ok {
+                    for group := range pending {
+                        logger.flushDigest(pending[group])
+                    }
+                    return
+                }
+                if _, ok := deadlines[da.group]; !ok {
+                    deadlines[da.group] = time.Now().Add(da.interval)
+                }
+                pending[da.group] = append(pending[da.group], da.alert)
+            case now := <-wait:
+                for group, deadline := range deadlines {
+                    if !deadline.After(now) {
+                        logger.flushDigest(pending[group])
+                        delete(pending, group)
+                        delete(deadlines, group)
+                    }
+                }
+        }
+        if timer != nil {
+            timer.Stop()
+        }
+    }
+}
+
+// nearestDeadline returns the earliest deadline.
+func nearestDeadline(deadlines map[string]time.Time) (time.Time, bool) {
+    var (
+        nearest time.Time
+        found bool
+    )
+    for _, deadline := range deadlines {
+        if !found || deadline.Before(nearest) {
+            nearest, found = deadline, true
+        }
+    }
+    return nearest, found
+}
+
+// flushDigest sends notifications as digests, one digest per notifier
+// and recipients list. Quiet hours are applied to digests.
+func (logger *LogChecker) flushDigest(alerts []queuedAlert) {
+    for _, d := range buildDigests(alerts, "collected by digest interval") {
+        logger.dispatch(d.notifier, d.subject, d.msg, d.to, d.severity)
+    }
+    if len(alerts) > 0 {
+        LoggerInfo.Printf("digest: %v notification(s)\n", len(alerts))
+    }
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestDigest(t *testing.T) {
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    f := &File{Log: "/var/log/digest.log", Emails: []string{"user@host.com"}}
+
+    // digests are disabled
+    logger.startDigests()
+    logger.notifyFile(f, "subject", "message 0", SeverityWarning)
+    if msg := notifier.wait(time.Second); msg != "message 0" {
+        t.Errorf("message should be sent immediately: %v", msg)
+    }
+    <-notifier.subjects
+    logger.stopDigests()
+
+    logger.Cfg.DigestInterval = 1
+    logger.startDigests()
+    for _, msg := range []string{"message 1", "message 2", "message 3"} {
+        logger.notifyFile(f, "subject", msg, SeverityWarning)
+    }
+    if msg := notifier.wait(300 * time.Millisecond); msg != "" {
+        t.Errorf("message should be collected to digest: %v", msg)
+    }
+    msg := notifier.wait(2 * time.Second)
+    if !strings.HasPrefix(msg, "Digest of 3 notification(s)") || !strings.Contains(msg, "message 1") || !strings.Contains(msg, "message 3") {
+        t.Errorf("incorrect digest: %v", msg)
+    }
+    if subject := <-notifier.subjects; !strings.Contains(subject, "digest of 3") {
+        t.Errorf("incorrect digest subject: %v", subject)
+    }
+
+    // service interval has own group, pending digests are sent by stop
+    fs := &File{Log: "/var/log/service.log", Emails: []string{"admin@host.com"}, service: &Service{Name: "test", DigestInterval: 3600}}
+    logger.notifyFile(f, "subject", "message 4", SeverityWarning)
+    logger.notifyFile(fs, "subject", "message 5", SeverityCritical)
+    if msg := notifier.wait(300 * time.Millisecond); msg != "" {
+        t.Errorf("message should be collected to digest: %v", msg)
+    }
+    logger.stopDigests()
+    logger.inflight.Wait()
+    messages := notifier.wait(time.Second) + notifier.wait(time.Second)
+    if !strings.Contains(messages, "message 4") || !strings.Contains(messages, "message 5") {
+        t.Errorf("pending digests are not sent: %v", messages)
+    }
+    logger.notifyFile(f, "subject", "message 6", SeverityWarning)
+    if msg := notifier.wait(time.Second); msg != "message 6" {
+        t.Errorf("message should be sent after stop: %v", msg)
+    }
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Duplicate notifications guard
+//
+package logchecker
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+    "time"
+)
+
+// DefaultDuplicateWindow is a default time window when an identical
+// notification to the same recipients is dropped.
+const DefaultDuplicateWindow = 10 * time.Second
+
+// sentNotification is a hash and a time of the last notification.
+type sentNotification struct {
+    hash [sha256.Size]byte
+    time time.Time
+}
+
+// DuplicatePeriod returns a window of duplicate notifications from
+// "duplicate_window" seconds, zero value means the default window
+// and a negative one disables the guard, then zero window is returned.
+func (cfg *Config) DuplicatePeriod() time.Duration {
+    switch {
+        case cfg.DuplicateWindow < 0:
+            return 0
+        case cfg.DuplicateWindow == 0:
+            return DefaultDuplicateWindow
+    }
+    return time.Duration(cfg.DuplicateWindow) * time.Second
+}
+
+// isDuplicate returns true if the notification has the same content
+// as the previous one of the notifier to the same recipients, and it was
+// sent inside the duplicate window. Otherwise the notification is saved
+// as the previous one. A shared storage is used if the back-end supports it,
+// so instances with the same storage don't send duplicates.
+func (logger *LogChecker) isDuplicate(notifier Notifier, subject, msg string, to []string) bool {
+    window := logger.Cfg.DuplicatePeriod()
+    if window == 0 {
+        return false
+    }
+    key := notifier.String() + "\n" + strings.Join(to, ",")
+    hash := sha256.Sum256([]byte(subject + "\n" + msg))
+    if storage, ok := logger.Backend.(KeyValueStorage); ok {
+        duplicate, err := sharedDuplicate(storage, key, hash, window)
+        if err == nil {
+            return duplicate
+        }
+        LoggerError.Printf("shared duplicate check error, local one is used: %v", err)
+    }
+    now := time.Now()
+    logger.sentMutex.Lock()
+    defer logger.sentMutex.Unlock()
+    if logger.sent == nil {
+        logger.sent = make(map[string]sentNotification)
+    }
+    if prev, ok := logger.sent[key]; ok && (prev.hash == hash) && (now.Sub(prev.time) < window) {
+        return true
+    }
+    logger.sent[key] = sentNotification{hash, now}
+    return false
+}
+
+// sharedDuplicate checks the previous notification in the shared storage
+// and saves the new one for the duplicate window.
+func sharedDuplicate(storage KeyValueStorage, key string, hash [sha256.Size]byte, window time.Duration) (bool, error) {
+    keyHash := sha256.Sum256([]byte(key))
+    name, value := "sent:" + hex.EncodeToString(keyHash[:]), hex.EncodeToString(hash[:])
+    prev, ok, err := storage.Get(name)
+    if err != nil {
+        return false, err
+    }
+    if ok && (prev == value) {
+        return true, nil
+    }
+    return false, storage.Set(name, value, window)
+}
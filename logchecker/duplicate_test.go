@@ -0,0 +1,50 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "testing"
+    "time"
+)
+
+func TestDuplicate(t *testing.T) {
+    logger := New()
+    notifier := newRecordNotifier()
+    to := []string{"user@host.com"}
+    logger.notifyAsync(notifier, "subject", "message", to)
+    logger.notifyAsync(notifier, "subject", "message", to)
+    logger.inflight.Wait()
+    if msg := notifier.wait(time.Second); msg != "message" {
+        t.Errorf("notification is not sent: %v", msg)
+    }
+    if msg := notifier.wait(100 * time.Millisecond); msg != "" {
+        t.Errorf("duplicate notification is sent: %v", msg)
+    }
+    // other recipients, other content and other notifiers
+    other := newRecordNotifier()
+    logger.notifyAsync(notifier, "subject", "message", []string{"admin@host.com"})
+    logger.notifyAsync(notifier, "subject", "other message", to)
+    logger.notifyAsync(notifier, "subject", "message", to)
+    logger.notifyAsync(other, "subject", "message", to)
+    logger.inflight.Wait()
+    for i := 0; i < 3; i++ {
+        if msg := notifier.wait(time.Second); msg == "" {
+            t.Errorf("notification %v is not sent", i)
+        }
+    }
+    if msg := other.wait(time.Second); msg != "message" {
+        t.Errorf("notification of other notifier is not sent: %v", msg)
+    }
+    // the guard is disabled
+    logger.Cfg.DuplicateWindow = -1
+    logger.notifyAsync(notifier, "subject", "message", to)
+    logger.notifyAsync(notifier, "subject", "message", to)
+    logger.inflight.Wait()
+    for i := 0; i < 2; i++ {
+        if msg := notifier.wait(time.Second); msg != "message" {
+            t.Errorf("notification %v is not sent: %v", i, msg)
+        }
+    }
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Environment variables in configuration
+//
+package logchecker
+
+import (
+    "os"
+)
+
+// ExpandEnv replaces ${VAR} and $VAR references by values of environment
+// variables, unknown variables are replaced by empty strings. "$$" is kept
+// as a literal "$".
+func ExpandEnv(s string) string {
+    return os.Expand(s, func(name string) string {
+        if name == "$" {
+            return "$"
+        }
+        return os.Getenv(name)
+    })
+}
+
+// expandEnv expands environment variables of sender, slack, chat and syslog
+// settings, webhook url and headers, Redis storage URL, address and password,
+// files paths and emails.
+func (cfg *Config) expandEnv() {
+    if IsRedisStorage(cfg.Storage) {
+        cfg.Storage = ExpandEnv(cfg.Storage)
+        cfg.StorageAddr, cfg.StoragePassword = ExpandEnv(cfg.StorageAddr), ExpandEnv(cfg.StoragePassword)
+    }
+    maps := []map[string]string{cfg.Sender, cfg.Slack, cfg.Chat, cfg.Syslog}
+    if cfg.Webhook != nil {
+        cfg.Webhook.URL = ExpandEnv(cfg.Webhook.URL)
+        maps = append(maps, cfg.Webhook.Headers)
+    }
+    for _, settings := range maps {
+        for k, v := range settings {
+            settings[k] = ExpandEnv(v)
+        }
+    }
+    for i := range cfg.Observed {
+        for k, email := range cfg.Observed[i].Emails {
+            cfg.Observed[i].Emails[k] = ExpandEnv(email)
+        }
+        for j := range cfg.Observed[i].Files {
+            f := &cfg.Observed[i].Files[j]
+            f.Log = ExpandEnv(f.Log)
+            for k, email := range f.Emails {
+                f.Emails[k] = ExpandEnv(email)
+            }
+            for k, email := range f.EscalateEmails {
+                f.EscalateEmails[k] = ExpandEnv(email)
+            }
+        }
+    }
+}
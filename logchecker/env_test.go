@@ -0,0 +1,58 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Environment variables testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+    os.Setenv("LOGCHECKER_TEST_PASSWORD", "secret")
+    defer os.Unsetenv("LOGCHECKER_TEST_PASSWORD")
+    values := map[string]string{
+        "${LOGCHECKER_TEST_PASSWORD}": "secret",
+        "$LOGCHECKER_TEST_PASSWORD": "secret",
+        "pa$$word": "pa$word",
+        "$$LOGCHECKER_TEST_PASSWORD": "$LOGCHECKER_TEST_PASSWORD",
+        "plain": "plain",
+    }
+    for k, v := range values {
+        if r := ExpandEnv(k); r != v {
+            t.Errorf("incorrect expansion [%v]: %v != %v", k, r, v)
+        }
+    }
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "\"password\": \"password\"": "\"password\": \"${LOGCHECKER_TEST_PASSWORD}\"",
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_syslog"),
+    }
+    example := filepath.Join(testdir, "config.env.json")
+    if err := prepareConfig(filepath.Join(testdir, "config.example.json"), example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer os.Remove(example)
+    for k, v := range newvalues {
+        if k[0] != '/' {
+            continue
+        }
+        if err := createFile(v, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]: %v", v, err)
+        }
+        defer os.Remove(v)
+    }
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatalf("error during InitConfig [%v]: %v", example, err)
+    }
+    if p := logger.Cfg.Sender["password"]; p != "secret" {
+        t.Errorf("sender password is not expanded: %v", p)
+    }
+}
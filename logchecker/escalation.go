@@ -0,0 +1,51 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Escalation of repeated notifications
+//
+package logchecker
+
+import (
+    "fmt"
+)
+
+// validateEscalation checks escalation settings of the file.
+func (f *File) validateEscalation() error {
+    switch {
+        case (f.EscalateAfter > 0) && (len(f.EscalateEmails) == 0):
+            return fmt.Errorf("escalate_emails should not be empty if escalate_after is set")
+        case (f.EscalateAfter == 0) && (len(f.EscalateEmails) > 0):
+            return fmt.Errorf("escalate_after should be set for escalate_emails")
+    }
+    return nil
+}
+
+// escalationNumber returns a number of the next notification of the period
+// if it should be escalated, otherwise it returns 0.
+func (f *File) escalationNumber() uint64 {
+    if (f.EscalateAfter == 0) || (f.Consecutive < f.EscalateAfter) {
+        return 0
+    }
+    return f.Consecutive + 1
+}
+
+// escalationRecipients appends escalation emails to the recipients
+// of an escalated notification.
+func (f *File) escalationRecipients(to []string) []string {
+    if f.escalation == 0 {
+        return to
+    }
+    found := make(map[string]bool, len(to))
+    result := append([]string{}, to...)
+    for _, email := range to {
+        found[email] = true
+    }
+    for _, email := range f.EscalateEmails {
+        if !found[email] {
+            found[email] = true
+            result = append(result, email)
+        }
+    }
+    return result
+}
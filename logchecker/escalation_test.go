@@ -0,0 +1,93 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Escalation testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// recipientNotifier is a test notifier that saves recipients and messages.
+type recipientNotifier struct {
+    recipients chan []string
+    messages chan string
+}
+
+func (rn *recipientNotifier) String() string {
+    return "recipientNotifier"
+}
+
+func (rn *recipientNotifier) Notify(msg string, to []string) error {
+    rn.recipients <- to
+    rn.messages <- msg
+    return nil
+}
+
+func TestEscalation(t *testing.T) {
+    var group sync.WaitGroup
+    invalid := []File{
+        {Log: "/var/log/app.log", Pattern: "ERROR", EscalateAfter: 2},
+        {Log: "/var/log/app.log", Pattern: "ERROR", EscalateEmails: []string{"manager@host.com"}},
+    }
+    for i := range invalid {
+        if err := invalid[i].validate(false); err == nil {
+            t.Errorf("[%v] invalid escalation settings are accepted", i)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_escalation.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Cfg.DuplicateWindow = -1
+    notifier := &recipientNotifier{make(chan []string, 10), make(chan string, 10)}
+    logger.notifier = notifier
+    f := &File{
+        Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10,
+        Emails: []string{"admin@host.com"}, EscalateAfter: 2, EscalateEmails: []string{"manager@host.com", "admin@host.com"},
+    }
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    check := func(escalated bool, number uint64) {
+        if err := updateFile(filename, "ERROR"); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        expected := "admin@host.com"
+        if escalated {
+            expected += ",manager@host.com"
+        }
+        if to := strings.Join(<-notifier.recipients, ","); to != expected {
+            t.Errorf("[%v] incorrect recipients: %v", number, to)
+        }
+        msg := <-notifier.messages
+        if contains := strings.Contains(msg, "Escalated alert: "); contains != escalated {
+            t.Errorf("[%v] incorrect escalation message: %v", number, msg)
+        }
+        if escalated && !strings.Contains(msg, "Escalated alert: 3 consecutive") {
+            t.Errorf("[%v] incorrect consecutive count: %v", number, msg)
+        }
+        if f.Consecutive != number {
+            t.Errorf("incorrect consecutive notifications: %v", f.Consecutive)
+        }
+    }
+    check(false, 1)
+    check(false, 2)
+    check(true, 3)
+    // a new period resets the escalation
+    f.Granularity++
+    check(false, 1)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Lifecycle events
+//
+package logchecker
+
+import (
+    "fmt"
+    "time"
+)
+
+const (
+    // EventStart is emitted after a successful start.
+    EventStart string = "start"
+    // EventStop is emitted after a stop.
+    EventStop string = "stop"
+    // EventReload is emitted after a configuration reload,
+    // Err is set if new configuration is rejected.
+    EventReload string = "reload"
+    // EventWatcherError is emitted when a file watcher is failed.
+    EventWatcherError string = "watcher_error"
+)
+
+// EventsBuffer is a capacity of the lifecycle events channel,
+// new events are dropped if it is full.
+var EventsBuffer = 64
+
+// Event is a lifecycle event of LogChecker.
+type Event struct {
+    Type string
+    Time time.Time
+    Service string
+    File string
+    Details string
+    Err error
+}
+
+// String returns a text representation of the event.
+func (e Event) String() string {
+    result := fmt.Sprintf("%v %v", e.Time.Format(time.RFC3339), e.Type)
+    if len(e.File) > 0 {
+        result += fmt.Sprintf(" [%v / %v]", e.Service, e.File)
+    }
+    if len(e.Details) > 0 {
+        result += ": " + e.Details
+    }
+    if e.Err != nil {
+        result += fmt.Sprintf(" (%v)", e.Err)
+    }
+    return result
+}
+
+// Events returns a channel of lifecycle events. It is buffered
+// and never blocks LogChecker, events are dropped if nobody reads them.
+func (logger *LogChecker) Events() <-chan Event {
+    return logger.events
+}
+
+// emit sends a lifecycle event without blocking.
+func (logger *LogChecker) emit(event Event) {
+    event.Time = time.Now()
+    select {
+        case logger.events <- event:
+        default:
+            LoggerDebug.Printf("event is dropped: %v", event)
+    }
+}
+
+// emitFile sends a lifecycle event of the watched file.
+func (logger *LogChecker) emitFile(eventType string, f *File, err error) {
+    event := Event{Type: eventType, File: f.Log, Err: err}
+    if f.service != nil {
+        event.Service = f.service.Name
+    }
+    logger.emit(event)
+}
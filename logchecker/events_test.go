@@ -0,0 +1,90 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Lifecycle events testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestEvents(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_events_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_events_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_events_syslog"),
+    }
+    oldexample := filepath.Join(testdir, "config.example.json")
+    example := filepath.Join(testdir, "config.events.json")
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer rm(example)
+    for _, v := range newvalues {
+        if err := createFile(v, 0666); err != nil {
+            t.Errorf("test file preparation error [%v]: %v", v, err)
+        }
+        defer rm(v)
+    }
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatal(err)
+    }
+    events := logger.Events()
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    if err := logger.Reload(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    expected := []string{EventStart, EventStop, EventStart, EventReload, EventStop}
+    for i, eventType := range expected {
+        select {
+            case event := <-events:
+                if (event.Type != eventType) || (event.Err != nil) || event.Time.IsZero() {
+                    t.Errorf("incorrect event %v: %v", i, event)
+                }
+            case <-time.After(time.Second):
+                t.Fatalf("event %v [%v] is not received", i, eventType)
+        }
+    }
+    // rejected configuration
+    if err := os.Truncate(example, 0); err != nil {
+        t.Fatal(err)
+    }
+    if err := logger.Reload(context.Background(), &group); err == nil {
+        t.Error("need reload error")
+    }
+    select {
+        case event := <-events:
+            if (event.Type != EventReload) || (event.Err == nil) {
+                t.Errorf("incorrect event: %v", event)
+            }
+        default:
+            t.Error("reload event is not received")
+    }
+    // events are dropped if the channel is full
+    for i := 0; i < EventsBuffer+1; i++ {
+        logger.emit(Event{Type: EventStop})
+    }
+    if n := len(events); n != EventsBuffer {
+        t.Errorf("incorrect events number: %v", n)
+    }
+}
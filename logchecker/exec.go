@@ -0,0 +1,168 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// External command notifier
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "os"
+    "os/exec"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    // ExecNotifierName is a name of the command notifier configured by "exec" settings.
+    ExecNotifierName string = "exec"
+    // DefaultExecTimeout is a default timeout of a command execution.
+    DefaultExecTimeout = 30 * time.Second
+    // DefaultExecConcurrency is a default maximum number of running commands.
+    DefaultExecConcurrency int = 4
+)
+
+// ExecSettings is a configuration of the command notifier.
+type ExecSettings struct {
+    Command string        `json:"command"`
+    Args []string         `json:"args"`
+    Timeout uint64        `json:"timeout"`
+    MaxConcurrent int     `json:"max_concurrent"`
+}
+
+// ExecAlert is a metadata of a notification, it's passed to a command
+// by environment variables and argument placeholders.
+type ExecAlert struct {
+    Service string
+    File string
+    Found uint64
+    Severity string
+}
+
+// ExecNotifier runs an external command per notification,
+// the message is written to the command's stdin.
+type ExecNotifier struct {
+    Command string
+    Args []string
+    Timeout time.Duration
+    slots chan bool
+}
+
+// execFileNotifier is a command notifier of the file's alert.
+type execFileNotifier struct {
+    *ExecNotifier
+    alert ExecAlert
+}
+
+// NewExecNotifier creates ExecNotifier from "exec" config settings.
+func NewExecNotifier(settings *ExecSettings) (*ExecNotifier, error) {
+    if (settings == nil) || (len(settings.Command) == 0) {
+        return nil, fmt.Errorf("exec command should not be empty")
+    }
+    command, err := exec.LookPath(settings.Command)
+    if err != nil {
+        return nil, fmt.Errorf("exec command error: %v", err)
+    }
+    if settings.MaxConcurrent < 0 {
+        return nil, fmt.Errorf("exec max_concurrent can't be negative")
+    }
+    en := &ExecNotifier{Command: command, Args: settings.Args, Timeout: DefaultExecTimeout}
+    if settings.Timeout > 0 {
+        en.Timeout = time.Duration(settings.Timeout) * time.Second
+    }
+    concurrency := settings.MaxConcurrent
+    if concurrency == 0 {
+        concurrency = DefaultExecConcurrency
+    }
+    en.slots = make(chan bool, concurrency)
+    return en, nil
+}
+
+// String returns a name of the notifier.
+func (en *ExecNotifier) String() string {
+    return fmt.Sprintf("exec (%v)", en.Command)
+}
+
+// Notify runs the command without alert metadata.
+func (en *ExecNotifier) Notify(msg string, to []string) error {
+    return en.Run(ExecAlert{}, msg, to)
+}
+
+// Run executes the command with the message on stdin. Placeholders
+// {service}, {file}, {found} and {severity} of arguments are replaced
+// by alert values, they are also available as LOGCHECKER_SERVICE,
+// LOGCHECKER_FILE, LOGCHECKER_FOUND, LOGCHECKER_SEVERITY environment
+// variables, recipients are in LOGCHECKER_TO. The notification is dropped
+// if the maximum number of commands is already running.
+func (en *ExecNotifier) Run(alert ExecAlert, msg string, to []string) error {
+    select {
+        case en.slots <- true:
+            defer func() { <-en.slots }()
+        default:
+            return fmt.Errorf("exec notification is dropped, %v commands are running", cap(en.slots))
+    }
+    found := strconv.FormatUint(alert.Found, 10)
+    replacer := strings.NewReplacer(
+        "{service}", alert.Service,
+        "{file}", alert.File,
+        "{found}", found,
+        "{severity}", alert.Severity,
+    )
+    args := make([]string, len(en.Args))
+    for i, arg := range en.Args {
+        args[i] = replacer.Replace(arg)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), en.Timeout)
+    defer cancel()
+    var stderr bytes.Buffer
+    cmd := exec.CommandContext(ctx, en.Command, args...)
+    cmd.Stdin = strings.NewReader(msg)
+    cmd.Stderr = &stderr
+    cmd.Env = append(os.Environ(),
+        "LOGCHECKER_SERVICE=" + alert.Service,
+        "LOGCHECKER_FILE=" + alert.File,
+        "LOGCHECKER_FOUND=" + found,
+        "LOGCHECKER_SEVERITY=" + alert.Severity,
+        "LOGCHECKER_TO=" + strings.Join(to, ","),
+    )
+    err := cmd.Run()
+    if stderr.Len() > 0 {
+        LoggerError.Printf("exec [%v] stderr: %v", en.Command, strings.TrimSpace(stderr.String()))
+    }
+    if ctx.Err() == context.DeadlineExceeded {
+        return fmt.Errorf("exec [%v] timeout %v is exceeded", en.Command, en.Timeout)
+    }
+    if err != nil {
+        return fmt.Errorf("exec [%v] error: %v", en.Command, err)
+    }
+    LoggerDebug.Printf("exec notification is sent: %v", en)
+    return nil
+}
+
+// Notify runs the command with the file's alert metadata.
+func (efn *execFileNotifier) Notify(msg string, to []string) error {
+    return efn.Run(efn.alert, msg, to)
+}
+
+// execNotifier returns the command notifier for the file's alert,
+// all files share one limit of running commands.
+func (logger *LogChecker) execNotifier(f *File) (Notifier, error) {
+    logger.execMutex.Lock()
+    defer logger.execMutex.Unlock()
+    if logger.exec == nil {
+        en, err := NewExecNotifier(logger.Cfg.Exec)
+        if err != nil {
+            return nil, err
+        }
+        logger.exec = en
+    }
+    alert := ExecAlert{File: f.Log, Found: f.Found, Severity: f.LastSeverity}
+    if f.service != nil {
+        alert.Service = f.service.Name
+    }
+    return &execFileNotifier{logger.exec, alert}, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Command notifier testing methods
+//
+package logchecker
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestExecNotifier(t *testing.T) {
+    for _, settings := range []*ExecSettings{
+        nil,
+        {},
+        {Command: "/unknown/command"},
+        {Command: "sh", MaxConcurrent: -1},
+    } {
+        if _, err := NewExecNotifier(settings); err == nil {
+            t.Errorf("need settings error: %v", settings)
+        }
+    }
+    output := filepath.Join(buildDir(), "test_exec.out")
+    defer os.Remove(output)
+    script := `cat > "$1"; echo "$LOGCHECKER_SERVICE;$LOGCHECKER_FILE;$LOGCHECKER_FOUND;$LOGCHECKER_TO;$2" >> "$1"; echo warning >&2`
+    en, err := NewExecNotifier(&ExecSettings{Command: "sh", Args: []string{"-c", script, "sh", output, "{service}/{found}"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if en.Timeout != DefaultExecTimeout {
+        t.Errorf("incorrect timeout: %v", en.Timeout)
+    }
+    alert := ExecAlert{Service: "app", File: "/var/log/app.log", Found: 3, Severity: SeverityWarning}
+    if err := en.Run(alert, "message\n", []string{"1@host.com", "2@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    data, err := ioutil.ReadFile(output)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if result := string(data); result != "message\napp;/var/log/app.log;3;1@host.com,2@host.com;app/3\n" {
+        t.Errorf("incorrect result: %v", result)
+    }
+    // timeout and concurrency limit
+    en, err = NewExecNotifier(&ExecSettings{Command: "sleep", Args: []string{"5"}, Timeout: 1, MaxConcurrent: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    result := make(chan error)
+    start := time.Now()
+    go func() {
+        result <- en.Run(ExecAlert{}, "", nil)
+    }()
+    time.Sleep(100 * time.Millisecond)
+    if err := en.Run(ExecAlert{}, "", nil); (err == nil) || !strings.Contains(err.Error(), "dropped") {
+        t.Errorf("need dropped notification error: %v", err)
+    }
+    if err := <-result; (err == nil) || !strings.Contains(err.Error(), "timeout") {
+        t.Errorf("need timeout error: %v", err)
+    }
+    if d := time.Since(start); d > 3 * time.Second {
+        t.Errorf("command is not killed: %v", d)
+    }
+
+    cfg := Config{Exec: &ExecSettings{Command: "sh"}}
+    if !cfg.hasNotifier(ExecNotifierName) {
+        t.Errorf("exec notifier should be available")
+    }
+    if err := RegisterNotifier(ExecNotifierName, en); err == nil {
+        t.Errorf("need reserved name error")
+    }
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Glob patterns of watched files
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// DefaultGlobInterval is a default interval to find new files of glob paths.
+const DefaultGlobInterval = 30 * time.Second
+
+// hasMeta checks that a path contains glob special characters.
+func hasMeta(path string) bool {
+    return strings.ContainsAny(path, `*?[`)
+}
+
+// IsGlob checks that the file path is a glob pattern.
+func (f *File) IsGlob() bool {
+    return hasMeta(f.Log)
+}
+
+// validateGlob checks the glob pattern of the file path,
+// the nearest directory without special characters should exist
+// if stat is true, matched files are not required.
+func (f *File) validateGlob(stat bool) error {
+    if _, err := filepath.Match(f.Log, ""); err != nil {
+        return fmt.Errorf("file pattern error: %v", err)
+    }
+    if !stat {
+        return nil
+    }
+    dir := filepath.Dir(f.Log)
+    for hasMeta(dir) {
+        dir = filepath.Dir(dir)
+    }
+    info, err := os.Stat(dir)
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("file pattern directory is not a directory [%v]", dir)
+    }
+    return nil
+}
+
+// globInterval returns an interval to find new files of glob paths.
+func (cfg *Config) globInterval() time.Duration {
+    if cfg.GlobInterval > 0 {
+        return time.Duration(cfg.GlobInterval) * time.Second
+    }
+    return DefaultGlobInterval
+}
+
+// clone returns a copy of the file settings with another path,
+// slices with validation results are copied, so they are not shared.
+func (f *File) clone(path string) *File {
+    c := *f
+    c.Log = path
+    c.SeverityRules = append([]SeverityRule{}, f.SeverityRules...)
+    c.Patterns = append([]SeverityPattern{}, f.Patterns...)
+    c.Periods = append([]PeriodLimit{}, f.Periods...)
+    return &c
+}
+
+// watchGlob starts watchers of files matched by the glob path of the file,
+// new files are found every glob interval until ctx is done
+// and read from the beginning.
+// A removed file is watched again if it's created later.
+// It returns a number of started watchers.
+func (logger *LogChecker) watchGlob(ctx context.Context, tmpl *File, group *sync.WaitGroup) int {
+    var mutex sync.Mutex
+    watched := map[string]bool{}
+    expand := func(created bool) int {
+        var started int
+        paths, err := filepath.Glob(tmpl.Log)
+        if err != nil {
+            LoggerError.Printf("file pattern error [%v]: %v", tmpl.Log, err)
+            return 0
+        }
+        mutex.Lock()
+        defer mutex.Unlock()
+        for _, path := range paths {
+            if watched[path] {
+                continue
+            }
+            if info, err := os.Stat(path); (err != nil) || info.IsDir() {
+                continue
+            }
+            f := tmpl.clone(path)
+            if err := f.Validate(); err != nil {
+                LoggerError.Printf("incorrect file was skipped [%v / %v]: %v\n", tmpl.service, f.Base(), err)
+                continue
+            }
+            watched[path] = true
+            if skip := f.initPosition(); skip {
+                LoggerInfo.Printf("empty file was skipped [%v / %v]\n", tmpl.service, f.Base())
+                continue
+            }
+            if created {
+                // lines of a new file are checked by the watcher start
+                f.startSize = 0
+            }
+            f.LogStart = time.Now()
+            f.ExtBoundary = f.Boundary
+            logger.restorePosition(f)
+            logger.registerGlobbed(f.Log, 1)
+            group.Add(1)
+            go func(f *File) {
+                defer group.Done()
+                f.Watch(ctx, group, logger)
+                logger.registerGlobbed(f.Log, -1)
+                mutex.Lock()
+                delete(watched, f.Log)
+                mutex.Unlock()
+            }(f)
+            LoggerInfo.Printf("file of pattern is watched [%v / %v]\n", tmpl.service, f.Base())
+            started++
+        }
+        return started
+    }
+    started := expand(false)
+    group.Add(1)
+    go func() {
+        defer group.Done()
+        ticker := time.NewTicker(logger.Cfg.globInterval())
+        defer ticker.Stop()
+        for {
+            select {
+                case <-ctx.Done():
+                    return
+                case <-ticker.C:
+                    expand(true)
+            }
+        }
+    }()
+    return started
+}
+
+// registerGlobbed adds or removes a watcher of the file found by a glob pattern,
+// so the file can be read by Tail.
+func (logger *LogChecker) registerGlobbed(path string, n int) {
+    logger.mutex.Lock()
+    defer logger.mutex.Unlock()
+    if logger.globbed == nil {
+        logger.globbed = map[string]int{}
+    }
+    logger.globbed[path] += n
+    if logger.globbed[path] <= 0 {
+        delete(logger.globbed, path)
+    }
+}
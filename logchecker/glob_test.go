@@ -0,0 +1,95 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Glob paths testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestGlobValidate(t *testing.T) {
+    dir := filepath.Join(buildDir(), "test_glob_validate")
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    values := map[string]bool{
+        filepath.Join(dir, "*.log"): true,
+        filepath.Join(dir, "*", "app.log"): true,
+        filepath.Join(dir, "absent", "*.log"): false,
+        filepath.Join(dir, "[.log"): false,
+        "logs/*.log": false,
+    }
+    for path, valid := range values {
+        f := &File{Log: path, Pattern: "ERROR"}
+        if !f.IsGlob() {
+            t.Errorf("glob is not detected [%v]", path)
+        }
+        if err := f.Validate(); (err == nil) != valid {
+            t.Errorf("incorrect validation [%v]: %v", path, err)
+        }
+    }
+    if f := (&File{Log: filepath.Join(dir, "app.log")}); f.IsGlob() {
+        t.Error("file path is detected as glob")
+    }
+}
+
+func TestGlob(t *testing.T) {
+    var group sync.WaitGroup
+    dir := filepath.Join(buildDir(), "test_glob")
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    first, second := filepath.Join(dir, "first.log"), filepath.Join(dir, "second.log")
+    if err := createFile(first, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    if err := createFile(filepath.Join(dir, "other.txt"), 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    logger := New()
+    logger.Cfg.GlobInterval = 1
+    logger.Cfg.Observed = []Service{{Name: "glob", Files: []File{
+        {Log: filepath.Join(dir, "*.log"), Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    defer logger.Stop(&group)
+    time.Sleep(100 * time.Millisecond)
+    if err := updateFile(first, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "ERROR 1") {
+        t.Fatalf("matched file is not watched: %v", msg)
+    }
+    // a new file is found by the next expansion
+    if err := createFile(second, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(second, "ERROR 2"); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(3 * time.Second)
+    if !strings.Contains(msg, "ERROR 2") || strings.Contains(msg, "ERROR 1") {
+        t.Fatalf("new file is not watched: %v", msg)
+    }
+    if err := updateFile(filepath.Join(dir, "other.txt"), "ERROR 3"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(1500 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("not matched file is watched: %v", msg)
+    }
+}
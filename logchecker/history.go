@@ -0,0 +1,113 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notifications and checks history, SQLite storage names
+//
+package logchecker
+
+import (
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    // SQLiteScheme is a prefix of SQLite storage, e.g. "sqlite:/var/lib/logchecker/state.db".
+    SQLiteScheme string = "sqlite:"
+    // SQLiteMemory is a path of in-memory SQLite database.
+    SQLiteMemory string = ":memory:"
+)
+
+// Notification is a record of a sent notification.
+type Notification struct {
+    Service string       `json:"service"`
+    File string          `json:"file"`
+    Count uint64         `json:"count"`
+    SentAt time.Time     `json:"sent_at"`
+    Recipients []string  `json:"recipients"`
+}
+
+// CheckRun is a record of a file check.
+type CheckRun struct {
+    Service string       `json:"service"`
+    File string          `json:"file"`
+    Found uint64         `json:"found"`
+    Total uint64         `json:"total"`
+    CheckedAt time.Time  `json:"checked_at"`
+}
+
+// NotificationHistory is a back-end that keeps sent notifications.
+type NotificationHistory interface {
+    Backender
+    AddNotification(n Notification) error
+    History(service string, limit int) ([]Notification, error)
+}
+
+// CheckHistory is a back-end that keeps file checks.
+type CheckHistory interface {
+    Backender
+    AddCheck(c CheckRun) error
+    Checks(service, file string, since time.Time) ([]CheckRun, error)
+}
+
+// IsSQLiteStorage checks that the storage is a SQLite database.
+func IsSQLiteStorage(storage string) bool {
+    return strings.HasPrefix(storage, SQLiteScheme)
+}
+
+// recordNotification saves a sent notification of the file
+// if the back-end keeps the history, errors are only logged.
+func (logger *LogChecker) recordNotification(f *File, to []string, sent time.Time) {
+    history, ok := logger.Backend.(NotificationHistory)
+    if !ok {
+        return
+    }
+    n := Notification{File: f.Log, Count: f.Found, SentAt: sent, Recipients: to}
+    if f.service != nil {
+        n.Service = f.service.Name
+    }
+    if err := history.AddNotification(n); err != nil {
+        LoggerError.Printf("can't save notification history [%v]: %v", f.Base(), err)
+    }
+}
+
+// recordCheck saves a check of the file if the back-end
+// keeps checks, errors are only logged.
+func (logger *LogChecker) recordCheck(f *File, found uint64, checked time.Time) {
+    history, ok := logger.Backend.(CheckHistory)
+    if !ok {
+        return
+    }
+    c := CheckRun{File: f.Log, Found: found, Total: f.Found, CheckedAt: checked}
+    if f.service != nil {
+        c.Service = f.service.Name
+    }
+    if err := history.AddCheck(c); err != nil {
+        LoggerError.Printf("can't save check history [%v]: %v", f.Base(), err)
+    }
+}
+
+// History returns last sent notifications of the service,
+// the storage should keep the history (SQLite).
+func (logger *LogChecker) History(service string, limit int) ([]Notification, error) {
+    logger.mutex.RLock()
+    history, ok := logger.Backend.(NotificationHistory)
+    logger.mutex.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("notification history is not supported by %v", logger.Backend)
+    }
+    return history.History(service, limit)
+}
+
+// Checks returns checks of the service file since the time,
+// the storage should keep the history (SQLite).
+func (logger *LogChecker) Checks(service, file string, since time.Time) ([]CheckRun, error) {
+    logger.mutex.RLock()
+    history, ok := logger.Backend.(CheckHistory)
+    logger.mutex.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("check history is not supported by %v", logger.Backend)
+    }
+    return history.Checks(service, file, since)
+}
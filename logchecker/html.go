@@ -0,0 +1,133 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// HTML email messages
+//
+package logchecker
+
+import (
+    "bytes"
+    "fmt"
+    "html/template"
+    "regexp"
+    "strings"
+)
+
+const (
+    // FormatHTML is a sender format of HTML email messages.
+    FormatHTML string = "html"
+    htmlHeaders string = "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
+)
+
+var (
+    // rgHTMLCount is a number of found lines with an optional severity.
+    rgHTMLCount = regexp.MustCompile(`(\d+) new items(, severity: (\w+))?`)
+    // htmlColors are colors of found lines counts by severities.
+    htmlColors = map[string]string{
+        SeverityInfo: "#1f6feb",
+        SeverityWarning: "#d97706",
+        SeverityCritical: "#dc2626",
+    }
+    htmlMessage = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"></head><body>
+{{range .}}{{if .Pre}}<pre style="background:#f6f8fa;padding:8px">{{range .Lines}}{{.Text}}
+{{end}}</pre>
+{{else}}<p>{{range $i, $line := .Lines}}{{if $i}}<br>
+{{end}}{{$line.Text}}{{if $line.Count}}<b style="color:{{$line.Color}}">{{$line.Count}}</b>{{$line.Rest}}{{end}}{{end}}</p>
+{{end}}{{end}}</body></html>
+`))
+)
+
+// htmlLine is a line of HTML message, Count is a highlighted number
+// of found lines between Text and Rest.
+type htmlLine struct {
+    Text string
+    Count string
+    Color string
+    Rest string
+}
+
+// htmlBlock is a paragraph of text lines or a block of report lines.
+type htmlBlock struct {
+    Pre bool
+    Lines []htmlLine
+}
+
+// validFormat checks sender "format" value.
+func validFormat(format string) bool {
+    switch format {
+        case "", FormatText, FormatHTML:
+            return true
+    }
+    return false
+}
+
+// newHTMLLine returns a text line with a highlighted count of found lines.
+func newHTMLLine(line string) htmlLine {
+    m := rgHTMLCount.FindStringSubmatchIndex(line)
+    if m == nil {
+        return htmlLine{Text: line}
+    }
+    color := htmlColors[SeverityWarning]
+    if m[6] >= 0 {
+        if c, ok := htmlColors[line[m[6]:m[7]]]; ok {
+            color = c
+        }
+    }
+    return htmlLine{Text: line[:m[2]], Count: line[m[2]:m[3]], Color: color, Rest: line[m[3]:]}
+}
+
+// htmlBody converts a plain text message to HTML, report lines are
+// in <pre> blocks and other lines are paragraphs. Empty lines separate
+// paragraphs, all values are escaped.
+func htmlBody(msg string) (string, error) {
+    var (
+        blocks []htmlBlock
+        buf bytes.Buffer
+    )
+    current := -1
+    for _, line := range strings.Split(strings.TrimRight(msg, "\n"), "\n") {
+        pre := rgWebhookLine.MatchString(line) || (line == "...")
+        switch {
+            case !pre && (len(strings.TrimSpace(line)) == 0):
+                current = -1
+                continue
+            case (current < 0) || (blocks[current].Pre != pre):
+                blocks = append(blocks, htmlBlock{Pre: pre})
+                current = len(blocks) - 1
+        }
+        if pre {
+            blocks[current].Lines = append(blocks[current].Lines, htmlLine{Text: line})
+        } else {
+            blocks[current].Lines = append(blocks[current].Lines, newHTMLLine(line))
+        }
+    }
+    if err := htmlMessage.Execute(&buf, blocks); err != nil {
+        return "", fmt.Errorf("html message error: %v", err)
+    }
+    return buf.String(), nil
+}
+
+// emailBody returns MIME headers and a body of an email message,
+// it's converted to HTML if sender "format" is "html".
+func (logger *LogChecker) emailBody(msg string) string {
+    if body, ok := logger.htmlEmail(msg); ok {
+        return htmlHeaders + body
+    }
+    return mimeHeaders + msg
+}
+
+// htmlEmail returns HTML body of the message if sender "format" is "html",
+// plain text is used for conversion errors.
+func (logger *LogChecker) htmlEmail(msg string) (string, bool) {
+    if logger.Cfg.Sender["format"] != FormatHTML {
+        return "", false
+    }
+    body, err := htmlBody(msg)
+    if err != nil {
+        LoggerError.Printf("%v, plain text is used", err)
+        return "", false
+    }
+    return body, true
+}
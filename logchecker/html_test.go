@@ -0,0 +1,59 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// HTML email messages testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "net/smtp"
+    "strings"
+    "testing"
+)
+
+func TestHTMLMessage(t *testing.T) {
+    var sent string
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        sent = string(msg)
+        return nil
+    }
+    for _, format := range []string{"", FormatText, FormatHTML} {
+        if !validFormat(format) {
+            t.Errorf("valid format is rejected: %v", format)
+        }
+    }
+    if validFormat("markdown") {
+        t.Error("unknown format is accepted")
+    }
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com:25"}
+    msg := emailMsg + "\n\nReport for \"app\" service (3 new items, severity: critical): /var/log/app.log\n1: Ошибка <script>alert(1)</script>\n2: ERROR & exit\n\n--\nBR, LogChecker"
+    if err := logger.Notify(msg, []string{"admin@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(sent, "Content-Type: text/plain; charset=\"UTF-8\";\n\n" + msg) {
+        t.Errorf("plain text is not default: %v", sent)
+    }
+    logger.Cfg.Sender["format"] = FormatHTML
+    if err := logger.Notify(msg, []string{"admin@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    for _, expected := range []string{
+        "Content-Type: text/html; charset=\"UTF-8\";\n\n<!DOCTYPE html>",
+        "Report for &#34;app&#34; service (<b style=\"color:#dc2626\">3</b> new items, severity: critical): /var/log/app.log</p>",
+        "<pre style=\"background:#f6f8fa;padding:8px\">1: Ошибка &lt;script&gt;alert(1)&lt;/script&gt;\n2: ERROR &amp; exit\n</pre>",
+        "<p>--<br>\nBR, LogChecker</p>",
+    } {
+        if !strings.Contains(sent, expected) {
+            t.Errorf("message doesn't contain %q: %v", expected, sent)
+        }
+    }
+    if strings.Contains(sent, "<script>") {
+        t.Errorf("html is not escaped: %v", sent)
+    }
+}
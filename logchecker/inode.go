@@ -0,0 +1,23 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+// Inodes of watched files
+//
+package logchecker
+
+import (
+    "os"
+    "syscall"
+)
+
+// fileInode returns an inode number of the file or 0 if it's unknown.
+func fileInode(info os.FileInfo) uint64 {
+    if st, ok := info.Sys().(*syscall.Stat_t); ok {
+        return uint64(st.Ino)
+    }
+    return 0
+}
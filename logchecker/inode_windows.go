@@ -0,0 +1,14 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Inodes of watched files, they are not available on Windows
+//
+package logchecker
+
+import "os"
+
+// fileInode returns 0, so a rotation is detected only by a file size.
+func fileInode(info os.FileInfo) uint64 {
+    return 0
+}
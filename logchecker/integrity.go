@@ -0,0 +1,56 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Integrity of watched files
+//
+package logchecker
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "fmt"
+    "hash"
+    "io"
+    "os"
+)
+
+// prefixHash returns a hash of the first size bytes of the file.
+func prefixHash(file *os.File, size int64) (hash.Hash, error) {
+    h := sha256.New()
+    if _, err := io.Copy(h, io.NewSectionReader(file, 0, size)); err != nil {
+        return nil, err
+    }
+    return h, nil
+}
+
+// checkIntegrity compares already read content of the file with its saved
+// hash and sends a critical notification if it was changed, not appended.
+// The current content becomes a new baseline after the check.
+func (f *File) checkIntegrity(file *os.File, logger *LogChecker) error {
+    if f.Offset == 0 {
+        f.integrity = sha256.New()
+        return nil
+    }
+    h, err := prefixHash(file, f.Offset)
+    if err != nil {
+        return err
+    }
+    if (f.integrity != nil) && !bytes.Equal(h.Sum(nil), f.integrity.Sum(nil)) {
+        LoggerInfo.Printf("integrity of file was changed [%v]\n", f.Base())
+        message := fmt.Sprintf("%v\n\nIntegrity alert for \"%v\" service (severity: %v): %v\nalready read content (%v bytes) was changed.\n\n--\nBR, LogChecker", logger.Cfg.preamble(), f.service, SeverityCritical, f.Log, f.Offset)
+        subject := fmt.Sprintf("LogChecker integrity alert: %v", f.Base())
+        logger.notifyFile(f, subject, message, SeverityCritical)
+    }
+    f.integrity = h
+    return nil
+}
+
+// updateIntegrity adds new read content to the file's hash.
+func (f *File) updateIntegrity(file *os.File, offset int64) error {
+    if f.integrity == nil {
+        return nil
+    }
+    _, err := io.Copy(f.integrity, io.NewSectionReader(file, f.Offset, offset - f.Offset))
+    return err
+}
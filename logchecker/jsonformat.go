@@ -0,0 +1,84 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// JSON structured logs
+//
+package logchecker
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+const (
+    // FormatText is a format of plain text logs, whole lines are matched.
+    FormatText string = "text"
+    // FormatJSON is a format of logs with one JSON object per line,
+    // only a value of File.Field is matched.
+    FormatJSON string = "json"
+)
+
+// validateFormat checks format settings of the file.
+func (f *File) validateFormat() error {
+    switch f.Format {
+        case "", FormatText:
+            if (len(f.Field) > 0) || (len(f.FieldPattern) > 0) {
+                return fmt.Errorf("field and field_pattern are used only for json format")
+            }
+        case FormatJSON:
+            if len(f.Field) == 0 {
+                return fmt.Errorf("field should not be empty for json format")
+            }
+            if len(f.Pattern) > 0 {
+                return fmt.Errorf("pattern is not used for json format, use field_pattern")
+            }
+        default:
+            return fmt.Errorf("unknown format [%v]", f.Format)
+    }
+    return nil
+}
+
+// linePattern returns the main pattern of the file,
+// it's FieldPattern for json format.
+func (f *File) linePattern() string {
+    if f.Format == FormatJSON {
+        return f.FieldPattern
+    }
+    return f.Pattern
+}
+
+// jsonField returns a value of the field from a JSON object line,
+// nested fields are separated by dots. Not string values are
+// returned in JSON encoding.
+func (f *File) jsonField(line string) (string, error) {
+    var (
+        object map[string]interface{}
+        value interface{}
+    )
+    decoder := json.NewDecoder(strings.NewReader(line))
+    decoder.UseNumber()
+    if err := decoder.Decode(&object); err != nil {
+        return "", err
+    }
+    value = object
+    for _, name := range strings.Split(f.Field, ".") {
+        fields, ok := value.(map[string]interface{})
+        if !ok {
+            return "", fmt.Errorf("field [%v] is not found", f.Field)
+        }
+        if value, ok = fields[name]; !ok {
+            return "", fmt.Errorf("field [%v] is not found", f.Field)
+        }
+    }
+    if s, ok := value.(string); ok {
+        return s, nil
+    }
+    data, err := json.Marshal(value)
+    if err != nil {
+        return "", err
+    }
+    return string(bytes.TrimSpace(data)), nil
+}
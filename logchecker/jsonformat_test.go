@@ -0,0 +1,100 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// JSON structured logs testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestJSONFormatValidate(t *testing.T) {
+    invalid := []File{
+        {Log: "/var/log/app.log", Format: "xml", Pattern: "ERROR"},
+        {Log: "/var/log/app.log", Format: FormatJSON, FieldPattern: "error"},
+        {Log: "/var/log/app.log", Format: FormatJSON, Field: "level"},
+        {Log: "/var/log/app.log", Format: FormatJSON, Field: "level", Pattern: "error"},
+        {Log: "/var/log/app.log", Pattern: "ERROR", Field: "level"},
+    }
+    for i := range invalid {
+        if err := invalid[i].validate(false); err == nil {
+            t.Errorf("[%v] invalid format settings are accepted", i)
+        }
+    }
+    f := &File{Log: "/var/log/app.log", Format: FormatJSON, Field: "level", FieldPattern: "^error$"}
+    if err := f.validate(false); err != nil {
+        t.Errorf("valid format settings are rejected: %v", err)
+    }
+    values := map[string]string{
+        `{"level": "error"}`: "error",
+        `{"level": 500}`: "500",
+        `{"level": 12345678901234567890}`: "12345678901234567890",
+        `{"level": true}`: "true",
+        `{"level": {"code": 1}}`: `{"code":1}`,
+    }
+    for line, expected := range values {
+        if value, err := f.jsonField(line); (err != nil) || (value != expected) {
+            t.Errorf("incorrect field value [%v]: %v, %v", line, value, err)
+        }
+    }
+    f.Field = "ctx.level"
+    if value, err := f.jsonField(`{"ctx": {"level": "warn"}}`); (err != nil) || (value != "warn") {
+        t.Errorf("incorrect nested field value: %v, %v", value, err)
+    }
+    for _, line := range []string{`{"level": "error"}`, `{"ctx": "error"}`, `error`, `["error"]`} {
+        if value, err := f.jsonField(line); err == nil {
+            t.Errorf("absent field is found [%v]: %v", line, value)
+        }
+    }
+}
+
+func TestJSONFormat(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_json.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Format: FormatJSON, Field: "level", FieldPattern: "^error$", Boundary: 1, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    lines := []string{
+        `{"level": "info", "msg": "no error here"}`,
+        `plain error line`,
+        `{"level": "error", "msg": "connection is lost"}`,
+        `{"msg": "error without level"}`,
+    }
+    for _, line := range lines {
+        if err := updateFile(filename, line); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "connection is lost") {
+        t.Errorf("error level line is not matched: %v", msg)
+    }
+    if strings.Contains(msg, "no error here") || strings.Contains(msg, "plain error line") {
+        t.Errorf("whole line is matched: %v", msg)
+    }
+    if (f.Found != 1) || (f.Pos != 4) {
+        t.Errorf("incorrect found %v or position %v", f.Found, f.Pos)
+    }
+    if f.ParseErrors != 2 {
+        t.Errorf("incorrect number of parse errors: %v", f.ParseErrors)
+    }
+}
@@ -21,25 +21,45 @@ package logchecker
 
 import (
     "bufio"
-    "encoding/json"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "errors"
     "fmt"
-    "golang.org/x/exp/inotify"
+    "hash"
     "io/ioutil"
     "log"
-    "net/smtp"
+    "mime"
+    "net"
+    "net/mail"
     "os"
     "path/filepath"
     "regexp"
-    "runtime"
+    "strconv"
     "strings"
     "sync"
+    "sync/atomic"
+    "text/template"
     "time"
 )
 
 const (
-    watcherMask uint32 = inotify.IN_MODIFY | inotify.IN_ATTRIB
+    watcherOps WatchOp = WatchWrite | WatchAttrib
+    followOps WatchOp = WatchMove | WatchRemove
     maxMsgLines uint64 = 10
     emailMsg string = "LogChecker notification.\n"
+    mimeHeaders string = "MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n"
+    defaultSMTPPort string = "25"
+    // ZeroByteWatch is a default mode to watch empty files from the start.
+    ZeroByteWatch string = "watch"
+    // ZeroByteSkip is a mode to skip files that are empty on start.
+    ZeroByteSkip string = "skip"
+    // SeverityInfo is a lowest severity level.
+    SeverityInfo string = "info"
+    // SeverityWarning is a default severity level.
+    SeverityWarning string = "warning"
+    // SeverityCritical is a highest severity level.
+    SeverityCritical string = "critical"
 )
 
 var (
@@ -51,22 +71,52 @@ var (
     LoggerDebug = log.New(ioutil.Discard, "DEBUG [logchecker]: ", log.Ldate|log.Lmicroseconds|log.Lshortfile)
     // MoveWait is waiting period before a check that a file was again created.
     MoveWait = 2 * time.Second
+    // FollowAttempts is a number of checks that a followed file was created again,
+    // every check waits MoveWait period.
+    FollowAttempts = 10
     // EmailSimulator is a file path to verify sent emails during debug mode.
     EmailSimulator string
+    // DefaultNotifier replaces the email simulator during debug mode if it is set.
+    DefaultNotifier Notifier
+    // SenderDialCheck activates a connection check of sender address during validation.
+    SenderDialCheck = false
+    // DialTimeout is a timeout of sender address connection check.
+    DialTimeout = 5 * time.Second
 
     debug = false
     initTime = time.Time{}
+    severityLevels = map[string]int{SeverityInfo: 0, SeverityWarning: 1, SeverityCritical: 2}
+    rgHostname = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*\.?$`)
+    // sendMail is a function to send emails, it is replaced in tests.
+    sendMail = sendMailContext
+    // newWatcher is a function to create file watchers, it is replaced in tests.
+    newWatcher = NewWatcher
 )
 
-// Backender is an interface to handle data storage operations.
+// Backender is an interface to handle data storage operations,
+// it keeps states of watched files by their paths. Open prepares
+// the storage before the start, Close releases it after the stop,
+// a closed storage can be opened again. SavePosition sets a number
+// of read lines of the file, its byte offset is reset, so the lines
+// are skipped by the next read. LoadPosition returns false if a state
+// of the file is not saved. IncrementCounter adds sent notifications
+// to the counter of the file.
 type Backender interface {
     String() string
+    Open() error
+    Close() error
+    SaveState(key string, st FileState) error
+    LoadState(key string) (FileState, error)
+    SavePosition(file string, pos uint64) error
+    LoadPosition(file string) (uint64, bool, error)
+    IncrementCounter(file string, n uint64) error
 }
 
 // Notifier is an interface to notify users about file changes.
+// Notify returns an error if the message is not delivered or queued.
 type Notifier interface {
     String() string
-    Notify(string, []string)
+    Notify(string, []string) error
 }
 
 type debugSender struct {
@@ -75,7 +125,7 @@ type debugSender struct {
 func (ds *debugSender) String() string {
     return ds.Name
 }
-func (ds *debugSender) Notify(msg string, to []string) {
+func (ds *debugSender) Notify(msg string, to []string) error {
     LoggerDebug.Printf("call EmailSimulator (%v)", EmailSimulator)
     writeLine := fmt.Sprintf("%v: get message (%v symbols) for [%v]\n", time.Now(), len(msg), strings.Join(to, ", "))
     if len(EmailSimulator) == 0 {
@@ -83,67 +133,193 @@ func (ds *debugSender) Notify(msg string, to []string) {
         LoggerDebug.Printf(writeLine)
     } else {
         if !filepath.IsAbs(EmailSimulator) {
-            LoggerError.Println("path should be absolute")
-            return
+            return fmt.Errorf("path should be absolute")
         }
         _, err := os.Stat(EmailSimulator);
         if err != nil {
-            LoggerError.Printf("unknown file: %v", err)
-            return
+            return fmt.Errorf("unknown file: %v", err)
         }
         file, err := os.OpenFile(EmailSimulator, os.O_APPEND|os.O_WRONLY, 0660)
         if err != nil {
-            LoggerError.Println(err)
-            return
+            return err
         }
         defer file.Close()
         writer := bufio.NewWriter(file)
         _, err = writer.WriteString(writeLine)
         if err != nil {
-            LoggerError.Println(err)
-            return
+            return err
         }
-        writer.Flush()
+        return writer.Flush()
     }
+    return nil
 }
 
 // File is a type of settings for a watched file.
 type File struct {
     Log string                `json:"file"`
     Pattern string            `json:"pattern"`
+    IgnoreCase bool           `json:"ignore_case"`
+    WholeWord bool            `json:"whole_word"`
     Boundary uint64           `json:"boundary"`
     Increase bool             `json:"increase"`
     Emails []string           `json:"emails"`
     Limit uint64              `json:"limit"`
     Period uint64             `json:"period"`
+    Severity string           `json:"severity"`
+    SeverityRules []SeverityRule  `json:"severity_rules"`
+    Patterns []SeverityPattern  `json:"patterns"`
+    Delivery string           `json:"delivery"`
+    Normalize bool            `json:"normalize"`
+    CountOnly bool            `json:"count_only"`
+    SubjectTemplate string    `json:"subject"`
+    Notifiers []string        `json:"notifiers"`
+    ZeroByte string           `json:"zero_byte"`
+    ContextBufferLines int    `json:"context_buffer_lines"`
+    WatchIntegrity bool       `json:"watch_integrity"`
+    Archived []string         `json:"archived"`
+    Follow bool               `json:"follow"`
+    Periods []PeriodLimit     `json:"periods"`
+    ReadTimeout uint64        `json:"read_timeout"`
+    SuppressWindow uint64     `json:"suppress_window"`
+    MessageTemplate string    `json:"message_template"`
+    LogURL string             `json:"log_url"`
+    Cooldown uint64           `json:"cooldown"`
+    FromEnd bool              `json:"from_end"`
+    RescanAfterSuppress bool  `json:"rescan_after_suppress"`
+    PollInterval uint64       `json:"poll_interval"`
+    Format string             `json:"format"`
+    Field string              `json:"field"`
+    FieldPattern string       `json:"field_pattern"`
+    Burst uint64              `json:"burst"`
+    EscalateAfter uint64      `json:"escalate_after"`
+    EscalateEmails []string   `json:"escalate_emails"`
+    Context uint64            `json:"context"`
+    Dedup bool                `json:"dedup"`
+    MaxLines uint64           `json:"max_lines"`
+    AttachReport bool         `json:"attach_report"`
+    AttachMaxSize int64       `json:"attach_max_size"`
+    DecayPeriod uint64        `json:"decay_period"`
     RgPattern *regexp.Regexp  // regexp expression from the pattern
     Pos uint64                // file posision after last check
+    Offset int64              // file offset in bytes after last check
     LogStart time.Time        // time of logger start
     Granularity uint64        // number of a period after last check
     Found uint64              // found lines by the Pattern
     Counter uint64            // cases counter for time period
     ExtBoundary uint64        // extended boundary value if Increase is set
+    Severities map[string]uint64  // found lines by severities for time period
+    LastSeverity string       // severity of last notification
+    LastCheck time.Time       // time of last check
+    prevCheck time.Time       // time of previous check
+    Fingerprints map[string]uint64  // found lines by fingerprints for time period
+    Suppressed uint64         // notifications suppressed as repeated ones
+    ParseErrors uint64        // lines without JSON object or its field in json format
+    Consecutive uint64        // consecutive notifications of the current period
+    startSize int64           // file size on start
+    startInode uint64         // file inode on start
+    restored bool             // state is loaded from the back-end
+    totals FileTotals         // counters since the first check, they are saved by the back-end
+    context *lineRing         // recent scanned lines
+    integrity hash.Hash       // hash of already read content
+    archived bool             // archived files are checked
+    reading int32             // a check with read timeout is running
+    moved int32               // the file was moved, its position is reset by the next check
+    lastHash string           // hash of last notified matched lines
+    lastNotified time.Time    // time of last not suppressed notification
+    lastSent time.Time        // time of last sent notification
+    lastDecay time.Time       // time of last decay of the extended boundary
+    burst uint64              // matched lines of the notified burst
+    escalation uint64         // consecutive number of the escalated notification
+    attachment string         // full report of the notified check if it's truncated
+    message *template.Template  // parsed MessageTemplate
     service *Service          // backward reference to service name
 }
 
+// SeverityRule is a rule to assign a severity to a matched line.
+type SeverityRule struct {
+    Match string     `json:"match"`
+    Severity string  `json:"severity"`
+    rgMatch *regexp.Regexp
+}
+
 // Service is a type of settings for a watched service.
 type Service struct {
-    Name string   `json:"name"`
-    Files []File  `json:"files"`
+    Name string     `json:"name"`
+    Files []File    `json:"files"`
+    After []string  `json:"after"`
+    Notifiers []string  `json:"notifiers"`
+    DigestInterval uint64  `json:"digest_interval"`
+    Emails []string     `json:"emails"`
 }
 
 // Config is main configuration settings.
 type Config struct {
     Path string
-    Sender map[string]string  `json:"sender"`
-    Observed []Service        `json:"observed"`
-    Storage string            `json:"storage"`
+    Sender map[string]string     `json:"sender"`
+    SenderKeyFile string         `json:"sender_key_file"`
+    Observed []Service           `json:"observed"`
+    Defaults File                `json:"defaults"`
+    Storage string               `json:"storage"`
+    StorageAddr string           `json:"storage_addr"`
+    StoragePassword string       `json:"storage_password"`
+    StorageDB int                `json:"storage_db"`
+    StorageTTL uint64            `json:"storage_ttl"`
+    MaxRecipientsPerMessage int  `json:"max_recipients_per_message"`
+    API string                   `json:"api"`
+    QuietHours *QuietHours       `json:"quiet_hours"`
+    Quiet []MaintenanceWindow    `json:"quiet"`
+    StatsTemplateText string     `json:"stats_template"`
+    StatsTemplateFile string     `json:"stats_template_file"`
+    StatsInterval int64          `json:"stats_interval"`
+    GlobInterval uint64          `json:"glob_interval"`
+    Notifiers map[string]Notifier  `json:"-"`
+    Slack map[string]string      `json:"slack"`
+    Chat map[string]string       `json:"chat"`
+    Syslog map[string]string     `json:"syslog"`
+    Exec *ExecSettings           `json:"exec"`
+    Webhook *WebhookSettings     `json:"webhook"`
+    ReloadResetDedup bool        `json:"reload_reset_dedup"`
+    RescanOnPatternChange bool   `json:"rescan_on_pattern_change"`
+    PersistState bool            `json:"persist_state"`
+    StateFile string             `json:"state_file"`
+    Snapshot string              `json:"snapshot"`
+    AllowInvalidEmails bool      `json:"allow_invalid_emails"`
+    DeadLetterMaxAge uint64      `json:"dead_letter_max_age"`
+    DeadLetterMaxSize int        `json:"dead_letter_max_size"`
+    Spool string                 `json:"spool"`
+    SpoolMaxSize int             `json:"spool_max_size"`
+    SpoolInterval uint64         `json:"spool_interval"`
+    Audit string                 `json:"audit"`
+    AuditMaxSize int64           `json:"audit_max_size"`
+    Hostname string              `json:"hostname"`
+    Environment string           `json:"environment"`
+    Preamble string              `json:"preamble"`
+    Sanitize *Sanitize           `json:"sanitize"`
+    DigestInterval uint64        `json:"digest_interval"`
+    DuplicateWindow int64        `json:"duplicate_window"`
+    MessageTemplate string       `json:"message_template"`
+    message *template.Template
 }
 
 // MemoryBackend is a type for the implementation of memory storage methods.
+// Positions are imported from Snapshot file by the first start
+// and exported to it by every close if it's set.
 type MemoryBackend struct {
     Name string
     Active bool
+    Snapshot string
+    positions map[string]FileState
+    mutex sync.Mutex
+    imported bool
+}
+
+// ConfigError is an error of a rejected configuration during reload.
+type ConfigError struct {
+    Err error
+}
+
+func (e *ConfigError) Error() string {
+    return fmt.Sprintf("new configuration is rejected: %v", e.Err)
 }
 
 // LogChecker is a main object for logging.
@@ -153,7 +329,49 @@ type LogChecker struct {
     Backend Backender
     Running time.Time
     InWork int
+    Delivery DeliveryStats
+    notifier Notifier
     mutex sync.RWMutex
+    quietMutex sync.Mutex
+    quietQueue []queuedAlert
+    maintenanceMutex sync.Mutex
+    maintenanceSummaries map[string]*maintenanceSummary
+    reload chan bool
+    events chan Event
+    syslog *SyslogNotifier
+    syslogMutex sync.Mutex
+    exec *ExecNotifier
+    execMutex sync.Mutex
+    webhookBatch *webhookBatcher
+    webhookMutex sync.Mutex
+    deadMutex sync.Mutex
+    deadLetters []DeadLetter
+    deadDropped uint64
+    spoolMutex sync.Mutex
+    spoolQueue []DeadLetter
+    spoolDone chan bool
+    auditMutex sync.Mutex
+    smtpConns smtpPool  // persistent SMTP connection
+    inflight sync.WaitGroup  // running notifications and email retries
+    notifyMutex sync.Mutex
+    notifyCtx context.Context  // parent context of sent notifications, Stop cancels it
+    notifyCancel context.CancelFunc
+    watchCtx context.Context  // context of started watchers, Stop cancels it
+    checkMutex sync.RWMutex   // checks change states under its read lock, Stop waits them
+    globbed map[string]int    // watched files of glob patterns, logger.mutex protects it
+    watchCancel context.CancelFunc
+    stopMutex sync.Mutex
+    background sync.WaitGroup  // goroutines of quiet hours, maintenance and statistics
+    statsMutex sync.Mutex
+    published map[*File]fileCounters  // values of watched files by their last checks
+    metrics Metrics
+    digestMutex sync.RWMutex
+    digestQueue chan digestAlert
+    digestDone chan bool
+    sentMutex sync.Mutex
+    sent map[string]sentNotification  // last notifications by notifiers and recipients
+    decisionMutex sync.Mutex
+    decisions map[string]Decision
 }
 
 // String service name.
@@ -161,6 +379,20 @@ func (s *Service) String() string {
     return s.Name
 }
 
+// FileEmails returns effective recipients of the file,
+// service's emails are used if the file doesn't have own ones.
+func (s *Service) FileEmails(f *File) []string {
+    if (len(f.Emails) == 0) && (s != nil) {
+        return s.Emails
+    }
+    return f.Emails
+}
+
+// recipients returns effective recipients of the file.
+func (f *File) recipients() []string {
+    return f.service.FileEmails(f)
+}
+
 // Base returns the last element of log file path.
 func (f *File) Base() string {
     return filepath.Base(f.Log)
@@ -171,73 +403,363 @@ func (f *File) String() string {
     return f.Log
 }
 
+// Expression returns a regular expression of the Pattern (FieldPattern
+// for json format) with IgnoreCase and WholeWord options.
+func (f *File) Expression() string {
+    return f.expression(f.linePattern())
+}
+
+// expression applies IgnoreCase and WholeWord options to the pattern.
+func (f *File) expression(expr string) string {
+    if f.WholeWord {
+        expr = `\b(?:` + expr + `)\b`
+    }
+    if f.IgnoreCase {
+        expr = "(?i)" + expr
+    }
+    return expr
+}
+
 // Validate checks that File is correct: has absolute path and exists.
 func (f *File) Validate() error {
+    return f.validate(true)
+}
+
+// validate checks file settings, the file is checked on disk if stat is true.
+func (f *File) validate(stat bool) error {
     var err error
     if !filepath.IsAbs(f.Log) {
         return fmt.Errorf("path should be absolute")
     }
-    _, err = os.Stat(f.Log);
-    if err != nil {
+    if f.IsGlob() {
+        if err = f.validateGlob(stat); err != nil {
+            return err
+        }
+    } else if stat {
+        if _, err = os.Stat(f.Log); err != nil {
+            return err
+        }
+    }
+    if err = f.validateFormat(); err != nil {
         return err
     }
-    if len(f.Pattern) == 0 {
-        return fmt.Errorf("pattern should not be empty")
+    f.RgPattern = nil
+    switch {
+        case len(f.linePattern()) > 0:
+            if f.RgPattern, err = regexp.Compile(f.Expression()); err != nil {
+                return err
+            }
+        case len(f.Patterns) == 0:
+            return fmt.Errorf("pattern should not be empty")
     }
-    f.RgPattern, err = regexp.Compile(f.Pattern)
-    if err != nil {
+    if err := f.validatePatterns(); err != nil {
         return err
     }
-    return nil
+    if len(f.Severity) == 0 {
+        f.Severity = SeverityWarning
+    }
+    if _, ok := severityLevels[f.Severity]; !ok {
+        return fmt.Errorf("unknown severity [%v]", f.Severity)
+    }
+    if (f.ZeroByte != "") && (f.ZeroByte != ZeroByteWatch) && (f.ZeroByte != ZeroByteSkip) {
+        return fmt.Errorf("unknown zero_byte mode [%v]", f.ZeroByte)
+    }
+    if !validDelivery(f.Delivery) {
+        return fmt.Errorf("unknown delivery mode [%v]", f.Delivery)
+    }
+    for _, pattern := range f.Archived {
+        if !filepath.IsAbs(pattern) {
+            return fmt.Errorf("archived path should be absolute [%v]", pattern)
+        }
+        if _, err := filepath.Match(pattern, ""); err != nil {
+            return fmt.Errorf("archived pattern error [%v]: %v", pattern, err)
+        }
+    }
+    if (f.ContextBufferLines < 0) || (f.ContextBufferLines > MaxContextLines) {
+        return fmt.Errorf("context_buffer_lines should be in range [0, %v]", MaxContextLines)
+    }
+    if f.Context > uint64(MaxContextLines) {
+        return fmt.Errorf("context should be in range [0, %v]", MaxContextLines)
+    }
+    for i := range f.SeverityRules {
+        rule := &f.SeverityRules[i]
+        if _, ok := severityLevels[rule.Severity]; !ok {
+            return fmt.Errorf("unknown severity rule severity [%v]", rule.Severity)
+        }
+        rule.rgMatch, err = regexp.Compile(rule.Match)
+        if err != nil {
+            return fmt.Errorf("severity rule error [%v]: %v", rule.Match, err)
+        }
+    }
+    if err := f.validateLogURL(); err != nil {
+        return err
+    }
+    if err := f.validateEscalation(); err != nil {
+        return err
+    }
+    if err := f.validateAttach(); err != nil {
+        return err
+    }
+    if err := f.validateDecay(); err != nil {
+        return err
+    }
+    f.message = nil
+    if len(f.MessageTemplate) > 0 {
+        if f.message, err = parseMessage(f.MessageTemplate); err != nil {
+            return fmt.Errorf("message_template error: %v", err)
+        }
+    }
+    return f.validatePeriods()
 }
 
-// Watch implements a file watcher.
-func (f *File) Watch(group *sync.WaitGroup, finish chan bool, logger *LogChecker) {
-    watcher, err := inotify.NewWatcher()
+// LineSeverity returns a severity of a matched line,
+// first suitable severity rule is used or File.Severity by default.
+func (f *File) LineSeverity(line string) string {
+    for _, rule := range f.SeverityRules {
+        if (rule.rgMatch != nil) && rule.rgMatch.MatchString(line) {
+            return rule.Severity
+        }
+    }
+    if len(f.Severity) == 0 {
+        return SeverityWarning
+    }
+    return f.Severity
+}
+
+// MaxSeverity returns the highest severity of two values.
+func MaxSeverity(a, b string) string {
+    if severityLevels[b] > severityLevels[a] {
+        return b
+    }
+    return a
+}
+
+// Watch implements a file watcher, it returns when ctx is done.
+// If File.PollInterval is set, the file is also checked every interval
+// when its modification time or size is changed, it's used for file
+// systems without reliable events (NFS).
+func (f *File) Watch(ctx context.Context, group *sync.WaitGroup, logger *LogChecker) {
+    var poll <-chan time.Time
+    watcher, err := newWatcher()
     if err != nil {
         LoggerError.Printf("can't create new watcher: %v - %v\n", f.Base(), err)
+        logger.emitFile(EventWatcherError, f, err)
         return
     }
-    if err = watcher.AddWatch(f.Log, watcherMask); err != nil {
+    // a re-created watcher is closed too
+    defer func() {
+        watcher.Close()
+    }()
+    ops := watcherOps
+    if f.Follow {
+        ops |= followOps
+    }
+    if err = watcher.Add(f.Log, ops); err != nil {
         LoggerError.Printf("can't add new watcher: %v - %v\n", f.Base(), err)
+        logger.emitFile(EventWatcherError, f, err)
         return
     }
+    // archived files and lines appended to an empty file before the watcher start
+    if len(f.Archived) > 0 {
+        if err := f.Check(group, logger); err != nil {
+            LoggerError.Printf("[%v]: %v", f.String(), err)
+        }
+    } else if f.startSize == 0 {
+        if info, err := os.Stat(f.Log); (err == nil) && (info.Size() > 0) {
+            if err := f.Check(group, logger); err != nil {
+                LoggerError.Printf("[%v]: %v", f.String(), err)
+            }
+        }
+    }
+    if f.PollInterval > 0 {
+        ticker := time.NewTicker(time.Duration(f.PollInterval) * time.Second)
+        defer ticker.Stop()
+        poll = ticker.C
+    }
+    modTime, size := f.stat()
     for {
         select {
-            case <-finish:
+            case <-ctx.Done():
                 return
-            case event := <-watcher.Event:
-                if (event.Mask & inotify.IN_ATTRIB) != 0 {
+            case <-poll:
+                t, n := f.stat()
+                if t.Equal(modTime) && (n == size) {
+                    continue
+                }
+                modTime, size = t, n
+                LoggerDebug.Printf("file is changed, poll check: %v", f.Base())
+                if err := f.Check(group, logger); err != nil {
+                    LoggerError.Printf("[%v]: %v", f.String(), err)
+                }
+            case event := <-watcher.Events():
+                if event.Has(WatchAttrib | followOps) {
                     LoggerInfo.Printf("file was deleted or moved[%v]: %v\n", event, f.Base())
-                    watcher, err = IsMoved(f.Log, watcher)
+                    var moved Watcher
+                    if f.Follow {
+                        moved, err = f.follow(ctx, watcher)
+                    } else {
+                        moved, err = IsMoved(f.Log, watcher)
+                    }
                     if err != nil {
                         LoggerError.Printf("re-creation watcher error: %v\n", err)
+                        logger.emitFile(EventWatcherError, f, err)
                         return
                     }
-                    f.Pos = 0
+                    if moved == nil {
+                        return
+                    }
+                    // the old watcher is closed by IsMoved
+                    watcher = moved
+                    // the watcher is stopped while the file was waited
+                    if ctx.Err() != nil {
+                        return
+                    }
+                    // the state can be changed by an abandoned check
+                    atomic.StoreInt32(&f.moved, 1)
                 }
+                modTime, size = f.stat()
                 if err := f.Check(group, logger); err != nil {
                     LoggerError.Printf("[%v]: %v", f.String(), err)
                 }
-            case err := <-watcher.Error:
+            case err := <-watcher.Errors():
                 LoggerError.Printf("file watcher error: %v\n", err)
+                logger.emitFile(EventWatcherError, f, err)
                 return
         }
     }
 }
 
+// stat returns modification time and size of the file,
+// zero values are returned if the file is not available.
+func (f *File) stat() (time.Time, int64) {
+    info, err := os.Stat(f.Log)
+    if err != nil {
+        return time.Time{}, 0
+    }
+    return info.ModTime(), info.Size()
+}
+
+// initPosition prepares a read position before the watcher start,
+// an empty file is read from the beginning, existing lines are skipped
+// if FromEnd is set. It returns true if the file should be skipped.
+func (f *File) initPosition() bool {
+    f.startSize, f.startInode = -1, 0
+    info, err := os.Stat(f.Log)
+    if err != nil {
+        return false
+    }
+    f.startSize, f.startInode = info.Size(), fileInode(info)
+    if f.startSize == 0 {
+        if f.ZeroByte == ZeroByteSkip {
+            return true
+        }
+        f.Pos, f.Offset = 0, 0
+    } else if f.FromEnd {
+        if err := f.seekEnd(); err != nil {
+            LoggerError.Printf("can't seek to the end [%v]: %v", f.Base(), err)
+        }
+    }
+    return false
+}
+
+// seekEnd sets a read position after the last complete line of the file,
+// so only appended lines are checked.
+func (f *File) seekEnd() error {
+    var (
+        lines uint64
+        offset int64
+        scanner *bufio.Scanner
+    )
+    file, err := os.Open(f.Log)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    compressed, err := isGzip(file)
+    if err != nil {
+        return err
+    }
+    if compressed {
+        reader, err := gzip.NewReader(file)
+        if err != nil {
+            return err
+        }
+        defer reader.Close()
+        info, err := file.Stat()
+        if err != nil {
+            return err
+        }
+        scanner, offset = bufio.NewScanner(reader), info.Size()
+    } else {
+        scanner = bufio.NewScanner(file)
+        scanner.Split(scanLines(&offset))
+    }
+    for scanner.Scan() {
+        lines++
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    f.Pos, f.Offset = lines, offset
+    LoggerDebug.Printf("existing lines are skipped [%v]: %v", f.Base(), f.Pos)
+    return nil
+}
+
 // Duration identifies user's time period after watcher start.
 func (f *File) Duration() uint64 {
     return uint64(time.Since(f.LogStart).Seconds()) / f.Period
 }
 
 // Check validates conditions before sending email notifications.
+// New lines are read from the last byte offset, an incomplete last line
+// is not consumed, so a line written by parts is matched once when it's done.
+// If File.ReadTimeout is set, the check is abandoned after the timeout
+// and next checks are failed until it's finished. An abandoned check
+// owns the file state, so a move of the file is applied by the next check,
+// and it doesn't change the state and doesn't notify after the stop.
 func (f *File) Check(group *sync.WaitGroup, logger *LogChecker) error {
+    if f.ReadTimeout == 0 {
+        return f.check(context.Background(), group, logger)
+    }
+    ctx := logger.watchCtx
+    if ctx == nil {
+        ctx = context.Background()
+    }
+    if !atomic.CompareAndSwapInt32(&f.reading, 0, 1) {
+        return fmt.Errorf("previous check is still running [%v]", f.Base())
+    }
+    group.Add(1)
+    defer group.Done()
+    result := make(chan error, 1)
+    go func() {
+        defer atomic.StoreInt32(&f.reading, 0)
+        // an abandoned check should not block the process stop
+        result <- f.check(ctx, &sync.WaitGroup{}, logger)
+    }()
+    timeout := time.Duration(f.ReadTimeout) * time.Second
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+    select {
+        case err := <-result:
+            return err
+        case <-timer.C:
+            return fmt.Errorf("read timeout %v is exceeded [%v]", timeout, f.Base())
+    }
+}
+
+// check reads new lines of the file and sends notifications,
+// it's interrupted before state changes if ctx is done.
+func (f *File) check(ctx context.Context, group *sync.WaitGroup, logger *LogChecker) error {
     var (
         counter, clines uint64
         msgLines []string
-        notifier Notifier
+        severity, firstLine string
     )
+    severities := map[string]uint64{}
+    fingerprints := map[string]uint64{}
+    around := &matchContext{size: int(f.Context)}
+    repeats := lineRepeats{}
+    attachment := &reportAttachment{limit: f.attachMaxSize()}
     group.Add(1)
     LoggerDebug.Printf("check: %v\n", f.Base())
     defer func() {
@@ -245,65 +767,289 @@ func (f *File) Check(group *sync.WaitGroup, logger *LogChecker) error {
         group.Done()
     }()
 
+    // the position of a moved file is reset here, so a check started
+    // before the move and abandoned by the timeout keeps the old one
+    if atomic.CompareAndSwapInt32(&f.moved, 1, 0) {
+        f.Pos, f.Offset = 0, 0
+        f.resetSuppression()
+    }
     file, err := os.Open(f.Log)
     if err != nil {
         return err
     }
     defer file.Close()
+    info, err := file.Stat()
+    if err != nil {
+        return err
+    }
+    if !logger.lockCheck(ctx) {
+        return ctx.Err()
+    }
+    // a state of the file checked without the watcher is loaded by the first check
+    if !f.restored {
+        f.startSize, f.startInode = info.Size(), fileInode(info)
+        logger.restorePosition(f)
+    }
+    if info.Size() < f.Offset {
+        LoggerInfo.Printf("file was truncated or rotated, position is reset [%v]\n", f.Base())
+        logger.resetPosition(f)
+    }
+    logger.checkMutex.RUnlock()
 
-    // read the file line by line
-    scanner := bufio.NewScanner(file)
-    counter = 0
-    for scanner.Scan() {
-        clines++
-        if f.Pos < clines {
-            if line := scanner.Text(); len(line) > 0 {
-                if f.RgPattern.MatchString(line) {
-                    switch {
-                        case counter < (maxMsgLines + 1):
-                            msgLines = append(msgLines, fmt.Sprintf("%v: %v", clines, line))
-                        case counter == (maxMsgLines + 1):
-                            msgLines = append(msgLines, "...")
+    compressed, err := isGzip(file)
+    if err != nil {
+        return err
+    }
+    startPos, startOffset := f.Pos, f.Offset
+    if f.WatchIntegrity && !compressed {
+        if err := f.checkIntegrity(file, logger); err != nil {
+            return err
+        }
+    }
+    // addLines adds report lines, their number is limited by File.MaxLines
+    maxLines := f.maxLines()
+    addLines := func(lines []string) {
+        for _, line := range lines {
+            if f.AttachReport {
+                attachment.add(line)
+            }
+            switch {
+                case uint64(len(msgLines)) < maxLines:
+                    msgLines = append(msgLines, line)
+                case uint64(len(msgLines)) == maxLines:
+                    msgLines = append(msgLines, "...")
+            }
+        }
+    }
+    // match handles a new line, source is set for archived files
+    match := func(line, source string, number uint64) {
+        if len(line) == 0 {
+            return
+        }
+        report := logger.Cfg.Sanitize.Line(line)
+        f.pushContext(report)
+        lineSeverity, matched := f.matchLine(line)
+        if !matched {
+            if !f.CountOnly {
+                addLines(around.skip(reportLine{source, number, report}))
+            }
+            return
+        }
+        if counter == 0 {
+            firstLine = report
+        }
+        fingerprints[f.Fingerprint(line)]++
+        severities[lineSeverity]++
+        severity = MaxSeverity(severity, lineSeverity)
+        switch {
+            case f.CountOnly:
+                // lines content is never reported
+            case f.Dedup && repeats.repeat(line):
+                // the first copy of the line is already handled
+            default:
+                rl := reportLine{source, number, report}
+                addLines(around.match(rl))
+                if f.Dedup {
+                    index, attached := len(msgLines) - 1, len(attachment.lines) - 1
+                    if (index < 0) || (msgLines[index] != rl.String()) {
+                        index = -1
                     }
-                    counter++
+                    if (attached < 0) || (attachment.lines[attached] != rl.String()) {
+                        attached = -1
+                    }
+                    repeats.add(line, index, attached)
                 }
-            }
+        }
+        counter++
+    }
+    if !f.archived {
+        f.sweepArchived(match)
+        f.archived = true
+    }
+    // read new lines from the last position
+    var scanner *bufio.Scanner
+    offset := f.Offset
+    if compressed {
+        // compressed file is read from the beginning, known lines are skipped
+        reader, err := gzip.NewReader(file)
+        if err != nil {
+            return err
+        }
+        defer reader.Close()
+        scanner, offset, clines = bufio.NewScanner(reader), info.Size(), 0
+    } else {
+        if _, err = file.Seek(f.Offset, os.SEEK_SET); err != nil {
+            return err
+        }
+        scanner, clines = bufio.NewScanner(file), f.Pos
+        if f.Offset == 0 {
+            // a position without its offset, known lines are skipped
+            clines = 0
+        }
+        scanner.Split(scanLines(&offset))
+    }
+    for scanner.Scan() {
+        clines++
+        if clines > f.Pos {
+            match(scanner.Text(), "", clines)
         }
     }
     err = scanner.Err()
     if err != nil {
         return err
     }
+    // the process is stopped during the reading
+    if !logger.lockCheck(ctx) {
+        return ctx.Err()
+    }
+    defer logger.checkMutex.RUnlock()
+    repeats.annotate(msgLines, attachment.lines)
     curPeriod, sent := f.Duration(), false
     if curPeriod != f.Granularity {
         f.Granularity = curPeriod
         f.Found = 0
         f.Counter = 0
+        f.Consecutive = 0
+        f.Severities = nil
+        f.Fingerprints = nil
         LoggerDebug.Printf("period was reset [%v]: %v", f.Base(), f.Granularity)
     }
-    f.Pos = clines
+    if f.WatchIntegrity && !compressed {
+        if err := f.updateIntegrity(file, offset); err != nil {
+            return err
+        }
+    }
+    if clines > startPos {
+        f.totals.Lines += clines - startPos
+    }
+    f.Pos, f.Offset = clines, offset
     f.Found += counter
+    f.prevCheck, f.LastCheck = f.LastCheck, time.Now()
+    if f.Severities == nil {
+        f.Severities = map[string]uint64{}
+    }
+    for k, v := range severities {
+        f.Severities[k] += v
+    }
+    f.addFingerprints(fingerprints)
+    f.resetPeriods(periodNow())
 
-    if (f.Found >= f.ExtBoundary) && (f.Counter <= f.Limit) {
-        if f.Increase {
-            f.ExtBoundary = f.ExtBoundary * 2
+    decision := f.decide(counter)
+    notify := len(decision.Action) == 0
+    if window, active := logger.Cfg.maintenance(decision.Time); notify && active {
+        logger.suppressMaintenance(f, MaxSeverity(severity, f.Severity))
+        decision.Action = DecisionMaintenance
+        decision.Reason = fmt.Sprintf("maintenance window %v is active", window)
+        LoggerInfo.Printf("notification is skipped by maintenance window [%v]: %v\n", f.Base(), window)
+    } else if remain, active := f.cooldown(decision.Time); notify && active && !decision.Burst {
+        remain = remain.Round(time.Second)
+        decision.Action = DecisionCooldown
+        decision.Reason = fmt.Sprintf("cooldown %v seconds is not elapsed, %v left", f.Cooldown, remain)
+        LoggerDebug.Printf("notification is delayed by cooldown [%v]: %v left", f.Base(), remain)
+    } else if notify && f.isSuppressed(linesHash(fingerprints), time.Now()) {
+        decision.Action = DecisionSuppressed
+        decision.Reason = fmt.Sprintf("the same lines were notified less than %v seconds ago", f.SuppressWindow)
+        LoggerInfo.Printf("repeated notification is suppressed [%v]: %v in total\n", f.Base(), f.Suppressed)
+    } else if notify {
+        if len(severity) == 0 {
+            // no new lines, the period's found items are reported
+            severity = f.Severity
+        }
+        f.LastSeverity = severity
+        if f.CountOnly {
+            msgLines = []string{"Lines are not included (count only mode)."}
+        }
+        if decision.Burst {
+            f.burst = counter
+        }
+        f.escalation = f.escalationNumber()
+        if f.AttachReport && !f.CountOnly && (uint64(len(msgLines)) > maxLines) {
+            f.attachment = attachment.String()
         }
-        if debug {
-            notifier = &debugSender{"debugSender"}
+        message := logger.fileMessage(f, msgLines, severity)
+        subject := logger.fileSubject(f, firstLine, f.Found, severity)
+        if subject == DefaultSubject {
+            subject = logger.Cfg.defaultSubject()
+        }
+        subject = f.severitySubject(subject, severity)
+        if decision.Burst {
+            subject = SanitizeSubject("[BURST] " + subject)
+            f.burst = 0
+        }
+        recipients := f.escalationRecipients(f.severityRecipients(severity))
+        err := logger.notifyFile(f, subject, message, severity)
+        f.escalation, f.attachment = 0, ""
+        if err != nil {
+            // the same lines are not suppressed by the next check
+            f.lastHash = ""
+            decision.Action = DecisionFailed
+            decision.Reason = fmt.Sprintf("notification is not delivered: %v", err)
         } else {
-            notifier = logger
+            if f.Increase && !decision.Burst {
+                f.ExtBoundary = f.ExtBoundary * 2
+            }
+            logger.incrementCounter(f)
+            f.Consecutive++
+            f.totals.Sent++
+            f.countPeriods()
+            f.lastSent = decision.Time
+            logger.metrics.addNotification(f)
+            logger.recordNotification(f, recipients, decision.Time)
+            sent = true
+            decision.Action = DecisionSent
+            decision.Reason = fmt.Sprintf("found %v lines reach boundary %v", f.Found, decision.Boundary)
+            if decision.Burst {
+                decision.Reason = fmt.Sprintf("burst of %v lines reaches %v", counter, f.Burst)
+            }
+            decision.Quiet = (logger.Cfg.QuietHours != nil) && logger.Cfg.QuietHours.Queued(severity, time.Now())
         }
-        message := fmt.Sprintf("%v\n\nReport for \"%v\" service (%v new items): %v\n%v\n\n--\nBR, LogChecker", emailMsg, f.service, f.Found, f.Log, strings.Join(msgLines, "\n"))
-        go notifier.Notify(message, f.Emails)
-        f.Counter++
-        sent = true
     } else {
-        f.ExtBoundary = f.Boundary
+        f.decayBoundary(decision.Time)
+    }
+    if decision.suppressed() {
+        f.totals.Suppressed++
     }
+    if f.RescanAfterSuppress && decision.suppressed() {
+        f.rewind(startPos, startOffset, counter, severities, fingerprints)
+        decision.Reason += ", lines will be checked again"
+    } else if counter > 0 {
+        logger.metrics.addMatches(f, counter)
+        f.totals.Matches += counter
+    }
+    decision.Counter = f.Counter
+    logger.setDecision(decision)
     LoggerDebug.Printf("check [%v], sent=%v, found=%v, boundary=%v, counter=%v, limit=%v", f.Base(), sent, f.Found, f.ExtBoundary, f.Counter, f.Limit)
+    logger.savePosition(f, info)
+    logger.recordCheck(f, counter, f.LastCheck)
+    logger.publishStats(f)
     return nil
 }
 
+// lockCheck prevents the stop from closing the storage and notifiers
+// while a check changes the file state, it returns false without
+// the lock if ctx is done, e.g. for a check abandoned before the stop.
+func (logger *LogChecker) lockCheck(ctx context.Context) bool {
+    logger.checkMutex.RLock()
+    if ctx.Err() != nil {
+        logger.checkMutex.RUnlock()
+        return false
+    }
+    return true
+}
+
+// scanLines is a split function of complete lines, it counts
+// consumed bytes. An incomplete last line is read during the next check.
+func scanLines(consumed *int64) bufio.SplitFunc {
+    return func(data []byte, atEOF bool) (int, []byte, error) {
+        if bytes.IndexByte(data, '\n') < 0 {
+            return 0, nil, nil
+        }
+        advance, token, err := bufio.ScanLines(data, atEOF)
+        *consumed += int64(advance)
+        return advance, token, err
+    }
+}
+
 // String of MemoryBackend returns a name of the logger back-end.
 func (bk *MemoryBackend) String() string {
     return fmt.Sprintf("Backend: %v", bk.Name)
@@ -316,16 +1062,50 @@ func (cfg Config) String() string {
         // services[i] = fmt.Sprintf("%v", service.Name)
         files := make([]string, len(service.Files))
         for j, file := range service.Files {
-            files[j] = file.Base()
+            files[j] = fmt.Sprintf("%v [%v]", file.Base(), strings.Join(service.FileEmails(&file), ", "))
         }
         services[i] = fmt.Sprintf("%v: %v", service.Name, strings.Join(files, ", "))
     }
-    return fmt.Sprintf("Config [%v]: %v\n\t%v\n", cfg.Path, cfg.Storage, strings.Join(services, "\n\t"))
+    return fmt.Sprintf("Config [%v]: %v, host %v\n\t%v\n", cfg.Path, cfg.storageName(), cfg.HostTag(), strings.Join(services, "\n\t"))
+}
+
+// Describe returns a human-readable summary of the configuration,
+// every file is validated separately, so all incorrect files are reported.
+func (logger *LogChecker) Describe() string {
+    logger.mutex.RLock()
+    defer logger.mutex.RUnlock()
+    cfg := &logger.Cfg
+    lines := []string{
+        fmt.Sprintf("Config: %v", cfg.Path),
+        fmt.Sprintf("Sender: %v (%v)", cfg.Sender["addr"], senderFrom(cfg.Sender)),
+        fmt.Sprintf("Storage: %v", cfg.storageName()),
+    }
+    for _, serv := range cfg.Observed {
+        lines = append(lines, fmt.Sprintf("Service \"%v\"", serv.Name))
+        if len(serv.After) > 0 {
+            lines = append(lines, fmt.Sprintf("  after: %v", strings.Join(serv.After, ", ")))
+        }
+        for _, f := range serv.Files {
+            status := "OK"
+            if err := f.Validate(); err != nil {
+                status = fmt.Sprintf("ERROR: %v", err)
+            }
+            lines = append(lines,
+                fmt.Sprintf("  %v: %v", f.Log, status),
+                fmt.Sprintf("    pattern \"%v\", severity=%v, boundary=%v, period=%v, limit=%v", f.linePattern(), f.Severity, f.Boundary, f.Period, f.Limit),
+                fmt.Sprintf("    emails: %v", strings.Join(serv.FileEmails(&f), ", ")),
+            )
+            for _, p := range f.Patterns {
+                lines = append(lines, fmt.Sprintf("    pattern \"%v\", severity=%v, emails: %v", p.Pattern, p.Severity, strings.Join(p.Emails, ", ")))
+            }
+        }
+    }
+    return strings.Join(lines, "\n") + "\n"
 }
 
 // New created new LogChecker object and returns its reference.
 func New() *LogChecker {
-    res := &LogChecker{}
+    res := &LogChecker{reload: make(chan bool, 1), events: make(chan Event, EventsBuffer)}
     res.Name = "LogChecker"
     return res
 }
@@ -395,65 +1175,414 @@ func (logger *LogChecker) RemoveService(serv *Service) error {
     return nil
 }
 
-// Validate checks the configuration.
-func (logger *LogChecker) Validate() error {
-    logger.mutex.RLock()
-    defer func() {
-        logger.mutex.RUnlock()
-    }()
+// ValidateOptions are options of a configuration validation.
+// SkipStat disables checks of files and a storage directory on disk.
+type ValidateOptions struct {
+    SkipStat bool
+}
+
+// ValidateConfig checks the configuration without LogChecker, it doesn't
+// change the configuration.
+func ValidateConfig(cfg Config, opts ValidateOptions) error {
+    sender := make(map[string]string, len(cfg.Sender))
+    for k, v := range cfg.Sender {
+        sender[k] = v
+    }
+    cfg.Sender = sender
+    _, err := validateConfig(&cfg, opts)
+    return err
+}
+
+// validateConfig checks the configuration and returns its backend,
+// the sender address is normalized. All found errors are joined.
+func validateConfig(cfg *Config, opts ValidateOptions) (Backender, error) {
+    var errs []error
     // check services
     services := map[string]bool{}
-    for _, serv := range logger.Cfg.Observed {
+    for _, serv := range cfg.Observed {
         _, ok := services[serv.Name]
         if ok {
-            return fmt.Errorf("service names should be unique [%v]", serv.Name)
+            errs = append(errs, fmt.Errorf("service names should be unique [%v]", serv.Name))
         }
         services[serv.Name] = true
+        for _, name := range serv.Notifiers {
+            if !cfg.hasNotifier(name) {
+                errs = append(errs, fmt.Errorf("service error [%v] unknown notifier [%v]", serv.Name, name))
+            }
+        }
+        for _, email := range serv.Emails {
+            if !IsEmail(email) {
+                errs = cfg.invalidEmail(errs, fmt.Errorf("service error [%v] invalid email [%v]", serv.Name, email))
+            }
+        }
         for _, f := range serv.Files {
-            if err := f.Validate(); err != nil {
-                return fmt.Errorf("file error [%v] %v", f.Log, err)
+            if err := f.validate(!opts.SkipStat); err != nil {
+                errs = append(errs, fmt.Errorf("file error [%v] %v", f.Log, err))
+            }
+            for _, name := range f.Notifiers {
+                if !cfg.hasNotifier(name) {
+                    errs = append(errs, fmt.Errorf("file error [%v] unknown notifier [%v]", f.Log, name))
+                }
+            }
+            emails := append(append([]string{}, f.Emails...), f.EscalateEmails...)
+            for _, p := range f.Patterns {
+                emails = append(emails, p.Emails...)
+            }
+            for _, email := range emails {
+                if !IsEmail(email) {
+                    errs = cfg.invalidEmail(errs, fmt.Errorf("service error [%v] file [%v] invalid email [%v]", serv.Name, f.Log, email))
+                }
+            }
+            f.service = &serv
+            if (len(f.recipients()) == 0) && (len(f.Patterns) == 0) && f.hasNotifier(EmailNotifier) {
+                errs = append(errs, fmt.Errorf("file error [%v] emails should not be empty", f.Log))
             }
         }
     }
+    if _, err := ServiceOrder(cfg.Observed); err != nil {
+        errs = append(errs, err)
+    }
     // check sender fields
-    mandatory := [4]string{"user", "password", "host", "addr"}
+    mandatory, err := senderFields(cfg.Sender)
+    if err != nil {
+        errs = append(errs, err)
+    }
     for _, field := range mandatory {
-        v, ok := logger.Cfg.Sender[field]
-        if !ok {
-            return fmt.Errorf("missing sender field [%v]", field)
+        v, ok := cfg.Sender[field]
+        switch {
+            case !ok:
+                errs = append(errs, fmt.Errorf("missing sender field [%v]", field))
+            case len(v) == 0:
+                errs = append(errs, fmt.Errorf("sender field can't be empty [%v]", field))
+        }
+    }
+    // empty host and addr are already reported as missing fields
+    if host := cfg.Sender["host"]; (len(host) > 0) && !IsHostname(host) {
+        errs = append(errs, fmt.Errorf("sender host is not a valid hostname [%v]", cfg.Sender["host"]))
+    }
+    if !validTLS(cfg.Sender["tls"]) {
+        errs = append(errs, fmt.Errorf("unknown sender tls mode [%v]", cfg.Sender["tls"]))
+    }
+    for _, name := range []string{"skip_verify", "insecure_skip_verify"} {
+        switch cfg.Sender[name] {
+            case "", "true", "false":
+            default:
+                errs = append(errs, fmt.Errorf("sender %v should be \"true\" or \"false\"", name))
+        }
+    }
+    if !validDelivery(cfg.Sender["delivery"]) {
+        errs = append(errs, fmt.Errorf("unknown sender delivery mode [%v]", cfg.Sender["delivery"]))
+    }
+    if !validFormat(cfg.Sender["format"]) {
+        errs = append(errs, fmt.Errorf("unknown sender format [%v]", cfg.Sender["format"]))
+    }
+    if _, _, err := retryPolicy(cfg.Sender); err != nil {
+        errs = append(errs, err)
+    }
+    if _, err := sendTimeout(cfg.Sender); err != nil {
+        errs = append(errs, err)
+    }
+    if _, err := smtpKeepAlive(cfg.Sender); err != nil {
+        errs = append(errs, err)
+    }
+    cfg.message = nil
+    if len(cfg.MessageTemplate) > 0 {
+        if cfg.message, err = parseMessage(cfg.MessageTemplate); err != nil {
+            errs = append(errs, fmt.Errorf("message_template error: %v", err))
         }
-        if len(v) == 0 {
-            return fmt.Errorf("sender field can't be empty [%v]", field)
+    }
+    if text := cfg.Sender["subject_template"]; len(text) > 0 {
+        if _, err := template.New("subject").Parse(text); err != nil {
+            errs = append(errs, fmt.Errorf("sender subject_template error: %v", err))
+        }
+    }
+    if len(cfg.Sender["addr"]) > 0 {
+        addr, err := SenderAddr(cfg.Sender["addr"])
+        switch {
+            case err != nil:
+                errs = append(errs, fmt.Errorf("sender addr is incorrect: %v", err))
+            case SenderDialCheck:
+                cfg.Sender["addr"] = addr
+                conn, err := net.DialTimeout("tcp", addr, DialTimeout)
+                if err != nil {
+                    errs = append(errs, fmt.Errorf("sender addr is unreachable: %v", err))
+                } else {
+                    conn.Close()
+                }
+            default:
+                cfg.Sender["addr"] = addr
         }
     }
     // check backend
     var backend Backender
-    switch logger.Cfg.Storage {
+    switch cfg.Storage {
         case "memory":
-            backend = &MemoryBackend{"Memory", true}
+            backend = &MemoryBackend{Name: "Memory", Active: true, Snapshot: cfg.Snapshot}
+        default:
+            switch {
+                case IsRedisStorage(cfg.Storage):
+                    redisBackend, err := cfg.newRedisBackend(!opts.SkipStat)
+                    if err != nil {
+                        errs = append(errs, fmt.Errorf("storage error: %v", err))
+                    } else {
+                        backend = redisBackend
+                    }
+                case IsSQLiteStorage(cfg.Storage):
+                    sqliteBackend, err := newSQLiteStorage(cfg.Storage, !opts.SkipStat)
+                    if err != nil {
+                        errs = append(errs, fmt.Errorf("storage error: %v", err))
+                    } else {
+                        backend = sqliteBackend
+                    }
+                case !filepath.IsAbs(cfg.Storage):
+                    errs = append(errs, fmt.Errorf("unknown backend"))
+                case opts.SkipStat:
+                    backend = &FileBackend{Name: "File", Dir: cfg.Storage, positions: map[string]FileState{}}
+                default:
+                    fileBackend, err := NewFileBackend(cfg.Storage)
+                    if err != nil {
+                        errs = append(errs, fmt.Errorf("storage error: %v", err))
+                    }
+                    backend = fileBackend
+            }
+    }
+    if stateBackend, err := cfg.stateBackend(opts); err != nil {
+        errs = append(errs, fmt.Errorf("state error: %v", err))
+    } else if stateBackend != nil {
+        backend = stateBackend
+    }
+    if err := cfg.validateSnapshot(opts); err != nil {
+        errs = append(errs, fmt.Errorf("snapshot error: %v", err))
+    }
+    if len(cfg.Slack) > 0 {
+        if _, err := NewSlackNotifier(cfg.Slack); err != nil {
+            errs = append(errs, err)
+        }
     }
-    if backend == nil {
-        return fmt.Errorf("unknown backend")
+    if len(cfg.Chat) > 0 {
+        if _, err := NewChatNotifier(cfg.Chat); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if len(cfg.Syslog) > 0 {
+        if _, err := NewSyslogNotifier(cfg.Syslog); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.Exec != nil {
+        if _, err := NewExecNotifier(cfg.Exec); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.Webhook != nil {
+        if _, err := NewWebhookNotifier(cfg.Webhook); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.QuietHours != nil {
+        if err := cfg.QuietHours.Validate(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    for i := range cfg.Quiet {
+        if err := cfg.Quiet[i].Validate(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.MaxRecipientsPerMessage < 0 {
+        errs = append(errs, fmt.Errorf("max recipients per message can't be negative"))
+    }
+    if cfg.DeadLetterMaxSize < 0 {
+        errs = append(errs, fmt.Errorf("dead letter max size can't be negative"))
+    }
+    if len(cfg.Spool) > 0 {
+        if err := validateSpool(cfg.Spool); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.SpoolMaxSize < 0 {
+        errs = append(errs, fmt.Errorf("spool max size can't be negative"))
+    }
+    if len(cfg.Audit) > 0 {
+        if err := validateAudit(cfg.Audit); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if cfg.AuditMaxSize < 0 {
+        errs = append(errs, fmt.Errorf("audit max size can't be negative"))
+    }
+    if cfg.Sanitize != nil {
+        if err := cfg.Sanitize.Validate(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if len(errs) > 0 {
+        return nil, errors.Join(errs...)
+    }
+    return backend, nil
+}
+
+// Validate checks the configuration, it normalizes some settings,
+// e.g. the sender address, so the configuration is locked for writing.
+func (logger *LogChecker) Validate() error {
+    logger.mutex.Lock()
+    defer func() {
+        logger.mutex.Unlock()
+    }()
+    backend, err := validateConfig(&logger.Cfg, ValidateOptions{})
+    if err != nil {
+        return err
+    }
+    if err := backend.Open(); err != nil {
+        return fmt.Errorf("can't open storage: %v", err)
     }
     logger.Backend = backend
     return nil
 }
 
-// Notify sends a prepared email message.
-func (logger *LogChecker) Notify(msg string, to []string) {
-    const mime string = "MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n";
-    content := []byte("From: LogChecker\nSubject: LogChecker notification\n" + mime + msg)
-    auth := smtp.PlainAuth(
-        "",
-        logger.Cfg.Sender["user"],
-        logger.Cfg.Sender["password"],
-        logger.Cfg.Sender["host"],
-    )
-    LoggerDebug.Println("send email")
-    err := smtp.SendMail(logger.Cfg.Sender["addr"], auth, logger.Cfg.Sender["user"], to, content)
-    if err != nil {
-        LoggerError.Printf("send email error: %v", err)
+// Notify sends a prepared email message, its subject is taken from
+// sender "subject" field without a service name and a number of lines.
+func (logger *LogChecker) Notify(msg string, to []string) error {
+    return logger.NotifySubject(logger.senderSubject("", 0), msg, to)
+}
+
+// NotifySubject sends a prepared email message with a subject.
+func (logger *LogChecker) NotifySubject(subject, msg string, to []string) error {
+    return logger.deliver(subject, msg, "", to, logger.Cfg.Sender["delivery"])
+}
+
+// emailHeader returns "From" and "Subject" headers of an email message.
+func (logger *LogChecker) emailHeader(subject string) string {
+    return "From: " + senderFromHeader(logger.Cfg.Sender) + "\nSubject: " + mime.QEncoding.Encode("utf-8", SanitizeSubject(subject)) + "\n"
+}
+
+// deliver sends a prepared email message using a delivery mode:
+// one message for all recipients or one message per recipient.
+// It returns an error if all messages are failed without retries
+// and spool, messages with retries in background are not failed.
+// A not empty attachment is added to messages, but not to dead letters.
+func (logger *LogChecker) deliver(subject, msg, attachment string, to []string, delivery string) error {
+    var lost int32
+    header, body := logger.emailHeader(subject), logger.emailContent(msg, attachment)
+    auth, from := senderAuth(logger.Cfg.Sender), senderFrom(logger.Cfg.Sender)
+    server := newSMTPServer(logger.Cfg.Sender)
+    if delivery == DeliveryIndividual {
+        LoggerDebug.Printf("send individual emails to %v recipient(s)", len(to))
+        ctx, cancel := logger.notifyContext()
+        errs := logger.smtpSendIndividual(ctx, server, auth, from, to, func(rcpt string) []byte {
+            return []byte(header + "To: " + rcpt + "\n" + body)
+        })
+        cancel()
+        logger.Delivery.add(uint64(len(to) - len(errs)), 0)
+        for _, rcpt := range to {
+            err, ok := errs[rcpt]
+            if !ok {
+                continue
+            }
+            rcpt := rcpt
+            logger.retrySend(err, func() error {
+                ctx, cancel := logger.notifyContext()
+                defer cancel()
+                return logger.smtpSendIndividual(ctx, server, auth, from, []string{rcpt}, func(rcpt string) []byte {
+                    return []byte(header + "To: " + rcpt + "\n" + body)
+                })[rcpt]
+            }, func(err error) {
+                if err == nil {
+                    logger.Delivery.add(1, 0)
+                    return
+                }
+                logger.Delivery.add(0, 1)
+                atomic.AddUint64(&logger.Delivery.Notifications, 1)
+                LoggerError.Printf("send email error [%v]: %v", rcpt, err)
+                if !logger.park(subject, msg, []string{rcpt}, delivery, err) {
+                    atomic.AddInt32(&lost, 1)
+                }
+            })
+        }
+        if (len(to) > 0) && (int(atomic.LoadInt32(&lost)) == len(to)) {
+            return fmt.Errorf("send email error: all %v message(s) are failed", len(to))
+        }
+        return nil
+    }
+    content := []byte(header + body)
+    batches := splitRecipients(to, logger.Cfg.MaxRecipientsPerMessage)
+    failed, pending := int32(0), int32(len(batches))
+    for _, batch := range batches {
+        batch := batch
+        send := func() error {
+            LoggerDebug.Printf("send email to %v recipient(s)", len(batch))
+            ctx, cancel := logger.notifyContext()
+            defer cancel()
+            return logger.smtpSend(ctx, server, auth, from, batch, content)
+        }
+        logger.retrySend(send(), send, func(err error) {
+            if err != nil {
+                atomic.AddInt32(&failed, 1)
+                logger.Delivery.add(0, uint64(len(batch)))
+                atomic.AddUint64(&logger.Delivery.Notifications, 1)
+                LoggerError.Printf("send email error [%v]: %v", strings.Join(batch, ", "), err)
+                if !logger.park(subject, msg, batch, delivery, err) {
+                    atomic.AddInt32(&lost, 1)
+                }
+            } else {
+                logger.Delivery.add(uint64(len(batch)), 0)
+            }
+            if (atomic.AddInt32(&pending, -1) == 0) && (len(batches) > 1) {
+                if n := atomic.LoadInt32(&failed); n > 0 {
+                    LoggerError.Printf("partial send email failure: %v of %v messages", n, len(batches))
+                }
+            }
+        })
+    }
+    if int(atomic.LoadInt32(&lost)) == len(batches) {
+        return fmt.Errorf("send email error: all %v message(s) are failed", len(batches))
     }
+    return nil
+}
+
+// retrySend calls done with a result of the first send attempt or
+// repeats the failed send in background with exponential backoff.
+// Retries are tracked, so Stop waits for them.
+func (logger *LogChecker) retrySend(err error, send func() error, done func(error)) {
+    attempts, backoff, _ := retryPolicy(logger.Cfg.Sender)
+    if (err == nil) || (attempts < 2) {
+        done(err)
+        return
+    }
+    logger.inflight.Add(1)
+    go func() {
+        defer logger.inflight.Done()
+        for i := 1; (err != nil) && (i < attempts); i++ {
+            LoggerError.Printf("send email error, retry %v of %v in %v: %v", i, attempts - 1, backoff, err)
+            time.Sleep(backoff)
+            backoff *= 2
+            err = send()
+        }
+        done(err)
+    }()
+}
+
+// emailNotifier returns a notifier of email messages with a delivery mode,
+// global sender "delivery" is used if the mode is empty.
+func (logger *LogChecker) emailNotifier(delivery string) Notifier {
+    if len(delivery) == 0 {
+        return logger
+    }
+    return &emailSender{logger, delivery}
+}
+
+// splitRecipients splits a recipients list into parts with maximum size,
+// zero size means that the list is not split.
+func splitRecipients(to []string, size int) [][]string {
+    if (size < 1) || (len(to) <= size) {
+        return [][]string{to}
+    }
+    batches := make([][]string, 0, (len(to) + size - 1) / size)
+    for size < len(to) {
+        batches = append(batches, to[:size])
+        to = to[size:]
+    }
+    return append(batches, to)
 }
 
 // IsWorking return "true" if LogChecker process is already running.
@@ -461,51 +1590,265 @@ func (logger *LogChecker) IsWorking() bool {
     return logger.Running != initTime
 }
 
-// Start runs LogChecker processes.
-func (logger *LogChecker) Start(group *sync.WaitGroup) (chan bool, error) {
+// Start runs LogChecker processes, watchers are tracked by the group.
+// They are finished by Stop or by the cancellation of ctx, Stop should
+// be called in both cases to send pending notifications.
+func (logger *LogChecker) Start(ctx context.Context, group *sync.WaitGroup) error {
     var watched int
-    finish := make(chan bool)
     if logger.IsWorking() {
-        return finish, fmt.Errorf("process is already running")
+        return fmt.Errorf("process is already running")
     }
+    order, err := ServiceOrder(logger.Cfg.Observed)
+    if err != nil {
+        return err
+    }
+    if logger.Backend != nil {
+        if err := logger.Backend.Open(); err != nil {
+            return fmt.Errorf("can't open storage: %v", err)
+        }
+    }
+    // positions exported by the previous process are imported
+    if bk, ok := logger.Backend.(*MemoryBackend); ok {
+        if err := bk.restoreSnapshot(); err != nil {
+            return err
+        }
+    }
+    ctx, logger.watchCancel = context.WithCancel(ctx)
+    logger.watchCtx = ctx
+    logger.resetStats()
     logger.Running = time.Now()
     defer LoggerInfo.Printf("%v is started.\n", logger)
 
-    for i, serv := range logger.Cfg.Observed {
+    for _, i := range order {
+        serv := logger.Cfg.Observed[i]
         info := make([]string, len(serv.Files))
         for j := range serv.Files {
-            if err := serv.Files[j].Validate(); err != nil {
+            if serv.Files[j].IsGlob() {
+                if err := serv.Files[j].Validate(); err != nil {
+                    LoggerError.Printf("incorrect file pattern was skipped [%v / %v]\n", serv.Name, serv.Files[j].Log)
+                    info[j] = fmt.Sprintf("FAILED: %s", serv.Files[j].String())
+                    continue
+                }
+                serv.Files[j].service = &logger.Cfg.Observed[i]
+                n := logger.watchGlob(ctx, &serv.Files[j], group)
+                info[j] = fmt.Sprintf("GLOB: %s \"%s\", %v files", serv.Files[j].String(), serv.Files[j].Pattern, n)
+                watched++
+                continue
+            }
+            if atomic.LoadInt32(&serv.Files[j].reading) != 0 {
+                // a check abandoned before the stop owns the state
+                LoggerInfo.Printf("previous check is still running, state is kept [%v / %v]\n", serv.Name, serv.Files[j].Base())
+                group.Add(1)
+                go func(f *File) {
+                    defer group.Done()
+                    f.Watch(ctx, group, logger)
+                }(&serv.Files[j])
+                info[j] = fmt.Sprintf("OK: %s \"%s\"", serv.Files[j].String(), serv.Files[j].linePattern())
+                watched++
+            } else if err := serv.Files[j].Validate(); err != nil {
                 LoggerError.Printf("incorrect file was skipped [%v / %v]\n", serv.Name, serv.Files[j].Base())
                 info[j] = fmt.Sprintf("FAILED: %s", serv.Files[j].String())
             } else {
+                if skip := serv.Files[j].initPosition(); skip {
+                    LoggerInfo.Printf("empty file was skipped [%v / %v]\n", serv.Name, serv.Files[j].Base())
+                    info[j] = fmt.Sprintf("SKIPPED: %s", serv.Files[j].String())
+                    continue
+                }
                 serv.Files[j].service = &logger.Cfg.Observed[i]
                 serv.Files[j].LogStart = time.Now()
                 serv.Files[j].ExtBoundary = serv.Files[j].Boundary
-                go serv.Files[j].Watch(group, finish, logger)
-                info[j] = fmt.Sprintf("OK: %s \"%s\"", serv.Files[j].String(), serv.Files[j].Pattern)
+                logger.restorePosition(&serv.Files[j])
+                logger.publishStats(&serv.Files[j])
+                group.Add(1)
+                go func(f *File) {
+                    defer group.Done()
+                    f.Watch(ctx, group, logger)
+                }(&serv.Files[j])
+                info[j] = fmt.Sprintf("OK: %s \"%s\"", serv.Files[j].String(), serv.Files[j].linePattern())
                 watched++
            }
        }
-       LoggerInfo.Printf("%v prepared\n\t%v\n", serv, strings.Join(info, "\n\t"))
+       LoggerInfo.Printf("%v prepared\n\t%v\n", serv.Name, strings.Join(info, "\n\t"))
     }
     if watched == 0 {
-        return finish, fmt.Errorf("empty task queue")
+        return fmt.Errorf("empty task queue")
+    }
+    logger.metrics.setWatched(watched)
+    // background goroutines use copies of settings, because a reload replaces them
+    quiet := logger.Cfg.QuietHours
+    windows := append([]MaintenanceWindow(nil), logger.Cfg.Quiet...)
+    logger.background.Add(2)
+    go func() {
+        defer logger.background.Done()
+        logger.watchQuietHours(ctx, quiet)
+    }()
+    go func() {
+        defer logger.background.Done()
+        logger.watchMaintenance(ctx, windows)
+    }()
+    logger.startDigests()
+    logger.startSpool(ctx)
+    if period := logger.Cfg.StatsPeriod(); period > 0 {
+        logger.background.Add(1)
+        go func() {
+            defer logger.background.Done()
+            logger.logStats(ctx, period)
+        }()
+    }
+    if bk, ok := logger.Backend.(*FileBackend); ok {
+        logger.background.Add(1)
+        go func() {
+            defer logger.background.Done()
+            logger.flushState(ctx, bk, StateFlushInterval)
+        }()
     }
-    return finish, nil
+    logger.emit(Event{Type: EventStart, Details: fmt.Sprintf("%v watched files", watched)})
+    return nil
 }
 
-// Stop terminated running process.
-func (logger *LogChecker) Stop(finish chan bool, group *sync.WaitGroup) error {
+// Stop terminated running process, it cancels watchers and waits
+// for them, running checks and notifications.
+func (logger *LogChecker) Stop(group *sync.WaitGroup) error {
+    logger.stopMutex.Lock()
+    defer logger.stopMutex.Unlock()
     if !logger.IsWorking() {
         return fmt.Errorf("process is already stopped")
     }
-    close(finish)
+    if logger.watchCancel != nil {
+        logger.watchCancel()
+        logger.watchCancel = nil
+    }
     group.Wait()
+    logger.background.Wait()
+    // abandoned checks finish their changes, next ones are interrupted
+    logger.checkMutex.Lock()
+    logger.checkMutex.Unlock()
+    logger.persistPositions()
+    logger.stopDigests()
+    logger.cancelNotifications()
+    logger.inflight.Wait()
+    logger.flushWebhook()
+    logger.stopSpool()
+    logger.smtpConns.Close()
+    // flushed notifications are recorded before the storage closing
+    if logger.Backend != nil {
+        if err := logger.Backend.Close(); err != nil {
+            LoggerError.Printf("can't close storage: %v", err)
+        }
+    }
+    logger.resetNotifications()
+    logger.metrics.setWatched(0)
     logger.Running = initTime
     LoggerInfo.Printf("%v is stopped\n", logger)
+    logger.emit(Event{Type: EventStop})
     return nil
 }
 
+// ServiceOrder returns indexes of services in start order, so every service
+// is started after services from its After list. The configuration order
+// is kept for independent services. It returns an error for unknown
+// dependencies and cycles.
+func ServiceOrder(services []Service) ([]int, error) {
+    indexes := make(map[string]int, len(services))
+    for i, serv := range services {
+        indexes[serv.Name] = i
+    }
+    // number of not started dependencies and reverse links
+    waiting := make([]int, len(services))
+    dependent := make([][]int, len(services))
+    for i, serv := range services {
+        for _, name := range serv.After {
+            j, ok := indexes[name]
+            if !ok {
+                return nil, fmt.Errorf("unknown dependency [%v] of service [%v]", name, serv.Name)
+            }
+            if j == i {
+                return nil, fmt.Errorf("service [%v] depends on itself", serv.Name)
+            }
+            waiting[i]++
+            dependent[j] = append(dependent[j], i)
+        }
+    }
+    order := make([]int, 0, len(services))
+    started := make([]bool, len(services))
+    for len(order) < len(services) {
+        next := -1
+        for i := range services {
+            if !started[i] && (waiting[i] == 0) {
+                next = i
+                break
+            }
+        }
+        if next == -1 {
+            cycle := []string{}
+            for i, serv := range services {
+                if !started[i] {
+                    cycle = append(cycle, serv.Name)
+                }
+            }
+            return nil, fmt.Errorf("services dependencies cycle [%v]", strings.Join(cycle, ", "))
+        }
+        started[next] = true
+        order = append(order, next)
+        for _, i := range dependent[next] {
+            waiting[i]--
+        }
+    }
+    return order, nil
+}
+
+// Reload re-reads the configuration file and restarts the process with ctx.
+// New configuration is validated before the stop, so the process
+// continues to work with old settings if the new ones are incorrect.
+func (logger *LogChecker) Reload(ctx context.Context, group *sync.WaitGroup) error {
+    staged := New()
+    staged.Cfg.Notifiers = logger.Cfg.Notifiers
+    if err := InitConfig(staged, logger.Cfg.Path); err != nil {
+        err = &ConfigError{err}
+        logger.emit(Event{Type: EventReload, Details: logger.Cfg.Path, Err: err})
+        return err
+    }
+    working := logger.IsWorking()
+    if working {
+        if err := logger.Stop(group); err != nil {
+            return err
+        }
+    }
+    logger.reloadPositions(staged.Backend, staged.Cfg.ReloadResetDedup)
+    if staged.Cfg.RescanOnPatternChange {
+        logger.rescanPositions(staged.Backend, &staged.Cfg)
+    }
+    logger.mutex.Lock()
+    // the storage of a working process is closed by the stop
+    if !working && (logger.Backend != nil) {
+        if err := logger.Backend.Close(); err != nil {
+            LoggerError.Printf("can't close storage: %v", err)
+        }
+    }
+    logger.Cfg, logger.Backend = staged.Cfg, staged.Backend
+    logger.mutex.Unlock()
+    logger.resetNotifiers()
+    err := logger.Start(ctx, group)
+    logger.emit(Event{Type: EventReload, Details: logger.Cfg.Path, Err: err})
+    return err
+}
+
+// TriggerReload requests a configuration reload,
+// the request is handled by a receiver of ReloadRequests channel.
+func (logger *LogChecker) TriggerReload() {
+    select {
+        case logger.reload <- true:
+            LoggerDebug.Println("reload is requested")
+        default:
+            LoggerDebug.Println("reload is already requested")
+    }
+}
+
+// ReloadRequests returns a channel of reload requests.
+func (logger *LogChecker) ReloadRequests() <-chan bool {
+    return logger.reload
+}
+
 // DebugMode is a initialization of Logger handlers.
 func DebugMode(debugmode bool) {
     debug = debugmode
@@ -536,12 +1879,8 @@ func FilePath(name string) (string, error) {
     return fullpath, err
 }
 
-// InitConfig initializes configuration from a file.
+// InitConfig initializes configuration from a JSON or YAML (".yaml", ".yml") file.
 func InitConfig(logger *LogChecker, name string) error {
-    if runtime.GOOS != "linux" {
-        LoggerError.Printf("unsupported platform: %v\n", runtime.GOOS)
-        return fmt.Errorf("only Linux is now supported")
-    }
     if logger.IsWorking() {
         return fmt.Errorf("logchecker is already running")
     }
@@ -551,34 +1890,135 @@ func InitConfig(logger *LogChecker, name string) error {
         return err
     }
     logger.Cfg.Path = path
-    jsondata, err := ioutil.ReadFile(path)
+    data, err := ioutil.ReadFile(path)
     if err != nil {
         LoggerError.Printf("can't read config file [%v]", name)
         return err
     }
-    err = json.Unmarshal(jsondata, &logger.Cfg)
+    // maps are not merged with a previous configuration
+    logger.Cfg.Sender, logger.Cfg.Slack, logger.Cfg.Syslog, logger.Cfg.Chat = nil, nil, nil, nil
+    logger.Cfg.Exec, logger.Cfg.Webhook, logger.Cfg.Defaults = nil, nil, File{}
+    err = ParseConfig(path, data, &logger.Cfg)
     if err != nil {
         LoggerError.Printf("can't parse config file [%v]", name)
         return err
     }
+    logger.Cfg.applyDefaults()
+    logger.Cfg.expandEnv()
+    if err = logger.Cfg.decryptSender(); err != nil {
+        LoggerError.Printf("can't decrypt sender settings [%v]", name)
+        return err
+    }
     return logger.Validate()
 }
 
-// IsMoved creates new inotify watcher if a file was moved, instead returns an error.
-func IsMoved(filename string, oldw *inotify.Watcher) (*inotify.Watcher, error) {
-    var neww *inotify.Watcher
+// IsHostname checks that a name is a plausible host name or IP address.
+func IsHostname(name string) bool {
+    if net.ParseIP(strings.Trim(name, "[]")) != nil {
+        return true
+    }
+    return (len(name) <= 253) && rgHostname.MatchString(name)
+}
+
+// IsEmail checks that an address is a plain email address without a name.
+func IsEmail(address string) bool {
+    parsed, err := mail.ParseAddress(address)
+    return (err == nil) && (parsed.Address == address)
+}
+
+// invalidEmail adds an error of invalid email address to errs or
+// only logs it as a warning if invalid emails are allowed.
+func (cfg *Config) invalidEmail(errs []error, err error) []error {
+    if cfg.AllowInvalidEmails {
+        LoggerError.Printf("warning: %v", err)
+        return errs
+    }
+    return append(errs, err)
+}
+
+// SenderAddr validates SMTP address "host:port" and returns it in normalized form.
+// IPv6 addresses should be bracketed, the port 25 is used if it's absent.
+func SenderAddr(addr string) (string, error) {
+    addr = strings.TrimSpace(addr)
+    if len(addr) == 0 {
+        return "", fmt.Errorf("empty address")
+    }
+    host, port, err := net.SplitHostPort(addr)
+    if err != nil {
+        // an address without a port: "host", "1.2.3.4" or "[2001:db8::25]"
+        host, port = addr, defaultSMTPPort
+        if strings.HasPrefix(addr, "[") {
+            if !strings.HasSuffix(addr, "]") {
+                return "", fmt.Errorf("unclosed bracket in address [%v]", addr)
+            }
+            host = addr[1:len(addr)-1]
+            if ip := net.ParseIP(host); (ip == nil) || (ip.To4() != nil) {
+                return "", fmt.Errorf("brackets are only allowed for IPv6 address [%v]", addr)
+            }
+        } else if strings.Contains(addr, ":") {
+            if net.ParseIP(addr) != nil {
+                return "", fmt.Errorf("IPv6 address should be bracketed [%v]", addr)
+            }
+            return "", fmt.Errorf("can't parse address [%v]: %v", addr, err)
+        }
+    }
+    if len(host) == 0 {
+        return "", fmt.Errorf("empty host in address [%v]", addr)
+    }
+    if !IsHostname(host) {
+        return "", fmt.Errorf("invalid host in address [%v]", addr)
+    }
+    if len(port) == 0 {
+        port = defaultSMTPPort
+    }
+    if p, err := strconv.ParseUint(port, 10, 16); (err != nil) || (p == 0) {
+        return "", fmt.Errorf("invalid port in address [%v]", addr)
+    }
+    return net.JoinHostPort(host, port), nil
+}
+
+// follow waits until a file with the original name is created again and
+// returns its watcher, so the file is followed by name like "tail -F" does.
+// It returns nil watcher without an error if ctx is done.
+func (f *File) follow(ctx context.Context, oldw Watcher) (Watcher, error) {
+    defer oldw.Close()
+    for i := 0; i < FollowAttempts; i++ {
+        select {
+            case <-ctx.Done():
+                return nil, nil
+            default:
+        }
+        neww, err := IsMoved(f.Log, oldw)
+        if err == nil {
+            if err = neww.Add(f.Log, followOps); err != nil {
+                neww.Close()
+                return nil, err
+            }
+            return neww, nil
+        }
+        if !os.IsNotExist(err) {
+            return nil, err
+        }
+        LoggerDebug.Printf("followed file is absent: %v\n", f.Base())
+    }
+    return nil, fmt.Errorf("file was not created again [%v]", f.Log)
+}
+
+// IsMoved creates new watcher if a file was moved, instead returns an error.
+// The old watcher is closed in any case.
+func IsMoved(filename string, oldw Watcher) (Watcher, error) {
+    defer oldw.Close()
     time.Sleep(MoveWait)
     if _, err := os.Stat(filename); err != nil {
-        oldw.RemoveWatch(filename)
-        return neww, err
+        return nil, err
     }
-    neww, err := inotify.NewWatcher()
+    neww, err := newWatcher()
     if err != nil {
-        return neww, err
+        return nil, err
     }
-    err = neww.AddWatch(filename, watcherMask)
-    if err != nil {
-        return neww, err
+    if err = neww.Add(filename, watcherOps); err != nil {
+        neww.Close()
+        return nil, err
     }
     return neww, nil
 }
@@ -8,13 +8,18 @@ package logchecker
 
 import (
     "bufio"
-    "golang.org/x/exp/inotify"
+    "bytes"
+    "context"
+    "fmt"
     "io/ioutil"
+    "net/smtp"
     "os"
     "os/signal"
     "path/filepath"
+    "regexp"
     "strings"
     "sync"
+    "sync/atomic"
     "syscall"
     "testing"
     "time"
@@ -303,12 +308,12 @@ func TestIsMoved(t *testing.T) {
     }
     // defer rm(testfile)
 
-    watcher, err := inotify.NewWatcher()
+    watcher, err := NewWatcher()
     if err != nil {
-        t.Errorf("cant create inotify watcher")
+        t.Errorf("cant create watcher")
     }
-    if err = watcher.AddWatch(testfile, inotify.IN_CLOSE_WRITE | inotify.IN_ATTRIB); err != nil {
-        t.Errorf("cant add inotify watcher")
+    if err = watcher.Add(testfile, WatchCloseWrite | WatchAttrib); err != nil {
+        t.Errorf("cant add watcher")
     }
 
     go func() {
@@ -329,16 +334,16 @@ func TestIsMoved(t *testing.T) {
     func() {
         for {
             select {
-                case event := <-watcher.Event:
-                    t.Log("file update detected", event.String())
-                    if (event.Mask & inotify.IN_ATTRIB) != 0 {
+                case event := <-watcher.Events():
+                    t.Log("file update detected", event.Name, event.Op)
+                    if event.Has(WatchAttrib) {
                         watcher, err = IsMoved(testfile, watcher)
                         if err != nil {
                             t.Log("file was removed")
                             return
                         }
                     }
-                case err := <-watcher.Error:
+                case err := <-watcher.Errors():
                     t.Errorf("watcher error: %v", err)
                     return
             }
@@ -398,24 +403,22 @@ func TestStart(t *testing.T) {
     logger.Name = "Test-LogChecker"
 
     // incorrect stop without start
-    finish := make(chan bool)
-    if err = logger.Stop(finish, &group); err == nil {
+    if err = logger.Stop(&group); err == nil {
         t.Error(err)
     }
     // delete a file
     rm(newvalues["/var/log/nginx/access.log"])
     // process start
-    finish, err = logger.Start(&group)
-    if err != nil {
+    if err = logger.Start(context.Background(), &group); err != nil {
         t.Error(err)
     }
      // config monitoring
-    watcher, err := inotify.NewWatcher()
+    watcher, err := NewWatcher()
     if err != nil {
         t.Error(err)
     }
-    if err = watcher.AddWatch(logger.Cfg.Path, watcherMask); err != nil {
-        close(finish)
+    if err = watcher.Add(logger.Cfg.Path, watcherOps); err != nil {
+        logger.Stop(&group)
         t.Errorf("can't activate config watcher: %v\n", err)
     }
     timestat := time.Tick(Period)
@@ -434,39 +437,38 @@ func TestStart(t *testing.T) {
             select {
                 case <-stopMonitor:
                     t.Log("stop monitoring")
-                    if err = logger.Stop(finish, &group); err != nil {
+                    if err = logger.Stop(&group); err != nil {
                         t.Error(err)
                     }
                     return
                 case <-sigchan:
                     t.Log("process will be stopped")
-                    if err = logger.Stop(finish, &group); err != nil {
+                    if err = logger.Stop(&group); err != nil {
                         t.Error(err)
                     }
                     return
-                case event := <-watcher.Event:
+                case event := <-watcher.Events():
                     t.Log("process will be restarted due to reconfiguration")
-                    if (event.Mask & inotify.IN_DELETE_SELF) != 0 {
+                    if event.Has(WatchRemove) {
                         watcher, err = IsMoved(logger.Cfg.Path, watcher)
                         if err != nil {
                             t.Errorf("re-creation watcher error: %v\n", err)
                         }
                     }
-                    if err = logger.Stop(finish, &group); err != nil {
+                    if err = logger.Stop(&group); err != nil {
                         t.Error(err)
                     }
                     err = InitConfig(logger, logger.Cfg.Path)
                     if err != nil {
                         t.Error(err)
                     }
-                    finish, err = logger.Start(&group)
-                    if err != nil {
+                    if err = logger.Start(context.Background(), &group); err != nil {
                         t.Errorf("can't start the process: %v\n", err)
                         t.Error(err)
                     }
-                case werr := <-watcher.Error:
+                case werr := <-watcher.Errors():
                     t.Errorf("config watcher error: %v\n", werr)
-                    if err = logger.Stop(finish, &group); err != nil {
+                    if err = logger.Stop(&group); err != nil {
                         t.Error(err)
                     }
                     t.Error(werr)
@@ -507,3 +509,1357 @@ func TestStart(t *testing.T) {
 
     close(stopMonitor)
 }
+
+func TestNotifyRecipients(t *testing.T) {
+    var (
+        mutex sync.Mutex
+        sends [][]string
+    )
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        mutex.Lock()
+        defer mutex.Unlock()
+        sends = append(sends, to)
+        if to[0] == "bad@host.com" {
+            return fmt.Errorf("rejected recipient")
+        }
+        return nil
+    }
+    to := []string{"1@host.com", "2@host.com", "3@host.com", "4@host.com", "bad@host.com"}
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "host": "smtp.host.com"}
+    logger.Notify("test", to)
+    if len(sends) != 1 {
+        t.Errorf("incorrect number of sends: %v", len(sends))
+    }
+    sends = nil
+    logger.Cfg.MaxRecipientsPerMessage = 2
+    logger.Notify("test", to)
+    if len(sends) != 3 {
+        t.Fatalf("incorrect number of sends: %v", len(sends))
+    }
+    for i, n := range []int{2, 2, 1} {
+        if len(sends[i]) != n {
+            t.Errorf("incorrect send size [%v]: %v", i, len(sends[i]))
+        }
+    }
+}
+
+func TestNotifyMessage(t *testing.T) {
+    var group sync.WaitGroup
+    type mail struct {
+        addr string
+        from string
+        to []string
+        msg string
+    }
+    mails := make(chan mail, 10)
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        mails <- mail{addr, from, to, string(msg)}
+        return nil
+    }
+    filename := filepath.Join(buildDir(), "test_notify_message.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = logger
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com:25"}
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Emails: []string{"admin@host.com"}, service: &Service{Name: "app"}}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, "INFO line", "ERROR line"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    select {
+        case m := <-mails:
+            if (m.addr != "smtp.host.com:25") || (m.from != "user@host.com") || (len(m.to) != 1) || (m.to[0] != "admin@host.com") {
+                t.Errorf("incorrect envelope: %v %v %v", m.addr, m.from, m.to)
+            }
+            for _, expected := range []string{
+                "From: LogChecker\n",
+                "Subject: " + logger.Cfg.defaultSubject() + "\n",
+                "MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n",
+                "Report for \"app\" service (1 new items, severity: warning): " + filename + "\n2: ERROR line\n",
+            } {
+                if !strings.Contains(m.msg, expected) {
+                    t.Errorf("message doesn't contain %q: %v", expected, m.msg)
+                }
+            }
+            if strings.Contains(m.msg, "INFO line") {
+                t.Errorf("not matched line is reported: %v", m.msg)
+            }
+        case <-time.After(time.Second):
+            t.Errorf("email is not sent")
+    }
+}
+
+func TestSenderAddr(t *testing.T) {
+    cases := []struct {
+        addr string
+        result string
+        ok bool
+    }{
+        {"smtp.host.com:25", "smtp.host.com:25", true},
+        {"smtp.host.com", "smtp.host.com:25", true},
+        {"smtp.host.com:", "smtp.host.com:25", true},
+        {" smtp.host.com:587 ", "smtp.host.com:587", true},
+        {"127.0.0.1:465", "127.0.0.1:465", true},
+        {"127.0.0.1", "127.0.0.1:25", true},
+        {"[2001:db8::25]:25", "[2001:db8::25]:25", true},
+        {"[2001:db8::25]", "[2001:db8::25]:25", true},
+        {"", "", false},
+        {"2001:db8::25", "", false},
+        {"[2001:db8::25", "", false},
+        {"[127.0.0.1]", "", false},
+        {"smtp.host.com:smtp", "", false},
+        {"smtp.host.com:0", "", false},
+        {"smtp.host.com:70000", "", false},
+        {":25", "", false},
+        {"smtp host.com:25", "", false},
+        {"-smtp.host.com:25", "", false},
+    }
+    for _, c := range cases {
+        result, err := SenderAddr(c.addr)
+        if (err == nil) != c.ok {
+            t.Errorf("incorrect validation [%v]: %v", c.addr, err)
+        }
+        if result != c.result {
+            t.Errorf("incorrect address [%v]: %v != %v", c.addr, result, c.result)
+        }
+    }
+    hosts := map[string]bool{
+        "smtp.host.com": true,
+        "localhost": true,
+        "192.168.0.1": true,
+        "2001:db8::25": true,
+        "[2001:db8::25]": true,
+        "": false,
+        "smtp_host.com": false,
+        "smtp.host.com/path": false,
+        "user@host.com": false,
+    }
+    for host, ok := range hosts {
+        if IsHostname(host) != ok {
+            t.Errorf("incorrect host validation [%v]", host)
+        }
+    }
+}
+
+func TestSeverityRules(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_severity.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    f := &File{
+        Log: filename,
+        Pattern: `HTTP/1.1" \d+`,
+        Boundary: 1,
+        Period: 3600,
+        Limit: 10,
+        Severity: SeverityInfo,
+        SeverityRules: []SeverityRule{
+            {Match: `" 5\d\d`, Severity: SeverityCritical},
+            {Match: `" 4\d\d`, Severity: SeverityWarning},
+        },
+    }
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    lines := map[string]string{
+        `GET / HTTP/1.1" 500 10`: SeverityCritical,
+        `GET / HTTP/1.1" 404 10`: SeverityWarning,
+        `GET / HTTP/1.1" 200 10`: SeverityInfo,
+    }
+    for line, severity := range lines {
+        if s := f.LineSeverity(line); s != severity {
+            t.Errorf("incorrect severity [%v]: %v", line, s)
+        }
+    }
+    DebugMode(true)
+    EmailSimulator = ""
+    logger := New()
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, `GET / HTTP/1.1" 200 10`, `GET / HTTP/1.1" 404 10`); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if f.LastSeverity != SeverityWarning {
+        t.Errorf("incorrect notification severity: %v", f.LastSeverity)
+    }
+    if err := updateFile(filename, `GET / HTTP/1.1" 503 10`, `GET / HTTP/1.1" 200 10`); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if f.LastSeverity != SeverityCritical {
+        t.Errorf("incorrect notification severity: %v", f.LastSeverity)
+    }
+    expected := map[string]uint64{SeverityInfo: 2, SeverityWarning: 1, SeverityCritical: 1}
+    for k, v := range expected {
+        if f.Severities[k] != v {
+            t.Errorf("incorrect severity counter [%v]: %v", k, f.Severities[k])
+        }
+    }
+    group.Wait()
+    f.SeverityRules[0].Severity = "unknown"
+    if err := f.Validate(); err == nil {
+        t.Errorf("need unknown severity error")
+    }
+}
+
+func TestNormalize(t *testing.T) {
+    cases := map[string]string{
+        "request 12345 failed": "request <num> failed",
+        "user 550e8400-e29b-41d4-a716-446655440000 not found": "user <uuid> not found",
+        "pointer 0x7ffd5e8c and id deadbeef01": "pointer <hex> and id <hex>",
+        "dead cafe a1 error": "dead cafe a1 error",
+        "took 1.25s": "took <num>s",
+        "order 1234567890 is done": "order <num> is done",
+    }
+    for line, normalized := range cases {
+        if result := Normalize(line); result != normalized {
+            t.Errorf("incorrect normalization [%v]: %v", line, result)
+        }
+    }
+    f := &File{Pattern: "user 42 ", Normalize: true}
+    f.RgPattern = regexp.MustCompile(f.Pattern)
+    first := "user 42 request 550e8400-e29b-41d4-a716-446655440000 failed"
+    second := "user 43 request 6ba7b810-9dad-11d1-80b4-00c04fd430c8 failed"
+    if f.Fingerprint(first) != f.Fingerprint(second) {
+        t.Errorf("fingerprints should be equal")
+    }
+    if !f.RgPattern.MatchString(first) || f.RgPattern.MatchString(second) {
+        t.Errorf("matching should use raw lines")
+    }
+    f.Normalize = false
+    if f.Fingerprint(first) == f.Fingerprint(second) {
+        t.Errorf("fingerprints should be different without normalization")
+    }
+}
+
+func TestCountOnly(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_count_only.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, CountOnly: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    secret := "ERROR user john.doe@host.com password=secret"
+    if err := updateFile(filename, secret, secret); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    // a queued notification is an in-memory artifact too
+    logger.Cfg.QuietHours = &QuietHours{
+        Start: time.Now().Add(-time.Hour).Format(quietLayout),
+        End: time.Now().Add(time.Hour).Format(quietLayout),
+    }
+    if err := logger.Cfg.QuietHours.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    for _, alert := range logger.quietQueue {
+        if strings.Contains(alert.msg, "secret") {
+            t.Errorf("queued notification contains log content: %v", alert.msg)
+        }
+    }
+    logger.FlushQuietHours()
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "2 new items") {
+        t.Errorf("notification should contain a count: %v", msg)
+    }
+    if strings.Contains(msg, "john.doe") || strings.Contains(msg, "secret") {
+        t.Errorf("notification contains log content: %v", msg)
+    }
+    for fp := range f.Fingerprints {
+        if strings.Contains(fp, "secret") {
+            t.Errorf("fingerprint contains log content: %v", fp)
+        }
+    }
+}
+
+func TestServiceOrder(t *testing.T) {
+    services := []Service{
+        {Name: "app", After: []string{"setup", "db"}},
+        {Name: "web"},
+        {Name: "db", After: []string{"setup"}},
+        {Name: "setup"},
+    }
+    order, err := ServiceOrder(services)
+    if err != nil {
+        t.Fatal(err)
+    }
+    names := make([]string, len(order))
+    for i, j := range order {
+        names[i] = services[j].Name
+    }
+    if result := strings.Join(names, ","); result != "web,setup,db,app" {
+        t.Errorf("incorrect order: %v", result)
+    }
+    services[3].After = []string{"app"}
+    if _, err := ServiceOrder(services); (err == nil) || !strings.Contains(err.Error(), "cycle") {
+        t.Errorf("need cycle error: %v", err)
+    }
+    services[3].After = []string{"setup"}
+    if _, err := ServiceOrder(services); err == nil {
+        t.Errorf("need self dependency error")
+    }
+    services[3].After = []string{"unknown"}
+    if _, err := ServiceOrder(services); err == nil {
+        t.Errorf("need unknown dependency error")
+    }
+    logger := New()
+    logger.Cfg.Observed = services
+    if err := logger.Start(context.Background(), &sync.WaitGroup{}); err == nil {
+        t.Errorf("need start error")
+    }
+    if logger.IsWorking() {
+        t.Errorf("process should not be started")
+    }
+}
+
+func TestSubject(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    f := &File{
+        Log: "/tmp/app.log",
+        Pattern: `ERROR \[(\w+)\] (.*)`,
+        SubjectTemplate: "[{service}] {2} ({1}, {count} items, {severity})",
+        service: &Service{Name: "app"},
+    }
+    f.RgPattern = regexp.MustCompile(f.Pattern)
+    subject := f.Subject("ERROR [db] connection refused\r\nBcc: user@host.com", 3, SeverityCritical)
+    if subject != "[app] connection refused (db, 3 items, critical)" {
+        t.Errorf("incorrect subject: %v", subject)
+    }
+    f.SubjectTemplate = "{first_line}"
+    subject = f.Subject("ERROR [db] connection refused\r\nBcc: user@host.com", 3, SeverityCritical)
+    if subject != "ERROR [db] connection refused Bcc: user@host.com" {
+        t.Errorf("incorrect subject: %v", subject)
+    }
+    subject = f.Subject("ERROR [db] " + strings.Repeat("long ", 100), 1, SeverityWarning)
+    if (len([]rune(subject)) != MaxSubjectLength) || !strings.HasSuffix(subject, "...") {
+        t.Errorf("incorrect truncated subject: %v", subject)
+    }
+    f.SubjectTemplate = "{first_line}"
+    f.CountOnly = true
+    if subject := f.Subject("ERROR [db] secret", 1, SeverityWarning); subject != DefaultSubject {
+        t.Errorf("line content in count only mode: %v", subject)
+    }
+    f.SubjectTemplate = ""
+    if subject := f.Subject("ERROR [db] secret", 1, SeverityWarning); subject != DefaultSubject {
+        t.Errorf("incorrect default subject: %v", subject)
+    }
+
+    // subject is passed to a notifier
+    filename := filepath.Join(buildDir(), "test_subject.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    f = &File{Log: filename, Pattern: `ERROR (.*)`, Boundary: 1, Period: 3600, Limit: 10, SubjectTemplate: "{first_line}"}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, "info", "ERROR DB connection refused", "ERROR timeout"); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    select {
+        case subject := <-notifier.subjects:
+            if subject != "ERROR DB connection refused" {
+                t.Errorf("incorrect subject: %v", subject)
+            }
+        case <-time.After(time.Second):
+            t.Errorf("notification is not sent")
+    }
+}
+
+func TestZeroByteFile(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_zero_byte.log")
+    skipped := filepath.Join(buildDir(), "test_zero_byte_skipped.log")
+    for _, name := range []string{filename, skipped} {
+        if err := createFile(name, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]", err)
+        }
+        defer rm(name)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Pos: 5},
+        {Log: skipped, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, ZeroByte: ZeroByteSkip},
+    }}}
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    // append immediately after the start
+    if err := updateFile(filename, "ERROR first line"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "1: ERROR first line") {
+        t.Errorf("first line is not matched: %v", msg)
+    }
+    if err := updateFile(skipped, "ERROR skipped"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(200 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("skipped file is watched: %v", msg)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Error(err)
+    }
+    f := File{Log: filename, Pattern: "ERROR", ZeroByte: "unknown"}
+    if err := f.Validate(); err == nil {
+        t.Errorf("need zero_byte mode error")
+    }
+}
+
+func TestFromEnd(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_from_end.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    if err := updateFile(filename, "ERROR old 1", "INFO old 2", "ERROR old 3"); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    logger.Cfg.DuplicateWindow = -1
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, FromEnd: true},
+    }}}
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(100 * time.Millisecond)
+    if err := updateFile(filename, "ERROR new 4"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "4: ERROR new 4") || strings.Contains(msg, "old") {
+        t.Errorf("incorrect message: %v", msg)
+    }
+    // rotated file is read from the beginning
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "1: ERROR 1") {
+        t.Errorf("rotated file is not read: %v", msg)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Error(err)
+    }
+    if found := logger.Cfg.Observed[0].Files[0].Found; found != 2 {
+        t.Errorf("incorrect found counter: %v", found)
+    }
+}
+
+func TestContextBuffer(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_context.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, ContextBufferLines: 3}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, "line 1", "line 2", "line 3", "line 4", "ERROR 5"); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    expected := []string{"line 3", "line 4", "ERROR 5"}
+    if lines := f.RecentLines(); strings.Join(lines, ",") != strings.Join(expected, ",") {
+        t.Errorf("incorrect recent lines: %v", lines)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "Recent lines (3):\nline 3\nline 4\nERROR 5") || strings.Contains(msg, "line 2") {
+        t.Errorf("notification should contain recent lines: %v", msg)
+    }
+    long := strings.Repeat("x", MaxContextLineLength * 2)
+    if err := updateFile(filename, long); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    lines := f.RecentLines()
+    if (len(lines) != 3) || (len(lines[2]) != MaxContextLineLength + 3) {
+        t.Errorf("incorrect recent lines: %v", lines)
+    }
+    f.ContextBufferLines = MaxContextLines + 1
+    if err := f.Validate(); err == nil {
+        t.Errorf("need context_buffer_lines error")
+    }
+}
+
+func TestMatchContext(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_match_context.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Context: 1}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    lines := []string{"line 1", "line 2", "ERROR 3", "line 4", "ERROR 5", "line 6", "line 7", "line 8", "ERROR 9"}
+    if err := updateFile(filename, lines...); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    expected := "2: line 2\n3: ERROR 3\n4: line 4\n5: ERROR 5\n6: line 6\n--\n8: line 8\n9: ERROR 9\n"
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, expected) || strings.Contains(msg, "line 1") || strings.Contains(msg, "line 7") {
+        t.Errorf("notification should contain context lines: %v", msg)
+    }
+    if f.Found != 3 {
+        t.Errorf("context lines are counted: %v", f.Found)
+    }
+    // the total number of lines is limited
+    lines = nil
+    for i := 0; i < int(maxMsgLines) * 2; i++ {
+        lines = append(lines, "line", "ERROR")
+    }
+    if err := updateFile(filename, lines...); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if n := strings.Count(msg, ": ERROR") + strings.Count(msg, ": line"); n != int(maxMsgLines) + 1 {
+        t.Errorf("incorrect number of report lines: %v", n)
+    }
+    f.Context = uint64(MaxContextLines) + 1
+    if err := f.Validate(); err == nil {
+        t.Errorf("need context error")
+    }
+}
+
+func TestCheckOffset(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_offset.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 100, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    if err := updateFile(filename, "ERROR 1", "line 2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if (f.Pos != 2) || (f.Offset != 15) || (f.Found != 1) {
+        t.Errorf("incorrect position: pos=%v, offset=%v, found=%v", f.Pos, f.Offset, f.Found)
+    }
+    // incomplete line is not consumed
+    file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+    if err != nil {
+        t.Fatal(err)
+    }
+    file.WriteString("ERR")
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if (f.Pos != 2) || (f.Offset != 15) || (f.Found != 1) {
+        t.Errorf("incorrect position: pos=%v, offset=%v, found=%v", f.Pos, f.Offset, f.Found)
+    }
+    file.WriteString("OR 3\n")
+    file.Close()
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if (f.Pos != 3) || (f.Offset != 23) || (f.Found != 2) {
+        t.Errorf("incorrect position: pos=%v, offset=%v, found=%v", f.Pos, f.Offset, f.Found)
+    }
+    // truncated file is read from the beginning
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if (f.Pos != 1) || (f.Offset != 8) || (f.Found != 3) {
+        t.Errorf("incorrect position: pos=%v, offset=%v, found=%v", f.Pos, f.Offset, f.Found)
+    }
+}
+
+// prepareBenchmarkFile creates a big log file for Check benchmarks.
+func prepareBenchmarkFile(b *testing.B, name string) *File {
+    lines := make([]string, 200000)
+    for i := range lines {
+        lines[i] = fmt.Sprintf("2015-01-01 00:00:00 INFO request %v is done in 10ms", i)
+    }
+    if err := createFile(name, 0666); err != nil {
+        b.Fatal(err)
+    }
+    if err := updateFile(name, lines...); err != nil {
+        b.Fatal(err)
+    }
+    f := &File{Log: name, Pattern: "ERROR", Boundary: 1000000, Period: 3600, Limit: 1}
+    if err := f.Validate(); err != nil {
+        b.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    return f
+}
+
+// BenchmarkCheckRescan reads the whole file on every check, as it was done before byte offsets.
+func BenchmarkCheckRescan(b *testing.B) {
+    name := filepath.Join(buildDir(), "bench_rescan.log")
+    f := prepareBenchmarkFile(b, name)
+    defer os.Remove(name)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := updateFile(name, "2015-01-01 00:00:00 ERROR new line"); err != nil {
+            b.Fatal(err)
+        }
+        file, err := os.Open(name)
+        if err != nil {
+            b.Fatal(err)
+        }
+        var clines uint64
+        scanner := bufio.NewScanner(file)
+        for scanner.Scan() {
+            clines++
+            if f.Pos < clines {
+                f.RgPattern.MatchString(scanner.Text())
+            }
+        }
+        file.Close()
+        f.Pos = clines
+    }
+}
+
+// BenchmarkCheckSeek reads only new lines from the last byte offset.
+func BenchmarkCheckSeek(b *testing.B) {
+    var group sync.WaitGroup
+    name := filepath.Join(buildDir(), "bench_seek.log")
+    f := prepareBenchmarkFile(b, name)
+    defer os.Remove(name)
+    logger := New()
+    if err := f.Check(&group, logger); err != nil {
+        b.Fatal(err)
+    }
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        if err := updateFile(name, "2015-01-01 00:00:00 ERROR new line"); err != nil {
+            b.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestWatchIntegrity(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_integrity.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 100, Period: 3600, Limit: 10, WatchIntegrity: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    for _, line := range []string{"user login", "user logout", "user login"} {
+        if err := updateFile(filename, line); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if msg := notifier.wait(100 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("appends should not trigger integrity alert: %v", msg)
+    }
+    // an earlier line is edited in place
+    data, err := ioutil.ReadFile(filename)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data = bytes.Replace(data, []byte("logout"), []byte("LOGOUT"), 1)
+    if err := ioutil.WriteFile(filename, data, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "user logout"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "Integrity alert") || !strings.Contains(msg, "(34 bytes) was changed") {
+        t.Errorf("need integrity alert: %v", msg)
+    }
+    if subject := <-notifier.subjects; subject != "LogChecker integrity alert: test_integrity.log" {
+        t.Errorf("incorrect subject: %v", subject)
+    }
+    // the changed content is a new baseline
+    if err := updateFile(filename, "user login"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(100 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("repeated integrity alert: %v", msg)
+    }
+}
+
+func TestMatchOptions(t *testing.T) {
+    filename := filepath.Join(buildDir(), "test_match_options.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    cases := []struct {
+        file File
+        matched []string
+        skipped []string
+    }{
+        {File{Pattern: "Error"}, []string{"Error 1", "ErrorCode"}, []string{"error 1", "ERROR"}},
+        {File{Pattern: "Error", IgnoreCase: true}, []string{"error 1", "ERROR", "errors"}, []string{"warning"}},
+        {File{Pattern: "Error", WholeWord: true}, []string{"Error 1", "an Error."}, []string{"Errors", "error"}},
+        {File{Pattern: "Error|fail", IgnoreCase: true, WholeWord: true}, []string{"ERROR", "FAIL now"}, []string{"errors", "failed"}},
+        {File{Pattern: "(?i)error", IgnoreCase: true, WholeWord: true}, []string{"Error"}, []string{"ErrorCode"}},
+        {File{Pattern: "(?-i:Error) 1", IgnoreCase: true}, []string{"Error 1"}, []string{"error 1"}},
+    }
+    for i, c := range cases {
+        c.file.Log = filename
+        if err := c.file.Validate(); err != nil {
+            t.Errorf("case %v: %v", i, err)
+            continue
+        }
+        for _, line := range c.matched {
+            if !c.file.RgPattern.MatchString(line) {
+                t.Errorf("case %v: line should be matched [%v]", i, line)
+            }
+        }
+        for _, line := range c.skipped {
+            if c.file.RgPattern.MatchString(line) {
+                t.Errorf("case %v: line should not be matched [%v]", i, line)
+            }
+        }
+    }
+}
+
+func TestSplitLine(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_split_line.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    // the line is written by two parts, the first one matches the pattern too
+    for _, part := range []string{"first line\nERROR 4", "2\nlast line\n"} {
+        if _, err := file.WriteString(part); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if (f.Found != 1) || (f.Pos != 3) {
+        t.Errorf("incorrect check: found=%v, pos=%v", f.Found, f.Pos)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "2: ERROR 42\n") {
+        t.Errorf("split line is not matched: %v", msg)
+    }
+    if n := len(notifier.messages); n != 0 {
+        t.Errorf("split line is matched %v more times", n)
+    }
+}
+
+func TestFollow(t *testing.T) {
+    var group sync.WaitGroup
+    defer func(wait time.Duration) {
+        MoveWait = wait
+    }(MoveWait)
+    MoveWait = 50 * time.Millisecond
+    filename := filepath.Join(buildDir(), "test_follow.log")
+    renamed := filename + ".1"
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    defer os.Remove(renamed)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Follow: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go f.Watch(ctx, &group, logger)
+    time.Sleep(100 * time.Millisecond)
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "ERROR 1") {
+        t.Fatalf("incorrect notification before rename: %v", msg)
+    }
+    // the path is absent during several follow attempts
+    if err := os.Rename(filename, renamed); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(200 * time.Millisecond)
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "ERROR 2"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "ERROR 2") {
+        t.Fatalf("recreated file is not followed: %v", msg)
+    }
+    if err := updateFile(filename, "ERROR 3"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "ERROR 3") || strings.Contains(msg, "ERROR 2") {
+        t.Errorf("incorrect notification after follow: %v", msg)
+    }
+    if err := updateFile(renamed, "ERROR 4"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(300 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("renamed file is still watched: %v", msg)
+    }
+}
+
+// silentWatcher is a test watcher without events.
+type silentWatcher struct {
+    events chan WatchEvent
+    errors chan error
+}
+
+func (sw *silentWatcher) Add(name string, op WatchOp) error {
+    return nil
+}
+
+func (sw *silentWatcher) Remove(name string) error {
+    return nil
+}
+
+func (sw *silentWatcher) Events() <-chan WatchEvent {
+    return sw.events
+}
+
+func (sw *silentWatcher) Errors() <-chan error {
+    return sw.errors
+}
+
+func (sw *silentWatcher) Close() error {
+    return nil
+}
+
+func TestPollInterval(t *testing.T) {
+    var group sync.WaitGroup
+    defer func(f func() (Watcher, error)) {
+        newWatcher = f
+    }(newWatcher)
+    newWatcher = func() (Watcher, error) {
+        return &silentWatcher{make(chan WatchEvent), make(chan error)}, nil
+    }
+    filename := filepath.Join(buildDir(), "test_poll.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, PollInterval: 1}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.initPosition()
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go f.Watch(ctx, &group, logger)
+    time.Sleep(100 * time.Millisecond)
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(2 * time.Second); !strings.Contains(msg, "ERROR 1") {
+        t.Fatalf("appended line is not found by polling: %v", msg)
+    }
+    if f.Pos != 1 {
+        t.Errorf("incorrect position: %v", f.Pos)
+    }
+}
+
+// slowNotifier is a test notifier with a long send.
+type slowNotifier struct {
+    delay time.Duration
+    sent int32
+}
+
+func (sn *slowNotifier) String() string {
+    return "slowNotifier"
+}
+
+func (sn *slowNotifier) Notify(msg string, to []string) error {
+    time.Sleep(sn.delay)
+    atomic.AddInt32(&sn.sent, 1)
+    return nil
+}
+
+func TestGracefulReload(t *testing.T) {
+    var group sync.WaitGroup
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_syslog"),
+    }
+    example := filepath.Join(testdir, "config.reload.json")
+    if err := prepareConfig(filepath.Join(testdir, "config.example.json"), example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer os.Remove(example)
+    for _, v := range newvalues {
+        if err := createFile(v, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]: %v", v, err)
+        }
+        if err := updateFile(v, "line"); err != nil {
+            t.Fatal(err)
+        }
+        defer os.Remove(v)
+    }
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatal(err)
+    }
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    sn := &slowNotifier{delay: 300 * time.Millisecond}
+    logger.dispatch(sn, "", "test", nil, SeverityWarning)
+    if err := logger.Reload(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    if n := atomic.LoadInt32(&sn.sent); n != 1 {
+        t.Errorf("reload doesn't wait for a notification: %v", n)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Errorf("stop error: %v", err)
+    }
+    if err := logger.Stop(&group); err == nil {
+        t.Errorf("need already stopped error")
+    }
+}
+
+func TestStartContext(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_start_context.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    ctx, cancel := context.WithCancel(context.Background())
+    if err := logger.Start(ctx, &group); err != nil {
+        t.Fatal(err)
+    }
+    cancel()
+    done := make(chan bool)
+    go func() {
+        group.Wait()
+        close(done)
+    }()
+    select {
+        case <-done:
+        case <-time.After(time.Second):
+            t.Fatal("watchers are not stopped by the context")
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestStopTwice(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_stop_twice.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    // concurrent stops, only one of them stops the process
+    errs := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() {
+            errs <- logger.Stop(&group)
+        }()
+    }
+    stopped := 0
+    for i := 0; i < 2; i++ {
+        if err := <-errs; err == nil {
+            stopped++
+        }
+    }
+    if stopped != 1 {
+        t.Errorf("incorrect number of stops: %v", stopped)
+    }
+    if err := logger.Stop(&group); err == nil {
+        t.Error("need already stopped error")
+    }
+}
+
+func TestValidateConfig(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Observed: []Service{{Name: "service", Files: []File{{Log: "/not/existing/file.log", Pattern: "ERROR", Emails: []string{"user@host.com"}}}}},
+        Storage: "/not/existing/storage",
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Errorf("config without stats should be valid: %v", err)
+    }
+    if cfg.Sender["addr"] != "smtp.host.com" {
+        t.Errorf("config is changed during validation: %v", cfg.Sender["addr"])
+    }
+    if cfg.Observed[0].Files[0].RgPattern != nil {
+        t.Errorf("files are changed during validation")
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+        t.Errorf("need file existence error")
+    }
+    cfg.Observed[0].Files[0].Pattern = "ERROR("
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err == nil {
+        t.Errorf("need pattern error")
+    }
+    cfg.Observed[0].Files[0].Pattern = "ERROR"
+    cfg.Storage = "relative/storage"
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err == nil {
+        t.Errorf("need backend error")
+    }
+}
+
+func TestValidateErrors(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Observed: []Service{{Name: "service", Files: []File{
+            {Log: "relative/file.log", Pattern: "ERROR"},
+            {Log: "/var/log/empty_pattern.log"},
+            {Log: "/var/log/valid.log", Pattern: "ERROR"},
+        }, Emails: []string{"admin@host.com"}}},
+        Storage: "memory",
+    }
+    err := ValidateConfig(cfg, ValidateOptions{SkipStat: true})
+    if err == nil {
+        t.Fatal("need validation errors")
+    }
+    for _, expected := range []string{
+        "file error [relative/file.log] path should be absolute",
+        "file error [/var/log/empty_pattern.log] pattern should not be empty",
+        "missing sender field [password]",
+    } {
+        if !strings.Contains(err.Error(), expected) {
+            t.Errorf("error is not reported [%v]: %v", expected, err)
+        }
+    }
+    if strings.Contains(err.Error(), "valid.log") {
+        t.Errorf("valid file is reported: %v", err)
+    }
+}
+
+func TestValidateEmails(t *testing.T) {
+    for k, v := range map[string]bool{
+        "ops@example.com": true,
+        "ops@localhost": true,
+        "ops@example,": false,
+        "Ops <ops@example.com>": false,
+        "ops": false,
+        "": false,
+    } {
+        if r := IsEmail(k); r != v {
+            t.Errorf("incorrect email check [%v]: %v", k, r)
+        }
+    }
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Observed: []Service{{Name: "service", Files: []File{
+            {Log: "/var/log/invalid.log", Pattern: "ERROR", Emails: []string{"ops@example.com", "ops@example,"}},
+            {Log: "/var/log/valid.log", Pattern: "ERROR"},
+        }, Emails: []string{"admin@@host.com"}}},
+        Storage: "memory",
+    }
+    err := ValidateConfig(cfg, ValidateOptions{SkipStat: true})
+    if err == nil {
+        t.Fatal("need validation errors")
+    }
+    for _, expected := range []string{
+        "service error [service] file [/var/log/invalid.log] invalid email [ops@example,]",
+        "service error [service] invalid email [admin@@host.com]",
+    } {
+        if !strings.Contains(err.Error(), expected) {
+            t.Errorf("error is not reported [%v]: %v", expected, err)
+        }
+    }
+    cfg.AllowInvalidEmails = true
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Errorf("invalid emails should be allowed: %v", err)
+    }
+}
+
+func TestServiceEmails(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Observed: []Service{{
+            Name: "app",
+            Emails: []string{"team@host.com"},
+            Files: []File{
+                {Log: "/var/log/app.log", Pattern: "ERROR"},
+                {Log: "/var/log/db.log", Pattern: "ERROR", Emails: []string{"dba@host.com"}},
+            },
+        }},
+        Storage: "memory",
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Fatal(err)
+    }
+    serv := &cfg.Observed[0]
+    if emails := serv.FileEmails(&serv.Files[0]); (len(emails) != 1) || (emails[0] != "team@host.com") {
+        t.Errorf("service emails should be used: %v", emails)
+    }
+    if emails := serv.FileEmails(&serv.Files[1]); (len(emails) != 1) || (emails[0] != "dba@host.com") {
+        t.Errorf("file emails should have priority: %v", emails)
+    }
+    if s := cfg.String(); !strings.Contains(s, "app.log [team@host.com]") || !strings.Contains(s, "db.log [dba@host.com]") {
+        t.Errorf("effective emails are not shown: %v", s)
+    }
+    // files without recipients are rejected only for email notifications
+    serv.Emails = nil
+    err := ValidateConfig(cfg, ValidateOptions{SkipStat: true})
+    if (err == nil) || !strings.Contains(err.Error(), "file error [/var/log/app.log] emails should not be empty") {
+        t.Errorf("need empty emails error: %v", err)
+    }
+    if strings.Contains(err.Error(), "db.log") {
+        t.Errorf("file with emails is reported: %v", err)
+    }
+    cfg.Syslog = map[string]string{"tag": "app"}
+    serv.Notifiers = []string{SyslogNotifierName}
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Errorf("emails are not needed without email notifier: %v", err)
+    }
+}
+
+func TestSenderSubject(t *testing.T) {
+    f := &File{Log: "/tmp/app.log", Pattern: "ERROR", service: &Service{Name: "app"}}
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"subject_template": "[{{.Service}}] {{.File}}: {{.Found}} {{.Severity}}"}
+    if subject := logger.fileSubject(f, "ERROR", 3, SeverityCritical); subject != "[app] /tmp/app.log: 3 critical" {
+        t.Errorf("incorrect sender subject: %v", subject)
+    }
+    f.SubjectTemplate = "{service}"
+    if subject := logger.fileSubject(f, "ERROR", 3, SeverityCritical); subject != "app" {
+        t.Errorf("file subject should have priority: %v", subject)
+    }
+    f.SubjectTemplate = ""
+    logger.Cfg.Sender["subject_template"] = "{{.Unknown}}"
+    if subject := logger.fileSubject(f, "ERROR", 3, SeverityCritical); subject != DefaultSubject {
+        t.Errorf("incorrect subject after template error: %v", subject)
+    }
+    logger.Cfg.Sender = map[string]string{
+        "user": "user@host.com",
+        "password": "password",
+        "host": "smtp.host.com",
+        "addr": "smtp.host.com",
+        "subject_template": "{{.Service",
+    }
+    logger.Cfg.Storage = "memory"
+    if err := logger.Validate(); err == nil {
+        t.Errorf("need subject_template error")
+    }
+}
+
+func TestSenderSubjectFormat(t *testing.T) {
+    messages := make(chan string, 10)
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        messages <- string(msg)
+        return nil
+    }
+    f := &File{Log: "/tmp/app.log", Pattern: "ERROR", service: &Service{Name: "app"}}
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "host": "smtp.host.com", "addr": "smtp.host.com:25"}
+    logger.NotifySubject(logger.fileSubject(f, "ERROR", 2, SeverityWarning), "message", []string{"admin@host.com"})
+    if msg := <-messages; !strings.HasPrefix(msg, "From: LogChecker\nSubject: " + DefaultSubject + "\n") {
+        t.Errorf("incorrect default headers: %v", msg)
+    }
+    logger.Cfg.Sender["from"] = "prod-1@host.com"
+    logger.Cfg.Sender["subject"] = "[prod-1] %s: %d errors, 100%%"
+    logger.NotifySubject(logger.fileSubject(f, "ERROR", 2, SeverityWarning), "message", []string{"admin@host.com"})
+    if msg := <-messages; !strings.HasPrefix(msg, "From: prod-1@host.com\nSubject: [prod-1] app: 2 errors, 100%\n") {
+        t.Errorf("incorrect custom headers: %v", msg)
+    }
+    // a file subject has priority
+    f.SubjectTemplate = "{service} alert"
+    if subject := logger.fileSubject(f, "ERROR", 2, SeverityWarning); subject != "app alert" {
+        t.Errorf("file subject should have priority: %v", subject)
+    }
+    logger.Notify("message", []string{"admin@host.com"})
+    if msg := <-messages; !strings.Contains(msg, "Subject: [prod-1] : 0 errors, 100%\n") {
+        t.Errorf("incorrect subject without file: %v", msg)
+    }
+}
+
+func TestDescribe(t *testing.T) {
+    filename := filepath.Join(buildDir(), "test_describe.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Cfg.Path = "/etc/logchecker.json"
+    logger.Cfg.Storage = "memory"
+    logger.Cfg.Observed = []Service{{
+        Name: "app",
+        Files: []File{
+            {Log: filename, Pattern: "ERROR", Emails: []string{"user@host.com"}},
+            {Log: "/not/existing/file.log", Pattern: "ERROR"},
+            {Log: filename, Pattern: "ERROR("},
+        },
+    }}
+    description := logger.Describe()
+    expected := []string{
+        "Config: /etc/logchecker.json\n",
+        "Service \"app\"\n",
+        "  " + filename + ": OK\n    pattern \"ERROR\"",
+        "    emails: user@host.com\n",
+        "  /not/existing/file.log: ERROR: stat /not/existing/file.log: no such file or directory\n",
+        "  " + filename + ": ERROR: error parsing regexp",
+    }
+    for _, value := range expected {
+        if !strings.Contains(description, value) {
+            t.Errorf("[%v] is not found in description:\n%v", value, description)
+        }
+    }
+    if logger.Cfg.Observed[0].Files[0].RgPattern != nil {
+        t.Errorf("files are changed by description")
+    }
+}
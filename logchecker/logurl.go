@@ -0,0 +1,62 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Links to log views
+//
+package logchecker
+
+import (
+    "fmt"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// RenderLogURL returns File.LogURL with replaced placeholders: {service},
+// {file}, {from} and {to} - RFC3339 time window of the detection,
+// {from_ms} and {to_ms} - the same window in Unix milliseconds.
+// Values are escaped for URL query.
+func (f *File) RenderLogURL(from, to time.Time) string {
+    if len(f.LogURL) == 0 {
+        return ""
+    }
+    ms := func(t time.Time) string {
+        return strconv.FormatInt(t.UnixNano() / int64(time.Millisecond), 10)
+    }
+    replacer := strings.NewReplacer(
+        "{service}", url.QueryEscape(f.serviceName()),
+        "{file}", url.QueryEscape(f.Log),
+        "{from}", url.QueryEscape(from.UTC().Format(time.RFC3339)),
+        "{to}", url.QueryEscape(to.UTC().Format(time.RFC3339)),
+        "{from_ms}", ms(from),
+        "{to_ms}", ms(to),
+    )
+    return replacer.Replace(f.LogURL)
+}
+
+// detectionLogURL returns a link to logs for the window from the previous
+// check (or the watcher start) to the last one.
+func (f *File) detectionLogURL() string {
+    from := f.prevCheck
+    if from.IsZero() {
+        from = f.LogStart
+    }
+    return f.RenderLogURL(from, f.LastCheck)
+}
+
+// validateLogURL checks that File.LogURL is an absolute URL.
+func (f *File) validateLogURL() error {
+    if len(f.LogURL) == 0 {
+        return nil
+    }
+    u, err := url.Parse(f.RenderLogURL(time.Time{}, time.Time{}))
+    if err != nil {
+        return fmt.Errorf("log_url is incorrect: %v", err)
+    }
+    if !u.IsAbs() || (len(u.Host) == 0) {
+        return fmt.Errorf("log_url should be an absolute URL")
+    }
+    return nil
+}
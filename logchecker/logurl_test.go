@@ -0,0 +1,67 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestLogURL(t *testing.T) {
+    var group sync.WaitGroup
+    f := &File{
+        Log: "/var/log/app.log",
+        LogURL: "https://kibana.host.com/app/discover?service={service}&file={file}&from={from}&to={to}&range={from_ms}-{to_ms}",
+        service: &Service{Name: "my app"},
+    }
+    from := time.Date(2015, 4, 11, 10, 0, 0, 0, time.UTC)
+    expected := "https://kibana.host.com/app/discover?service=my+app&file=%2Fvar%2Flog%2Fapp.log" +
+        "&from=2015-04-11T10%3A00%3A00Z&to=2015-04-11T10%3A05%3A00Z&range=1428746400000-1428746700000"
+    if link := f.RenderLogURL(from, from.Add(5 * time.Minute)); link != expected {
+        t.Errorf("incorrect log url: %v", link)
+    }
+    for _, incorrect := range []string{"kibana.host.com/app", "https://kibana.host.com/%zz"} {
+        f.LogURL = incorrect
+        if err := f.validateLogURL(); err == nil {
+            t.Errorf("need log_url error: %v", incorrect)
+        }
+    }
+
+    filename := filepath.Join(buildDir(), "test_log_url.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f = &File{
+        Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10,
+        LogURL: "https://grafana.host.com/explore?service={service}&from={from_ms}&to={to_ms}",
+        service: &Service{Name: "app"},
+    }
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    start := time.Now()
+    f.LogStart, f.ExtBoundary = start, f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    link := f.RenderLogURL(start, f.LastCheck)
+    if !strings.Contains(link, "service=app&from=") {
+        t.Errorf("incorrect detection log url: %v", link)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "\n\nLogs: " + link + "\n\nHost: ") {
+        t.Errorf("log url is not in the notification: %v", msg)
+    }
+}
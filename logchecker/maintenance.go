@@ -0,0 +1,235 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Maintenance windows of notifications
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "time"
+)
+
+const maintenanceLayout string = "2006-01-02 15:04"
+
+var (
+    // MaintenanceCheck is a period to check the end of maintenance windows.
+    MaintenanceCheck = time.Minute
+
+    weekdays = map[string]time.Weekday{
+        "sun": time.Sunday,
+        "mon": time.Monday,
+        "tue": time.Tuesday,
+        "wed": time.Wednesday,
+        "thu": time.Thursday,
+        "fri": time.Friday,
+        "sat": time.Saturday,
+    }
+)
+
+// MaintenanceWindow is a time window when notifications are not sent,
+// matched lines are still counted. Start and End are "HH:MM" of a daily
+// window (Days limits it by weekdays of the start) or "YYYY-MM-DD HH:MM"
+// of a single window. The local time zone is used if Timezone is empty.
+type MaintenanceWindow struct {
+    Start string      `json:"start"`
+    End string        `json:"end"`
+    Days []string     `json:"days"`
+    Timezone string   `json:"timezone"`
+    location *time.Location
+    daily bool
+    start time.Time
+    end time.Time
+    clockStart time.Duration
+    clockEnd time.Duration
+    days map[time.Weekday]bool
+}
+
+// maintenanceSummary is suppressed alerts of one notifier and recipients list.
+type maintenanceSummary struct {
+    notifier Notifier
+    to []string
+    files map[string]uint64
+}
+
+// String returns a description of the window.
+func (mw *MaintenanceWindow) String() string {
+    result := mw.Start + " - " + mw.End
+    if len(mw.Days) > 0 {
+        result += " " + strings.Join(mw.Days, ",")
+    }
+    if len(mw.Timezone) > 0 {
+        result += " " + mw.Timezone
+    }
+    return result
+}
+
+// Validate checks maintenance window settings.
+func (mw *MaintenanceWindow) Validate() error {
+    var err error
+    mw.location = time.Local
+    if len(mw.Timezone) > 0 {
+        if mw.location, err = time.LoadLocation(mw.Timezone); err != nil {
+            return fmt.Errorf("invalid maintenance timezone: %v", err)
+        }
+    }
+    mw.days = nil
+    if mw.clockStart, err = parseClock(mw.Start); err == nil {
+        mw.daily = true
+        if mw.clockEnd, err = parseClock(mw.End); err != nil {
+            return fmt.Errorf("invalid maintenance end: %v", err)
+        }
+        if mw.clockStart == mw.clockEnd {
+            return fmt.Errorf("maintenance start and end should be different")
+        }
+        for _, day := range mw.Days {
+            weekday, ok := weekdays[strings.ToLower(day)]
+            if !ok {
+                return fmt.Errorf("unknown maintenance day [%v]", day)
+            }
+            if mw.days == nil {
+                mw.days = map[time.Weekday]bool{}
+            }
+            mw.days[weekday] = true
+        }
+        return nil
+    }
+    mw.daily = false
+    if mw.start, err = time.ParseInLocation(maintenanceLayout, strings.TrimSpace(mw.Start), mw.location); err != nil {
+        return fmt.Errorf("invalid maintenance start: %v", err)
+    }
+    if mw.end, err = time.ParseInLocation(maintenanceLayout, strings.TrimSpace(mw.End), mw.location); err != nil {
+        return fmt.Errorf("invalid maintenance end: %v", err)
+    }
+    if !mw.end.After(mw.start) {
+        return fmt.Errorf("maintenance end should be after start")
+    }
+    if len(mw.Days) > 0 {
+        return fmt.Errorf("maintenance days are used only for daily windows")
+    }
+    return nil
+}
+
+// Active returns true if the time is inside the window.
+func (mw *MaintenanceWindow) Active(t time.Time) bool {
+    if !mw.daily {
+        return !t.Before(mw.start) && t.Before(mw.end)
+    }
+    t = t.In(mw.location)
+    current, day := sinceMidnight(t), t.Weekday()
+    switch {
+        case mw.clockStart < mw.clockEnd:
+            if (current < mw.clockStart) || (current >= mw.clockEnd) {
+                return false
+            }
+        case current >= mw.clockStart:
+            // the window is over midnight, it is started today
+        case current < mw.clockEnd:
+            // the window is over midnight, it was started yesterday
+            day = (day + 6) % 7
+        default:
+            return false
+    }
+    return (mw.days == nil) || mw.days[day]
+}
+
+// maintenance returns an active maintenance window.
+func (cfg *Config) maintenance(t time.Time) (*MaintenanceWindow, bool) {
+    return activeWindow(cfg.Quiet, t)
+}
+
+// activeWindow returns an active window of the list.
+func activeWindow(windows []MaintenanceWindow, t time.Time) (*MaintenanceWindow, bool) {
+    for i := range windows {
+        if windows[i].Active(t) {
+            return &windows[i], true
+        }
+    }
+    return nil, false
+}
+
+// suppressMaintenance counts a notification of the file skipped
+// by a maintenance window for every notifier of the file.
+func (logger *LogChecker) suppressMaintenance(f *File, severity string) {
+    logger.maintenanceMutex.Lock()
+    defer logger.maintenanceMutex.Unlock()
+    if logger.maintenanceSummaries == nil {
+        logger.maintenanceSummaries = map[string]*maintenanceSummary{}
+    }
+    name := fmt.Sprintf("%v / %v", f.serviceName(), f.Log)
+    for _, n := range f.fileNotifiers() {
+        notifier, err := logger.notifierByName(n, f)
+        if err != nil {
+            LoggerError.Printf("[%v]: %v", f.String(), err)
+            continue
+        }
+        to := f.severityRecipients(severity)
+        key := notifier.String() + "\n" + strings.Join(to, ",")
+        summary, ok := logger.maintenanceSummaries[key]
+        if !ok {
+            summary = &maintenanceSummary{notifier, to, map[string]uint64{}}
+            logger.maintenanceSummaries[key] = summary
+        }
+        summary.files[name]++
+    }
+}
+
+// FlushMaintenance sends one summary of notifications skipped by
+// maintenance windows per notifier and recipients list.
+// It returns a number of sent summaries.
+func (logger *LogChecker) FlushMaintenance() int {
+    logger.maintenanceMutex.Lock()
+    summaries := logger.maintenanceSummaries
+    logger.maintenanceSummaries = nil
+    logger.maintenanceMutex.Unlock()
+
+    for _, summary := range summaries {
+        var total uint64
+        names := make([]string, 0, len(summary.files))
+        for name := range summary.files {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        lines := make([]string, len(names))
+        for i, name := range names {
+            lines[i] = fmt.Sprintf("%v: %v", name, summary.files[name])
+            total += summary.files[name]
+        }
+        subject := fmt.Sprintf("%v: %v notification(s) suppressed by maintenance", DefaultSubject, total)
+        msg := fmt.Sprintf("%v notification(s) were suppressed during maintenance window.\n\n%v", total, strings.Join(lines, "\n"))
+        logger.notifyAsync(summary.notifier, subject, msg, summary.to)
+    }
+    if len(summaries) > 0 {
+        LoggerInfo.Printf("maintenance summary: %v notification(s)\n", len(summaries))
+    }
+    return len(summaries)
+}
+
+// watchMaintenance sends summaries of skipped notifications when
+// maintenance windows are finished. Summaries of a previous configuration
+// are sent immediately if no window is active.
+func (logger *LogChecker) watchMaintenance(ctx context.Context, windows []MaintenanceWindow) {
+    check := func() {
+        if _, active := activeWindow(windows, time.Now()); !active {
+            logger.FlushMaintenance()
+        }
+    }
+    check()
+    if len(windows) == 0 {
+        return
+    }
+    ticker := time.NewTicker(MaintenanceCheck)
+    defer ticker.Stop()
+    for {
+        select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                check()
+        }
+    }
+}
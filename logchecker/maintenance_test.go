@@ -0,0 +1,120 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Maintenance windows testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+    invalid := []MaintenanceWindow{
+        {Start: "25:00", End: "03:00"},
+        {Start: "01:00", End: "01:00"},
+        {Start: "01:00", End: "03:00", Days: []string{"someday"}},
+        {Start: "01:00", End: "03:00", Timezone: "Unknown/Zone"},
+        {Start: "2024-05-01 10:00", End: "2024-05-01 09:00"},
+        {Start: "2024-05-01 10:00", End: "2024-05-01 12:00", Days: []string{"mon"}},
+        {Start: "2024-05-01 10:00", End: "12:00"},
+    }
+    for i := range invalid {
+        if err := invalid[i].Validate(); err == nil {
+            t.Errorf("invalid window is accepted: %v", invalid[i].String())
+        }
+    }
+    zone := time.FixedZone("UTC+3", 3 * 3600)
+    // 2024-05-06 is Monday
+    daily := MaintenanceWindow{Start: "23:00", End: "02:00", Days: []string{"mon"}, Timezone: "UTC"}
+    single := MaintenanceWindow{Start: "2024-05-01 10:00", End: "2024-05-01 12:00", Timezone: "UTC"}
+    for _, mw := range []*MaintenanceWindow{&daily, &single} {
+        if err := mw.Validate(); err != nil {
+            t.Fatal(err)
+        }
+    }
+    values := []struct {
+        mw *MaintenanceWindow
+        t time.Time
+        active bool
+    }{
+        {&daily, time.Date(2024, 5, 6, 23, 30, 0, 0, time.UTC), true},
+        {&daily, time.Date(2024, 5, 7, 1, 30, 0, 0, time.UTC), true},
+        {&daily, time.Date(2024, 5, 7, 4, 30, 0, 0, zone), true},
+        {&daily, time.Date(2024, 5, 7, 2, 0, 0, 0, time.UTC), false},
+        {&daily, time.Date(2024, 5, 7, 23, 30, 0, 0, time.UTC), false},
+        {&daily, time.Date(2024, 5, 6, 1, 30, 0, 0, time.UTC), false},
+        {&daily, time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC), false},
+        {&single, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), true},
+        {&single, time.Date(2024, 5, 1, 14, 0, 0, 0, zone), true},
+        {&single, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), false},
+        {&single, time.Date(2024, 5, 2, 11, 0, 0, 0, time.UTC), false},
+    }
+    for i, v := range values {
+        if active := v.mw.Active(v.t); active != v.active {
+            t.Errorf("[%v] incorrect activity of %v at %v: %v", i, v.mw, v.t, active)
+        }
+    }
+}
+
+func TestMaintenance(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_maintenance.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    serv := &Service{Name: "maintenance"}
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, service: serv}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    now := time.Now()
+    logger.Cfg.Quiet = []MaintenanceWindow{{
+        Start: now.Add(-time.Hour).Format(maintenanceLayout),
+        End: now.Add(time.Hour).Format(maintenanceLayout),
+    }}
+    if err := logger.Cfg.Quiet[0].Validate(); err != nil {
+        t.Fatal(err)
+    }
+    for _, line := range []string{"ERROR 1", "ERROR 2"} {
+        if err := updateFile(filename, line); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if msg := notifier.wait(200 * time.Millisecond); len(msg) > 0 {
+        t.Fatalf("notification is sent during maintenance: %v", msg)
+    }
+    if (f.Pos != 2) || (f.Found != 2) || (f.Counter != 0) {
+        t.Errorf("incorrect file state: pos=%v, found=%v, counter=%v", f.Pos, f.Found, f.Counter)
+    }
+    if d := logger.LastDecision(serv.Name, filename); d.Action != DecisionMaintenance {
+        t.Errorf("incorrect decision: %v", d)
+    }
+    // the window is finished
+    logger.Cfg.Quiet = nil
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go logger.watchMaintenance(ctx, nil)
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "2 notification(s) were suppressed") || !strings.Contains(msg, "maintenance / " + filename + ": 2") {
+        t.Errorf("incorrect maintenance summary: %v", msg)
+    }
+    if n := logger.FlushMaintenance(); n != 0 {
+        t.Errorf("summary is sent twice: %v", n)
+    }
+}
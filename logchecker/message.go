@@ -0,0 +1,118 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notification messages
+//
+package logchecker
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+    "text/template"
+)
+
+// DefaultMessageTemplate is a default template of the file's notification message.
+const DefaultMessageTemplate string = "{{.Preamble}}\n\nReport for \"{{.Service}}\" service ({{.Found}} new items, severity: {{.Severity}}): {{.File}}\n{{if .Escalation}}Escalated alert: {{.Escalation}} consecutive notifications of the period.\n{{end}}{{if .Burst}}Burst alert: {{.Burst}} lines are found by one check.\n{{end}}{{join .Lines \"\\n\"}}{{.Context}}{{if .LogURL}}\n\nLogs: {{.LogURL}}{{end}}\n\nHost: {{.Hostname}}{{if .Environment}} ({{.Environment}}){{end}}\n\n--\nBR, LogChecker"
+
+var (
+    messageFuncs = template.FuncMap{"join": strings.Join}
+    defaultMessage = template.Must(template.New("message").Funcs(messageFuncs).Parse(DefaultMessageTemplate))
+)
+
+// MessageData is a data of "message_template".
+type MessageData struct {
+    Preamble string
+    Service string
+    File string
+    Found uint64
+    Boundary uint64
+    Burst uint64
+    Escalation uint64
+    Severity string
+    Lines []string
+    Context string
+    Hostname string
+    Environment string
+    LogURL string
+}
+
+// preamble returns the first line of notification messages,
+// "preamble" config field or the default one.
+func (cfg *Config) preamble() string {
+    if len(cfg.Preamble) > 0 {
+        return cfg.Preamble
+    }
+    return emailMsg
+}
+
+// maxLines returns a maximum number of report lines of the file's message,
+// File.MaxLines or the default limit.
+func (f *File) maxLines() uint64 {
+    if f.MaxLines > 0 {
+        return f.MaxLines
+    }
+    return maxMsgLines + 1
+}
+
+// parseMessage parses and checks a message template,
+// it's executed with empty data to find unknown fields.
+func parseMessage(text string) (*template.Template, error) {
+    tmpl, err := template.New("message").Funcs(messageFuncs).Parse(text)
+    if err != nil {
+        return nil, err
+    }
+    if err := tmpl.Execute(&bytes.Buffer{}, MessageData{}); err != nil {
+        return nil, err
+    }
+    return tmpl, nil
+}
+
+// messageTemplate returns a template of the file's messages, File.MessageTemplate
+// has priority over the global one. Templates are parsed during the validation,
+// not validated ones are parsed here.
+func (logger *LogChecker) messageTemplate(f *File) (*template.Template, error) {
+    switch {
+        case f.message != nil:
+            return f.message, nil
+        case len(f.MessageTemplate) > 0:
+            return parseMessage(f.MessageTemplate)
+        case logger.Cfg.message != nil:
+            return logger.Cfg.message, nil
+        case len(logger.Cfg.MessageTemplate) > 0:
+            return parseMessage(logger.Cfg.MessageTemplate)
+    }
+    return defaultMessage, nil
+}
+
+// fileMessage renders a notification message of the file,
+// the default template is used if the message can't be rendered.
+func (logger *LogChecker) fileMessage(f *File, lines []string, severity string) string {
+    var buf bytes.Buffer
+    data := MessageData{
+        Preamble: logger.Cfg.preamble(),
+        Service: fmt.Sprint(f.service),
+        File: f.Log,
+        Found: f.Found,
+        Boundary: f.ExtBoundary,
+        Burst: f.burst,
+        Escalation: f.escalation,
+        Severity: severity,
+        Lines: lines,
+        Context: f.contextReport(),
+        Hostname: logger.Cfg.Host(),
+        Environment: logger.Cfg.Environment,
+        LogURL: f.detectionLogURL(),
+    }
+    tmpl, err := logger.messageTemplate(f)
+    if err == nil {
+        err = tmpl.Execute(&buf, data)
+    }
+    if err != nil {
+        LoggerError.Printf("message template error, default message is used [%v]: %v", f.Base(), err)
+        buf.Reset()
+        defaultMessage.Execute(&buf, data)
+    }
+    return buf.String()
+}
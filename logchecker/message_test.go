@@ -0,0 +1,105 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestFileMessage(t *testing.T) {
+    logger := New()
+    f := &File{Log: "/var/log/app.log", Pattern: "ERROR", Found: 12, ExtBoundary: 10, service: &Service{Name: "app"}}
+    lines := []string{"1: ERROR 1", "2: ERROR 2"}
+    hostname, _ := os.Hostname()
+    for _, serv := range []*Service{f.service, nil} {
+        f.service = serv
+        expected := fmt.Sprintf("%v\n\nReport for \"%v\" service (%v new items, severity: %v): %v\n%v%v\n\nHost: %v\n\n--\nBR, LogChecker", emailMsg, f.service, f.Found, SeverityWarning, f.Log, strings.Join(lines, "\n"), f.contextReport(), hostname)
+        if msg := logger.fileMessage(f, lines, SeverityWarning); msg != expected {
+            t.Errorf("incorrect default message: %q", msg)
+        }
+    }
+    f.service = &Service{Name: "app"}
+    // the configured hostname and environment
+    logger.Cfg.Hostname, logger.Cfg.Environment = "web-1", "prod"
+    if msg := logger.fileMessage(f, lines, SeverityWarning); !strings.Contains(msg, "\n\nHost: web-1 (prod)\n\n--") {
+        t.Errorf("incorrect host in the message: %v", msg)
+    }
+    if subject := logger.Cfg.defaultSubject(); subject != DefaultSubject + ": web-1 (prod)" {
+        t.Errorf("incorrect default subject: %v", subject)
+    }
+    if s := logger.Cfg.String(); !strings.Contains(s, "host web-1 (prod)") {
+        t.Errorf("incorrect config string: %v", s)
+    }
+    if report := logger.StatsReport(); !strings.Contains(report, "host=web-1, environment=prod, running=") {
+        t.Errorf("incorrect stats report: %v", report)
+    }
+    logger.Cfg.Hostname, logger.Cfg.Environment = "", ""
+    logger.Cfg.MessageTemplate = "{{.Hostname}} {{.Service}}: {{.Found}}/{{.Boundary}}"
+    if msg := logger.fileMessage(f, lines, SeverityWarning); msg != hostname + " app: 12/10" {
+        t.Errorf("incorrect global message: %v", msg)
+    }
+    f.MessageTemplate = "{{.File}}\n{{range .Lines}}> {{.}}\n{{end}}"
+    if err := f.validate(false); err != nil {
+        t.Fatal(err)
+    }
+    if msg := logger.fileMessage(f, lines, SeverityWarning); msg != "/var/log/app.log\n> 1: ERROR 1\n> 2: ERROR 2\n" {
+        t.Errorf("file message should have priority: %v", msg)
+    }
+    // errors are found by the validation
+    for _, text := range []string{"{{.Found", "{{.Unknown}}", "{{unknown .Lines}}"} {
+        f.MessageTemplate = text
+        if err := f.validate(false); err == nil {
+            t.Errorf("need file template error: %v", text)
+        }
+        cfg := Config{
+            Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+            Storage: "memory",
+            MessageTemplate: text,
+        }
+        if err := ValidateConfig(cfg, ValidateOptions{}); (err == nil) || !strings.Contains(err.Error(), "message_template") {
+            t.Errorf("need global template error [%v]: %v", text, err)
+        }
+    }
+}
+
+func TestMaxLines(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_max_lines.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, MaxLines: 3}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, "ERROR 1", "ERROR 2", "ERROR 3", "ERROR 4", "ERROR 5"); err != nil {
+        t.Fatal(err)
+    }
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    logger.Cfg.Preamble = "Custom preamble."
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "1: ERROR 1\n2: ERROR 2\n3: ERROR 3\n...\n") || strings.Contains(msg, "ERROR 4") {
+        t.Errorf("report should be truncated after 3 lines: %v", msg)
+    }
+    if !strings.HasPrefix(msg, "Custom preamble.\n\nReport for ") {
+        t.Errorf("incorrect message preamble: %v", msg)
+    }
+    if f.Found != 5 {
+        t.Errorf("incorrect number of found lines: %v", f.Found)
+    }
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Prometheus metrics
+//
+package logchecker
+
+import (
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// metricFile is a label set of file metrics.
+type metricFile struct {
+    service string
+    file string
+}
+
+// Metrics are counters of matches and notifications, they are kept
+// during configuration reloads.
+type Metrics struct {
+    mutex sync.Mutex
+    matches map[metricFile]uint64
+    notifications map[string]uint64
+    watched int
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// addMatches increments matched lines counter of the file.
+func (m *Metrics) addMatches(f *File, n uint64) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if m.matches == nil {
+        m.matches = make(map[metricFile]uint64)
+    }
+    m.matches[metricFile{f.serviceName(), f.Log}] += n
+}
+
+// addNotification increments notifications counter of the file's service.
+func (m *Metrics) addNotification(f *File) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+    if m.notifications == nil {
+        m.notifications = make(map[string]uint64)
+    }
+    m.notifications[f.serviceName()]++
+}
+
+// setWatched sets a number of watched files.
+func (m *Metrics) setWatched(n int) {
+    m.mutex.Lock()
+    m.watched = n
+    m.mutex.Unlock()
+}
+
+// WriteTo writes metrics in Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+    var b strings.Builder
+    m.mutex.Lock()
+    files := make([]metricFile, 0, len(m.matches))
+    for key := range m.matches {
+        files = append(files, key)
+    }
+    sort.Slice(files, func(i, j int) bool {
+        if files[i].service != files[j].service {
+            return files[i].service < files[j].service
+        }
+        return files[i].file < files[j].file
+    })
+    b.WriteString("# HELP logchecker_matches_total Matched lines of watched files.\n")
+    b.WriteString("# TYPE logchecker_matches_total counter\n")
+    for _, key := range files {
+        fmt.Fprintf(&b, "logchecker_matches_total{service=\"%v\",file=\"%v\"} %v\n",
+            labelReplacer.Replace(key.service), labelReplacer.Replace(key.file), m.matches[key])
+    }
+    services := make([]string, 0, len(m.notifications))
+    for service := range m.notifications {
+        services = append(services, service)
+    }
+    sort.Strings(services)
+    b.WriteString("# HELP logchecker_notifications_total Sent notifications of services.\n")
+    b.WriteString("# TYPE logchecker_notifications_total counter\n")
+    for _, service := range services {
+        fmt.Fprintf(&b, "logchecker_notifications_total{service=\"%v\"} %v\n",
+            labelReplacer.Replace(service), m.notifications[service])
+    }
+    b.WriteString("# HELP logchecker_files_watched Number of watched files.\n")
+    b.WriteString("# TYPE logchecker_files_watched gauge\n")
+    fmt.Fprintf(&b, "logchecker_files_watched %v\n", m.watched)
+    m.mutex.Unlock()
+    n, err := io.WriteString(w, b.String())
+    return int64(n), err
+}
+
+// serviceName returns a name of the file's service.
+func (f *File) serviceName() string {
+    if f.service == nil {
+        return ""
+    }
+    return f.service.Name
+}
+
+// MetricsHandler returns HTTP handler of Prometheus metrics on /metrics path.
+func (logger *LogChecker) MetricsHandler() http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != "GET" {
+            http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+        if _, err := logger.metrics.WriteTo(w); err != nil {
+            LoggerError.Printf("metrics writing error: %v\n", err)
+        }
+    })
+    return mux
+}
+
+// ListenMetrics starts HTTP server of Prometheus metrics.
+func (logger *LogChecker) ListenMetrics(addr string) {
+    go func() {
+        LoggerInfo.Printf("metrics are listening on %v\n", addr)
+        if err := http.ListenAndServe(addr, logger.MetricsHandler()); err != nil {
+            LoggerError.Printf("metrics server error: %v\n", err)
+        }
+    }()
+}
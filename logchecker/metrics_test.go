@@ -0,0 +1,66 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Prometheus metrics testing methods
+//
+package logchecker
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestMetrics(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_metrics.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    if err := updateFile(filename, "ERROR 1", "line", "ERROR 2"); err != nil {
+        t.Fatal(err)
+    }
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, service: &Service{Name: "app"}}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    logger.metrics.setWatched(1)
+    server := httptest.NewServer(logger.MetricsHandler())
+    defer server.Close()
+    resp, err := http.Get(server.URL + "/metrics")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    data, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body := string(data)
+    expected := []string{
+        "# TYPE logchecker_matches_total counter",
+        "logchecker_matches_total{service=\"app\",file=\"" + filename + "\"} 2\n",
+        "logchecker_notifications_total{service=\"app\"} 1\n",
+        "# TYPE logchecker_files_watched gauge",
+        "logchecker_files_watched 1\n",
+    }
+    for _, value := range expected {
+        if !strings.Contains(body, value) {
+            t.Errorf("metric [%v] is not found:\n%v", value, body)
+        }
+    }
+}
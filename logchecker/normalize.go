@@ -0,0 +1,59 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Normalization of log lines
+//
+package logchecker
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "regexp"
+    "strings"
+)
+
+// maxFingerprints is a maximum number of distinct fingerprints per file and time period.
+const maxFingerprints int = 1000
+
+var (
+    rgUUID = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+    rgHex = regexp.MustCompile(`(?i)\b(0x[0-9a-f]+|[0-9a-f]{8,})\b`)
+    rgNumber = regexp.MustCompile(`\b\d+(\.\d+)?`)
+)
+
+// Normalize replaces UUIDs, hexadecimal and numeric tokens by placeholders,
+// so lines that differ only by identifiers have the same normalized form.
+func Normalize(line string) string {
+    line = rgUUID.ReplaceAllString(line, "<uuid>")
+    line = rgHex.ReplaceAllStringFunc(line, func(token string) string {
+        // words like "deadbeef" are kept, pure numbers are replaced later
+        if (strings.IndexAny(token, "0123456789") < 0) || (strings.IndexAny(token, "abcdefxABCDEFX") < 0) {
+            return token
+        }
+        return "<hex>"
+    })
+    return rgNumber.ReplaceAllString(line, "<num>")
+}
+
+// Fingerprint returns a hash of a line, the line is normalized
+// before hashing if File.Normalize is set.
+func (f *File) Fingerprint(line string) string {
+    if f.Normalize {
+        line = Normalize(line)
+    }
+    sum := sha1.Sum([]byte(line))
+    return hex.EncodeToString(sum[:])
+}
+
+// addFingerprints counts matched lines by fingerprints during time period.
+func (f *File) addFingerprints(fingerprints map[string]uint64) {
+    if f.Fingerprints == nil {
+        f.Fingerprints = make(map[string]uint64)
+    }
+    for fp, n := range fingerprints {
+        if _, ok := f.Fingerprints[fp]; ok || (len(f.Fingerprints) < maxFingerprints) {
+            f.Fingerprints[fp] += n
+        }
+    }
+}
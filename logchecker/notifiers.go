@@ -0,0 +1,198 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Registry of notifiers
+//
+package logchecker
+
+import (
+    "errors"
+    "fmt"
+    "sync"
+)
+
+// EmailNotifier is a name of the built-in email notifier.
+const EmailNotifier string = "email"
+
+var (
+    registryMutex sync.RWMutex
+    registry = map[string]Notifier{}
+)
+
+// RegisterNotifier adds a named notifier to the global registry,
+// so files can reference it in "notifiers" config field.
+// A notifier with the same name is replaced.
+func RegisterNotifier(name string, n Notifier) error {
+    if len(name) == 0 {
+        return fmt.Errorf("notifier name should not be empty")
+    }
+    switch name {
+        case EmailNotifier, SlackNotifierName, SyslogNotifierName, ExecNotifierName, WebhookNotifierName, ChatNotifierName:
+            return fmt.Errorf("notifier name [%v] is reserved", name)
+    }
+    if n == nil {
+        return fmt.Errorf("notifier should not be nil")
+    }
+    registryMutex.Lock()
+    defer registryMutex.Unlock()
+    registry[name] = n
+    LoggerDebug.Printf("notifier is registered: %v\n", name)
+    return nil
+}
+
+// UnregisterNotifier removes a named notifier from the global registry.
+func UnregisterNotifier(name string) {
+    registryMutex.Lock()
+    defer registryMutex.Unlock()
+    delete(registry, name)
+}
+
+// fileNotifiers returns names of file's notifiers, service's notifiers
+// are used if the file doesn't have own ones, email is used by default.
+func (f *File) fileNotifiers() []string {
+    switch {
+        case len(f.Notifiers) > 0:
+            return f.Notifiers
+        case (f.service != nil) && (len(f.service.Notifiers) > 0):
+            return f.service.Notifiers
+    }
+    return []string{EmailNotifier}
+}
+
+// hasNotifier checks that a notifier name is known.
+func (cfg *Config) hasNotifier(name string) bool {
+    switch name {
+        case EmailNotifier:
+            return true
+        case SlackNotifierName:
+            if len(cfg.Slack) > 0 {
+                return true
+            }
+        case SyslogNotifierName:
+            if len(cfg.Syslog) > 0 {
+                return true
+            }
+        case ExecNotifierName:
+            if cfg.Exec != nil {
+                return true
+            }
+        case WebhookNotifierName:
+            if cfg.Webhook != nil {
+                return true
+            }
+        case ChatNotifierName:
+            if len(cfg.Chat) > 0 {
+                return true
+            }
+    }
+    if _, ok := cfg.Notifiers[name]; ok {
+        return true
+    }
+    registryMutex.RLock()
+    defer registryMutex.RUnlock()
+    _, ok := registry[name]
+    return ok
+}
+
+// notifierByName returns a notifier by its name, configuration notifiers
+// have priority over the global registry.
+func (logger *LogChecker) notifierByName(name string, f *File) (Notifier, error) {
+    if name == EmailNotifier {
+        switch {
+            case logger.notifier != nil:
+                return logger.notifier, nil
+            case debug && (DefaultNotifier != nil):
+                return DefaultNotifier, nil
+            case debug:
+                return &debugSender{"debugSender"}, nil
+        }
+        return logger.emailNotifier(f.Delivery), nil
+    }
+    if (name == SlackNotifierName) && (len(logger.Cfg.Slack) > 0) {
+        sn, err := NewSlackNotifier(logger.Cfg.Slack)
+        if err != nil {
+            return nil, err
+        }
+        sn.Escape = logger.Cfg.Sanitize.escapes()
+        return sn, nil
+    }
+    if (name == ChatNotifierName) && (len(logger.Cfg.Chat) > 0) {
+        cn, err := NewChatNotifier(logger.Cfg.Chat)
+        if err != nil {
+            return nil, err
+        }
+        cn.Escape = logger.Cfg.Sanitize.escapes()
+        return cn, nil
+    }
+    if (name == SyslogNotifierName) && (len(logger.Cfg.Syslog) > 0) {
+        sn, err := logger.syslogNotifier()
+        if err != nil {
+            return nil, err
+        }
+        return sn, nil
+    }
+    if (name == ExecNotifierName) && (logger.Cfg.Exec != nil) {
+        return logger.execNotifier(f)
+    }
+    if (name == WebhookNotifierName) && (logger.Cfg.Webhook != nil) {
+        return logger.webhookNotifier(f)
+    }
+    if n, ok := logger.Cfg.Notifiers[name]; ok {
+        return n, nil
+    }
+    registryMutex.RLock()
+    defer registryMutex.RUnlock()
+    if n, ok := registry[name]; ok {
+        return n, nil
+    }
+    return nil, fmt.Errorf("unknown notifier [%v]", name)
+}
+
+// hasNotifier checks that the notifier name is used by the file.
+func (f *File) hasNotifier(name string) bool {
+    for _, n := range f.fileNotifiers() {
+        if n == name {
+            return true
+        }
+    }
+    return false
+}
+
+// notifyFile sends a message to all notifiers of the file,
+// it's pushed to the digest aggregator if digests are enabled.
+// An error is returned if no notifier delivered or queued the message.
+func (logger *LogChecker) notifyFile(f *File, subject, message, severity string) error {
+    var errs []error
+    names := f.fileNotifiers()
+    for _, name := range names {
+        notifier, err := logger.notifierByName(name, f)
+        if err != nil {
+            LoggerError.Printf("[%v]: %v", f.String(), err)
+            errs = append(errs, err)
+            continue
+        }
+        to := f.escalationRecipients(f.severityRecipients(severity))
+        alert := queuedAlert{notifier, subject, message, to, severity, f.Log, f.Found, f.attachment}
+        if logger.digest(f, alert) {
+            continue
+        }
+        if err := logger.dispatchSync(alert); err != nil {
+            LoggerError.Printf("notification error [%v]: %v", notifier, err)
+            errs = append(errs, fmt.Errorf("%v: %v", notifier, err))
+        }
+    }
+    if len(errs) == len(names) {
+        return errors.Join(errs...)
+    }
+    return nil
+}
+
+// resetNotifiers releases shared notifiers after the configuration change.
+func (logger *LogChecker) resetNotifiers() {
+    logger.resetSyslog()
+    logger.resetWebhook()
+    logger.execMutex.Lock()
+    logger.exec = nil
+    logger.execMutex.Unlock()
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notifiers registry testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestRegisterNotifier(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    global, local, email := newRecordNotifier(), newRecordNotifier(), newRecordNotifier()
+    if err := RegisterNotifier(EmailNotifier, global); err == nil {
+        t.Errorf("need reserved name error")
+    }
+    if err := RegisterNotifier("", global); err == nil {
+        t.Errorf("need empty name error")
+    }
+    if err := RegisterNotifier("test-global", global); err != nil {
+        t.Fatal(err)
+    }
+    defer UnregisterNotifier("test-global")
+
+    filename := filepath.Join(buildDir(), "test_notifiers.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer rm(filename)
+    logger := New()
+    logger.notifier = email
+    logger.Cfg.Storage = "memory"
+    logger.Cfg.Sender = map[string]string{
+        "user": "user@host.com",
+        "password": "password",
+        "host": "smtp.host.com",
+        "addr": "smtp.host.com:25",
+    }
+    logger.Cfg.Notifiers = map[string]Notifier{"test-local": local}
+    f := File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Emails: []string{"user@host.com"}}
+    f.Notifiers = []string{"test-global", "unknown"}
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{f}}}
+    if err := logger.Validate(); err == nil {
+        t.Errorf("need unknown notifier error")
+    }
+    f.Notifiers = []string{"test-global", "test-local", EmailNotifier}
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{f}}}
+    if err := logger.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    fp := &logger.Cfg.Observed[0].Files[0]
+    if err := fp.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    fp.LogStart, fp.ExtBoundary = time.Now(), fp.Boundary
+    if err := updateFile(filename, "ERROR"); err != nil {
+        t.Fatal(err)
+    }
+    if err := fp.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    for name, n := range map[string]*recordNotifier{"global": global, "local": local, "email": email} {
+        if msg := n.wait(time.Second); len(msg) == 0 {
+            t.Errorf("notification is not sent by %v notifier", name)
+        }
+    }
+}
+
+func TestDefaultNotifier(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_default_notifier.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    fake := newRecordNotifier()
+    DebugMode(true)
+    DefaultNotifier = fake
+    defer func() {
+        DefaultNotifier = nil
+    }()
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    if err := updateFile(filename, "ERROR 1"); err != nil {
+        t.Fatal(err)
+    }
+    logger := New()
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if msg := fake.wait(time.Second); !strings.Contains(msg, "1: ERROR 1") {
+        t.Errorf("notification is not captured: %v", msg)
+    }
+    // the default debug sender is used without DefaultNotifier
+    DefaultNotifier = nil
+    n, err := logger.notifierByName(EmailNotifier, f)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := n.(*debugSender); !ok {
+        t.Errorf("incorrect debug notifier: %v", n)
+    }
+}
+
+func TestServiceNotifiers(t *testing.T) {
+    var group sync.WaitGroup
+    custom := newRecordNotifier()
+    if err := RegisterNotifier("test-service", custom); err != nil {
+        t.Fatal(err)
+    }
+    defer UnregisterNotifier("test-service")
+    filename := filepath.Join(buildDir(), "test_service_notifiers.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Storage = "memory"
+    logger.Cfg.Sender = map[string]string{
+        "user": "user@host.com",
+        "password": "password",
+        "host": "smtp.host.com",
+        "addr": "smtp.host.com:25",
+    }
+    f := File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10}
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{f}, Notifiers: []string{"unknown"}}}
+    if err := logger.Validate(); err == nil {
+        t.Errorf("need unknown notifier error")
+    }
+    logger.Cfg.Observed[0].Notifiers = []string{"test-service"}
+    if err := logger.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    fp := &logger.Cfg.Observed[0].Files[0]
+    if err := fp.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    fp.service = &logger.Cfg.Observed[0]
+    fp.LogStart, fp.ExtBoundary = time.Now(), fp.Boundary
+    if err := updateFile(filename, "ERROR"); err != nil {
+        t.Fatal(err)
+    }
+    if err := fp.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if msg := custom.wait(time.Second); len(msg) == 0 {
+        t.Errorf("notification is not sent by service notifier")
+    }
+    if msg := logger.notifier.(*recordNotifier).wait(100 * time.Millisecond); len(msg) > 0 {
+        t.Errorf("email notifier should not be used: %v", msg)
+    }
+    // file's notifiers have priority
+    fp.Notifiers = []string{EmailNotifier}
+    if names := fp.fileNotifiers(); (len(names) != 1) || (names[0] != EmailNotifier) {
+        t.Errorf("incorrect file notifiers: %v", names)
+    }
+}
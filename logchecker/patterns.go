@@ -0,0 +1,123 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Severity patterns with own recipients
+//
+package logchecker
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// SeverityPattern is an additional pattern of the file,
+// its matched lines have own severity and recipients.
+type SeverityPattern struct {
+    Pattern string    `json:"pattern"`
+    Severity string   `json:"severity"`
+    Emails []string   `json:"emails"`
+    rgPattern *regexp.Regexp
+}
+
+// validatePatterns compiles severity patterns, at least one
+// severity should have recipients.
+func (f *File) validatePatterns() error {
+    var (
+        err error
+        recipients bool
+    )
+    for i := range f.Patterns {
+        p := &f.Patterns[i]
+        if len(p.Pattern) == 0 {
+            return fmt.Errorf("severity pattern should not be empty")
+        }
+        if _, ok := severityLevels[p.Severity]; !ok {
+            return fmt.Errorf("unknown pattern severity [%v]", p.Severity)
+        }
+        p.rgPattern, err = regexp.Compile(f.expression(p.Pattern))
+        if err != nil {
+            return fmt.Errorf("severity pattern error [%v]: %v", p.Pattern, err)
+        }
+        recipients = recipients || (len(p.Emails) > 0)
+    }
+    if (len(f.Patterns) > 0) && !recipients {
+        return fmt.Errorf("patterns should have emails of at least one severity")
+    }
+    return nil
+}
+
+// matchLine checks the line by the file's pattern and severity patterns,
+// it returns the highest severity of matched ones. A value of the field
+// is checked for json format, not JSON lines are skipped and counted.
+func (f *File) matchLine(line string) (string, bool) {
+    var (
+        severity string
+        matched bool
+    )
+    text := line
+    if f.Format == FormatJSON {
+        value, err := f.jsonField(line)
+        if err != nil {
+            f.ParseErrors++
+            LoggerDebug.Printf("line is skipped [%v]: %v", f.Base(), err)
+            return "", false
+        }
+        text = value
+    }
+    if (f.RgPattern != nil) && f.RgPattern.MatchString(text) {
+        severity, matched = f.LineSeverity(line), true
+    }
+    for _, p := range f.Patterns {
+        if (p.rgPattern == nil) || !p.rgPattern.MatchString(text) {
+            continue
+        }
+        if matched {
+            severity = MaxSeverity(severity, p.Severity)
+        } else {
+            severity, matched = p.Severity, true
+        }
+    }
+    return severity, matched
+}
+
+// severityRecipients returns emails of severity patterns with the
+// notification's severity, effective file recipients are used by default.
+func (f *File) severityRecipients(severity string) []string {
+    var emails []string
+    found := map[string]bool{}
+    for _, p := range f.Patterns {
+        if p.Severity != severity {
+            continue
+        }
+        for _, email := range p.Emails {
+            if !found[email] {
+                found[email] = true
+                emails = append(emails, email)
+            }
+        }
+    }
+    if len(emails) == 0 {
+        return f.recipients()
+    }
+    return emails
+}
+
+// severitySubject adds the triggering severity to the subject
+// of a file with severity patterns.
+func (f *File) severitySubject(subject, severity string) string {
+    if (len(f.Patterns) == 0) || strings.Contains(subject, severity) {
+        return subject
+    }
+    return SanitizeSubject(fmt.Sprintf("[%v] %v", strings.ToUpper(severity), subject))
+}
+
+// patternSet returns all regular expressions of the file and its matched field.
+func (f *File) patternSet() string {
+    expressions := []string{f.Format + ":" + f.Field + ":" + f.Expression()}
+    for _, p := range f.Patterns {
+        expressions = append(expressions, p.Severity + ":" + f.expression(p.Pattern))
+    }
+    return strings.Join(expressions, "\n")
+}
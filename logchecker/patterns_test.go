@@ -0,0 +1,93 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "context"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSeverityPatterns(t *testing.T) {
+    var group sync.WaitGroup
+    type mail struct {
+        to []string
+        msg string
+    }
+    mails := make(chan mail, 10)
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        mails <- mail{to, string(msg)}
+        return nil
+    }
+    incorrect := [][]SeverityPattern{
+        {{Pattern: "WARN", Severity: SeverityWarning}},
+        {{Pattern: "", Severity: SeverityWarning, Emails: []string{"list@host.com"}}},
+        {{Pattern: "WARN", Severity: "unknown", Emails: []string{"list@host.com"}}},
+        {{Pattern: "WARN(", Severity: SeverityWarning, Emails: []string{"list@host.com"}}},
+    }
+    for _, patterns := range incorrect {
+        f := &File{Log: "/var/log/test.log", Patterns: patterns}
+        if err := f.validate(false); err == nil {
+            t.Errorf("need validation error: %v", patterns)
+        }
+    }
+    filename := filepath.Join(buildDir(), "test_severity_patterns.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = logger
+    logger.Cfg.DuplicateWindow = -1
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com:25"}
+    f := &File{
+        Log: filename, Boundary: 1, Period: 3600, Limit: 10,
+        Patterns: []SeverityPattern{
+            {Pattern: "WARN", Severity: SeverityWarning, Emails: []string{"list@host.com"}},
+            {Pattern: "CRIT", Severity: SeverityCritical, Emails: []string{"pager@host.com"}},
+        },
+        service: &Service{Name: "app"},
+    }
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    check := func(lines, recipient, severity string) {
+        if err := updateFile(filename, lines); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        select {
+            case m := <-mails:
+                if (len(m.to) != 1) || (m.to[0] != recipient) {
+                    t.Errorf("[%v] incorrect recipients: %v", severity, m.to)
+                }
+                subject := "Subject: [" + strings.ToUpper(severity) + "] " + logger.Cfg.defaultSubject() + "\n"
+                if !strings.Contains(m.msg, subject) {
+                    t.Errorf("[%v] incorrect subject: %v", severity, m.msg)
+                }
+                if !strings.Contains(m.msg, "severity: " + severity + ")") {
+                    t.Errorf("[%v] severity is not in the message: %v", severity, m.msg)
+                }
+            case <-time.After(time.Second):
+                t.Errorf("[%v] email is not sent", severity)
+        }
+    }
+    check("INFO a\nWARN b", "list@host.com", SeverityWarning)
+    check("WARN c\nCRIT d", "pager@host.com", SeverityCritical)
+    if f.Found != 3 {
+        t.Errorf("incorrect found counter: %v", f.Found)
+    }
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Multiple time periods of notification limits
+//
+package logchecker
+
+import (
+    "fmt"
+    "time"
+)
+
+const (
+    // PeriodHour is an hourly period of notification limits.
+    PeriodHour string = "hour"
+    // PeriodDay is a daily period of notification limits.
+    PeriodDay string = "day"
+    // PeriodWeek is a weekly period of notification limits, weeks start on Monday.
+    PeriodWeek string = "week"
+)
+
+// periodNow returns current time for period limits, it's replaced in tests.
+var periodNow = time.Now
+
+// PeriodLimit is a maximum number of notifications for a calendar period,
+// every period has an independent counter that is reset on the period boundary.
+type PeriodLimit struct {
+    Period string     `json:"period"`
+    Limit uint64      `json:"limit"`
+    Counter uint64    // sent notifications for current period
+    start time.Time   // start of current period
+}
+
+// Validate checks period limit settings.
+func (pl *PeriodLimit) Validate() error {
+    switch pl.Period {
+        case PeriodHour, PeriodDay, PeriodWeek:
+        default:
+            return fmt.Errorf("unknown period [%v]", pl.Period)
+    }
+    if pl.Limit == 0 {
+        return fmt.Errorf("limit of period [%v] should be positive", pl.Period)
+    }
+    return nil
+}
+
+// periodStart returns a local start time of the period that contains t.
+func periodStart(period string, t time.Time) time.Time {
+    year, month, day := t.Date()
+    switch period {
+        case PeriodHour:
+            return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+        case PeriodWeek:
+            // days since Monday
+            shift := (int(t.Weekday()) + 6) % 7
+            return time.Date(year, month, day - shift, 0, 0, 0, 0, t.Location())
+    }
+    return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// reset sets the counter to zero if t is out of current period.
+func (pl *PeriodLimit) reset(t time.Time) bool {
+    start := periodStart(pl.Period, t)
+    if start.Equal(pl.start) {
+        return false
+    }
+    pl.start, pl.Counter = start, 0
+    return true
+}
+
+// validatePeriods checks period limits of the file, every period can be used once.
+func (f *File) validatePeriods() error {
+    periods := map[string]bool{}
+    for i := range f.Periods {
+        if err := f.Periods[i].Validate(); err != nil {
+            return err
+        }
+        if periods[f.Periods[i].Period] {
+            return fmt.Errorf("duplicate period [%v]", f.Periods[i].Period)
+        }
+        periods[f.Periods[i].Period] = true
+    }
+    return nil
+}
+
+// resetPeriods resets counters of finished periods.
+func (f *File) resetPeriods(t time.Time) {
+    for i := range f.Periods {
+        if f.Periods[i].reset(t) {
+            LoggerDebug.Printf("%v period was reset [%v]", f.Periods[i].Period, f.Base())
+        }
+    }
+}
+
+// PeriodsAllow returns true if no period limit is reached.
+func (f *File) PeriodsAllow() bool {
+    _, reached := f.reachedPeriod()
+    return !reached
+}
+
+// reachedPeriod returns the first period which limit is reached.
+func (f *File) reachedPeriod() (PeriodLimit, bool) {
+    for _, pl := range f.Periods {
+        if pl.Counter >= pl.Limit {
+            return pl, true
+        }
+    }
+    return PeriodLimit{}, false
+}
+
+// countPeriods increments counters of all periods after a notification.
+func (f *File) countPeriods() {
+    for i := range f.Periods {
+        f.Periods[i].Counter++
+    }
+}
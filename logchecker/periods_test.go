@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestPeriodStart(t *testing.T) {
+    // 2015-04-15 is Wednesday
+    moment := time.Date(2015, 4, 15, 13, 45, 30, 0, time.Local)
+    cases := map[string]time.Time{
+        PeriodHour: time.Date(2015, 4, 15, 13, 0, 0, 0, time.Local),
+        PeriodDay: time.Date(2015, 4, 15, 0, 0, 0, 0, time.Local),
+        PeriodWeek: time.Date(2015, 4, 13, 0, 0, 0, 0, time.Local),
+    }
+    for period, expected := range cases {
+        if start := periodStart(period, moment); !start.Equal(expected) {
+            t.Errorf("incorrect start of %v period: %v", period, start)
+        }
+    }
+    sunday := time.Date(2015, 4, 19, 23, 0, 0, 0, time.Local)
+    if start := periodStart(PeriodWeek, sunday); !start.Equal(cases[PeriodWeek]) {
+        t.Errorf("incorrect start of week for Sunday: %v", start)
+    }
+    for _, incorrect := range [][]PeriodLimit{
+        {{Period: "month", Limit: 1}},
+        {{Period: PeriodHour}},
+        {{Period: PeriodDay, Limit: 1}, {Period: PeriodDay, Limit: 2}},
+    } {
+        f := &File{Periods: incorrect}
+        if err := f.validatePeriods(); err == nil {
+            t.Errorf("need validation error: %v", incorrect)
+        }
+    }
+}
+
+func TestPeriods(t *testing.T) {
+    var group sync.WaitGroup
+    // fake clock, Sunday 2015-04-19 22:30
+    now := time.Date(2015, 4, 19, 22, 30, 0, 0, time.Local)
+    periodNow = func() time.Time { return now }
+    defer func() { periodNow = time.Now }()
+
+    filename := filepath.Join(buildDir(), "test_periods.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{
+        Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600 * 24 * 30, Limit: 100,
+        Periods: []PeriodLimit{{Period: PeriodHour, Limit: 2}, {Period: PeriodDay, Limit: 3}, {Period: PeriodWeek, Limit: 4}},
+    }
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+
+    check := func(shift time.Duration, sent bool, counters ...uint64) {
+        now = now.Add(shift)
+        if err := updateFile(filename, "ERROR line"); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        msg := notifier.wait(100 * time.Millisecond)
+        if (len(msg) > 0) != sent {
+            t.Errorf("%v: notification sent=%v, expected %v", now, len(msg) > 0, sent)
+        }
+        for i, counter := range counters {
+            if f.Periods[i].Counter != counter {
+                t.Errorf("%v: incorrect %v counter %v, expected %v", now, f.Periods[i].Period, f.Periods[i].Counter, counter)
+            }
+        }
+    }
+    check(0, true, 1, 1, 1)
+    check(10 * time.Minute, true, 2, 2, 2)
+    // hourly limit is reached
+    check(10 * time.Minute, false, 2, 2, 2)
+    // 23:05, new hour
+    check(15 * time.Minute, true, 1, 3, 3)
+    // daily limit is reached
+    check(10 * time.Minute, false, 1, 3, 3)
+    // Monday 00:15, new hour, day and week
+    check(time.Hour, true, 1, 1, 1)
+    check(time.Hour, true, 1, 2, 2)
+    check(time.Hour, true, 1, 3, 3)
+    // Tuesday, last notification of the week
+    check(24 * time.Hour, true, 1, 1, 4)
+    // weekly limit is reached
+    check(time.Hour, false, 0, 1, 4)
+    // next Monday
+    check(6 * 24 * time.Hour, true, 1, 1, 1)
+}
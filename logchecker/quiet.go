@@ -0,0 +1,213 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Quiet hours of notifications
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+)
+
+const (
+    // QuietSend is a quiet hours policy to send notifications immediately.
+    QuietSend string = "send"
+    // QuietQueue is a quiet hours policy to defer notifications until the end of quiet hours.
+    QuietQueue string = "queue"
+    quietLayout string = "15:04"
+)
+
+// QuietHours is a daily time window when notifications are queued
+// and delivered as a digest after the window end. Policy maps a severity
+// to QuietSend or QuietQueue, critical notifications are sent by default,
+// others are queued.
+type QuietHours struct {
+    Start string               `json:"start"`
+    End string                 `json:"end"`
+    Policy map[string]string   `json:"policy"`
+    start time.Duration
+    end time.Duration
+}
+
+// queuedAlert is a notification deferred by quiet hours or a digest.
+type queuedAlert struct {
+    notifier Notifier
+    subject string
+    msg string
+    to []string
+    severity string
+    file string
+    found uint64
+    attachment string
+}
+
+// Validate checks quiet hours settings.
+func (qh *QuietHours) Validate() error {
+    var err error
+    if qh.start, err = parseClock(qh.Start); err != nil {
+        return fmt.Errorf("invalid quiet hours start: %v", err)
+    }
+    if qh.end, err = parseClock(qh.End); err != nil {
+        return fmt.Errorf("invalid quiet hours end: %v", err)
+    }
+    if qh.start == qh.end {
+        return fmt.Errorf("quiet hours start and end should be different")
+    }
+    for severity, policy := range qh.Policy {
+        if _, ok := severityLevels[severity]; !ok {
+            return fmt.Errorf("unknown quiet hours severity [%v]", severity)
+        }
+        if (policy != QuietSend) && (policy != QuietQueue) {
+            return fmt.Errorf("unknown quiet hours policy [%v]", policy)
+        }
+    }
+    return nil
+}
+
+// parseClock converts "HH:MM" to a duration since midnight.
+func parseClock(value string) (time.Duration, error) {
+    t, err := time.Parse(quietLayout, strings.TrimSpace(value))
+    if err != nil {
+        return 0, err
+    }
+    return time.Duration(t.Hour()) * time.Hour + time.Duration(t.Minute()) * time.Minute, nil
+}
+
+// sinceMidnight returns a duration from local midnight.
+func sinceMidnight(t time.Time) time.Duration {
+    year, month, day := t.Date()
+    return t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+}
+
+// Active returns true if the time is inside quiet hours.
+func (qh *QuietHours) Active(t time.Time) bool {
+    current := sinceMidnight(t)
+    if qh.start < qh.end {
+        return (current >= qh.start) && (current < qh.end)
+    }
+    // the window is over midnight
+    return (current >= qh.start) || (current < qh.end)
+}
+
+// Next returns a duration until the nearest end of quiet hours.
+func (qh *QuietHours) Next(t time.Time) time.Duration {
+    d := qh.end - sinceMidnight(t)
+    if d <= 0 {
+        d += 24 * time.Hour
+    }
+    return d
+}
+
+// Queued returns true if a notification with the severity should be deferred.
+func (qh *QuietHours) Queued(severity string, t time.Time) bool {
+    if !qh.Active(t) {
+        return false
+    }
+    policy, ok := qh.Policy[severity]
+    if !ok {
+        return severity != SeverityCritical
+    }
+    return policy == QuietQueue
+}
+
+// queueQuiet queues a notification during quiet hours,
+// it returns false if the notification should be sent now.
+func (logger *LogChecker) queueQuiet(alert queuedAlert) bool {
+    qh := logger.Cfg.QuietHours
+    if (qh == nil) || !qh.Queued(alert.severity, time.Now()) {
+        return false
+    }
+    logger.quietMutex.Lock()
+    logger.quietQueue = append(logger.quietQueue, alert)
+    logger.quietMutex.Unlock()
+    LoggerDebug.Printf("notification is queued by quiet hours [%v]", alert.severity)
+    return true
+}
+
+// dispatch sends a notification in background or queues it during quiet hours.
+func (logger *LogChecker) dispatch(notifier Notifier, subject, msg string, to []string, severity string) {
+    if !logger.queueQuiet(queuedAlert{notifier: notifier, subject: subject, msg: msg, to: to, severity: severity}) {
+        logger.notifyAsync(notifier, subject, msg, to)
+    }
+}
+
+// dispatchSync sends a notification or queues it during quiet hours,
+// it returns an error if the notification is not delivered.
+func (logger *LogChecker) dispatchSync(alert queuedAlert) error {
+    if logger.queueQuiet(alert) {
+        return nil
+    }
+    return logger.notifySync(alert)
+}
+
+// FlushQuietHours sends queued notifications as digests,
+// one digest per notifier and recipients list.
+func (logger *LogChecker) FlushQuietHours() int {
+    logger.quietMutex.Lock()
+    queue := logger.quietQueue
+    logger.quietQueue = nil
+    logger.quietMutex.Unlock()
+
+    for _, digest := range buildDigests(queue, "deferred by quiet hours") {
+        logger.notifyAsync(digest.notifier, digest.subject, digest.msg, digest.to)
+    }
+    if len(queue) > 0 {
+        LoggerInfo.Printf("quiet hours digest: %v notification(s)\n", len(queue))
+    }
+    return len(queue)
+}
+
+// buildDigests combines notifications to digests, one digest per notifier
+// and recipients list. A digest has the highest severity of its notifications.
+func buildDigests(queue []queuedAlert, reason string) []queuedAlert {
+    keys := []string{}
+    groups := map[string][]queuedAlert{}
+    for _, alert := range queue {
+        key := alert.notifier.String() + "\n" + strings.Join(alert.to, ",")
+        if _, ok := groups[key]; !ok {
+            keys = append(keys, key)
+        }
+        groups[key] = append(groups[key], alert)
+    }
+    digests := make([]queuedAlert, len(keys))
+    for i, key := range keys {
+        alerts := groups[key]
+        severity, found := "", uint64(0)
+        messages := make([]string, len(alerts))
+        for j, alert := range alerts {
+            messages[j] = alert.subject + "\n" + alert.msg
+            severity = MaxSeverity(severity, alert.severity)
+            found += alert.found
+        }
+        digests[i] = queuedAlert{
+            notifier: alerts[0].notifier,
+            subject: fmt.Sprintf("%v: digest of %v notification(s)", DefaultSubject, len(alerts)),
+            msg: fmt.Sprintf("Digest of %v notification(s) %v.\n\n%v", len(alerts), reason, strings.Join(messages, "\n\n")),
+            to: alerts[0].to,
+            severity: severity,
+            found: found,
+        }
+    }
+    return digests
+}
+
+// watchQuietHours flushes queued notifications at the end of quiet hours qh.
+func (logger *LogChecker) watchQuietHours(ctx context.Context, qh *QuietHours) {
+    if qh == nil {
+        return
+    }
+    for {
+        timer := time.NewTimer(qh.Next(time.Now()))
+        select {
+            case <-ctx.Done():
+                timer.Stop()
+                return
+            case <-timer.C:
+                logger.FlushQuietHours()
+        }
+    }
+}
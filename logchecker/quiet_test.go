@@ -0,0 +1,108 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Quiet hours testing methods
+//
+package logchecker
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+)
+
+// recordNotifier is a test notifier that saves all messages and subjects.
+type recordNotifier struct {
+    messages chan string
+    subjects chan string
+}
+
+func newRecordNotifier() *recordNotifier {
+    return &recordNotifier{make(chan string, 100), make(chan string, 100)}
+}
+
+// String returns a unique name, so duplicates are checked per notifier.
+func (rn *recordNotifier) String() string {
+    return fmt.Sprintf("recordNotifier %p", rn)
+}
+
+func (rn *recordNotifier) Notify(msg string, to []string) error {
+    return rn.NotifySubject(DefaultSubject, msg, to)
+}
+
+func (rn *recordNotifier) NotifySubject(subject, msg string, to []string) error {
+    rn.subjects <- subject
+    rn.messages <- msg
+    return nil
+}
+
+// wait returns a received message or empty string after a timeout.
+func (rn *recordNotifier) wait(timeout time.Duration) string {
+    select {
+        case msg := <-rn.messages:
+            return msg
+        case <-time.After(timeout):
+            return ""
+    }
+}
+
+func TestQuietHours(t *testing.T) {
+    now := time.Now()
+    qh := &QuietHours{
+        Start: now.Add(-time.Hour).Format(quietLayout),
+        End: now.Add(time.Hour).Format(quietLayout),
+        Policy: map[string]string{SeverityInfo: QuietQueue},
+    }
+    if err := qh.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    if !qh.Active(now) || qh.Active(now.Add(2 * time.Hour)) {
+        t.Errorf("incorrect quiet hours window")
+    }
+    if d := qh.Next(now); (d <= 0) || (d > time.Hour) {
+        t.Errorf("incorrect quiet hours end: %v", d)
+    }
+    overnight := &QuietHours{Start: "22:00", End: "07:00"}
+    if err := overnight.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    day := time.Date(2015, 4, 11, 0, 0, 0, 0, time.Local)
+    if !overnight.Active(day.Add(23 * time.Hour)) || !overnight.Active(day.Add(6 * time.Hour)) || overnight.Active(day.Add(12 * time.Hour)) {
+        t.Errorf("incorrect overnight quiet hours window")
+    }
+    for _, incorrect := range []*QuietHours{
+        {Start: "25:00", End: "07:00"},
+        {Start: "07:00", End: "07:00"},
+        {Start: "22:00", End: "07:00", Policy: map[string]string{"unknown": QuietQueue}},
+        {Start: "22:00", End: "07:00", Policy: map[string]string{SeverityCritical: "drop"}},
+    } {
+        if err := incorrect.Validate(); err == nil {
+            t.Errorf("need validation error: %v", incorrect)
+        }
+    }
+
+    logger := New()
+    logger.Cfg.QuietHours = qh
+    notifier := newRecordNotifier()
+    logger.dispatch(notifier, "", "warning message", []string{"user@host.com"}, SeverityWarning)
+    logger.dispatch(notifier, "", "info message", []string{"user@host.com"}, SeverityInfo)
+    logger.dispatch(notifier, "", "critical message", []string{"user@host.com"}, SeverityCritical)
+    if msg := notifier.wait(time.Second); msg != "critical message" {
+        t.Errorf("critical message should be sent: %v", msg)
+    }
+    if msg := notifier.wait(100 * time.Millisecond); msg != "" {
+        t.Errorf("message should be deferred: %v", msg)
+    }
+    if n := logger.FlushQuietHours(); n != 2 {
+        t.Errorf("incorrect number of queued messages: %v", n)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "warning message") || !strings.Contains(msg, "info message") {
+        t.Errorf("incorrect digest: %v", msg)
+    }
+    if msg := notifier.wait(100 * time.Millisecond); msg != "" {
+        t.Errorf("only one digest should be sent: %v", msg)
+    }
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+// Read timeout testing methods, named pipes are not supported by Windows
+//
+package logchecker
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "syscall"
+    "testing"
+    "time"
+)
+
+func TestReadTimeout(t *testing.T) {
+    var group sync.WaitGroup
+    // opening of a named pipe blocks like a file on a hung mount
+    filename := filepath.Join(buildDir(), "test_read_timeout.fifo")
+    os.Remove(filename)
+    if err := syscall.Mkfifo(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, ReadTimeout: 1}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    logger.watchCtx = ctx
+    start := time.Now()
+    if err := f.Check(&group, logger); (err == nil) || !strings.Contains(err.Error(), "read timeout") {
+        t.Errorf("need timeout error: %v", err)
+    }
+    if d := time.Since(start); d > 2 * time.Second {
+        t.Errorf("check is not abandoned: %v", d)
+    }
+    if err := f.Check(&group, logger); (err == nil) || !strings.Contains(err.Error(), "still running") {
+        t.Errorf("need running check error: %v", err)
+    }
+    // the watcher group is not blocked by the abandoned check
+    done := make(chan bool)
+    go func() {
+        group.Wait()
+        close(done)
+    }()
+    select {
+        case <-done:
+        case <-time.After(time.Second):
+            t.Errorf("group is blocked")
+    }
+    // release the blocked check after the stop
+    cancel()
+    writer, err := os.OpenFile(filename, os.O_WRONLY, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    writer.Close()
+    for i := 0; (i < 100) && (atomic.LoadInt32(&f.reading) != 0); i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if atomic.LoadInt32(&f.reading) != 0 {
+        t.Fatal("abandoned check is not finished")
+    }
+    if f.restored || (len(notifier.messages) != 0) {
+        t.Error("abandoned check changes the file state after the stop")
+    }
+}
+
+func TestReadTimeoutMove(t *testing.T) {
+    var group sync.WaitGroup
+    defer func(wait time.Duration) {
+        MoveWait = wait
+    }(MoveWait)
+    MoveWait = 50 * time.Millisecond
+    filename := filepath.Join(buildDir(), "test_read_timeout_move.fifo")
+    moved := filename + ".1"
+    os.Remove(filename)
+    if err := syscall.Mkfifo(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(filename)
+    defer os.Remove(moved)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, ReadTimeout: 1, Follow: true}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    // the state is prepared by the start
+    f.LogStart, f.ExtBoundary, f.restored = time.Now(), f.Boundary, true
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    ctx, cancel := context.WithCancel(context.Background())
+    group.Add(1)
+    go func() {
+        defer group.Done()
+        f.Watch(ctx, &group, logger)
+    }()
+    // the check is blocked by the pipe opening
+    if err := f.Check(&group, logger); (err == nil) || !strings.Contains(err.Error(), "read timeout") {
+        t.Errorf("need timeout error: %v", err)
+    }
+    // the file is moved while the check is pending
+    if err := os.Rename(filename, moved); err != nil {
+        t.Fatal(err)
+    }
+    if err := syscall.Mkfifo(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; (i < 100) && (atomic.LoadInt32(&f.moved) == 0); i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if atomic.LoadInt32(&f.moved) == 0 {
+        t.Error("move is not handled")
+    }
+    // release the abandoned check of the old file
+    writer, err := os.OpenFile(moved, os.O_WRONLY, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    writer.Close()
+    for i := 0; (i < 100) && (atomic.LoadInt32(&f.reading) != 0); i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    if atomic.LoadInt32(&f.reading) != 0 {
+        t.Fatal("abandoned check is not finished")
+    }
+    // the position is reset by the next check of the new file
+    if atomic.LoadInt32(&f.moved) != 1 {
+        t.Error("move is handled by the abandoned check")
+    }
+    cancel()
+    group.Wait()
+}
@@ -0,0 +1,423 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Redis storage back-end
+//
+package logchecker
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // RedisScheme is a URL scheme of Redis storage.
+    RedisScheme string = "redis"
+    // DefaultRedisPrefix is a default prefix of Redis keys.
+    DefaultRedisPrefix string = "logchecker:"
+    defaultRedisPort string = "6379"
+    redisPositions string = "positions"
+)
+
+var (
+    // RedisTimeout is a timeout of Redis requests.
+    RedisTimeout = 5 * time.Second
+    // RedisAttempts is a number of Redis request attempts for network errors,
+    // the connection is opened again before every next attempt.
+    RedisAttempts = 3
+    // RedisBackoff is a delay before the second attempt, it's doubled for next ones.
+    RedisBackoff = 100 * time.Millisecond
+)
+
+// KeyValueStorage is a back-end that keeps shared values,
+// zero ttl means that a value doesn't expire.
+type KeyValueStorage interface {
+    Backender
+    Get(key string) (string, bool, error)
+    Set(key, value string, ttl time.Duration) error
+}
+
+// RedisBackend is a back-end that saves file positions and shared values
+// to Redis, so several instances can use the same state.
+// Positions are kept in one hash, all keys have Prefix.
+// The hash expires after TTL without saved positions if it's set.
+type RedisBackend struct {
+    Name string
+    Addr string
+    User string
+    Password string
+    DB int
+    Prefix string
+    TTL time.Duration
+    mutex sync.Mutex
+    conn net.Conn
+    reader *bufio.Reader
+}
+
+// redisError is an error reply of Redis server.
+type redisError string
+
+func (e redisError) Error() string {
+    return "redis error: " + string(e)
+}
+
+// isRedisReply checks that the error is a reply of Redis server,
+// not a network one.
+func isRedisReply(err error) bool {
+    var reply redisError
+    return errors.As(err, &reply)
+}
+
+// IsRedisStorage checks that the storage is a Redis URL
+// or "redis" with "storage_addr" settings.
+func IsRedisStorage(storage string) bool {
+    return (storage == RedisScheme) || strings.HasPrefix(storage, RedisScheme + "://")
+}
+
+// redisStorage returns a Redis URL of the storage, "redis" storage
+// is built from "storage_addr", "storage_password" and "storage_db".
+func (cfg *Config) redisStorage() (string, error) {
+    if cfg.Storage != RedisScheme {
+        return cfg.Storage, nil
+    }
+    if len(cfg.StorageAddr) == 0 {
+        return "", fmt.Errorf("storage_addr is required by redis storage")
+    }
+    if cfg.StorageDB < 0 {
+        return "", fmt.Errorf("storage_db should be a non-negative number")
+    }
+    u := url.URL{Scheme: RedisScheme, Host: cfg.StorageAddr, Path: "/" + strconv.Itoa(cfg.StorageDB)}
+    if len(cfg.StoragePassword) > 0 {
+        u.User = url.UserPassword("", cfg.StoragePassword)
+    }
+    return u.String(), nil
+}
+
+// newRedisBackend creates a back-end of Redis storage with "storage_ttl",
+// the connection is checked if stat is true.
+func (cfg *Config) newRedisBackend(stat bool) (*RedisBackend, error) {
+    storage, err := cfg.redisStorage()
+    if err != nil {
+        return nil, err
+    }
+    bk, err := NewRedisBackend(storage)
+    if err != nil {
+        return nil, err
+    }
+    bk.TTL = time.Duration(cfg.StorageTTL) * time.Second
+    if stat {
+        if err := bk.Ping(); err != nil {
+            bk.Close()
+            return nil, err
+        }
+    }
+    return bk, nil
+}
+
+// storageName returns the storage without a password of Redis URL.
+func (cfg *Config) storageName() string {
+    if cfg.Storage == RedisScheme {
+        return fmt.Sprintf("%v://%v/%v", RedisScheme, cfg.StorageAddr, cfg.StorageDB)
+    }
+    if !IsRedisStorage(cfg.Storage) {
+        return cfg.Storage
+    }
+    u, err := url.Parse(cfg.Storage)
+    if err != nil {
+        return RedisScheme + "://"
+    }
+    return u.Redacted()
+}
+
+// NewRedisBackend creates RedisBackend from a URL
+// "redis://[user:password@]host[:port][/db][?prefix=name:]",
+// a connection is opened by the first request.
+func NewRedisBackend(storage string) (*RedisBackend, error) {
+    u, err := url.Parse(storage)
+    if err != nil {
+        return nil, fmt.Errorf("incorrect redis url: %v", err)
+    }
+    if u.Scheme != RedisScheme {
+        return nil, fmt.Errorf("redis url should have \"%v\" scheme", RedisScheme)
+    }
+    if len(u.Hostname()) == 0 {
+        return nil, fmt.Errorf("redis host should not be empty")
+    }
+    bk := &RedisBackend{Name: "Redis", Addr: u.Host, Prefix: DefaultRedisPrefix}
+    if len(u.Port()) == 0 {
+        bk.Addr = net.JoinHostPort(u.Hostname(), defaultRedisPort)
+    }
+    if u.User != nil {
+        if password, ok := u.User.Password(); ok {
+            bk.User, bk.Password = u.User.Username(), password
+        } else {
+            bk.Password = u.User.Username()
+        }
+    }
+    if db := strings.Trim(u.Path, "/"); len(db) > 0 {
+        n, err := strconv.Atoi(db)
+        if (err != nil) || (n < 0) {
+            return nil, fmt.Errorf("redis database should be a non-negative number")
+        }
+        bk.DB = n
+    }
+    if prefix, ok := u.Query()["prefix"]; ok {
+        bk.Prefix = prefix[0]
+    }
+    return bk, nil
+}
+
+// String returns a name of the logger back-end.
+func (bk *RedisBackend) String() string {
+    return fmt.Sprintf("Backend: %v", bk.Name)
+}
+
+// LoadState returns a saved state of the log file.
+func (bk *RedisBackend) LoadState(key string) (FileState, error) {
+    var st FileState
+    reply, err := bk.do("HGET", bk.Prefix + redisPositions, key)
+    if err != nil {
+        return st, err
+    }
+    value, ok := reply.(string)
+    if !ok {
+        return st, ErrNoState
+    }
+    if err := json.Unmarshal([]byte(value), &st); err != nil {
+        return st, fmt.Errorf("incorrect redis state: %v", err)
+    }
+    return st, nil
+}
+
+// SaveState saves a state of the log file.
+func (bk *RedisBackend) SaveState(key string, st FileState) error {
+    data, err := json.Marshal(st)
+    if err != nil {
+        return err
+    }
+    if _, err = bk.do("HSET", bk.Prefix + redisPositions, key, string(data)); err != nil {
+        return err
+    }
+    if bk.TTL > 0 {
+        _, err = bk.do("PEXPIRE", bk.Prefix + redisPositions, strconv.FormatInt(int64(bk.TTL / time.Millisecond), 10))
+    }
+    return err
+}
+
+// LoadPosition returns a saved position of the log file.
+func (bk *RedisBackend) LoadPosition(file string) (uint64, bool, error) {
+    st, err := bk.LoadState(file)
+    switch {
+        case err == ErrNoState:
+            return 0, false, nil
+        case err != nil:
+            return 0, false, err
+    }
+    return st.Pos, true, nil
+}
+
+// SavePosition saves a position of the log file, other values are kept.
+func (bk *RedisBackend) SavePosition(file string, pos uint64) error {
+    return bk.update(file, func(st *FileState) {
+        st.Pos, st.Offset = pos, 0
+    })
+}
+
+// IncrementCounter adds n to the notifications counter of the log file.
+func (bk *RedisBackend) IncrementCounter(file string, n uint64) error {
+    return bk.update(file, func(st *FileState) {
+        st.Counter += n
+    })
+}
+
+// update changes a saved state of the log file, a missing state is created.
+// It's not atomic, a file is checked by one process.
+func (bk *RedisBackend) update(file string, change func(*FileState)) error {
+    st, err := bk.LoadState(file)
+    if (err != nil) && (err != ErrNoState) {
+        return err
+    }
+    change(&st)
+    return bk.SaveState(file, st)
+}
+
+// ResetPositions removes all saved positions.
+func (bk *RedisBackend) ResetPositions() error {
+    _, err := bk.do("DEL", bk.Prefix + redisPositions)
+    return err
+}
+
+// Get returns a shared value by a key without Prefix.
+func (bk *RedisBackend) Get(key string) (string, bool, error) {
+    reply, err := bk.do("GET", bk.Prefix + key)
+    if err != nil {
+        return "", false, err
+    }
+    value, ok := reply.(string)
+    return value, ok, nil
+}
+
+// Set saves a shared value by a key without Prefix,
+// it's removed after ttl if it's not zero.
+func (bk *RedisBackend) Set(key, value string, ttl time.Duration) error {
+    args := []string{"SET", bk.Prefix + key, value}
+    if ttl > 0 {
+        args = append(args, "PX", strconv.FormatInt(int64(ttl / time.Millisecond), 10))
+    }
+    _, err := bk.do(args...)
+    return err
+}
+
+// Ping checks the connection to Redis server.
+func (bk *RedisBackend) Ping() error {
+    _, err := bk.do("PING")
+    return err
+}
+
+// Open does nothing, the connection is opened by the first request.
+func (bk *RedisBackend) Open() error {
+    return nil
+}
+
+// Close closes the connection.
+func (bk *RedisBackend) Close() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    return bk.disconnect()
+}
+
+// do sends a command and returns its reply, it's repeated with
+// backoff after network errors, so a broken connection is opened again.
+// Requests are serialized.
+func (bk *RedisBackend) do(args ...string) (interface{}, error) {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    delay := RedisBackoff
+    for attempt := 1; ; attempt++ {
+        reply, err := bk.request(args)
+        if (err == nil) || isRedisReply(err) || (attempt >= RedisAttempts) {
+            return reply, err
+        }
+        LoggerDebug.Printf("redis request is repeated after %v: %v", delay, err)
+        time.Sleep(delay)
+        delay *= 2
+    }
+}
+
+// request sends one command, the connection is closed after network errors.
+func (bk *RedisBackend) request(args []string) (interface{}, error) {
+    if bk.conn == nil {
+        if err := bk.connect(); err != nil {
+            return nil, err
+        }
+    }
+    reply, err := bk.command(args)
+    if (err != nil) && !isRedisReply(err) {
+        bk.disconnect()
+    }
+    return reply, err
+}
+
+// connect opens a connection, authenticates and selects the database.
+func (bk *RedisBackend) connect() error {
+    conn, err := net.DialTimeout("tcp", bk.Addr, RedisTimeout)
+    if err != nil {
+        return fmt.Errorf("redis connection error: %v", err)
+    }
+    bk.conn, bk.reader = conn, bufio.NewReader(conn)
+    var commands [][]string
+    switch {
+        case len(bk.User) > 0:
+            commands = append(commands, []string{"AUTH", bk.User, bk.Password})
+        case len(bk.Password) > 0:
+            commands = append(commands, []string{"AUTH", bk.Password})
+    }
+    if bk.DB > 0 {
+        commands = append(commands, []string{"SELECT", strconv.Itoa(bk.DB)})
+    }
+    for _, args := range commands {
+        if _, err := bk.command(args); err != nil {
+            bk.disconnect()
+            return fmt.Errorf("redis %v error: %w", strings.ToLower(args[0]), err)
+        }
+    }
+    return nil
+}
+
+// disconnect closes the connection, the mutex should be locked.
+func (bk *RedisBackend) disconnect() error {
+    if bk.conn == nil {
+        return nil
+    }
+    err := bk.conn.Close()
+    bk.conn, bk.reader = nil, nil
+    return err
+}
+
+// command writes a command as an array of bulk strings and reads its reply.
+func (bk *RedisBackend) command(args []string) (interface{}, error) {
+    var b strings.Builder
+    b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+    for _, arg := range args {
+        b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+    }
+    bk.conn.SetDeadline(time.Now().Add(RedisTimeout))
+    if _, err := io.WriteString(bk.conn, b.String()); err != nil {
+        return nil, err
+    }
+    return readRedisReply(bk.reader)
+}
+
+// readRedisReply reads a reply of RESP protocol: a simple string,
+// an error, an integer, a bulk string (nil if it's not found) or an array.
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+    line, err := reader.ReadString('\n')
+    if err != nil {
+        return nil, err
+    }
+    line = strings.TrimRight(line, "\r\n")
+    if len(line) == 0 {
+        return nil, fmt.Errorf("empty redis reply")
+    }
+    switch line[0] {
+        case '+':
+            return line[1:], nil
+        case '-':
+            return nil, redisError(line[1:])
+        case ':':
+            return strconv.ParseInt(line[1:], 10, 64)
+        case '$':
+            n, err := strconv.Atoi(line[1:])
+            if (err != nil) || (n < 0) {
+                return nil, err
+            }
+            data := make([]byte, n + 2)
+            if _, err := io.ReadFull(reader, data); err != nil {
+                return nil, err
+            }
+            return string(data[:n]), nil
+        case '*':
+            n, err := strconv.Atoi(line[1:])
+            if (err != nil) || (n < 0) {
+                return nil, err
+            }
+            items := make([]interface{}, n)
+            for i := range items {
+                if items[i], err = readRedisReply(reader); err != nil {
+                    return nil, err
+                }
+            }
+            return items, nil
+    }
+    return nil, fmt.Errorf("unknown redis reply: %q", line)
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Redis storage testing methods
+//
+package logchecker
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// redisStub is a minimal Redis server for tests, it supports
+// AUTH, SELECT, PING, GET, SET, HGET, HSET, PEXPIRE and DEL commands.
+type redisStub struct {
+    listener net.Listener
+    password string
+    mutex sync.Mutex
+    values map[string]string
+    hashes map[string]map[string]string
+    expires map[string]string
+    commands []string
+}
+
+func newRedisStub(t *testing.T, password string) *redisStub {
+    return newRedisStubAddr(t, "127.0.0.1:0", password)
+}
+
+func newRedisStubAddr(t *testing.T, addr, password string) *redisStub {
+    listener, err := net.Listen("tcp", addr)
+    if err != nil {
+        t.Fatalf("can't start redis stub: %v", err)
+    }
+    stub := &redisStub{listener: listener, password: password, values: map[string]string{}, hashes: map[string]map[string]string{}, expires: map[string]string{}}
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go stub.handle(conn)
+        }
+    }()
+    return stub
+}
+
+func (s *redisStub) Close() {
+    s.listener.Close()
+}
+
+func (s *redisStub) Commands() []string {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return append([]string{}, s.commands...)
+}
+
+func (s *redisStub) handle(conn net.Conn) {
+    defer conn.Close()
+    reader := bufio.NewReader(conn)
+    authorized := len(s.password) == 0
+    for {
+        reply, err := readRedisReply(reader)
+        if err != nil {
+            return
+        }
+        items := reply.([]interface{})
+        args := make([]string, len(items))
+        for i := range items {
+            args[i] = items[i].(string)
+        }
+        s.mutex.Lock()
+        s.commands = append(s.commands, args[0])
+        result := "+OK"
+        switch {
+            case args[0] == "AUTH":
+                if args[len(args) - 1] != s.password {
+                    result = "-WRONGPASS invalid password"
+                } else {
+                    authorized = true
+                }
+            case !authorized:
+                result = "-NOAUTH Authentication required."
+            case args[0] == "SELECT":
+            case args[0] == "PING":
+                result = "+PONG"
+            case args[0] == "PEXPIRE":
+                s.expires[args[1]] = args[2]
+                result = ":1"
+            case args[0] == "GET":
+                result = "$-1"
+                if value, ok := s.values[args[1]]; ok {
+                    result = fmt.Sprintf("$%v\r\n%v", len(value), value)
+                }
+            case args[0] == "SET":
+                s.values[args[1]] = args[2]
+            case args[0] == "HGET":
+                result = "$-1"
+                if value, ok := s.hashes[args[1]][args[2]]; ok {
+                    result = fmt.Sprintf("$%v\r\n%v", len(value), value)
+                }
+            case args[0] == "HSET":
+                if s.hashes[args[1]] == nil {
+                    s.hashes[args[1]] = map[string]string{}
+                }
+                s.hashes[args[1]][args[2]] = args[3]
+                result = ":1"
+            case args[0] == "DEL":
+                delete(s.values, args[1])
+                delete(s.hashes, args[1])
+                result = ":1"
+            default:
+                result = "-ERR unknown command"
+        }
+        s.mutex.Unlock()
+        fmt.Fprintf(conn, "%v\r\n", result)
+    }
+}
+
+func TestRedisURL(t *testing.T) {
+    cases := []struct {
+        storage string
+        addr string
+        user string
+        password string
+        db int
+        prefix string
+    }{
+        {"redis://127.0.0.1", "127.0.0.1:6379", "", "", 0, DefaultRedisPrefix},
+        {"redis://:secret@redis.host.com:6380/2", "redis.host.com:6380", "", "secret", 2, DefaultRedisPrefix},
+        {"redis://secret@redis.host.com/", "redis.host.com:6379", "", "secret", 0, DefaultRedisPrefix},
+        {"redis://app:secret@[::1]:7000/15?prefix=app:", "[::1]:7000", "app", "secret", 15, "app:"},
+    }
+    for _, c := range cases {
+        bk, err := NewRedisBackend(c.storage)
+        if err != nil {
+            t.Errorf("[%v] unexpected error: %v", c.storage, err)
+            continue
+        }
+        if (bk.Addr != c.addr) || (bk.User != c.user) || (bk.Password != c.password) || (bk.DB != c.db) || (bk.Prefix != c.prefix) {
+            t.Errorf("[%v] incorrect settings: %+v", c.storage, bk)
+        }
+    }
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+    }
+    for _, storage := range []string{"redis://", "redis://host.com/db", "redis://host.com/-1", "redis://host.com:port", "redis:host.com"} {
+        cfg.Storage = storage
+        if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+            t.Errorf("incorrect storage is accepted: %v", storage)
+        }
+    }
+    cfg.Storage = "redis://127.0.0.1:6379/1"
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Errorf("storage is not accepted: %v", err)
+    }
+    if IsRedisStorage("/var/lib/logchecker") || !IsRedisStorage(cfg.Storage) || !IsRedisStorage("redis") {
+        t.Error("incorrect redis storage detection")
+    }
+}
+
+func TestRedisStorageSettings(t *testing.T) {
+    defer func(attempts int, backoff time.Duration) {
+        RedisAttempts, RedisBackoff = attempts, backoff
+    }(RedisAttempts, RedisBackoff)
+    RedisAttempts, RedisBackoff = 3, 10 * time.Millisecond
+    stub := newRedisStub(t, "p@ss/word")
+    defer stub.Close()
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Storage: "redis",
+        StoragePassword: "p@ss/word",
+        StorageDB: 2,
+        StorageTTL: 3600,
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err == nil {
+        t.Error("redis storage without address is accepted")
+    }
+    cfg.StorageAddr = stub.listener.Addr().String()
+    if err := ValidateConfig(cfg, ValidateOptions{}); err != nil {
+        t.Errorf("redis storage is not accepted: %v", err)
+    }
+    if name := cfg.storageName(); (name != "redis://" + cfg.StorageAddr + "/2") {
+        t.Errorf("incorrect storage name: %v", name)
+    }
+    bk, err := cfg.newRedisBackend(true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    if (bk.Password != cfg.StoragePassword) || (bk.DB != 2) || (bk.TTL != time.Hour) {
+        t.Errorf("incorrect settings: %+v", bk)
+    }
+    if err := bk.SaveState("/var/log/app.log", FileState{Pos: 1}); err != nil {
+        t.Fatal(err)
+    }
+    stub.mutex.Lock()
+    if ttl := stub.expires[DefaultRedisPrefix + redisPositions]; ttl != "3600000" {
+        t.Errorf("incorrect ttl: %v", ttl)
+    }
+    stub.mutex.Unlock()
+    // connection errors fail the validation, they are not checked offline
+    cfg.StoragePassword = "wrong"
+    if err := ValidateConfig(cfg, ValidateOptions{}); (err == nil) || !strings.Contains(err.Error(), "WRONGPASS") {
+        t.Errorf("need authentication error: %v", err)
+    }
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    addr := listener.Addr().String()
+    listener.Close()
+    cfg.StorageAddr = addr
+    if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+        t.Error("unavailable redis storage is accepted")
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{SkipStat: true}); err != nil {
+        t.Errorf("redis storage is checked offline: %v", err)
+    }
+    // a transient failure is repeated with backoff
+    bk, err = NewRedisBackend("redis://" + addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    started := make(chan *redisStub)
+    go func() {
+        time.Sleep(15 * time.Millisecond)
+        started <- newRedisStubAddr(t, addr, "")
+    }()
+    err = bk.Ping()
+    later := <-started
+    defer later.Close()
+    if err != nil {
+        t.Errorf("request is not repeated: %v", err)
+    }
+}
+
+// testRedisBackend checks positions and shared values of the back-end.
+func testRedisBackend(t *testing.T, bk *RedisBackend) {
+    defer bk.Close()
+    if err := bk.ResetPositions(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := bk.LoadState("/var/log/app.log"); err != ErrNoState {
+        t.Errorf("position should not be found: %v", err)
+    }
+    pos := FileState{Pos: 10, Offset: 120, Size: 120, LogStart: time.Now().Truncate(time.Second), Granularity: 2, Found: 3, Counter: 1}
+    if err := bk.SaveState("/var/log/app.log", pos); err != nil {
+        t.Fatal(err)
+    }
+    // another instance gets the saved position
+    other, err := NewRedisBackend(fmt.Sprintf("redis://:%v@%v/%v?prefix=%v", bk.Password, bk.Addr, bk.DB, bk.Prefix))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer other.Close()
+    saved, err := other.LoadState("/var/log/app.log")
+    if (err != nil) || (saved.Pos != pos.Pos) || (saved.Offset != pos.Offset) || !saved.LogStart.Equal(pos.LogStart) || (saved.Counter != pos.Counter) {
+        t.Errorf("incorrect position: %+v", saved)
+    }
+    if err := other.ResetPositions(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := bk.LoadState("/var/log/app.log"); err != ErrNoState {
+        t.Errorf("positions are not reset: %v", err)
+    }
+    testBackendPositions(t, bk)
+    if err := bk.Set("test", "value", time.Minute); err != nil {
+        t.Fatal(err)
+    }
+    if value, ok, err := other.Get("test"); (err != nil) || !ok || (value != "value") {
+        t.Errorf("incorrect shared value: %v, %v, %v", value, ok, err)
+    }
+    if _, ok, err := other.Get("unknown"); (err != nil) || ok {
+        t.Errorf("unknown value is found: %v", err)
+    }
+}
+
+func TestRedisBackend(t *testing.T) {
+    stub := newRedisStub(t, "secret")
+    defer stub.Close()
+    bk, err := NewRedisBackend("redis://:secret@" + stub.listener.Addr().String() + "/3")
+    if err != nil {
+        t.Fatal(err)
+    }
+    testRedisBackend(t, bk)
+    if commands := strings.Join(stub.Commands()[:2], ","); commands != "AUTH,SELECT" {
+        t.Errorf("incorrect connection commands: %v", commands)
+    }
+    // a broken connection is opened again
+    bk, err = NewRedisBackend("redis://:secret@" + stub.listener.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    if err := bk.Set("key", "value", 0); err != nil {
+        t.Fatal(err)
+    }
+    bk.conn.Close()
+    if value, ok, err := bk.Get("key"); (err != nil) || !ok || (value != "value") {
+        t.Errorf("connection is not reopened: %v, %v, %v", value, ok, err)
+    }
+    // incorrect password
+    bk, err = NewRedisBackend("redis://:wrong@" + stub.listener.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.SaveState("/var/log/app.log", FileState{}); (err == nil) || !strings.Contains(err.Error(), "WRONGPASS") {
+        t.Errorf("need authentication error: %v", err)
+    }
+    // duplicates are found by the shared storage
+    bk, err = NewRedisBackend("redis://:secret@" + stub.listener.Addr().String() + "/?prefix=dup:")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    first, second := New(), New()
+    first.Backend, second.Backend = bk, bk
+    notifier := &recipientNotifier{}
+    if first.isDuplicate(notifier, "subject", "message", []string{"admin@host.com"}) {
+        t.Error("first notification is a duplicate")
+    }
+    if !second.isDuplicate(notifier, "subject", "message", []string{"admin@host.com"}) {
+        t.Error("duplicate of another instance is not found")
+    }
+}
+
+// TestRedisIntegration uses a Redis server from LOGCHECKER_TEST_REDIS
+// environment variable, e.g. "redis://127.0.0.1:6379/15".
+func TestRedisIntegration(t *testing.T) {
+    storage := os.Getenv("LOGCHECKER_TEST_REDIS")
+    if len(storage) == 0 {
+        t.Skip("LOGCHECKER_TEST_REDIS is not set")
+    }
+    bk, err := NewRedisBackend(storage)
+    if err != nil {
+        t.Fatal(err)
+    }
+    bk.Prefix = "logchecker_test_" + strconv.FormatInt(time.Now().UnixNano(), 10) + ":"
+    testRedisBackend(t, bk)
+}
+
+func TestRedisStorageName(t *testing.T) {
+    os.Setenv("LOGCHECKER_REDIS_PASSWORD", "secret")
+    defer os.Unsetenv("LOGCHECKER_REDIS_PASSWORD")
+    cfg := &Config{Storage: "redis://:${LOGCHECKER_REDIS_PASSWORD}@127.0.0.1:6379/1"}
+    cfg.expandEnv()
+    if cfg.Storage != "redis://:secret@127.0.0.1:6379/1" {
+        t.Errorf("storage is not expanded: %v", cfg.Storage)
+    }
+    if name := cfg.storageName(); strings.Contains(name, "secret") || !strings.Contains(name, "127.0.0.1:6379/1") {
+        t.Errorf("password is not hidden: %v", name)
+    }
+    cfg.Storage = "/var/lib/$HOME"
+    cfg.expandEnv()
+    if name := cfg.storageName(); name != "/var/lib/$HOME" {
+        t.Errorf("incorrect storage name: %v", name)
+    }
+}
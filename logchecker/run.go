@@ -0,0 +1,109 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Process lifecycle with configuration reloads
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "sync"
+)
+
+// Stages of the process lifecycle, they are used by RunError.
+const (
+    RunStart = "start"
+    RunWatcher = "watcher"
+    RunReload = "reload"
+    RunStop = "stop"
+)
+
+// RunError is an error of Run, its Stage is a failed step of the lifecycle,
+// so a caller can choose an exit code.
+type RunError struct {
+    Stage string
+    Err error
+}
+
+func (e *RunError) Error() string {
+    return e.Err.Error()
+}
+
+// Unwrap returns an original error.
+func (e *RunError) Unwrap() error {
+    return e.Err
+}
+
+// Run starts the process and handles its lifecycle: the configuration file
+// is watched, its changes and reload requests restart the process with new
+// settings, an incorrect configuration is skipped. It returns nil when ctx
+// is done and the process is stopped, otherwise RunError is returned.
+func (logger *LogChecker) Run(ctx context.Context) error {
+    var group sync.WaitGroup
+    if err := logger.Start(ctx, &group); err != nil {
+        return &RunError{RunStart, fmt.Errorf("can't start the process: %v", err)}
+    }
+    // stop is called before an abnormal return
+    stop := func(stage string, err error) error {
+        if serr := logger.Stop(&group); serr != nil {
+            LoggerError.Printf("can't stop the process: %v\n", serr)
+        }
+        return &RunError{stage, err}
+    }
+    // config monitoring
+    watcher, err := NewWatcher()
+    if err != nil {
+        return stop(RunWatcher, fmt.Errorf("can't create config watcher: %v", err))
+    }
+    defer func() {
+        watcher.Close()
+    }()
+    if err = watcher.Add(logger.Cfg.Path, WatchCloseWrite | WatchAttrib | WatchRemove); err != nil {
+        return stop(RunWatcher, fmt.Errorf("can't activate config watcher: %v", err))
+    }
+    // process event monitor
+    for {
+        select {
+            case <-ctx.Done():
+                LoggerInfo.Println("process will be stopped")
+                if err = logger.Stop(&group); err != nil {
+                    return &RunError{RunStop, err}
+                }
+                return nil
+            case event := <-watcher.Events():
+                LoggerInfo.Println("process will be restarted due to reconfiguration")
+                if event.Has(WatchRemove) {
+                    moved, err := IsMoved(logger.Cfg.Path, watcher)
+                    if err != nil {
+                        return stop(RunWatcher, fmt.Errorf("re-creation watcher error: %v", err))
+                    }
+                    watcher = moved
+                }
+                if err = logger.runReload(ctx, &group); err != nil {
+                    return err
+                }
+            case <-logger.ReloadRequests():
+                LoggerInfo.Println("process will be restarted due to reload request")
+                if err = logger.runReload(ctx, &group); err != nil {
+                    return err
+                }
+            case werr := <-watcher.Errors():
+                return stop(RunWatcher, fmt.Errorf("config watcher error: %v", werr))
+        }
+    }
+}
+
+// runReload restarts the process with new configuration, an incorrect
+// configuration is skipped and the process continues to work with old settings.
+func (logger *LogChecker) runReload(ctx context.Context, group *sync.WaitGroup) error {
+    if err := logger.Reload(ctx, group); err != nil {
+        if _, ok := err.(*ConfigError); ok {
+            LoggerError.Printf("reload error: %v\n", err)
+            return nil
+        }
+        return &RunError{RunReload, fmt.Errorf("can't restart the process: %v", err)}
+    }
+    return nil
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Process lifecycle testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestRun(t *testing.T) {
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_run_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_run_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_run_syslog"),
+    }
+    oldexample := filepath.Join(testdir, "config.example.json")
+    example := filepath.Join(testdir, "config.run.json")
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer os.Remove(example)
+    for _, v := range newvalues {
+        if err := createFile(v, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]: %v", v, err)
+        }
+        defer os.Remove(v)
+    }
+    // a process without configuration can't be started
+    err := New().Run(context.Background())
+    if rerr := (*RunError)(nil); !errors.As(err, &rerr) || (rerr.Stage != RunStart) {
+        t.Errorf("need start error: %v", err)
+    }
+
+    logger := New()
+    if err := InitConfig(logger, example); err != nil {
+        t.Fatal(err)
+    }
+    logger.notifier = newRecordNotifier()
+    events := logger.Events()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    result := make(chan error, 1)
+    go func() {
+        result <- logger.Run(ctx)
+    }()
+    wait := func(eventType string) {
+        timeout := time.After(3 * time.Second)
+        for {
+            select {
+                case event := <-events:
+                    if event.Type == eventType {
+                        return
+                    }
+                case <-timeout:
+                    t.Fatalf("event %v is not received", eventType)
+            }
+        }
+    }
+    wait(EventStart)
+    // the configuration file is changed
+    newvalues["My service #2"] = "Reloaded service"
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    wait(EventReload)
+    logger.mutex.RLock()
+    name := logger.Cfg.Observed[1].Name
+    logger.mutex.RUnlock()
+    if name != "Reloaded service" {
+        t.Errorf("config is not reloaded: %v", name)
+    }
+    cancel()
+    select {
+        case err := <-result:
+            if err != nil {
+                t.Errorf("run error: %v", err)
+            }
+        case <-time.After(3 * time.Second):
+            t.Fatal("run is not finished by the context")
+    }
+    if logger.IsWorking() {
+        t.Error("process is not stopped")
+    }
+}
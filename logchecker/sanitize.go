@@ -0,0 +1,78 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Sanitization of reported log lines
+//
+package logchecker
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+    "unicode"
+)
+
+// DefaultSanitizeLineLength is a default maximum length of a sanitized line.
+const DefaultSanitizeLineLength int = 1024
+
+var (
+    rgANSI = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b[@-Z\\-_]`)
+    slackReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// Sanitize is a configuration of log lines sanitization before they are
+// included to notifications. MaxLineLength limits a line length,
+// Escape activates escaping of markup for notifiers with a markup format.
+type Sanitize struct {
+    MaxLineLength int  `json:"max_line_length"`
+    Escape bool        `json:"escape"`
+}
+
+// Validate checks sanitization settings.
+func (s *Sanitize) Validate() error {
+    if s.MaxLineLength < 0 {
+        return fmt.Errorf("sanitize max_line_length can't be negative")
+    }
+    return nil
+}
+
+// Line removes ANSI escape sequences, replaces other control symbols
+// except tabs by their \xNN codes and truncates the line.
+// The line is not changed if sanitization is not configured.
+func (s *Sanitize) Line(line string) string {
+    if s == nil {
+        return line
+    }
+    line = rgANSI.ReplaceAllString(line, "")
+    var b strings.Builder
+    for _, r := range line {
+        switch {
+            case r == '\t':
+                b.WriteRune(r)
+            case unicode.IsControl(r):
+                fmt.Fprintf(&b, "\\x%02x", r)
+            default:
+                b.WriteRune(r)
+        }
+    }
+    line = b.String()
+    size := s.MaxLineLength
+    if size == 0 {
+        size = DefaultSanitizeLineLength
+    }
+    if runes := []rune(line); len(runes) > size {
+        line = string(runes[:size]) + "..."
+    }
+    return line
+}
+
+// escapes returns true if markup should be escaped.
+func (s *Sanitize) escapes() bool {
+    return (s != nil) && s.Escape
+}
+
+// slackEscape escapes control symbols of Slack message format.
+func slackEscape(text string) string {
+    return slackReplacer.Replace(text)
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Sanitization testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSanitize(t *testing.T) {
+    var (
+        group sync.WaitGroup
+        s *Sanitize
+    )
+    raw := "\x1b[31mERROR\x1b[0m bad\x07\x00 data\r\tend"
+    if line := s.Line(raw); line != raw {
+        t.Errorf("line should not be changed without sanitization: %q", line)
+    }
+    s = &Sanitize{MaxLineLength: 20}
+    if line := s.Line(raw); line != "ERROR bad\\x07\\x00 da..." {
+        t.Errorf("incorrect sanitized line: %q", line)
+    }
+    if err := (&Sanitize{MaxLineLength: -1}).Validate(); err == nil {
+        t.Errorf("need max_line_length error")
+    }
+    if text := slackEscape("<b>a & b</b>"); text != "&lt;b&gt;a &amp; b&lt;/b&gt;" {
+        t.Errorf("incorrect slack escaping: %v", text)
+    }
+    filename := filepath.Join(buildDir(), "test_sanitize.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    if err := updateFile(filename, raw); err != nil {
+        t.Fatal(err)
+    }
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    notifier := newRecordNotifier()
+    logger := New()
+    logger.notifier = notifier
+    logger.Cfg.Sanitize = &Sanitize{}
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    msg := notifier.wait(time.Second)
+    if !strings.Contains(msg, "1: ERROR bad\\x07\\x00 data\\x0d\tend") {
+        t.Errorf("reported line is not sanitized: %q", msg)
+    }
+    if strings.ContainsAny(msg, "\x1b\x07\x00\r") {
+        t.Errorf("control symbols are reported: %q", msg)
+    }
+}
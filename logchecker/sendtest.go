@@ -0,0 +1,91 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Test notifications
+//
+package logchecker
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "time"
+)
+
+// TestNotificationSubject is a subject of test notifications.
+const TestNotificationSubject string = "LogChecker test notification"
+
+// SendTest sends a canned test message by the active notifier. Emails
+// are sent synchronously without retries, so errors of authentication,
+// TLS and recipients are returned. Recipients of all watched files
+// are used if to is empty.
+func (logger *LogChecker) SendTest(to []string) error {
+    if len(to) == 0 {
+        to = logger.Cfg.recipients()
+    }
+    if len(to) == 0 {
+        return fmt.Errorf("recipients of test notification are empty")
+    }
+    hostname, _ := os.Hostname()
+    msg := fmt.Sprintf("%v\nTest notification from %v at %v, watched files are not checked.\n\n--\nBR, LogChecker",
+        logger.Cfg.preamble(), hostname, time.Now().Format(time.RFC3339))
+    notifier, err := logger.notifierByName(EmailNotifier, &File{})
+    if err != nil {
+        return err
+    }
+    if sender, ok := notifier.(*LogChecker); ok {
+        return sender.sendEmail(TestNotificationSubject, msg, to, sender.Cfg.Sender["delivery"])
+    }
+    ctx, cancel := logger.notifyContext()
+    defer cancel()
+    return notify(ctx, notifier, TestNotificationSubject, msg, to)
+}
+
+// sendEmail sends an email message and returns an error
+// for every failed recipient of individual delivery.
+func (logger *LogChecker) sendEmail(subject, msg string, to []string, delivery string) error {
+    header, body := logger.emailHeader(subject), logger.emailBody(msg)
+    auth, from := senderAuth(logger.Cfg.Sender), senderFrom(logger.Cfg.Sender)
+    server := newSMTPServer(logger.Cfg.Sender)
+    ctx, cancel := logger.notifyContext()
+    defer cancel()
+    if delivery == DeliveryIndividual {
+        var result []error
+        errs := sendIndividual(ctx, server, auth, from, to, func(rcpt string) []byte {
+            return []byte(header + "To: " + rcpt + "\n" + body)
+        })
+        for _, rcpt := range to {
+            if err, ok := errs[rcpt]; ok {
+                result = append(result, fmt.Errorf("send email error [%v]: %v", rcpt, err))
+            }
+        }
+        return errors.Join(result...)
+    }
+    content := []byte(header + body)
+    if len(server.mode) == 0 {
+        return sendMail(ctx, server.addr, auth, from, to, content)
+    }
+    return server.send(ctx, auth, from, to, content)
+}
+
+// recipients returns unique email recipients of all watched files.
+func (cfg *Config) recipients() []string {
+    var result []string
+    found := map[string]bool{}
+    for _, serv := range cfg.Observed {
+        for _, f := range serv.Files {
+            emails := append(append([]string{}, serv.FileEmails(&f)...), f.EscalateEmails...)
+            for _, p := range f.Patterns {
+                emails = append(emails, p.Emails...)
+            }
+            for _, email := range emails {
+                if !found[email] {
+                    found[email] = true
+                    result = append(result, email)
+                }
+            }
+        }
+    }
+    return result
+}
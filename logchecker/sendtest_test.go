@@ -0,0 +1,65 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestSendTest(t *testing.T) {
+    var recipients []string
+    var content string
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        recipients, content = to, string(msg)
+        if to[0] == "rejected@host.com" {
+            return fmt.Errorf("550 mailbox unavailable")
+        }
+        return nil
+    }
+    logger := New()
+    logger.notifier = logger
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com:25"}
+    if err := logger.SendTest(nil); err == nil {
+        t.Errorf("need empty recipients error")
+    }
+    logger.Cfg.Observed = []Service{
+        {Name: "app", Emails: []string{"admin@host.com"}, Files: []File{
+            {Log: "/var/log/app.log"},
+            {Log: "/var/log/app_error.log", Emails: []string{"dev@host.com", "admin@host.com"}},
+        }},
+    }
+    if err := logger.SendTest(nil); err != nil {
+        t.Fatal(err)
+    }
+    if strings.Join(recipients, ",") != "admin@host.com,dev@host.com" {
+        t.Errorf("incorrect recipients: %v", recipients)
+    }
+    if !strings.Contains(content, "Subject: " + TestNotificationSubject + "\n") || !strings.Contains(content, "Test notification from") {
+        t.Errorf("incorrect message: %v", content)
+    }
+    if err := logger.SendTest([]string{"rejected@host.com"}); (err == nil) || !strings.Contains(err.Error(), "550") {
+        t.Errorf("need SMTP error: %v", err)
+    }
+    // the active notifier is used
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    if err := logger.SendTest([]string{"user@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    if msg := notifier.wait(time.Second); !strings.Contains(msg, "Test notification from") {
+        t.Errorf("incorrect notification: %v", msg)
+    }
+    if subject := <-notifier.subjects; subject != TestNotificationSubject {
+        t.Errorf("incorrect subject: %v", subject)
+    }
+}
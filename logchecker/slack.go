@@ -0,0 +1,125 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Slack webhook notifier
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// SlackNotifierName is a name of the Slack notifier configured by "slack" settings.
+const SlackNotifierName string = "slack"
+
+var (
+    // SlackTimeout is a timeout of Slack webhook requests.
+    SlackTimeout = 10 * time.Second
+    rgReportLine = regexp.MustCompile(`^\d+: `)
+)
+
+// SlackNotifier sends notifications to Slack incoming webhook,
+// Escape activates escaping of Slack markup symbols.
+type SlackNotifier struct {
+    WebhookURL string
+    Channel string
+    Username string
+    Escape bool
+}
+
+// slackPayload is a message of Slack incoming webhook.
+type slackPayload struct {
+    Text string      `json:"text"`
+    Channel string   `json:"channel,omitempty"`
+    Username string  `json:"username,omitempty"`
+}
+
+// NewSlackNotifier creates SlackNotifier from "slack" config settings:
+// "webhook_url" (mandatory), "channel" and "username".
+func NewSlackNotifier(settings map[string]string) (*SlackNotifier, error) {
+    webhook := settings["webhook_url"]
+    if len(webhook) == 0 {
+        return nil, fmt.Errorf("slack webhook_url should not be empty")
+    }
+    u, err := url.Parse(webhook)
+    if err != nil {
+        return nil, fmt.Errorf("slack webhook_url is incorrect: %v", err)
+    }
+    if ((u.Scheme != "https") && (u.Scheme != "http")) || (len(u.Host) == 0) {
+        return nil, fmt.Errorf("slack webhook_url should be an absolute HTTP(S) URL")
+    }
+    return &SlackNotifier{WebhookURL: webhook, Channel: settings["channel"], Username: settings["username"]}, nil
+}
+
+// String returns a name of the notifier.
+func (sn *SlackNotifier) String() string {
+    if len(sn.Channel) > 0 {
+        return fmt.Sprintf("slack (%v)", sn.Channel)
+    }
+    return SlackNotifierName
+}
+
+// Notify posts a message to Slack webhook, recipients are ignored.
+func (sn *SlackNotifier) Notify(msg string, to []string) error {
+    return sn.NotifyContext(context.Background(), msg, to)
+}
+
+// NotifyContext posts a message to Slack webhook, the request
+// is cancelled when the context is done.
+func (sn *SlackNotifier) NotifyContext(ctx context.Context, msg string, to []string) error {
+    text := truncateReport(msg)
+    if sn.Escape {
+        text = slackEscape(text)
+    }
+    payload, err := json.Marshal(slackPayload{text, sn.Channel, sn.Username})
+    if err != nil {
+        return fmt.Errorf("slack payload error: %v", err)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, sn.WebhookURL, bytes.NewReader(payload))
+    if err != nil {
+        return fmt.Errorf("slack request error: %v", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    client := &http.Client{Timeout: SlackTimeout}
+    resp, err := client.Do(req)
+    if err != nil {
+        return fmt.Errorf("slack request error: %v", err)
+    }
+    defer resp.Body.Close()
+    if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+        return fmt.Errorf("slack response error: %v", resp.Status)
+    }
+    LoggerDebug.Printf("slack notification is sent: %v", sn)
+    return nil
+}
+
+// truncateReport limits a number of reported lines like File.Check does,
+// it is used for messages that were not prepared by File.Check.
+func truncateReport(msg string) string {
+    var counter uint64
+    lines := strings.Split(msg, "\n")
+    result := make([]string, 0, len(lines))
+    for _, line := range lines {
+        if rgReportLine.MatchString(line) {
+            counter++
+            switch {
+                case counter == (maxMsgLines + 2):
+                    result = append(result, "...")
+                    continue
+                case counter > (maxMsgLines + 2):
+                    continue
+            }
+        }
+        result = append(result, line)
+    }
+    return strings.Join(result, "\n")
+}
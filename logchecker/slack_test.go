@@ -0,0 +1,78 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Slack notifier testing methods
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestSlackNotifier(t *testing.T) {
+    payloads := make(chan slackPayload, 10)
+    status := http.StatusOK
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var payload slackPayload
+        if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+            t.Errorf("incorrect content type: %v", ct)
+        }
+        if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+            t.Errorf("incorrect payload: %v", err)
+        }
+        payloads <- payload
+        w.WriteHeader(status)
+    }))
+    defer server.Close()
+
+    for _, settings := range []map[string]string{
+        {},
+        {"webhook_url": "hooks.slack.com/services/test"},
+        {"webhook_url": "ftp://hooks.slack.com/services/test"},
+    } {
+        if _, err := NewSlackNotifier(settings); err == nil {
+            t.Errorf("need settings error: %v", settings)
+        }
+    }
+    sn, err := NewSlackNotifier(map[string]string{"webhook_url": server.URL, "channel": "#ops", "username": "logchecker"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := []string{"Report for \"app\" service:"}
+    for i := 1; i <= 20; i++ {
+        lines = append(lines, fmt.Sprintf("%v: ERROR %v", i, i))
+    }
+    sn.Notify(strings.Join(lines, "\n"), []string{"user@host.com"})
+    select {
+        case payload := <-payloads:
+            if (payload.Channel != "#ops") || (payload.Username != "logchecker") {
+                t.Errorf("incorrect payload: %v", payload)
+            }
+            if !strings.Contains(payload.Text, "11: ERROR 11\n...") || strings.Contains(payload.Text, "12: ERROR") {
+                t.Errorf("incorrect truncation: %v", payload.Text)
+            }
+        case <-time.After(time.Second):
+            t.Errorf("payload is not posted")
+    }
+    // a non-2xx response is only logged
+    status = http.StatusNotFound
+    sn.Notify("test", nil)
+    if payload := <-payloads; payload.Text != "test" {
+        t.Errorf("incorrect payload: %v", payload)
+    }
+
+    cfg := Config{Slack: map[string]string{"webhook_url": server.URL}}
+    if !cfg.hasNotifier(SlackNotifierName) {
+        t.Errorf("slack notifier should be available")
+    }
+    if err := RegisterNotifier(SlackNotifierName, sn); err == nil {
+        t.Errorf("need reserved name error")
+    }
+}
@@ -0,0 +1,294 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// SMTP delivery methods
+//
+package logchecker
+
+import (
+    "context"
+    "crypto/tls"
+    "fmt"
+    "net/smtp"
+    "strconv"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    // DeliveryCombined is a delivery mode of one message for all recipients.
+    DeliveryCombined string = "combined"
+    // DeliveryIndividual is a delivery mode of one message per recipient.
+    DeliveryIndividual string = "individual"
+    // TLSNone is a mode of SMTP connection without TLS.
+    TLSNone string = "none"
+    // TLSStart is a mode of SMTP connection with mandatory STARTTLS.
+    TLSStart string = "starttls"
+    // TLSImplicit is a mode of SMTP connection over TLS, usually port 465.
+    TLSImplicit string = "ssl"
+    // TLSImplicitAlias is an alias of TLSImplicit mode.
+    TLSImplicitAlias string = "tls"
+    // AuthPlain is a default SMTP authentication by user and password.
+    AuthPlain string = "plain"
+    // AuthNone is a mode of SMTP relay without authentication.
+    AuthNone string = "none"
+    // DefaultSendAttempts is a default number of email send attempts.
+    DefaultSendAttempts int = 1
+    // DefaultSendBackoff is a default delay before the first send retry,
+    // it's doubled for every next retry.
+    DefaultSendBackoff = 2 * time.Second
+)
+
+// DeliveryStats is per-recipient statistics of email delivery.
+// Notifications is a number of messages failed after all send attempts.
+type DeliveryStats struct {
+    Sent uint64
+    Failed uint64
+    Notifications uint64
+}
+
+// String returns a delivery statistics info.
+func (ds *DeliveryStats) String() string {
+    return fmt.Sprintf(
+        "sent=%v, failed=%v, failed notifications=%v",
+        atomic.LoadUint64(&ds.Sent),
+        atomic.LoadUint64(&ds.Failed),
+        atomic.LoadUint64(&ds.Notifications),
+    )
+}
+
+func (ds *DeliveryStats) add(sent, failed uint64) {
+    atomic.AddUint64(&ds.Sent, sent)
+    atomic.AddUint64(&ds.Failed, failed)
+}
+
+// emailSender is an email notifier with a specific delivery mode.
+type emailSender struct {
+    logger *LogChecker
+    delivery string
+}
+
+func (es *emailSender) String() string {
+    return fmt.Sprintf("email (%v)", es.delivery)
+}
+
+func (es *emailSender) Notify(msg string, to []string) error {
+    return es.NotifySubject(DefaultSubject, msg, to)
+}
+
+func (es *emailSender) NotifySubject(subject, msg string, to []string) error {
+    return es.logger.deliver(subject, msg, "", to, es.delivery)
+}
+
+func validDelivery(delivery string) bool {
+    switch delivery {
+        case "", DeliveryCombined, DeliveryIndividual:
+            return true
+    }
+    return false
+}
+
+// smtpServer is a connection settings of SMTP server.
+type smtpServer struct {
+    addr string
+    host string
+    mode string
+    skipVerify bool
+}
+
+// newSMTPServer returns SMTP connection settings from sender fields.
+// Sender field "insecure_skip_verify" is an alias of "skip_verify".
+func newSMTPServer(sender map[string]string) *smtpServer {
+    s := &smtpServer{
+        addr: sender["addr"],
+        host: sender["host"],
+        mode: sender["tls"],
+        skipVerify: (sender["skip_verify"] == "true") || (sender["insecure_skip_verify"] == "true"),
+    }
+    if s.mode == TLSImplicitAlias {
+        s.mode = TLSImplicit
+    }
+    return s
+}
+
+// senderFields returns mandatory sender fields of the authentication mode.
+func senderFields(sender map[string]string) ([]string, error) {
+    switch sender["auth"] {
+        case "", AuthPlain:
+            return []string{"user", "password", "host", "addr"}, nil
+        case AuthNone:
+            return []string{"from", "host", "addr"}, nil
+    }
+    return nil, fmt.Errorf("unknown sender auth mode [%v]", sender["auth"])
+}
+
+// senderAuth returns SMTP authentication, it's nil for AuthNone mode.
+func senderAuth(sender map[string]string) smtp.Auth {
+    if sender["auth"] == AuthNone {
+        return nil
+    }
+    return smtp.PlainAuth("", sender["user"], sender["password"], sender["host"])
+}
+
+// senderFrom returns an envelope sender address, "from" field has priority over "user".
+func senderFrom(sender map[string]string) string {
+    if from := sender["from"]; len(from) > 0 {
+        return from
+    }
+    return sender["user"]
+}
+
+// senderFromHeader returns a value of "From" header, "from" field or "LogChecker".
+func senderFromHeader(sender map[string]string) string {
+    if from := SanitizeSubject(sender["from"]); len(from) > 0 {
+        return from
+    }
+    return "LogChecker"
+}
+
+// retryPolicy returns a number of send attempts and a delay before
+// the first retry from sender "attempts" and "backoff" fields.
+func retryPolicy(sender map[string]string) (int, time.Duration, error) {
+    attempts, backoff := DefaultSendAttempts, DefaultSendBackoff
+    if value := sender["attempts"]; len(value) > 0 {
+        n, err := strconv.Atoi(value)
+        if (err != nil) || (n < 1) {
+            return 0, 0, fmt.Errorf("sender attempts should be a positive number")
+        }
+        attempts = n
+    }
+    if value := sender["backoff"]; len(value) > 0 {
+        d, err := time.ParseDuration(value)
+        if (err != nil) || (d <= 0) {
+            return 0, 0, fmt.Errorf("sender backoff should be a positive duration")
+        }
+        backoff = d
+    }
+    return attempts, backoff, nil
+}
+
+func validTLS(mode string) bool {
+    switch mode {
+        case "", TLSNone, TLSStart, TLSImplicit, TLSImplicitAlias:
+            return true
+    }
+    return false
+}
+
+// dial opens SMTP connection using TLS mode and authenticates if auth is not nil.
+// Without TLS mode STARTTLS is used if a server supports it, like smtp.SendMail does.
+// The connection is closed when the context is done.
+func (s *smtpServer) dial(ctx context.Context, a smtp.Auth) (*smtp.Client, error) {
+    c, _, err := s.open(ctx, a)
+    return c, err
+}
+
+// open is dial that returns the client's connection as well.
+func (s *smtpServer) open(ctx context.Context, a smtp.Auth) (*smtp.Client, *contextConn, error) {
+    var (
+        c *smtp.Client
+        conn *contextConn
+        err error
+    )
+    tlsConfig := &tls.Config{ServerName: s.host, InsecureSkipVerify: s.skipVerify}
+    if s.mode == TLSImplicit {
+        if conn, err = dialContext(ctx, s.addr, tlsConfig); err != nil {
+            return nil, nil, err
+        }
+        if c, err = smtp.NewClient(conn, s.host); err != nil {
+            conn.Close()
+            return nil, nil, err
+        }
+    } else {
+        if conn, err = dialContext(ctx, s.addr, nil); err != nil {
+            return nil, nil, err
+        }
+        if c, err = smtp.NewClient(conn, s.host); err != nil {
+            conn.Close()
+            return nil, nil, err
+        }
+        ok, _ := c.Extension("STARTTLS")
+        switch {
+            case (s.mode == TLSStart) && !ok:
+                c.Close()
+                return nil, nil, fmt.Errorf("server doesn't support STARTTLS")
+            case ok && (s.mode != TLSNone):
+                if err = c.StartTLS(tlsConfig); err != nil {
+                    c.Close()
+                    return nil, nil, err
+                }
+        }
+    }
+    if a != nil {
+        if ok, _ := c.Extension("AUTH"); ok {
+            if err = c.Auth(a); err != nil {
+                c.Close()
+                return nil, nil, err
+            }
+        }
+    }
+    return c, conn, nil
+}
+
+// send sends a message to recipients by one SMTP transaction.
+func (s *smtpServer) send(ctx context.Context, a smtp.Auth, from string, to []string, msg []byte) error {
+    c, err := s.dial(ctx, a)
+    if err != nil {
+        return err
+    }
+    defer c.Close()
+    if err = sendTransaction(c, from, to, msg); err != nil {
+        return err
+    }
+    return c.Quit()
+}
+
+// sendIndividual sends a message to every recipient by a separate SMTP transaction,
+// but only one connection is used. It returns errors for failed recipients.
+func sendIndividual(ctx context.Context, s *smtpServer, a smtp.Auth, from string, to []string, content func(string) []byte) map[string]error {
+    errs := make(map[string]error)
+    fail := func(err error) map[string]error {
+        for _, rcpt := range to {
+            if _, ok := errs[rcpt]; !ok {
+                errs[rcpt] = err
+            }
+        }
+        return errs
+    }
+    c, err := s.dial(ctx, a)
+    if err != nil {
+        return fail(err)
+    }
+    defer c.Close()
+    for _, rcpt := range to {
+        if err = sendTransaction(c, from, []string{rcpt}, content(rcpt)); err != nil {
+            errs[rcpt] = err
+            if err = c.Reset(); err != nil {
+                return fail(err)
+            }
+        }
+    }
+    c.Quit()
+    return errs
+}
+
+// sendTransaction sends one message using opened SMTP connection.
+func sendTransaction(c *smtp.Client, from string, to []string, msg []byte) error {
+    if err := c.Mail(from); err != nil {
+        return err
+    }
+    for _, rcpt := range to {
+        if err := c.Rcpt(rcpt); err != nil {
+            return err
+        }
+    }
+    w, err := c.Data()
+    if err != nil {
+        return err
+    }
+    if _, err = w.Write(msg); err != nil {
+        return err
+    }
+    return w.Close()
+}
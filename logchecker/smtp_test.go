@@ -0,0 +1,409 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// SMTP delivery testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "fmt"
+    "math/big"
+    "net"
+    "net/smtp"
+    "net/textproto"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// smtpMessage is a message received by smtpStub.
+type smtpMessage struct {
+    from string
+    to []string
+    data string
+    secure bool
+    auth bool
+}
+
+// smtpStub is a local SMTP server for tests.
+type smtpStub struct {
+    listener net.Listener
+    reject map[string]bool
+    tlsConfig *tls.Config
+    implicit bool
+    mutex sync.Mutex
+    connections int
+    messages []smtpMessage
+}
+
+func newSMTPStub(t testing.TB, reject ...string) *smtpStub {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can't start SMTP stub: %v", err)
+    }
+    stub := &smtpStub{listener: listener, reject: map[string]bool{}}
+    for _, rcpt := range reject {
+        stub.reject[rcpt] = true
+    }
+    go stub.serve()
+    return stub
+}
+
+// newTLSSMTPStub starts SMTP stub with STARTTLS support or implicit TLS.
+func newTLSSMTPStub(t *testing.T, implicit bool) *smtpStub {
+    cfg := &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}}
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("can't start SMTP stub: %v", err)
+    }
+    if implicit {
+        listener = tls.NewListener(listener, cfg)
+    }
+    stub := &smtpStub{listener: listener, reject: map[string]bool{}, tlsConfig: cfg, implicit: implicit}
+    go stub.serve()
+    return stub
+}
+
+// testCertificate generates a self-signed certificate for 127.0.0.1.
+func testCertificate(t *testing.T) tls.Certificate {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject: pkix.Name{Organization: []string{"LogChecker test"}},
+        NotBefore: time.Now().Add(-time.Hour),
+        NotAfter: time.Now().Add(time.Hour),
+        KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+        ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (s *smtpStub) Addr() string {
+    return s.listener.Addr().String()
+}
+
+func (s *smtpStub) Close() {
+    s.listener.Close()
+}
+
+func (s *smtpStub) Messages() []smtpMessage {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return append([]smtpMessage{}, s.messages...)
+}
+
+func (s *smtpStub) Connections() int {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    return s.connections
+}
+
+func (s *smtpStub) serve() {
+    for {
+        conn, err := s.listener.Accept()
+        if err != nil {
+            return
+        }
+        s.mutex.Lock()
+        s.connections++
+        s.mutex.Unlock()
+        go s.handle(conn)
+    }
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+    var msg smtpMessage
+    defer func() {
+        conn.Close()
+    }()
+    secure, auth := s.implicit, false
+    tp := textproto.NewConn(conn)
+    tp.PrintfLine("220 localhost ESMTP stub")
+    for {
+        line, err := tp.ReadLine()
+        if err != nil {
+            return
+        }
+        cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+        switch cmd {
+            case "EHLO":
+                tp.PrintfLine("250-localhost")
+                if (s.tlsConfig != nil) && !secure {
+                    tp.PrintfLine("250-STARTTLS")
+                }
+                tp.PrintfLine("250 AUTH PLAIN")
+            case "STARTTLS":
+                tp.PrintfLine("220 Ready to start TLS")
+                tlsConn := tls.Server(conn, s.tlsConfig)
+                if err := tlsConn.Handshake(); err != nil {
+                    return
+                }
+                conn, secure = tlsConn, true
+                tp = textproto.NewConn(conn)
+            case "HELO", "NOOP":
+                tp.PrintfLine("250 OK")
+            case "AUTH":
+                auth = true
+                tp.PrintfLine("235 Authentication successful")
+            case "MAIL":
+                msg = smtpMessage{from: line, secure: secure, auth: auth}
+                tp.PrintfLine("250 OK")
+            case "RCPT":
+                rcpt := strings.Trim(line[strings.Index(line, ":") + 1:], " <>")
+                if s.reject[rcpt] {
+                    tp.PrintfLine("550 rejected recipient")
+                } else {
+                    msg.to = append(msg.to, rcpt)
+                    tp.PrintfLine("250 OK")
+                }
+            case "DATA":
+                tp.PrintfLine("354 Go ahead")
+                data, err := tp.ReadDotLines()
+                if err != nil {
+                    return
+                }
+                msg.data = strings.Join(data, "\n")
+                s.mutex.Lock()
+                s.messages = append(s.messages, msg)
+                s.mutex.Unlock()
+                tp.PrintfLine("250 OK")
+            case "RSET":
+                msg = smtpMessage{}
+                tp.PrintfLine("250 OK")
+            case "QUIT":
+                tp.PrintfLine("221 Bye")
+                return
+            default:
+                tp.PrintfLine("502 unknown command")
+        }
+    }
+}
+
+func TestIndividualDelivery(t *testing.T) {
+    stub := newSMTPStub(t, "bad@host.com")
+    defer stub.Close()
+
+    logger := New()
+    logger.Cfg.Sender = map[string]string{
+        "user": "user@host.com",
+        "password": "password",
+        "host": "127.0.0.1",
+        "addr": stub.Addr(),
+        "delivery": DeliveryIndividual,
+    }
+    to := []string{"1@host.com", "bad@host.com", "2@host.com"}
+    logger.Notify("test message", to)
+    if n := stub.Connections(); n != 1 {
+        t.Errorf("incorrect number of connections: %v", n)
+    }
+    messages := stub.Messages()
+    if len(messages) != 2 {
+        t.Fatalf("incorrect number of messages: %v", len(messages))
+    }
+    for i, rcpt := range []string{"1@host.com", "2@host.com"} {
+        if (len(messages[i].to) != 1) || (messages[i].to[0] != rcpt) {
+            t.Errorf("incorrect recipients: %v", messages[i].to)
+        }
+        if !strings.Contains(messages[i].data, "To: " + rcpt + "\n") {
+            t.Errorf("incorrect To header: %v", messages[i].data)
+        }
+        if strings.Contains(messages[i].data, "bad@host.com") {
+            t.Errorf("other recipients are visible: %v", messages[i].data)
+        }
+    }
+    if (logger.Delivery.Sent != 2) || (logger.Delivery.Failed != 1) {
+        t.Errorf("incorrect delivery stats: %v", logger.Delivery.String())
+    }
+    // per-file combined mode
+    logger.emailNotifier(DeliveryCombined).Notify("test message", []string{"1@host.com", "2@host.com"})
+    messages = stub.Messages()
+    if (len(messages) != 3) || (len(messages[2].to) != 2) {
+        t.Errorf("incorrect combined message: %v", messages)
+    }
+    if (logger.Delivery.Sent != 4) || (logger.Delivery.Failed != 1) {
+        t.Errorf("incorrect delivery stats: %v", logger.Delivery.String())
+    }
+    if validDelivery("unknown") {
+        t.Errorf("incorrect delivery validation")
+    }
+}
+
+func TestSMTPTLS(t *testing.T) {
+    cases := []struct {
+        mode string
+        skip string
+        implicit bool
+        secure bool
+    }{
+        {TLSNone, "skip_verify", false, false},
+        {TLSStart, "skip_verify", false, true},
+        {TLSImplicit, "skip_verify", true, true},
+        {TLSImplicitAlias, "insecure_skip_verify", true, true},
+    }
+    for _, c := range cases {
+        stub := newTLSSMTPStub(t, c.implicit)
+        logger := New()
+        logger.Cfg.Sender = map[string]string{
+            "user": "user@host.com",
+            "password": "password",
+            "host": "127.0.0.1",
+            "addr": stub.Addr(),
+            "tls": c.mode,
+            c.skip: "true",
+        }
+        logger.Notify("test message", []string{"1@host.com", "2@host.com"})
+        messages := stub.Messages()
+        if (len(messages) != 1) || (messages[0].secure != c.secure) || (len(messages[0].to) != 2) {
+            t.Errorf("incorrect %v messages: %v", c.mode, messages)
+        }
+        if logger.Delivery.Sent != 2 {
+            t.Errorf("incorrect %v delivery stats: %v", c.mode, logger.Delivery.String())
+        }
+        stub.Close()
+    }
+    // certificate verification
+    stub := newTLSSMTPStub(t, false)
+    defer stub.Close()
+    server := newSMTPServer(map[string]string{"addr": stub.Addr(), "host": "127.0.0.1", "tls": TLSStart})
+    if _, err := server.dial(context.Background(), nil); err == nil {
+        t.Errorf("need certificate verification error")
+    }
+    // STARTTLS is mandatory
+    plain := newSMTPStub(t)
+    defer plain.Close()
+    server = newSMTPServer(map[string]string{"addr": plain.Addr(), "host": "127.0.0.1", "tls": TLSStart})
+    if _, err := server.dial(context.Background(), nil); err == nil {
+        t.Errorf("need STARTTLS support error")
+    }
+    if validTLS("unknown") {
+        t.Errorf("incorrect tls mode validation")
+    }
+}
+
+func TestSendRetry(t *testing.T) {
+    var (
+        mutex sync.Mutex
+        calls int
+        failures int
+    )
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        mutex.Lock()
+        defer mutex.Unlock()
+        calls++
+        if calls <= failures {
+            return fmt.Errorf("temporary failure")
+        }
+        return nil
+    }
+    logger := New()
+    logger.Cfg.Sender = map[string]string{"user": "user@host.com", "host": "smtp.host.com", "attempts": "3", "backoff": "20ms"}
+    if _, _, err := retryPolicy(map[string]string{"backoff": "-1s"}); err == nil {
+        t.Errorf("incorrect backoff validation")
+    }
+    // success after two retries, Stop waits for them
+    failures = 2
+    start := time.Now()
+    logger.Notify("test", []string{"1@host.com", "2@host.com"})
+    logger.Running = time.Now()
+    if err := logger.Stop(&sync.WaitGroup{}); err != nil {
+        t.Fatal(err)
+    }
+    if d := time.Since(start); d < 60 * time.Millisecond {
+        t.Errorf("backoff is not exponential: %v", d)
+    }
+    if (calls != 3) || (logger.Delivery.Sent != 2) || (logger.Delivery.Failed != 0) {
+        t.Errorf("incorrect delivery after retries: %v, %v", calls, logger.Delivery.String())
+    }
+    // all attempts are failed
+    calls, failures = 0, 10
+    logger.Notify("test", []string{"1@host.com"})
+    logger.inflight.Wait()
+    if (calls != 3) || (logger.Delivery.Failed != 1) || (logger.Delivery.Notifications != 1) {
+        t.Errorf("incorrect delivery after failed retries: %v, %v", calls, logger.Delivery.String())
+    }
+    if !strings.Contains(logger.Stats().Delivery, "failed notifications=1") {
+        t.Errorf("failed notifications are not reported: %v", logger.Stats().Delivery)
+    }
+    if n := len(logger.DeadLetters()); n != 1 {
+        t.Errorf("incorrect number of dead letters: %v", n)
+    }
+}
+
+func TestSenderAuth(t *testing.T) {
+    cases := []struct {
+        sender map[string]string
+        valid bool
+    }{
+        {map[string]string{"user": "user@host.com", "password": "password"}, true},
+        {map[string]string{"auth": AuthPlain, "user": "user@host.com", "password": "password"}, true},
+        {map[string]string{"auth": AuthPlain, "user": "user@host.com"}, false},
+        {map[string]string{"password": "password"}, false},
+        {map[string]string{"auth": AuthNone, "from": "relay@host.com"}, true},
+        {map[string]string{"auth": AuthNone, "from": "relay@host.com", "user": "", "password": ""}, true},
+        {map[string]string{"auth": AuthNone, "user": "user@host.com"}, false},
+        {map[string]string{"auth": "login", "user": "user@host.com", "password": "password"}, false},
+    }
+    for i, c := range cases {
+        logger := New()
+        logger.Cfg.Storage = "memory"
+        logger.Cfg.Sender = map[string]string{"host": "127.0.0.1", "addr": "127.0.0.1:25"}
+        for k, v := range c.sender {
+            logger.Cfg.Sender[k] = v
+        }
+        if err := logger.Validate(); (err == nil) != c.valid {
+            t.Errorf("incorrect validation of case %v: %v", i, err)
+        }
+    }
+    if from := senderFrom(map[string]string{"user": "user@host.com"}); from != "user@host.com" {
+        t.Errorf("incorrect sender from: %v", from)
+    }
+    stub := newSMTPStub(t)
+    defer stub.Close()
+    for _, auth := range []string{AuthNone, AuthPlain} {
+        logger := New()
+        logger.Cfg.Sender = map[string]string{
+            "auth": auth,
+            "user": "user@host.com",
+            "password": "password",
+            "from": "relay@host.com",
+            "host": "127.0.0.1",
+            "addr": stub.Addr(),
+        }
+        logger.Notify("test message", []string{"1@host.com"})
+        if logger.Delivery.Sent != 1 {
+            t.Errorf("incorrect %v delivery stats: %v", auth, logger.Delivery.String())
+        }
+    }
+    messages := stub.Messages()
+    if len(messages) != 2 {
+        t.Fatalf("incorrect number of messages: %v", len(messages))
+    }
+    for i, auth := range []bool{false, true} {
+        if (messages[i].auth != auth) || !strings.Contains(messages[i].from, "relay@host.com") {
+            t.Errorf("incorrect message %v: %v", i, messages[i])
+        }
+        if !strings.Contains(messages[i].data, "From: relay@host.com\n") {
+            t.Errorf("incorrect message %v: %v", i, messages[i])
+        }
+    }
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Persistent SMTP connections
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "net/textproto"
+    "sync"
+    "time"
+)
+
+// smtpPool keeps one authenticated SMTP connection open between
+// notifications, sends are serialized over it.
+type smtpPool struct {
+    mutex sync.Mutex
+    key string  // server settings of the opened connection
+    client *smtp.Client
+    conn *contextConn
+    timer *time.Timer
+}
+
+// smtpKeepAlive returns an idle time of a persistent SMTP connection
+// from sender "keepalive" field, zero means that connections are not kept.
+func smtpKeepAlive(sender map[string]string) (time.Duration, error) {
+    value := sender["keepalive"]
+    if len(value) == 0 {
+        return 0, nil
+    }
+    d, err := time.ParseDuration(value)
+    if (err != nil) || (d <= 0) {
+        return 0, fmt.Errorf("sender keepalive should be a positive duration")
+    }
+    return d, nil
+}
+
+// send sends a message using the opened connection, it's reconnected
+// if the connection is failed. Rejected messages don't close it.
+// The connection is closed after idle time without sends.
+func (p *smtpPool) send(ctx context.Context, s *smtpServer, a smtp.Auth, from string, to []string, msg []byte, idle time.Duration) error {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    if p.timer != nil {
+        p.timer.Stop()
+        p.timer = nil
+    }
+    key := fmt.Sprint(*s, from)
+    if (p.client != nil) && (p.key != key) {
+        p.close()
+    }
+    if p.client != nil {
+        usable, err := p.transaction(ctx, from, to, msg)
+        if usable {
+            p.timer = time.AfterFunc(idle, p.expire)
+            return err
+        }
+        LoggerDebug.Printf("smtp connection is reopened: %v", err)
+        p.close()
+    }
+    c, conn, err := s.open(ctx, a)
+    if err != nil {
+        return err
+    }
+    p.client, p.conn, p.key = c, conn, key
+    usable, err := p.transaction(ctx, from, to, msg)
+    if !usable {
+        p.close()
+        return err
+    }
+    p.timer = time.AfterFunc(idle, p.expire)
+    return err
+}
+
+// transaction sends one message and returns false if the connection
+// can't be used anymore. A transaction rejected by the server is reset.
+// The context is released after it, so the connection stays open.
+func (p *smtpPool) transaction(ctx context.Context, from string, to []string, msg []byte) (bool, error) {
+    p.conn.watch(ctx)
+    defer p.conn.release()
+    err := sendTransaction(p.client, from, to, msg)
+    if err == nil {
+        return true, nil
+    }
+    if _, ok := err.(*textproto.Error); !ok {
+        return false, err
+    }
+    return p.client.Reset() == nil, err
+}
+
+// expire closes the idle connection.
+func (p *smtpPool) expire() {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    p.timer = nil
+    p.close()
+}
+
+// close quits and closes the connection, the mutex should be locked.
+func (p *smtpPool) close() {
+    if p.client == nil {
+        return
+    }
+    p.conn.SetDeadline(time.Now().Add(DialTimeout))
+    if err := p.client.Quit(); err != nil {
+        p.client.Close()
+    }
+    p.client, p.conn, p.key = nil, nil, ""
+}
+
+// Close closes the opened connection.
+func (p *smtpPool) Close() {
+    p.mutex.Lock()
+    defer p.mutex.Unlock()
+    if p.timer != nil {
+        p.timer.Stop()
+        p.timer = nil
+    }
+    p.close()
+}
+
+// sendIndividual sends a message to every recipient by a separate
+// transaction over the persistent connection.
+func (p *smtpPool) sendIndividual(ctx context.Context, s *smtpServer, a smtp.Auth, from string, to []string, content func(string) []byte, idle time.Duration) map[string]error {
+    errs := make(map[string]error)
+    for _, rcpt := range to {
+        if err := p.send(ctx, s, a, from, []string{rcpt}, content(rcpt), idle); err != nil {
+            errs[rcpt] = err
+        }
+    }
+    return errs
+}
+
+// smtpSend sends a message over the persistent connection if sender
+// "keepalive" is set, otherwise a new connection is used.
+func (logger *LogChecker) smtpSend(ctx context.Context, s *smtpServer, a smtp.Auth, from string, to []string, msg []byte) error {
+    if idle, _ := smtpKeepAlive(logger.Cfg.Sender); idle > 0 {
+        return logger.smtpConns.send(ctx, s, a, from, to, msg, idle)
+    }
+    if len(s.mode) == 0 {
+        return sendMail(ctx, s.addr, a, from, to, msg)
+    }
+    return s.send(ctx, a, from, to, msg)
+}
+
+// smtpSendIndividual is smtpSend of individual messages for every recipient.
+func (logger *LogChecker) smtpSendIndividual(ctx context.Context, s *smtpServer, a smtp.Auth, from string, to []string, content func(string) []byte) map[string]error {
+    if idle, _ := smtpKeepAlive(logger.Cfg.Sender); idle > 0 {
+        return logger.smtpConns.sendIndividual(ctx, s, a, from, to, content, idle)
+    }
+    return sendIndividual(ctx, s, a, from, to, content)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Persistent SMTP connections testing methods
+//
+package logchecker
+
+import (
+    "fmt"
+    "testing"
+    "time"
+)
+
+// keepAliveSender returns sender settings of the SMTP stub.
+func keepAliveSender(stub *smtpStub, keepalive string) map[string]string {
+    sender := map[string]string{"user": "user@host.com", "password": "password", "host": "127.0.0.1", "addr": stub.Addr()}
+    if len(keepalive) > 0 {
+        sender["keepalive"] = keepalive
+    }
+    return sender
+}
+
+func TestSMTPKeepAlive(t *testing.T) {
+    for _, value := range []string{"0s", "-1s", "30"} {
+        if _, err := smtpKeepAlive(map[string]string{"keepalive": value}); err == nil {
+            t.Errorf("incorrect keepalive is accepted: %v", value)
+        }
+    }
+    stub := newSMTPStub(t, "bad@host.com")
+    defer stub.Close()
+    logger := New()
+    defer logger.smtpConns.Close()
+    logger.Cfg.Sender = keepAliveSender(stub, "1m")
+    for i := 0; i < 3; i++ {
+        if err := logger.Notify(fmt.Sprintf("message %v", i), []string{"1@host.com"}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // a rejected recipient doesn't close the connection
+    logger.Cfg.Sender["delivery"] = DeliveryIndividual
+    logger.Notify("individual message", []string{"bad@host.com", "2@host.com"})
+    if n := stub.Connections(); n != 1 {
+        t.Errorf("connection is not reused: %v", n)
+    }
+    if messages := stub.Messages(); len(messages) != 4 {
+        t.Errorf("incorrect number of messages: %v", len(messages))
+    }
+    // a broken connection is reopened
+    logger.smtpConns.conn.Conn.Close()
+    if err := logger.Notify("reconnect message", []string{"1@host.com"}); err != nil {
+        t.Errorf("connection is not reopened: %v", err)
+    }
+    if n := stub.Connections(); n != 2 {
+        t.Errorf("incorrect number of connections: %v", n)
+    }
+    // the idle connection is closed
+    logger.Cfg.Sender["keepalive"] = "20ms"
+    if err := logger.Notify("idle message", []string{"1@host.com"}); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(200 * time.Millisecond)
+    logger.smtpConns.mutex.Lock()
+    if logger.smtpConns.client != nil {
+        t.Error("idle connection is not closed")
+    }
+    logger.smtpConns.mutex.Unlock()
+}
+
+func BenchmarkSMTPKeepAlive(b *testing.B) {
+    stub := newSMTPStub(b)
+    defer stub.Close()
+    for _, keepalive := range []string{"", "1m"} {
+        name := "new"
+        if len(keepalive) > 0 {
+            name = "keepalive"
+        }
+        b.Run(name, func(b *testing.B) {
+            logger := New()
+            defer logger.smtpConns.Close()
+            logger.Cfg.Sender = keepAliveSender(stub, keepalive)
+            for i := 0; i < b.N; i++ {
+                // a burst of 50 alerts
+                for j := 0; j < 50; j++ {
+                    if err := logger.Notify("benchmark message", []string{"1@host.com"}); err != nil {
+                        b.Fatal(err)
+                    }
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Snapshots of the memory storage
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// memorySnapshot is a content of a snapshot file.
+type memorySnapshot struct {
+    Saved time.Time                   `json:"saved"`
+    Positions map[string]FileState    `json:"positions"`
+}
+
+// validateSnapshot checks "snapshot" path of the memory storage,
+// its directory should exist.
+func (cfg *Config) validateSnapshot(opts ValidateOptions) error {
+    if len(cfg.Snapshot) == 0 {
+        return nil
+    }
+    switch {
+        case cfg.Storage != "memory":
+            return fmt.Errorf("snapshot requires memory storage")
+        case cfg.PersistState:
+            return fmt.Errorf("snapshot can't be used with persist_state")
+        case !filepath.IsAbs(cfg.Snapshot):
+            return fmt.Errorf("snapshot path should be absolute")
+        case opts.SkipStat:
+            return nil
+    }
+    info, err := os.Stat(filepath.Dir(cfg.Snapshot))
+    if err != nil {
+        return err
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("snapshot directory is not a directory")
+    }
+    return nil
+}
+
+// ExportSnapshot saves all positions, counters and totals to the file,
+// it's replaced atomically.
+func (bk *MemoryBackend) ExportSnapshot(path string) error {
+    bk.mutex.Lock()
+    data, err := json.Marshal(memorySnapshot{Saved: time.Now(), Positions: bk.positions})
+    bk.mutex.Unlock()
+    if err != nil {
+        return err
+    }
+    tmp := path + ".tmp"
+    if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// ImportSnapshot replaces positions by the snapshot file,
+// an incorrect file is rejected and positions are not changed.
+func (bk *MemoryBackend) ImportSnapshot(path string) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    return bk.importSnapshot(path)
+}
+
+// restoreSnapshot imports the snapshot once if it's set,
+// a missing snapshot file is not an error.
+func (bk *MemoryBackend) restoreSnapshot() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if (len(bk.Snapshot) == 0) || bk.imported {
+        return nil
+    }
+    if err := bk.importSnapshot(bk.Snapshot); (err != nil) && !os.IsNotExist(err) {
+        return err
+    }
+    bk.imported = true
+    return nil
+}
+
+// keepSnapshot marks the snapshot of the new back-end as imported during
+// the configuration reload, if its positions are taken from the old one
+// or reset, so the start doesn't replace them by the exported file.
+func keepSnapshot(old, backend Backender, reset bool) {
+    next, ok := backend.(*MemoryBackend)
+    if !ok {
+        return
+    }
+    imported := reset
+    if prev, ok := old.(*MemoryBackend); ok && (prev != next) {
+        prev.mutex.Lock()
+        imported = imported || (prev.imported && (prev.Snapshot == next.Snapshot))
+        prev.mutex.Unlock()
+    }
+    next.mutex.Lock()
+    next.imported = imported
+    next.mutex.Unlock()
+}
+
+// importSnapshot reads the snapshot file, the mutex should be locked.
+func (bk *MemoryBackend) importSnapshot(path string) error {
+    var snapshot memorySnapshot
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    if err := json.Unmarshal(data, &snapshot); err != nil {
+        return fmt.Errorf("incorrect snapshot file %v: %v", path, err)
+    }
+    bk.positions = snapshot.Positions
+    return nil
+}
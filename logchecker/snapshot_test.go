@@ -0,0 +1,124 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Memory storage snapshots testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSnapshotConfig(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Storage: "memory",
+    }
+    for _, snapshot := range []string{"snapshot.json", filepath.Join(buildDir(), "unknown", "snapshot.json")} {
+        cfg.Snapshot = snapshot
+        if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+            t.Errorf("incorrect snapshot is accepted: %v", snapshot)
+        }
+    }
+    cfg.Snapshot = filepath.Join(buildDir(), "snapshot.json")
+    if err := ValidateConfig(cfg, ValidateOptions{}); err != nil {
+        t.Errorf("snapshot is not accepted: %v", err)
+    }
+    cfg.Storage = "sqlite:" + SQLiteMemory
+    if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+        t.Error("snapshot is accepted with sqlite storage")
+    }
+}
+
+func TestSnapshot(t *testing.T) {
+    var group sync.WaitGroup
+    snapshot := filepath.Join(buildDir(), "test_snapshot.json")
+    defer os.Remove(snapshot)
+    filename := filepath.Join(buildDir(), "test_snapshot.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+
+    bk := &MemoryBackend{Name: "Memory", Active: true}
+    st := FileState{Pos: 3, Offset: 30, Found: 2, Counter: 1, Totals: FileTotals{Lines: 3, Matches: 2, Sent: 1}}
+    if err := bk.SaveState(filename, st); err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.ExportSnapshot(snapshot); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(snapshot + ".tmp"); !os.IsNotExist(err) {
+        t.Errorf("temporary snapshot file is kept: %v", err)
+    }
+    imported := &MemoryBackend{Name: "Memory", Active: true}
+    if err := imported.ImportSnapshot(snapshot); err != nil {
+        t.Fatal(err)
+    }
+    if saved, err := imported.LoadState(filename); (err != nil) || (saved.Pos != st.Pos) || (saved.Totals != st.Totals) {
+        t.Errorf("incorrect imported state: %+v, %v", saved, err)
+    }
+
+    // the stop exports positions, the next start imports them
+    start := func() (*LogChecker, error) {
+        logger := New()
+        logger.Backend = &MemoryBackend{Name: "Memory", Active: true, Snapshot: snapshot}
+        logger.notifier = newRecordNotifier()
+        logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+            {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+        }}}
+        return logger, logger.Start(context.Background(), &group)
+    }
+    os.Remove(snapshot)
+    logger, err := start()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(filename, "ERROR 1", "OK 2"); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(300 * time.Millisecond)
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    // the storage opening by the configuration loading doesn't import it
+    opened := &MemoryBackend{Name: "Memory", Active: true, Snapshot: snapshot}
+    if err := opened.Open(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := opened.LoadState(filename); err != ErrNoState {
+        t.Errorf("snapshot is imported before the start: %v", err)
+    }
+    logger, err = start()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if f := logger.Cfg.Observed[0].Files[0]; (f.Pos != 2) || (f.Found != 1) {
+        t.Errorf("position is not imported: pos=%v, found=%v", f.Pos, f.Found)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+
+    // a corrupt snapshot is rejected
+    if err := ioutil.WriteFile(snapshot, []byte("{\"positions\": "), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err := imported.ImportSnapshot(snapshot); (err == nil) || !strings.Contains(err.Error(), snapshot) {
+        t.Errorf("need corrupt snapshot error: %v", err)
+    }
+    if _, err := imported.LoadState(filename); err != nil {
+        t.Errorf("positions are changed by corrupt snapshot: %v", err)
+    }
+    if _, err := start(); (err == nil) || !strings.Contains(err.Error(), snapshot) {
+        t.Errorf("process is started with corrupt snapshot: %v", err)
+    }
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Persistent queue of failed emails
+//
+package logchecker
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+const (
+    // SpoolFileName is a name of the queue file in the spool directory.
+    SpoolFileName string = "logchecker.spool"
+    // DefaultSpoolMaxSize is a default maximum number of queued emails.
+    DefaultSpoolMaxSize int = 1000
+    // DefaultSpoolInterval is a default interval of the queue sending.
+    DefaultSpoolInterval = time.Minute
+)
+
+// spoolLimits returns an interval of the queue sending and its maximum size.
+func (cfg *Config) spoolLimits() (time.Duration, int) {
+    interval, size := DefaultSpoolInterval, DefaultSpoolMaxSize
+    if cfg.SpoolInterval > 0 {
+        interval = time.Duration(cfg.SpoolInterval) * time.Second
+    }
+    if cfg.SpoolMaxSize > 0 {
+        size = cfg.SpoolMaxSize
+    }
+    return interval, size
+}
+
+// validateSpool checks that the spool path is an absolute path of a directory.
+func validateSpool(dir string) error {
+    if !filepath.IsAbs(dir) {
+        return fmt.Errorf("spool path should be absolute")
+    }
+    info, err := os.Stat(dir)
+    if err != nil {
+        return fmt.Errorf("spool error: %v", err)
+    }
+    if !info.IsDir() {
+        return fmt.Errorf("spool path is not a directory")
+    }
+    return nil
+}
+
+// spoolPath returns a path of the queue file.
+func (logger *LogChecker) spoolPath() string {
+    return filepath.Join(logger.Cfg.Spool, SpoolFileName)
+}
+
+// park saves a failed email to the queue if the spool is configured,
+// otherwise it becomes a dead letter. It returns true if the email is
+// queued for a next delivery.
+func (logger *LogChecker) park(subject, msg string, to []string, delivery string, err error) bool {
+    if len(logger.Cfg.Spool) == 0 {
+        logger.addDeadLetter(subject, msg, to, delivery, err)
+        return false
+    }
+    logger.spoolMutex.Lock()
+    defer logger.spoolMutex.Unlock()
+    logger.spoolQueue = append(logger.spoolQueue, DeadLetter{time.Now(), subject, msg, to, delivery, err.Error()})
+    logger.trimSpool()
+    if err := logger.saveSpool(); err != nil {
+        LoggerError.Printf("spool save error: %v", err)
+    }
+    return true
+}
+
+// Spooled returns a copy of queued emails.
+func (logger *LogChecker) Spooled() []DeadLetter {
+    logger.spoolMutex.Lock()
+    defer logger.spoolMutex.Unlock()
+    return append([]DeadLetter{}, logger.spoolQueue...)
+}
+
+// trimSpool drops the oldest emails over the maximum size of the queue,
+// spoolMutex should be locked.
+func (logger *LogChecker) trimSpool() {
+    _, maxSize := logger.Cfg.spoolLimits()
+    if n := len(logger.spoolQueue) - maxSize; n > 0 {
+        logger.spoolQueue = append([]DeadLetter{}, logger.spoolQueue[n:]...)
+        LoggerError.Printf("spool is full, the oldest emails are dropped: %v", n)
+    }
+}
+
+// saveSpool writes the queue to the file as JSON lines, the file is
+// replaced atomically and removed if the queue is empty.
+// spoolMutex should be locked.
+func (logger *LogChecker) saveSpool() error {
+    path := logger.spoolPath()
+    if len(logger.spoolQueue) == 0 {
+        if err := os.Remove(path); (err != nil) && !os.IsNotExist(err) {
+            return err
+        }
+        return nil
+    }
+    var buf bytes.Buffer
+    encoder := json.NewEncoder(&buf)
+    for _, dl := range logger.spoolQueue {
+        if err := encoder.Encode(dl); err != nil {
+            return err
+        }
+    }
+    tmp := path + ".tmp"
+    if err := ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
+
+// loadSpool reads queued emails from the file, incorrect lines are skipped.
+// The current queue is kept and saved if the file doesn't exist.
+// spoolMutex should be locked.
+func (logger *LogChecker) loadSpool() error {
+    file, err := os.Open(logger.spoolPath())
+    if err != nil {
+        if os.IsNotExist(err) {
+            return logger.saveSpool()
+        }
+        return err
+    }
+    defer file.Close()
+    var queue []DeadLetter
+    reader := bufio.NewReader(file)
+    for {
+        line, err := reader.ReadBytes('\n')
+        if len(bytes.TrimSpace(line)) > 0 {
+            var dl DeadLetter
+            if e := json.Unmarshal(line, &dl); e != nil {
+                LoggerError.Printf("incorrect spool line is skipped: %v", e)
+            } else {
+                queue = append(queue, dl)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+    }
+    logger.spoolQueue = queue
+    logger.trimSpool()
+    return nil
+}
+
+// DrainSpool sends queued emails in order until the first failure,
+// sent emails are removed from the queue. It returns a number of sent emails.
+func (logger *LogChecker) DrainSpool() (int, error) {
+    logger.spoolMutex.Lock()
+    defer logger.spoolMutex.Unlock()
+    var (
+        sent int
+        err error
+    )
+    for _, dl := range logger.spoolQueue {
+        if err = logger.sendEmail(dl.Subject, dl.Msg, dl.To, dl.Delivery); err != nil {
+            break
+        }
+        sent++
+    }
+    if sent == 0 {
+        return 0, err
+    }
+    logger.spoolQueue = append([]DeadLetter{}, logger.spoolQueue[sent:]...)
+    LoggerInfo.Printf("spooled emails are sent: %v, %v are queued", sent, len(logger.spoolQueue))
+    if saveErr := logger.saveSpool(); saveErr != nil {
+        LoggerError.Printf("spool save error: %v", saveErr)
+    }
+    return sent, err
+}
+
+// startSpool loads queued emails and runs their sending in background
+// right now and then every spool interval until ctx is done.
+func (logger *LogChecker) startSpool(ctx context.Context) {
+    if len(logger.Cfg.Spool) == 0 {
+        return
+    }
+    logger.spoolMutex.Lock()
+    if err := logger.loadSpool(); err != nil {
+        LoggerError.Printf("spool load error: %v", err)
+    }
+    logger.spoolMutex.Unlock()
+    interval, _ := logger.Cfg.spoolLimits()
+    logger.spoolDone = make(chan bool)
+    go func(done chan bool) {
+        defer close(done)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            if len(logger.Spooled()) > 0 {
+                if _, err := logger.DrainSpool(); err != nil {
+                    LoggerError.Printf("spooled email is not sent: %v", err)
+                }
+            }
+            select {
+                case <-ctx.Done():
+                    return
+                case <-ticker.C:
+            }
+        }
+    }(logger.spoolDone)
+}
+
+// stopSpool waits for the queue sending and saves queued emails.
+func (logger *LogChecker) stopSpool() {
+    if logger.spoolDone == nil {
+        return
+    }
+    <-logger.spoolDone
+    logger.spoolDone = nil
+    logger.spoolMutex.Lock()
+    defer logger.spoolMutex.Unlock()
+    if err := logger.saveSpool(); err != nil {
+        LoggerError.Printf("spool save error: %v", err)
+    }
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Spool testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "net/smtp"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSpool(t *testing.T) {
+    var (
+        mutex sync.Mutex
+        sent []string
+    )
+    fail := true
+    defer func(f func(context.Context, string, smtp.Auth, string, []string, []byte) error) {
+        sendMail = f
+    }(sendMail)
+    sendMail = func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+        mutex.Lock()
+        defer mutex.Unlock()
+        if fail {
+            return fmt.Errorf("connection refused")
+        }
+        sent = append(sent, string(msg))
+        return nil
+    }
+    dir := filepath.Join(buildDir(), "test_spool")
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    if err := validateSpool("spool"); err == nil {
+        t.Error("relative spool path is accepted")
+    }
+    if err := validateSpool(dir); err != nil {
+        t.Errorf("spool validation error: %v", err)
+    }
+    cfg := Config{Sender: map[string]string{"user": "user@host.com", "host": "smtp.host.com"}, Spool: dir, SpoolMaxSize: 2}
+
+    logger := New()
+    logger.Cfg = cfg
+    for i := 0; i < 3; i++ {
+        if err := logger.Notify(fmt.Sprintf("msg %v", i), []string{"to@host.com"}); err != nil {
+            t.Errorf("[%v] spooled email is failed: %v", i, err)
+        }
+    }
+    if n := len(logger.DeadLetters()); n != 0 {
+        t.Errorf("failed emails are not spooled: %v", n)
+    }
+    queue := logger.Spooled()
+    if (len(queue) != 2) || (queue[0].Msg != "msg 1") {
+        t.Fatalf("the oldest email is not dropped: %v", queue)
+    }
+    if _, err := os.Stat(filepath.Join(dir, SpoolFileName)); err != nil {
+        t.Fatalf("spool is not saved: %v", err)
+    }
+    if n, err := logger.DrainSpool(); (n != 0) || (err == nil) {
+        t.Errorf("spooled emails are sent: %v, %v", n, err)
+    }
+
+    // a new process replays the queue on start
+    restarted := New()
+    restarted.Cfg = cfg
+    ctx, cancel := context.WithCancel(context.Background())
+    mutex.Lock()
+    fail = false
+    mutex.Unlock()
+    restarted.startSpool(ctx)
+    cancel()
+    restarted.stopSpool()
+    if n := len(restarted.Spooled()); n != 0 {
+        t.Errorf("spooled emails are not sent: %v", n)
+    }
+    if len(sent) != 2 {
+        t.Fatalf("incorrect number of sent emails: %v", len(sent))
+    }
+    if _, err := os.Stat(filepath.Join(dir, SpoolFileName)); !os.IsNotExist(err) {
+        t.Errorf("empty spool is not removed: %v", err)
+    }
+}
+
+func TestSpoolLimits(t *testing.T) {
+    cfg := Config{}
+    if interval, size := cfg.spoolLimits(); (interval != DefaultSpoolInterval) || (size != DefaultSpoolMaxSize) {
+        t.Errorf("incorrect default spool limits: %v, %v", interval, size)
+    }
+    cfg.SpoolInterval, cfg.SpoolMaxSize = 5, 10
+    if interval, size := cfg.spoolLimits(); (interval != 5 * time.Second) || (size != 10) {
+        t.Errorf("incorrect spool limits: %v, %v", interval, size)
+    }
+}
@@ -0,0 +1,397 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite
+// +build sqlite
+
+// SQLite storage back-end, the driver requires cgo
+//
+package logchecker
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+
+    _ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteMigrations are schema versions of the SQLite back-end,
+// a database is migrated to the last one by the first request.
+// Its version is kept by "user_version" pragma.
+var sqliteMigrations = [][]string{
+    // 1: positions and notifications
+    {`CREATE TABLE IF NOT EXISTS positions (
+        file TEXT PRIMARY KEY,
+        pos INTEGER NOT NULL,
+        offset INTEGER NOT NULL,
+        size INTEGER NOT NULL,
+        log_start TIMESTAMP NOT NULL,
+        granularity INTEGER NOT NULL,
+        found INTEGER NOT NULL,
+        counter INTEGER NOT NULL,
+        inode INTEGER NOT NULL,
+        fingerprints TEXT NOT NULL
+    )`,
+    `CREATE TABLE IF NOT EXISTS notifications (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        service TEXT NOT NULL,
+        file TEXT NOT NULL,
+        count INTEGER NOT NULL,
+        sent_at TIMESTAMP NOT NULL,
+        recipients TEXT NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS notifications_service ON notifications (service, id)`},
+    // 2: check runs
+    {`CREATE TABLE IF NOT EXISTS checks (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        service TEXT NOT NULL,
+        file TEXT NOT NULL,
+        found INTEGER NOT NULL,
+        total INTEGER NOT NULL,
+        checked_at TIMESTAMP NOT NULL
+    )`,
+    `CREATE INDEX IF NOT EXISTS checks_file ON checks (service, file, checked_at)`},
+    // 3: file totals
+    {`ALTER TABLE positions ADD COLUMN totals TEXT NOT NULL DEFAULT '{}'`},
+}
+
+// SQLiteBackend is a back-end that saves file positions and
+// the history of sent notifications to a SQLite database.
+type SQLiteBackend struct {
+    Name string
+    Path string
+    db *sql.DB
+    mutex sync.Mutex
+    prepared bool
+}
+
+// NewSQLiteBackend creates SQLiteBackend from a storage "sqlite:/path/to.db",
+// the path should be absolute or ":memory:". The directory of a database
+// is checked if stat is true, tables are created by the first request.
+func NewSQLiteBackend(storage string, stat bool) (*SQLiteBackend, error) {
+    path := strings.TrimPrefix(storage, SQLiteScheme)
+    if path != SQLiteMemory {
+        if !filepath.IsAbs(path) {
+            return nil, fmt.Errorf("sqlite database path should be absolute")
+        }
+        if stat {
+            info, err := os.Stat(filepath.Dir(path))
+            if err != nil {
+                return nil, err
+            }
+            if !info.IsDir() {
+                return nil, fmt.Errorf("sqlite database directory is not a directory")
+            }
+        }
+    }
+    db, err := sql.Open("sqlite3", path)
+    if err != nil {
+        return nil, fmt.Errorf("sqlite error: %v", err)
+    }
+    // every connection of in-memory database is a new database
+    db.SetMaxOpenConns(1)
+    return &SQLiteBackend{Name: "SQLite", Path: path, db: db}, nil
+}
+
+// Open opens a closed database again and migrates its schema.
+func (bk *SQLiteBackend) Open() error {
+    bk.mutex.Lock()
+    if bk.db == nil {
+        db, err := sql.Open("sqlite3", bk.Path)
+        if err != nil {
+            bk.mutex.Unlock()
+            return fmt.Errorf("sqlite error: %v", err)
+        }
+        db.SetMaxOpenConns(1)
+        bk.db, bk.prepared = db, false
+    }
+    bk.mutex.Unlock()
+    return bk.prepare()
+}
+
+// String returns a name of the logger back-end.
+func (bk *SQLiteBackend) String() string {
+    return fmt.Sprintf("Backend: %v", bk.Name)
+}
+
+// prepare migrates the database schema once.
+func (bk *SQLiteBackend) prepare() error {
+    var version int
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if bk.db == nil {
+        return fmt.Errorf("sqlite database is closed")
+    }
+    if bk.prepared {
+        return nil
+    }
+    if err := bk.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+        return fmt.Errorf("sqlite schema version error: %v", err)
+    }
+    for v := version; v < len(sqliteMigrations); v++ {
+        if err := bk.migrate(v + 1); err != nil {
+            return fmt.Errorf("sqlite schema error [version %v]: %v", v + 1, err)
+        }
+        LoggerDebug.Printf("sqlite schema is migrated to version %v", v + 1)
+    }
+    bk.prepared = true
+    return nil
+}
+
+// migrate applies the schema version in a transaction.
+func (bk *SQLiteBackend) migrate(version int) error {
+    tx, err := bk.db.Begin()
+    if err != nil {
+        return err
+    }
+    for _, query := range sqliteMigrations[version - 1] {
+        if _, err := tx.Exec(query); err != nil {
+            tx.Rollback()
+            return err
+        }
+    }
+    // pragma doesn't support parameters
+    if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// LoadState returns a saved state of the log file.
+func (bk *SQLiteBackend) LoadState(key string) (FileState, error) {
+    var (
+        st FileState
+        fingerprints, totals string
+    )
+    if err := bk.prepare(); err != nil {
+        return st, err
+    }
+    row := bk.db.QueryRow(
+        "SELECT pos, offset, size, log_start, granularity, found, counter, inode, fingerprints, totals FROM positions WHERE file = ?", key,
+    )
+    err := row.Scan(&st.Pos, &st.Offset, &st.Size, &st.LogStart, &st.Granularity, &st.Found, &st.Counter, &st.Inode, &fingerprints, &totals)
+    if err == sql.ErrNoRows {
+        return st, ErrNoState
+    }
+    if err != nil {
+        return st, err
+    }
+    if err := json.Unmarshal([]byte(fingerprints), &st.Fingerprints); err != nil {
+        return st, fmt.Errorf("incorrect sqlite state: %v", err)
+    }
+    if err := json.Unmarshal([]byte(totals), &st.Totals); err != nil {
+        return st, fmt.Errorf("incorrect sqlite totals: %v", err)
+    }
+    return st, nil
+}
+
+// SaveState saves a state of the log file.
+func (bk *SQLiteBackend) SaveState(key string, st FileState) error {
+    if err := bk.prepare(); err != nil {
+        return err
+    }
+    fingerprints, err := json.Marshal(st.Fingerprints)
+    if err != nil {
+        return err
+    }
+    totals, err := json.Marshal(st.Totals)
+    if err != nil {
+        return err
+    }
+    _, err = bk.db.Exec(
+        "INSERT OR REPLACE INTO positions (file, pos, offset, size, log_start, granularity, found, counter, inode, fingerprints, totals) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+        key, st.Pos, st.Offset, st.Size, st.LogStart, st.Granularity, st.Found, st.Counter, st.Inode, string(fingerprints), string(totals),
+    )
+    return err
+}
+
+// LoadPosition returns a saved position of the log file.
+func (bk *SQLiteBackend) LoadPosition(file string) (uint64, bool, error) {
+    var pos uint64
+    if err := bk.prepare(); err != nil {
+        return 0, false, err
+    }
+    err := bk.db.QueryRow("SELECT pos FROM positions WHERE file = ?", file).Scan(&pos)
+    switch {
+        case err == sql.ErrNoRows:
+            return 0, false, nil
+        case err != nil:
+            return 0, false, err
+    }
+    return pos, true, nil
+}
+
+// SavePosition saves a position of the log file, other values are kept.
+func (bk *SQLiteBackend) SavePosition(file string, pos uint64) error {
+    return bk.update(file, "UPDATE positions SET pos = ?, offset = 0 WHERE file = ?", pos, FileState{Pos: pos})
+}
+
+// IncrementCounter adds n to the notifications counter of the log file.
+func (bk *SQLiteBackend) IncrementCounter(file string, n uint64) error {
+    return bk.update(file, "UPDATE positions SET counter = counter + ? WHERE file = ?", n, FileState{Counter: n})
+}
+
+// update changes a saved state of the log file by the query,
+// the initial state is saved if the file is not found.
+func (bk *SQLiteBackend) update(file, query string, value uint64, initial FileState) error {
+    if err := bk.prepare(); err != nil {
+        return err
+    }
+    result, err := bk.db.Exec(query, value, file)
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); (err != nil) || (n > 0) {
+        return err
+    }
+    return bk.SaveState(file, initial)
+}
+
+// ResetPositions removes all saved positions, the history is kept.
+func (bk *SQLiteBackend) ResetPositions() error {
+    if err := bk.prepare(); err != nil {
+        return err
+    }
+    _, err := bk.db.Exec("DELETE FROM positions")
+    return err
+}
+
+// AddNotification saves a sent notification.
+func (bk *SQLiteBackend) AddNotification(n Notification) error {
+    if err := bk.prepare(); err != nil {
+        return err
+    }
+    _, err := bk.db.Exec(
+        "INSERT INTO notifications (service, file, count, sent_at, recipients) VALUES (?, ?, ?, ?, ?)",
+        n.Service, n.File, n.Count, n.SentAt, strings.Join(n.Recipients, ","),
+    )
+    return err
+}
+
+// History returns last notifications of the service, the newest are first.
+// All services are used if the service is empty, non-positive limit
+// returns all records.
+func (bk *SQLiteBackend) History(service string, limit int) ([]Notification, error) {
+    if err := bk.prepare(); err != nil {
+        return nil, err
+    }
+    if limit <= 0 {
+        limit = -1
+    }
+    rows, err := bk.db.Query(
+        "SELECT service, file, count, sent_at, recipients FROM notifications WHERE (? = '') OR (service = ?) ORDER BY id DESC LIMIT ?",
+        service, service, limit,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var result []Notification
+    for rows.Next() {
+        var (
+            n Notification
+            recipients string
+        )
+        if err := rows.Scan(&n.Service, &n.File, &n.Count, &n.SentAt, &recipients); err != nil {
+            return nil, err
+        }
+        if len(recipients) > 0 {
+            n.Recipients = strings.Split(recipients, ",")
+        }
+        result = append(result, n)
+    }
+    return result, rows.Err()
+}
+
+// AddCheck saves a file check.
+func (bk *SQLiteBackend) AddCheck(c CheckRun) error {
+    if err := bk.prepare(); err != nil {
+        return err
+    }
+    _, err := bk.db.Exec(
+        "INSERT INTO checks (service, file, found, total, checked_at) VALUES (?, ?, ?, ?, ?)",
+        c.Service, c.File, c.Found, c.Total, c.CheckedAt.UTC(),
+    )
+    return err
+}
+
+// Checks returns file checks since the time, the oldest are first.
+// Times are saved in UTC to be compared as text.
+// All services or files are used if the service or the file is empty.
+func (bk *SQLiteBackend) Checks(service, file string, since time.Time) ([]CheckRun, error) {
+    if err := bk.prepare(); err != nil {
+        return nil, err
+    }
+    rows, err := bk.db.Query(
+        "SELECT service, file, found, total, checked_at FROM checks WHERE ((? = '') OR (service = ?)) AND ((? = '') OR (file = ?)) AND (checked_at >= ?) ORDER BY id",
+        service, service, file, file, since.UTC(),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    var result []CheckRun
+    for rows.Next() {
+        var c CheckRun
+        if err := rows.Scan(&c.Service, &c.File, &c.Found, &c.Total, &c.CheckedAt); err != nil {
+            return nil, err
+        }
+        result = append(result, c)
+    }
+    return result, rows.Err()
+}
+
+// Close closes the database. An in-memory database is kept open,
+// because it's dropped by the closing, so the next start uses its state.
+func (bk *SQLiteBackend) Close() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if (bk.db == nil) || (bk.Path == SQLiteMemory) {
+        return nil
+    }
+    err := bk.db.Close()
+    bk.db, bk.prepared = nil, false
+    return err
+}
+
+// newSQLiteStorage creates a back-end of SQLite storage for the validation.
+func newSQLiteStorage(storage string, stat bool) (Backender, error) {
+    bk, err := NewSQLiteBackend(storage, stat)
+    if err != nil {
+        return nil, err
+    }
+    return bk, nil
+}
+
+// keepSQLiteMemory passes an in-memory database of the old back-end
+// to the new one during the configuration reload, so its state is not lost.
+func keepSQLiteMemory(old, backend Backender) {
+    prev, ok := old.(*SQLiteBackend)
+    if !ok || (prev.Path != SQLiteMemory) {
+        return
+    }
+    next, ok := backend.(*SQLiteBackend)
+    if !ok || (next.Path != SQLiteMemory) || (next == prev) {
+        return
+    }
+    prev.mutex.Lock()
+    defer prev.mutex.Unlock()
+    next.mutex.Lock()
+    defer next.mutex.Unlock()
+    if prev.db == nil {
+        return
+    }
+    if next.db != nil {
+        next.db.Close()
+    }
+    next.db, next.prepared = prev.db, prev.prepared
+    prev.db, prev.prepared = nil, false
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !sqlite
+// +build !sqlite
+
+// SQLite storage is not built without the tag "sqlite"
+//
+package logchecker
+
+import (
+    "fmt"
+)
+
+// newSQLiteStorage rejects SQLite storage, its driver requires cgo,
+// so it's built only with the tag "sqlite".
+func newSQLiteStorage(storage string, stat bool) (Backender, error) {
+    return nil, fmt.Errorf("sqlite storage is not supported by this build, it requires the tag sqlite")
+}
+
+// keepSQLiteMemory does nothing without SQLite storage.
+func keepSQLiteMemory(old, backend Backender) {
+}
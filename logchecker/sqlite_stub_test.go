@@ -0,0 +1,25 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !sqlite
+// +build !sqlite
+
+// SQLite storage stub testing methods
+//
+package logchecker
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestSQLiteStub(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Storage: "sqlite:" + SQLiteMemory,
+    }
+    if err := ValidateConfig(cfg, ValidateOptions{}); (err == nil) || !strings.Contains(err.Error(), "tag sqlite") {
+        t.Errorf("sqlite storage is accepted without the driver: %v", err)
+    }
+}
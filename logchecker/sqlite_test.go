@@ -0,0 +1,265 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build sqlite
+// +build sqlite
+
+// SQLite storage testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSQLiteBackend(t *testing.T) {
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+    }
+    for _, storage := range []string{"sqlite:", "sqlite:state.db", "sqlite:" + filepath.Join(buildDir(), "unknown", "state.db")} {
+        cfg.Storage = storage
+        if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+            t.Errorf("incorrect storage is accepted: %v", storage)
+        }
+    }
+    cfg.Storage = "sqlite:" + SQLiteMemory
+    if err := ValidateConfig(cfg, ValidateOptions{}); err != nil {
+        t.Errorf("storage is not accepted: %v", err)
+    }
+    cfg.PersistState, cfg.StateFile = true, filepath.Join(buildDir(), "test.state")
+    if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+        t.Error("persist_state is accepted with sqlite storage")
+    }
+
+    bk, err := NewSQLiteBackend("sqlite:" + SQLiteMemory, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    if _, err := bk.LoadState("/var/log/app.log"); err != ErrNoState {
+        t.Errorf("state should not be found: %v", err)
+    }
+    st := FileState{
+        Pos: 10, Offset: 120, Size: 140, LogStart: time.Now().Truncate(time.Second), Granularity: 2,
+        Found: 3, Counter: 1, Inode: 42, Fingerprints: map[string]uint64{"ERROR N": 3},
+        Totals: FileTotals{Lines: 100, Matches: 5, Sent: 2, Suppressed: 1},
+    }
+    for i := 0; i < 2; i++ {
+        if err := bk.SaveState("/var/log/app.log", st); err != nil {
+            t.Fatal(err)
+        }
+        st.Pos++
+    }
+    saved, err := bk.LoadState("/var/log/app.log")
+    if (err != nil) || (saved.Pos != 11) || (saved.Offset != st.Offset) || !saved.LogStart.Equal(st.LogStart) || (saved.Inode != st.Inode) || (saved.Fingerprints["ERROR N"] != 3) || (saved.Totals != st.Totals) {
+        t.Errorf("incorrect state: %+v, %v", saved, err)
+    }
+    if err := bk.ResetPositions(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := bk.LoadState("/var/log/app.log"); err != ErrNoState {
+        t.Errorf("positions are not reset: %v", err)
+    }
+    testBackendPositions(t, bk)
+    // in-memory database is kept by the closing and passed to a new back-end
+    if err := bk.SaveState("/var/log/app.log", st); err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.Open(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := bk.LoadState("/var/log/app.log"); err != nil {
+        t.Errorf("in-memory state is lost after reopen: %v", err)
+    }
+    next, err := NewSQLiteBackend("sqlite:" + SQLiteMemory, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer next.Close()
+    keepSQLiteMemory(bk, next)
+    if _, err := next.LoadState("/var/log/app.log"); err != nil {
+        t.Errorf("in-memory state is not passed to the new back-end: %v", err)
+    }
+}
+
+func TestSQLiteOpenClose(t *testing.T) {
+    var group sync.WaitGroup
+    dir := buildDir()
+    database := filepath.Join(dir, "test_open_close.db")
+    defer os.Remove(database)
+    bk, err := NewSQLiteBackend("sqlite:" + database, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    testBackendReopen(t, bk)
+    // the stop closes the storage, the next start opens it again
+    filename := filepath.Join(dir, "test_open_close.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Backend = bk
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    for i := 0; i < 2; i++ {
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        if err := logger.Stop(&group); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := bk.LoadState(filename); err == nil {
+            t.Error("storage is not closed by the stop")
+        }
+    }
+}
+
+func TestSQLiteHistory(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_sqlite_history.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    if _, err := logger.History("web", 10); err == nil {
+        t.Error("history without sqlite storage")
+    }
+    bk, err := NewSQLiteBackend("sqlite:" + SQLiteMemory, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    logger.Backend = bk
+    logger.Cfg.DuplicateWindow = -1
+    rn := newRecordNotifier()
+    logger.notifier = rn
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10, Emails: []string{"admin@host.com", "dev@host.com"}}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.service = &Service{Name: "web"}
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    start := time.Now()
+    for _, lines := range [][]string{{"ERROR 1"}, {"ERROR 2", "OK", "ERROR 3"}} {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for i := 0; i < 2; i++ {
+        rn.wait(time.Second)
+    }
+    history, err := logger.History("web", 10)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(history) != 2 {
+        t.Fatalf("incorrect number of notifications: %v", len(history))
+    }
+    n := history[0]
+    if (n.Service != "web") || (n.File != filename) || (n.Count != 3) || n.SentAt.Before(start.Truncate(time.Second)) {
+        t.Errorf("incorrect last notification: %+v", n)
+    }
+    if strings.Join(n.Recipients, ",") != "admin@host.com,dev@host.com" {
+        t.Errorf("incorrect recipients: %v", n.Recipients)
+    }
+    if history[1].Count != 1 {
+        t.Errorf("incorrect first notification: %+v", history[1])
+    }
+    if history, err = logger.History("web", 1); (err != nil) || (len(history) != 1) || (history[0].Count != 3) {
+        t.Errorf("incorrect limited history: %v, %v", history, err)
+    }
+    if history, err = logger.History("api", 0); (err != nil) || (len(history) != 0) {
+        t.Errorf("incorrect history of another service: %v, %v", history, err)
+    }
+    if history, err = logger.History("", 0); (err != nil) || (len(history) != 2) {
+        t.Errorf("incorrect history of all services: %v, %v", history, err)
+    }
+}
+
+func TestSQLiteChecks(t *testing.T) {
+    var (
+        group sync.WaitGroup
+        version int
+    )
+    filename := filepath.Join(buildDir(), "test_sqlite_checks.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    storage := filepath.Join(buildDir(), "test_checks.db")
+    defer os.Remove(storage)
+    bk, err := NewSQLiteBackend("sqlite:" + storage, true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer bk.Close()
+    // a database of the first schema version is migrated
+    if err := bk.migrate(1); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := bk.LoadState(filename); err != ErrNoState {
+        t.Errorf("state should not be found: %v", err)
+    }
+    if err := bk.db.QueryRow("PRAGMA user_version").Scan(&version); (err != nil) || (version != len(sqliteMigrations)) {
+        t.Errorf("incorrect schema version: %v, %v", version, err)
+    }
+    logger := New()
+    if _, err := logger.Checks("web", "", time.Time{}); err == nil {
+        t.Error("checks without sqlite storage")
+    }
+    logger.Backend = bk
+    logger.notifier = newRecordNotifier()
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 10, Period: 3600, Limit: 10}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.service = &Service{Name: "web"}
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    start := time.Now()
+    for _, lines := range [][]string{{"ERROR 1", "OK"}, {"OK"}, {"ERROR 2", "ERROR 3"}} {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+    }
+    checks, err := logger.Checks("web", filename, start.Add(-time.Second))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(checks) != 3 {
+        t.Fatalf("incorrect number of checks: %v", len(checks))
+    }
+    for i, expected := range []uint64{1, 0, 2} {
+        if c := checks[i]; (c.Service != "web") || (c.File != filename) || (c.Found != expected) || c.CheckedAt.IsZero() {
+            t.Errorf("incorrect check %v: %+v", i, c)
+        }
+    }
+    if checks[2].Total != 3 {
+        t.Errorf("incorrect total: %v", checks[2].Total)
+    }
+    if checks, err = logger.Checks("", "", time.Now().Add(time.Hour)); (err != nil) || (len(checks) != 0) {
+        t.Errorf("incorrect checks in the future: %v, %v", checks, err)
+    }
+    if checks, err = logger.Checks("api", "", time.Time{}); (err != nil) || (len(checks) != 0) {
+        t.Errorf("incorrect checks of another service: %v, %v", checks, err)
+    }
+}
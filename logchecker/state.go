@@ -0,0 +1,528 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Persistent state of watched files
+//
+package logchecker
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// StateFileName is a name of the state file in the storage directory.
+const StateFileName string = "logchecker.state"
+
+// ErrNoState is an error of LoadState if a state of the key is not saved.
+var ErrNoState = errors.New("state is not found")
+
+// StateFlushInterval is a period of the state file writing by a running process,
+// changes of FileBackend are kept in memory between flushes.
+var StateFlushInterval = time.Second
+
+// PositionStorage is a back-end that can remove all saved states,
+// e.g. for a fresh start after the configuration reload.
+type PositionStorage interface {
+    Backender
+    ResetPositions() error
+}
+
+// FileState is a saved read state of a watched file.
+type FileState struct {
+    Pos uint64            `json:"pos"`
+    Offset int64          `json:"offset"`
+    Size int64            `json:"size"`
+    LogStart time.Time    `json:"log_start"`
+    Granularity uint64    `json:"granularity"`
+    Found uint64          `json:"found"`
+    Counter uint64        `json:"counter"`
+    Inode uint64          `json:"inode,omitempty"`
+    Totals FileTotals     `json:"totals"`
+    Fingerprints map[string]uint64  `json:"fingerprints,omitempty"`
+}
+
+// FileBackend is a back-end that saves file positions to the state file,
+// it's StateFileName in Dir if File is empty.
+type FileBackend struct {
+    Name string
+    Dir string
+    File string
+    positions map[string]FileState
+    dirty bool
+    mutex sync.Mutex
+}
+
+// NewFileBackend creates a new FileBackend for the storage directory
+// and loads its state file if it exists.
+func NewFileBackend(dir string) (*FileBackend, error) {
+    if !filepath.IsAbs(dir) {
+        return nil, fmt.Errorf("storage path should be absolute")
+    }
+    info, err := os.Stat(dir)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return nil, fmt.Errorf("storage path is not a directory")
+    }
+    bk := &FileBackend{Name: "File", Dir: dir, positions: map[string]FileState{}}
+    if err := bk.load(); err != nil {
+        return nil, err
+    }
+    return bk, nil
+}
+
+// NewStateFileBackend creates a new FileBackend for the state file path
+// and loads it if it exists, its directory should exist.
+func NewStateFileBackend(path string) (*FileBackend, error) {
+    if !filepath.IsAbs(path) {
+        return nil, fmt.Errorf("state file path should be absolute")
+    }
+    bk := &FileBackend{Name: "File", Dir: filepath.Dir(path), File: path, positions: map[string]FileState{}}
+    info, err := os.Stat(bk.Dir)
+    if err != nil {
+        return nil, err
+    }
+    if !info.IsDir() {
+        return nil, fmt.Errorf("state file directory is not a directory")
+    }
+    if err := bk.load(); err != nil {
+        return nil, err
+    }
+    return bk, nil
+}
+
+// load reads saved positions from the state file if it exists.
+func (bk *FileBackend) load() error {
+    data, err := ioutil.ReadFile(bk.Path())
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+    if err := json.Unmarshal(data, &bk.positions); err != nil {
+        return fmt.Errorf("incorrect state file: %v", err)
+    }
+    return nil
+}
+
+// String returns a name of the logger back-end.
+func (bk *FileBackend) String() string {
+    return fmt.Sprintf("Backend: %v", bk.Name)
+}
+
+// Path returns an absolute path of the state file.
+func (bk *FileBackend) Path() string {
+    if len(bk.File) > 0 {
+        return bk.File
+    }
+    return filepath.Join(bk.Dir, StateFileName)
+}
+
+// Open of FileBackend does nothing, the state file is loaded by its constructor.
+func (bk *FileBackend) Open() error {
+    return nil
+}
+
+// Close of FileBackend writes not flushed changes to the state file.
+func (bk *FileBackend) Close() error {
+    return bk.Flush()
+}
+
+// Flush replaces the state file atomically if there are not saved changes.
+func (bk *FileBackend) Flush() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if !bk.dirty {
+        return nil
+    }
+    if err := bk.write(); err != nil {
+        return err
+    }
+    bk.dirty = false
+    return nil
+}
+
+// LoadState returns a saved state of the log file.
+func (bk *FileBackend) LoadState(key string) (FileState, error) {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st, ok := bk.positions[key]
+    if !ok {
+        return st, ErrNoState
+    }
+    return st, nil
+}
+
+// SaveState saves a state of the log file, the state file
+// is replaced by the next flush.
+func (bk *FileBackend) SaveState(key string, st FileState) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    bk.positions[key] = st
+    bk.dirty = true
+    return nil
+}
+
+// LoadPosition returns a saved position of the log file.
+func (bk *FileBackend) LoadPosition(file string) (uint64, bool, error) {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st, ok := bk.positions[file]
+    return st.Pos, ok, nil
+}
+
+// SavePosition saves a position of the log file, other values are kept.
+func (bk *FileBackend) SavePosition(file string, pos uint64) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st := bk.positions[file]
+    st.Pos, st.Offset = pos, 0
+    bk.positions[file] = st
+    bk.dirty = true
+    return nil
+}
+
+// IncrementCounter adds n to the notifications counter of the log file.
+func (bk *FileBackend) IncrementCounter(file string, n uint64) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st := bk.positions[file]
+    st.Counter += n
+    bk.positions[file] = st
+    bk.dirty = true
+    return nil
+}
+
+// write replaces the state file atomically, the mutex should be locked.
+func (bk *FileBackend) write() error {
+    data, err := json.Marshal(bk.positions)
+    if err != nil {
+        return err
+    }
+    tmp := bk.Path() + ".tmp"
+    if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, bk.Path())
+}
+
+// stateBackend returns a back-end of the state file if "persist_state"
+// is set, nil is returned if positions are kept by the storage.
+func (cfg *Config) stateBackend(opts ValidateOptions) (*FileBackend, error) {
+    if !cfg.PersistState {
+        if len(cfg.StateFile) > 0 {
+            return nil, fmt.Errorf("state_file requires persist_state")
+        }
+        return nil, nil
+    }
+    switch {
+        case IsRedisStorage(cfg.Storage) || IsSQLiteStorage(cfg.Storage):
+            return nil, fmt.Errorf("persist_state is not supported by redis and sqlite storages, they keep positions themselves")
+        case len(cfg.StateFile) == 0:
+            if cfg.Storage == "memory" {
+                return nil, fmt.Errorf("persist_state requires state_file or storage directory")
+            }
+            return nil, nil
+        case opts.SkipStat:
+            if !filepath.IsAbs(cfg.StateFile) {
+                return nil, fmt.Errorf("state file path should be absolute")
+            }
+            return &FileBackend{Name: "File", Dir: filepath.Dir(cfg.StateFile), File: cfg.StateFile, positions: map[string]FileState{}}, nil
+    }
+    return NewStateFileBackend(cfg.StateFile)
+}
+
+// persistPositions saves the latest positions of started files,
+// it's called by the stop, when checks are finished.
+// Files of glob paths are saved by their checks.
+func (logger *LogChecker) persistPositions() {
+    if logger.Backend == nil {
+        return
+    }
+    for i := range logger.Cfg.Observed {
+        for j := range logger.Cfg.Observed[i].Files {
+            f := &logger.Cfg.Observed[i].Files[j]
+            // a file with an abandoned check is skipped, the check owns its state
+            if !f.restored || f.IsGlob() || (atomic.LoadInt32(&f.reading) != 0) {
+                continue
+            }
+            info, err := os.Stat(f.Log)
+            if err != nil {
+                continue
+            }
+            logger.savePosition(f, info)
+        }
+    }
+    if bk, ok := logger.Backend.(*FileBackend); ok {
+        if err := bk.Flush(); err != nil {
+            LoggerError.Printf("can't save state file: %v", err)
+        }
+    }
+}
+
+// flushState writes changed positions of FileBackend to the state file
+// every interval until ctx is done.
+func (logger *LogChecker) flushState(ctx context.Context, bk *FileBackend, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                if err := bk.Flush(); err != nil {
+                    LoggerError.Printf("can't save state file: %v", err)
+                }
+        }
+    }
+}
+
+// ResetPositions removes all saved positions and the state file.
+func (bk *FileBackend) ResetPositions() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    bk.positions, bk.dirty = map[string]FileState{}, false
+    if err := os.Remove(bk.Path()); (err != nil) && !os.IsNotExist(err) {
+        return err
+    }
+    return nil
+}
+
+// Open of MemoryBackend does nothing, its snapshot is imported by the start.
+func (bk *MemoryBackend) Open() error {
+    return nil
+}
+
+// Close of MemoryBackend keeps positions, so they are used by the next start,
+// they are exported to the snapshot if it's set.
+func (bk *MemoryBackend) Close() error {
+    if len(bk.Snapshot) == 0 {
+        return nil
+    }
+    return bk.ExportSnapshot(bk.Snapshot)
+}
+
+// LoadState returns a saved state of the log file.
+func (bk *MemoryBackend) LoadState(key string) (FileState, error) {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st, ok := bk.positions[key]
+    if !ok {
+        return st, ErrNoState
+    }
+    return st, nil
+}
+
+// SaveState saves a state of the log file in memory.
+func (bk *MemoryBackend) SaveState(key string, st FileState) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if bk.positions == nil {
+        bk.positions = map[string]FileState{}
+    }
+    bk.positions[key] = st
+    return nil
+}
+
+// LoadPosition returns a saved position of the log file.
+func (bk *MemoryBackend) LoadPosition(file string) (uint64, bool, error) {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    st, ok := bk.positions[file]
+    return st.Pos, ok, nil
+}
+
+// SavePosition saves a position of the log file in memory, other values are kept.
+func (bk *MemoryBackend) SavePosition(file string, pos uint64) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if bk.positions == nil {
+        bk.positions = map[string]FileState{}
+    }
+    st := bk.positions[file]
+    st.Pos, st.Offset = pos, 0
+    bk.positions[file] = st
+    return nil
+}
+
+// IncrementCounter adds n to the notifications counter of the log file.
+func (bk *MemoryBackend) IncrementCounter(file string, n uint64) error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    if bk.positions == nil {
+        bk.positions = map[string]FileState{}
+    }
+    st := bk.positions[file]
+    st.Counter += n
+    bk.positions[file] = st
+    return nil
+}
+
+// ResetPositions removes all saved positions.
+func (bk *MemoryBackend) ResetPositions() error {
+    bk.mutex.Lock()
+    defer bk.mutex.Unlock()
+    bk.positions = nil
+    return nil
+}
+
+// reloadPositions prepares positions of a new back-end during
+// the configuration reload. Saved positions and fingerprints are
+// removed if reset is set, otherwise positions from the memory
+// are kept, so old lines are not reported again. An in-memory SQLite
+// database is used by the new back-end.
+func (logger *LogChecker) reloadPositions(backend Backender, reset bool) {
+    keepSQLiteMemory(logger.Backend, backend)
+    keepSnapshot(logger.Backend, backend, reset)
+    storage, ok := backend.(PositionStorage)
+    if !ok {
+        return
+    }
+    if reset {
+        if err := storage.ResetPositions(); err != nil {
+            LoggerError.Printf("can't reset positions: %v", err)
+        }
+        return
+    }
+    // the state file is loaded before the stop, which flushes latest positions
+    if bk, ok := backend.(*FileBackend); ok {
+        if err := bk.load(); err != nil {
+            LoggerError.Printf("can't load state file: %v", err)
+        }
+    }
+    old, ok := logger.Backend.(*MemoryBackend)
+    if !ok {
+        return
+    }
+    old.mutex.Lock()
+    defer old.mutex.Unlock()
+    for log, pos := range old.positions {
+        if err := backend.SaveState(log, pos); err != nil {
+            LoggerError.Printf("can't keep position [%v]: %v", log, err)
+        }
+    }
+}
+
+// rescanPositions resets read positions of files which patterns
+// are changed by the new configuration, so their old lines are checked
+// again. Other saved values are kept, so the current period and its
+// limit are still used.
+func (logger *LogChecker) rescanPositions(backend Backender, cfg *Config) {
+    expressions := map[string]string{}
+    for _, serv := range logger.Cfg.Observed {
+        for _, f := range serv.Files {
+            expressions[f.Log] = f.patternSet()
+        }
+    }
+    for _, serv := range cfg.Observed {
+        for _, f := range serv.Files {
+            expr, ok := expressions[f.Log]
+            if !ok || (expr == f.patternSet()) {
+                continue
+            }
+            if _, ok, err := backend.LoadPosition(f.Log); (err != nil) || !ok {
+                continue
+            }
+            if err := backend.SavePosition(f.Log, 0); err != nil {
+                LoggerError.Printf("can't reset position [%v]: %v", f.Log, err)
+                continue
+            }
+            LoggerInfo.Printf("pattern is changed, file will be rescanned [%v]\n", f.Base())
+        }
+    }
+}
+
+// restorePosition loads a saved position of the file,
+// it is ignored if the file was truncated or rotated.
+func (logger *LogChecker) restorePosition(f *File) {
+    f.restored = true
+    if logger.Backend == nil {
+        return
+    }
+    pos, err := logger.Backend.LoadState(f.Log)
+    if err != nil {
+        if err != ErrNoState {
+            LoggerError.Printf("can't load position [%v]: %v", f.Base(), err)
+        }
+        return
+    }
+    // totals are kept for a truncated or rotated file
+    f.totals = pos.Totals
+    if f.startSize < pos.Size {
+        LoggerInfo.Printf("file was truncated, saved position is ignored [%v]\n", f.Base())
+        return
+    }
+    if (pos.Inode != 0) && (f.startInode != 0) && (pos.Inode != f.startInode) {
+        LoggerInfo.Printf("file was rotated, saved position is ignored [%v]\n", f.Base())
+        return
+    }
+    f.Pos, f.Offset = pos.Pos, pos.Offset
+    f.LogStart, f.Granularity = pos.LogStart, pos.Granularity
+    f.Found, f.Counter = pos.Found, pos.Counter
+    f.Fingerprints = nil
+    f.addFingerprints(pos.Fingerprints)
+    LoggerDebug.Printf("position is restored [%v]: %v", f.Base(), f.Pos)
+}
+
+// resetPosition reads the file from the beginning by the next check,
+// e.g. after its truncation.
+func (logger *LogChecker) resetPosition(f *File) {
+    f.Pos, f.Offset, f.integrity = 0, 0, nil
+    f.resetSuppression()
+    if logger.Backend == nil {
+        return
+    }
+    if err := logger.Backend.SavePosition(f.Log, 0); err != nil {
+        LoggerError.Printf("can't reset position [%v]: %v", f.Base(), err)
+    }
+}
+
+// incrementCounter counts a sent notification of the file by the back-end,
+// the file keeps its copy to check the limit.
+func (logger *LogChecker) incrementCounter(f *File) {
+    f.Counter++
+    if logger.Backend == nil {
+        return
+    }
+    if err := logger.Backend.IncrementCounter(f.Log, 1); err != nil {
+        LoggerError.Printf("can't increment counter [%v]: %v", f.Base(), err)
+    }
+}
+
+// savePosition saves a current position of the file.
+func (logger *LogChecker) savePosition(f *File, info os.FileInfo) {
+    if logger.Backend == nil {
+        return
+    }
+    pos := FileState{
+        Pos: f.Pos,
+        Offset: f.Offset,
+        Size: info.Size(),
+        LogStart: f.LogStart,
+        Granularity: f.Granularity,
+        Found: f.Found,
+        Counter: f.Counter,
+        Inode: fileInode(info),
+        Totals: f.totals,
+    }
+    if len(f.Fingerprints) > 0 {
+        pos.Fingerprints = make(map[string]uint64, len(f.Fingerprints))
+        for fp, n := range f.Fingerprints {
+            pos.Fingerprints[fp] = n
+        }
+    }
+    if err := logger.Backend.SaveState(f.Log, pos); err != nil {
+        LoggerError.Printf("can't save position [%v]: %v", f.Base(), err)
+    }
+}
@@ -0,0 +1,648 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Persistent state testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestPersistPosition(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.RemoveAll(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    testdir := buildDir()
+    storage := filepath.Join(testdir, "test_state")
+    if err := os.MkdirAll(storage, 0700); err != nil {
+        t.Fatal(err)
+    }
+    defer rm(storage)
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_state_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_state_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_state_syslog"),
+        "\"memory\"": "\"" + storage + "\"",
+    }
+    oldexample := filepath.Join(testdir, "config.example.json")
+    example := filepath.Join(testdir, "config.state.json")
+    if err := prepareConfig(oldexample, example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer rm(example)
+    for k, v := range newvalues {
+        if k == "\"memory\"" {
+            continue
+        }
+        if err := createFile(v, 0666); err != nil {
+            t.Errorf("test file preparation error [%v]: %v", v, err)
+        }
+        defer rm(v)
+    }
+    testFile := newvalues["/var/log/nginx/error.log"]
+    start := func(rn *recordNotifier) *LogChecker {
+        logger := New()
+        if err := InitConfig(logger, example); err != nil {
+            t.Fatal(err)
+        }
+        logger.notifier = rn
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        // wait watchers start
+        time.Sleep(100 * time.Millisecond)
+        return logger
+    }
+
+    rn := newRecordNotifier()
+    logger := start(rn)
+    if _, ok := logger.Backend.(*FileBackend); !ok {
+        t.Fatalf("incorrect backend: %v", logger.Backend)
+    }
+    if err := updateFile(testFile, "ERROR 1", "ERROR 2", "ERROR 3"); err != nil {
+        t.Fatal(err)
+    }
+    if msg := rn.wait(3 * time.Second); !strings.Contains(msg, "3: ERROR 3") {
+        t.Errorf("incorrect message: %v", msg)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    backend, err := NewFileBackend(storage)
+    if err != nil {
+        t.Fatal(err)
+    }
+    saved, err := backend.LoadState(testFile)
+    if (err != nil) || (saved.Pos != 3) || (saved.Found != 3) {
+        t.Errorf("incorrect saved position: %v", saved)
+    }
+
+    // restart, only new lines are matched
+    logger = start(newRecordNotifier())
+    if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 3 {
+        t.Errorf("position is not restored: %v", pos)
+    }
+    if err := updateFile(testFile, "ERROR 4"); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; i < 30; i++ {
+        time.Sleep(100 * time.Millisecond)
+        backend, err = NewFileBackend(storage)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if pos, _ := backend.LoadState(testFile); pos.Pos == 4 {
+            break
+        }
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    if pos, _ := backend.LoadState(testFile); (pos.Pos != 4) || (pos.Found != saved.Found + 1) {
+        t.Errorf("incorrect position after restart: %v", pos)
+    }
+
+    // truncated file is read from the beginning
+    if err := createFile(testFile, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(testFile, "OK"); err != nil {
+        t.Fatal(err)
+    }
+    logger = start(newRecordNotifier())
+    if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 0 {
+        t.Errorf("position of truncated file is restored: %v", pos)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := NewFileBackend("test_state"); err == nil {
+        t.Error("need storage path error")
+    }
+}
+
+func TestMemoryState(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_memory_state.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    backend := &MemoryBackend{Name: "Memory", Active: true}
+    if _, err := backend.LoadState(filename); err != ErrNoState {
+        t.Errorf("state should not be found: %v", err)
+    }
+    logger := New()
+    logger.Backend = backend
+    logger.Cfg.DuplicateWindow = -1
+    rn := newRecordNotifier()
+    logger.notifier = rn
+    check := func(lines ...string) *File {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        // every check uses a new file, so its state is loaded from the back-end
+        f := &File{Log: filename, Pattern: "ERROR", Boundary: 2, Period: 3600, Limit: 10}
+        if err := f.Validate(); err != nil {
+            t.Fatal(err)
+        }
+        f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        return f
+    }
+    if f := check("ERROR 1", "OK"); (f.Pos != 2) || (f.Found != 1) || (f.Counter != 0) {
+        t.Errorf("incorrect state of first check: pos=%v, found=%v, counter=%v", f.Pos, f.Found, f.Counter)
+    }
+    f := check("ERROR 2")
+    if (f.Pos != 3) || (f.Found != 2) || (f.Counter != 1) {
+        t.Errorf("state is not restored: pos=%v, found=%v, counter=%v", f.Pos, f.Found, f.Counter)
+    }
+    if msg := rn.wait(time.Second); !strings.Contains(msg, "3: ERROR 2") || strings.Contains(msg, "ERROR 1") {
+        t.Errorf("incorrect message: %v", msg)
+    }
+    st, err := backend.LoadState(filename)
+    if (err != nil) || (st.Pos != f.Pos) || (st.Found != f.Found) || (st.Counter != f.Counter) {
+        t.Errorf("incorrect saved state: %+v, %v", st, err)
+    }
+    if err := backend.ResetPositions(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := backend.LoadState(filename); err != ErrNoState {
+        t.Errorf("state is not reset: %v", err)
+    }
+}
+
+// testBackendReopen checks that a state is kept by the closing of the back-end.
+func testBackendReopen(t *testing.T, bk Backender) {
+    if err := bk.Open(); err != nil {
+        t.Fatalf("%v: open error: %v", bk, err)
+    }
+    if err := bk.SaveState("/var/log/app.log", FileState{Pos: 7, Offset: 70}); err != nil {
+        t.Fatalf("%v: save error: %v", bk, err)
+    }
+    // repeated close is not an error
+    for i := 0; i < 2; i++ {
+        if err := bk.Close(); err != nil {
+            t.Errorf("%v: close error: %v", bk, err)
+        }
+    }
+    if err := bk.Open(); err != nil {
+        t.Fatalf("%v: repeated open error: %v", bk, err)
+    }
+    if st, err := bk.LoadState("/var/log/app.log"); (err != nil) || (st.Pos != 7) || (st.Offset != 70) {
+        t.Errorf("%v: state is not kept after reopen: %v, %v", bk, st, err)
+    }
+}
+
+func TestBackendOpenClose(t *testing.T) {
+    fileBackend, err := NewFileBackend(buildDir())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(fileBackend.Path())
+    for _, bk := range []Backender{&MemoryBackend{Name: "Memory", Active: true}, fileBackend} {
+        testBackendReopen(t, bk)
+    }
+}
+
+func TestFileBackendFlush(t *testing.T) {
+    const key = "/var/log/flush.log"
+    stateFile := filepath.Join(buildDir(), "test_flush.state")
+    defer os.Remove(stateFile)
+    bk, err := NewStateFileBackend(stateFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    saved := func() FileState {
+        backend, err := NewStateFileBackend(stateFile)
+        if err != nil {
+            t.Fatal(err)
+        }
+        st, _ := backend.LoadState(key)
+        return st
+    }
+    // saves change the state in memory only
+    for i := 1; i <= 100; i++ {
+        if err := bk.SavePosition(key, uint64(i)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := bk.IncrementCounter(key, 1); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+        t.Errorf("state file is written before the flush: %v", err)
+    }
+    if err := bk.Flush(); err != nil {
+        t.Fatal(err)
+    }
+    if st := saved(); (st.Pos != 100) || (st.Counter != 1) {
+        t.Errorf("incorrect flushed state: %+v", st)
+    }
+    // not changed state is not written again
+    if err := os.Remove(stateFile); err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.Flush(); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+        t.Errorf("not changed state is written: %v", err)
+    }
+    if err := bk.SaveState(key, FileState{Pos: 7, Offset: 70}); err != nil {
+        t.Fatal(err)
+    }
+    if err := bk.Close(); err != nil {
+        t.Fatal(err)
+    }
+    if st := saved(); (st.Pos != 7) || (st.Offset != 70) {
+        t.Errorf("state is not written by the close: %+v", st)
+    }
+    // a running process flushes changes periodically
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        New().flushState(ctx, bk, 10 * time.Millisecond)
+    }()
+    if err := bk.SavePosition(key, 9); err != nil {
+        t.Fatal(err)
+    }
+    for i := 0; (i < 100) && (saved().Pos != 9); i++ {
+        time.Sleep(10 * time.Millisecond)
+    }
+    cancel()
+    <-done
+    if st := saved(); st.Pos != 9 {
+        t.Errorf("state is not flushed periodically: %+v", st)
+    }
+}
+
+// testBackendPositions checks positions and counters of the back-end.
+func testBackendPositions(t *testing.T, bk Backender) {
+    const key = "/var/log/positions.log"
+    if _, ok, err := bk.LoadPosition(key); (err != nil) || ok {
+        t.Fatalf("%v: position should not be found: %v", bk, err)
+    }
+    // a missing state is created
+    if err := bk.IncrementCounter(key, 2); err != nil {
+        t.Fatalf("%v: increment error: %v", bk, err)
+    }
+    if err := bk.SaveState(key, FileState{Pos: 5, Offset: 50, Found: 3, Counter: 1}); err != nil {
+        t.Fatalf("%v: save error: %v", bk, err)
+    }
+    if err := bk.SavePosition(key, 7); err != nil {
+        t.Fatalf("%v: save position error: %v", bk, err)
+    }
+    for i := 0; i < 2; i++ {
+        if err := bk.IncrementCounter(key, 2); err != nil {
+            t.Fatalf("%v: increment error: %v", bk, err)
+        }
+    }
+    if pos, ok, err := bk.LoadPosition(key); (err != nil) || !ok || (pos != 7) {
+        t.Errorf("%v: incorrect position: %v, %v, %v", bk, pos, ok, err)
+    }
+    // other values are kept, the offset is unknown for a saved position
+    st, err := bk.LoadState(key)
+    if (err != nil) || (st.Pos != 7) || (st.Offset != 0) || (st.Found != 3) || (st.Counter != 5) {
+        t.Errorf("%v: incorrect state: %+v, %v", bk, st, err)
+    }
+}
+
+func TestBackendPositions(t *testing.T) {
+    var group sync.WaitGroup
+    dir := buildDir()
+    fileBackend, err := NewFileBackend(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(fileBackend.Path())
+    for _, bk := range []Backender{&MemoryBackend{Name: "Memory", Active: true}, fileBackend} {
+        testBackendPositions(t, bk)
+    }
+    // lines before a saved position are skipped, sent notifications are counted by the back-end
+    filename := filepath.Join(dir, "test_positions.log")
+    if err := ioutil.WriteFile(filename, []byte("ERROR 1\nERROR 2\nERROR 3\n"), 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    backend := &MemoryBackend{Name: "Memory", Active: true}
+    if err := backend.SavePosition(filename, 2); err != nil {
+        t.Fatal(err)
+    }
+    logger := New()
+    logger.Backend = backend
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    f := &logger.Cfg.Observed[0].Files[0]
+    if err := f.Check(&group, logger); err != nil {
+        t.Fatal(err)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    st, err := backend.LoadState(filename)
+    if (err != nil) || (st.Pos != 3) || (st.Found != 1) || (st.Counter != 1) {
+        t.Errorf("incorrect state: %+v, %v", st, err)
+    }
+}
+
+func TestPersistStateFile(t *testing.T) {
+    var group sync.WaitGroup
+    testdir := buildDir()
+    stateFile := filepath.Join(testdir, "test_persist.state")
+    defer os.Remove(stateFile)
+    cfg := Config{
+        Sender: map[string]string{"user": "user@host.com", "password": "password", "host": "smtp.host.com", "addr": "smtp.host.com"},
+        Storage: "memory",
+    }
+    invalid := []struct {
+        persist bool
+        storage string
+        file string
+    }{
+        {true, "memory", ""},
+        {false, "memory", stateFile},
+        {true, "memory", "test_persist.state"},
+        {true, "memory", filepath.Join(testdir, "unknown", "test_persist.state")},
+        {true, "redis://127.0.0.1", stateFile},
+    }
+    for _, c := range invalid {
+        cfg.PersistState, cfg.Storage, cfg.StateFile = c.persist, c.storage, c.file
+        if err := ValidateConfig(cfg, ValidateOptions{}); err == nil {
+            t.Errorf("incorrect state settings are accepted: %+v", c)
+        }
+    }
+    cfg.PersistState, cfg.Storage, cfg.StateFile = true, "memory", stateFile
+    if err := ValidateConfig(cfg, ValidateOptions{}); err != nil {
+        t.Errorf("state settings are not accepted: %v", err)
+    }
+
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_persist_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_persist_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_persist_syslog"),
+        "\"memory\"": fmt.Sprintf("\"memory\", \"persist_state\": true, \"state_file\": \"%v\"", stateFile),
+    }
+    example := filepath.Join(testdir, "config.persist.json")
+    if err := prepareConfig(filepath.Join(testdir, "config.example.json"), example, newvalues); err != nil {
+        t.Fatalf("can't prepare test config file [%v]", err)
+    }
+    defer os.Remove(example)
+    for k, v := range newvalues {
+        if k == "\"memory\"" {
+            continue
+        }
+        if err := createFile(v, 0666); err != nil {
+            t.Errorf("test file preparation error [%v]: %v", v, err)
+        }
+        defer os.Remove(v)
+    }
+    testFile := newvalues["/var/log/nginx/error.log"]
+    start := func() *LogChecker {
+        logger := New()
+        if err := InitConfig(logger, example); err != nil {
+            t.Fatal(err)
+        }
+        logger.notifier = newRecordNotifier()
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        return logger
+    }
+    load := func() FileState {
+        backend, err := NewStateFileBackend(stateFile)
+        if err != nil {
+            t.Fatal(err)
+        }
+        st, err := backend.LoadState(testFile)
+        if err != nil {
+            t.Fatalf("state is not saved: %v", err)
+        }
+        return st
+    }
+
+    logger := start()
+    if bk, ok := logger.Backend.(*FileBackend); !ok || (bk.Path() != stateFile) {
+        t.Fatalf("incorrect backend: %v", logger.Backend)
+    }
+    if err := updateFile(testFile, "ERROR 1", "ERROR 2", "ERROR 3"); err != nil {
+        t.Fatal(err)
+    }
+    time.Sleep(300 * time.Millisecond)
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    info, err := os.Stat(testFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if st := load(); (st.Pos != 3) || (st.Inode != fileInode(info)) {
+        t.Errorf("incorrect saved state: %+v", st)
+    }
+    // restart, the position is restored
+    logger = start()
+    if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 3 {
+        t.Errorf("position is not restored: %v", pos)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    if fileInode(info) == 0 {
+        t.Skip("inodes are not supported")
+    }
+    // the file is rotated, a new one is not smaller
+    if err := os.Rename(testFile, testFile + ".1"); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(testFile + ".1")
+    if err := createFile(testFile, 0666); err != nil {
+        t.Fatal(err)
+    }
+    if err := updateFile(testFile, "OK 1", "OK 2", "OK 3", "OK 4"); err != nil {
+        t.Fatal(err)
+    }
+    logger = start()
+    if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 0 {
+        t.Errorf("position of rotated file is restored: %v", pos)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+    if st := load(); (st.Pos != 0) || (st.Inode == fileInode(info)) {
+        t.Errorf("state is not saved by stop: %+v", st)
+    }
+}
+
+func TestReloadResetDedup(t *testing.T) {
+    var group sync.WaitGroup
+    rm := func(name string) {
+        if err := os.Remove(name); err != nil {
+            t.Errorf("can't remove file [%v]: %v", name, err)
+        }
+    }
+    testdir := buildDir()
+    for _, reset := range []bool{false, true} {
+        newvalues := map[string]string{
+            "/var/log/nginx/error.log": filepath.Join(testdir, "test_dedup_error.log"),
+            "/var/log/nginx/access.log": filepath.Join(testdir, "test_dedup_access.log"),
+            "/var/log/syslog": filepath.Join(testdir, "test_dedup_syslog"),
+            "\"memory\"": fmt.Sprintf("\"memory\", \"reload_reset_dedup\": %v", reset),
+            "\"limit\": 1": "\"limit\": 10",
+        }
+        oldexample := filepath.Join(testdir, "config.example.json")
+        example := filepath.Join(testdir, "config.dedup.json")
+        if err := prepareConfig(oldexample, example, newvalues); err != nil {
+            t.Fatalf("can't prepare test config file [%v]", err)
+        }
+        for _, v := range newvalues {
+            if !filepath.IsAbs(v) {
+                continue
+            }
+            if err := createFile(v, 0666); err != nil {
+                t.Errorf("test file preparation error [%v]: %v", v, err)
+            }
+        }
+        testFile := newvalues["/var/log/nginx/error.log"]
+        rn := newRecordNotifier()
+        logger := New()
+        if err := InitConfig(logger, example); err != nil {
+            t.Fatal(err)
+        }
+        logger.notifier = rn
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        time.Sleep(100 * time.Millisecond)
+        if err := updateFile(testFile, "ERROR 1", "ERROR 2"); err != nil {
+            t.Fatal(err)
+        }
+        if msg := rn.wait(3 * time.Second); !strings.Contains(msg, "1: ERROR 1") {
+            t.Errorf("incorrect message: %v", msg)
+        }
+        if err := logger.Reload(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        time.Sleep(100 * time.Millisecond)
+        // drop repeated notifications before the reload
+        for len(rn.messages) > 0 {
+            rn.wait(0)
+        }
+        if err := updateFile(testFile, "ERROR 3"); err != nil {
+            t.Fatal(err)
+        }
+        msg := rn.wait(time.Second)
+        if !strings.Contains(msg, "3: ERROR 3") {
+            t.Errorf("new line is not reported [reset=%v]: %v", reset, msg)
+        }
+        if paged := strings.Contains(msg, "1: ERROR 1"); paged != reset {
+            t.Errorf("incorrect re-paging [reset=%v]: %v", reset, msg)
+        }
+        if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 3 {
+            t.Errorf("incorrect position [reset=%v]: %v", reset, pos)
+        }
+        if err := logger.Stop(&group); err != nil {
+            t.Fatal(err)
+        }
+        for _, v := range newvalues {
+            if filepath.IsAbs(v) {
+                rm(v)
+            }
+        }
+        rm(example)
+    }
+}
+
+func TestRescanOnPatternChange(t *testing.T) {
+    var group sync.WaitGroup
+    testdir := buildDir()
+    oldexample := filepath.Join(testdir, "config.example.json")
+    example := filepath.Join(testdir, "config.rescan.json")
+    testFile := filepath.Join(testdir, "test_rescan_error.log")
+    defer os.Remove(example)
+    for _, rescan := range []bool{false, true} {
+        newvalues := map[string]string{
+            "/var/log/nginx/error.log": testFile,
+            "/var/log/nginx/access.log": filepath.Join(testdir, "test_rescan_access.log"),
+            "/var/log/syslog": filepath.Join(testdir, "test_rescan_syslog"),
+            "\"memory\"": fmt.Sprintf("\"memory\", \"rescan_on_pattern_change\": %v", rescan),
+            "\"limit\": 1": "\"limit\": 10",
+        }
+        if err := prepareConfig(oldexample, example, newvalues); err != nil {
+            t.Fatalf("can't prepare test config file [%v]", err)
+        }
+        for _, v := range newvalues {
+            if !filepath.IsAbs(v) {
+                continue
+            }
+            if err := createFile(v, 0666); err != nil {
+                t.Errorf("test file preparation error [%v]: %v", v, err)
+            }
+            defer os.Remove(v)
+        }
+        rn := newRecordNotifier()
+        logger := New()
+        if err := InitConfig(logger, example); err != nil {
+            t.Fatal(err)
+        }
+        logger.notifier = rn
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        time.Sleep(100 * time.Millisecond)
+        if err := updateFile(testFile, "WARNING 1", "ERROR 1"); err != nil {
+            t.Fatal(err)
+        }
+        if msg := rn.wait(3 * time.Second); !strings.Contains(msg, "2: ERROR 1") || strings.Contains(msg, "WARNING") {
+            t.Errorf("incorrect message: %v", msg)
+        }
+        // the pattern of the first file is changed
+        newvalues["\"pattern\": \"ERROR\""] = "\"pattern\": \"ERROR|WARNING\""
+        if err := prepareConfig(oldexample, example, newvalues); err != nil {
+            t.Fatalf("can't prepare test config file [%v]", err)
+        }
+        if err := logger.Reload(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        time.Sleep(100 * time.Millisecond)
+        for len(rn.messages) > 0 {
+            rn.wait(0)
+        }
+        if err := updateFile(testFile, "WARNING 2"); err != nil {
+            t.Fatal(err)
+        }
+        msg := rn.wait(time.Second)
+        if !strings.Contains(msg, "3: WARNING 2") {
+            t.Errorf("new line is not reported [rescan=%v]: %v", rescan, msg)
+        }
+        if rescanned := strings.Contains(msg, "1: WARNING 1"); rescanned != rescan {
+            t.Errorf("incorrect rescan [rescan=%v]: %v", rescan, msg)
+        }
+        if pos := logger.Cfg.Observed[0].Files[0].Pos; pos != 3 {
+            t.Errorf("incorrect position [rescan=%v]: %v", rescan, pos)
+        }
+        if err := logger.Stop(&group); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
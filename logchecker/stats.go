@@ -0,0 +1,230 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Statistics of LogChecker
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "text/template"
+    "time"
+)
+
+// DefaultStatsInterval is a default period of statistics logging.
+const DefaultStatsInterval = 60 * time.Minute
+
+// StatsIntervalFlag replaces "stats_interval" config value if it's not zero,
+// a negative value disables statistics logging.
+var StatsIntervalFlag time.Duration
+
+// DefaultStatsTemplate is a default template of statistics report.
+const DefaultStatsTemplate string = `{{.Name}}: host={{.Hostname}}{{if .Environment}}, environment={{.Environment}}{{end}}, running={{.Working}}, uptime={{.Uptime}}, files={{len .Files}}, emails: {{.Delivery}}
+{{range .Files}}  {{.Service}} {{.Log}}: matches={{.Found}}, boundary={{.Boundary}}, sent={{.Sent}}/{{.Limit}}, last check={{if .LastCheck.IsZero}}never{{else}}{{.LastCheckAge}} ago{{end}}
+{{end}}`
+
+// FileTotals are counters of a watched file since its first check,
+// they are saved by the storage, so reloads and restarts keep them.
+type FileTotals struct {
+    Lines uint64       `json:"lines"`
+    Matches uint64     `json:"matches"`
+    Sent uint64        `json:"sent"`
+    Suppressed uint64  `json:"suppressed"`
+}
+
+// FileStats is a statistics snapshot of a watched file,
+// Found and Sent are values of the current period.
+type FileStats struct {
+    Service string
+    Log string
+    Found uint64
+    Boundary uint64
+    Sent uint64
+    Limit uint64
+    Pos uint64
+    Totals FileTotals
+    LastCheck time.Time
+    LastCheckAge time.Duration
+}
+
+// Stats is a statistics snapshot of LogChecker.
+type Stats struct {
+    Name string
+    Hostname string
+    Environment string
+    Working bool
+    Running time.Time
+    Uptime time.Duration
+    Delivery string
+    Files []FileStats
+}
+
+// fileCounters are values of a file published by its check for Stats,
+// because a running check changes File fields.
+type fileCounters struct {
+    found uint64
+    boundary uint64
+    sent uint64
+    pos uint64
+    totals FileTotals
+    lastCheck time.Time
+}
+
+// counters returns current values of the file.
+func (f *File) counters() fileCounters {
+    return fileCounters{
+        found: f.Found,
+        boundary: f.ExtBoundary,
+        sent: f.Counter,
+        pos: f.Pos,
+        totals: f.totals,
+        lastCheck: f.LastCheck,
+    }
+}
+
+// publishStats saves values of the file for Stats, it's called
+// by the start before the file watching and by every check.
+func (logger *LogChecker) publishStats(f *File) {
+    logger.statsMutex.Lock()
+    defer logger.statsMutex.Unlock()
+    if logger.published == nil {
+        logger.published = map[*File]fileCounters{}
+    }
+    logger.published[f] = f.counters()
+}
+
+// resetStats removes published values of files of a previous start.
+func (logger *LogChecker) resetStats() {
+    logger.statsMutex.Lock()
+    logger.published = nil
+    logger.statsMutex.Unlock()
+}
+
+// Stats returns a statistics snapshot. Values of watched files are taken
+// from their last checks, other files are not changed concurrently.
+func (logger *LogChecker) Stats() Stats {
+    logger.mutex.RLock()
+    defer logger.mutex.RUnlock()
+    now := time.Now()
+    stats := Stats{
+        Name: logger.Name,
+        Hostname: logger.Cfg.Host(),
+        Environment: logger.Cfg.Environment,
+        Working: logger.IsWorking(),
+        Running: logger.Running,
+        Delivery: logger.Delivery.String(),
+    }
+    if stats.Working {
+        stats.Uptime = now.Sub(logger.Running) / time.Second * time.Second
+    }
+    logger.statsMutex.Lock()
+    defer logger.statsMutex.Unlock()
+    for i := range logger.Cfg.Observed {
+        serv := &logger.Cfg.Observed[i]
+        for j := range serv.Files {
+            f := &serv.Files[j]
+            c, ok := logger.published[f]
+            if !ok {
+                c = f.counters()
+            }
+            fs := FileStats{
+                Service: serv.Name,
+                Log: f.Log,
+                Found: c.found,
+                Boundary: c.boundary,
+                Sent: c.sent,
+                Limit: f.Limit,
+                Pos: c.pos,
+                Totals: c.totals,
+                LastCheck: c.lastCheck,
+            }
+            if !c.lastCheck.IsZero() {
+                fs.LastCheckAge = now.Sub(c.lastCheck) / time.Second * time.Second
+            }
+            stats.Files = append(stats.Files, fs)
+        }
+    }
+    return stats
+}
+
+// RenderStats renders a statistics report using a text template,
+// the default template is used if the template is empty or incorrect.
+func RenderStats(stats Stats, text string) string {
+    var buf bytes.Buffer
+    if len(text) > 0 {
+        tmpl, err := template.New("stats").Parse(text)
+        if err == nil {
+            err = tmpl.Execute(&buf, stats)
+        }
+        if err == nil {
+            return buf.String()
+        }
+        LoggerError.Printf("statistics template error, default one is used: %v\n", err)
+        buf.Reset()
+    }
+    template.Must(template.New("stats").Parse(DefaultStatsTemplate)).Execute(&buf, stats)
+    return buf.String()
+}
+
+// StatsTemplate returns a statistics template from the configuration,
+// a template file has priority over an inline template.
+func (cfg *Config) StatsTemplate() string {
+    if len(cfg.StatsTemplateFile) > 0 {
+        data, err := ioutil.ReadFile(cfg.StatsTemplateFile)
+        if err == nil {
+            return string(data)
+        }
+        LoggerError.Printf("can't read statistics template, default one is used: %v\n", err)
+        return ""
+    }
+    return cfg.StatsTemplateText
+}
+
+// StatsReport returns a rendered statistics report.
+func (logger *LogChecker) StatsReport() string {
+    logger.mutex.RLock()
+    text := logger.Cfg.StatsTemplate()
+    logger.mutex.RUnlock()
+    return RenderStats(logger.Stats(), text)
+}
+
+// StatsPeriod returns a period of statistics logging from "stats_interval"
+// seconds, zero value means the default period and a negative one disables
+// the logging, then zero period is returned.
+func (cfg *Config) StatsPeriod() time.Duration {
+    switch {
+        case StatsIntervalFlag < 0:
+            return 0
+        case StatsIntervalFlag > 0:
+            return StatsIntervalFlag
+        case cfg.StatsInterval < 0:
+            return 0
+        case cfg.StatsInterval == 0:
+            return DefaultStatsInterval
+    }
+    return time.Duration(cfg.StatsInterval) * time.Second
+}
+
+// logStats writes a statistics report to LoggerInfo every period,
+// the statistics snapshot is written as JSON in debug mode.
+func (logger *LogChecker) logStats(ctx context.Context, period time.Duration) {
+    ticker := time.NewTicker(period)
+    defer ticker.Stop()
+    for {
+        select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+                LoggerInfo.Printf("statistics:\n%v", logger.StatsReport())
+                if debug {
+                    if data, err := json.Marshal(logger.Stats()); err == nil {
+                        LoggerDebug.Printf("statistics: %s", data)
+                    }
+                }
+        }
+    }
+}
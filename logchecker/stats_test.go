@@ -0,0 +1,174 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Statistics testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "bytes"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// syncBuffer is a buffer for concurrent writes of loggers.
+type syncBuffer struct {
+    mutex sync.Mutex
+    buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+    sb.mutex.Lock()
+    defer sb.mutex.Unlock()
+    return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+    sb.mutex.Lock()
+    defer sb.mutex.Unlock()
+    return sb.buf.String()
+}
+
+func TestStatsInterval(t *testing.T) {
+    cfg := &Config{}
+    if p := cfg.StatsPeriod(); p != DefaultStatsInterval {
+        t.Errorf("incorrect default stats period: %v", p)
+    }
+    cfg.StatsInterval = 30
+    if p := cfg.StatsPeriod(); p != 30 * time.Second {
+        t.Errorf("incorrect stats period: %v", p)
+    }
+    cfg.StatsInterval = -1
+    if p := cfg.StatsPeriod(); p != 0 {
+        t.Errorf("stats logging should be disabled: %v", p)
+    }
+    if err := json.Unmarshal([]byte(`{"stats_interval": 90}`), cfg); err != nil {
+        t.Fatal(err)
+    }
+    if p := cfg.StatsPeriod(); p != 90 * time.Second {
+        t.Errorf("incorrect parsed stats period: %v", p)
+    }
+    StatsIntervalFlag = 5 * time.Second
+    if p := cfg.StatsPeriod(); p != StatsIntervalFlag {
+        t.Errorf("stats period flag is ignored: %v", p)
+    }
+    StatsIntervalFlag = -1
+    if p := cfg.StatsPeriod(); p != 0 {
+        t.Errorf("stats logging should be disabled by flag: %v", p)
+    }
+    StatsIntervalFlag = 0
+    output := &syncBuffer{}
+    LoggerInfo.SetOutput(output)
+    defer LoggerInfo.SetOutput(os.Stderr)
+    logger := New()
+    logger.Name = "StatsTest"
+    logger.Cfg.Observed = []Service{{Name: "service", Files: []File{{Log: "/tmp/test_stats.log", Found: 7, Limit: 5}}}}
+    ctx, cancel := context.WithCancel(context.Background())
+    go logger.logStats(ctx, 50 * time.Millisecond)
+    time.Sleep(180 * time.Millisecond)
+    cancel()
+    report := output.String()
+    if n := strings.Count(report, "statistics:"); (n < 2) || (n > 4) {
+        t.Errorf("stats logging doesn't honor the interval: %v lines", n)
+    }
+    if !strings.Contains(report, logger.StatsReport()) || !strings.Contains(report, "/tmp/test_stats.log: matches=7") {
+        t.Errorf("incorrect stats report: %v", report)
+    }
+    time.Sleep(100 * time.Millisecond)
+    if r := output.String(); r != report {
+        t.Errorf("stats logging is not stopped")
+    }
+}
+
+func TestStatsTotals(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_stats_totals.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.Backend = &MemoryBackend{Name: "Memory", Active: true}
+    logger.Cfg.DuplicateWindow = -1
+    logger.notifier = newRecordNotifier()
+    // every check uses a new file like a reload, so totals are loaded from the back-end
+    check := func(lines ...string) *File {
+        if err := updateFile(filename, lines...); err != nil {
+            t.Fatal(err)
+        }
+        f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 1}
+        if err := f.Validate(); err != nil {
+            t.Fatal(err)
+        }
+        f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        return f
+    }
+    check("ERROR 1", "OK 2", "OK 3")
+    check("ERROR 4", "ERROR 5")
+    // the limit is reached
+    f := check("ERROR 6")
+    expected := FileTotals{Lines: 6, Matches: 4, Sent: 2, Suppressed: 1}
+    if f.totals != expected {
+        t.Errorf("incorrect totals: %+v", f.totals)
+    }
+    logger.Cfg.Observed = []Service{{Name: "service", Files: []File{*f}}}
+    stats := logger.Stats()
+    if fs := stats.Files[0]; (fs.Totals != expected) || (fs.Pos != 6) {
+        t.Errorf("incorrect file statistics: %+v", fs)
+    }
+    data, err := json.Marshal(stats)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), `"Totals":{"lines":6,"matches":4,"sent":2,"suppressed":1}`) {
+        t.Errorf("incorrect JSON statistics: %s", data)
+    }
+}
+
+func TestStatsConcurrentCheck(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_stats_concurrent.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "service", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 100, Period: 3600, Limit: 10},
+    }}}
+    if err := logger.Start(context.Background(), &group); err != nil {
+        t.Fatal(err)
+    }
+    // statistics are read during checks
+    for i := 0; i < 10; i++ {
+        if err := updateFile(filename, "ERROR line"); err != nil {
+            t.Fatal(err)
+        }
+        logger.Stats()
+        time.Sleep(10 * time.Millisecond)
+    }
+    var fs FileStats
+    for i := 0; i < 30; i++ {
+        if fs = logger.Stats().Files[0]; fs.Found == 10 {
+            break
+        }
+        time.Sleep(50 * time.Millisecond)
+    }
+    if (fs.Found != 10) || (fs.Pos != 10) || (fs.Totals.Lines != 10) || fs.LastCheck.IsZero() {
+        t.Errorf("incorrect file statistics: %+v", fs)
+    }
+    if err := logger.Stop(&group); err != nil {
+        t.Fatal(err)
+    }
+}
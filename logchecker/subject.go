@@ -0,0 +1,223 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notification subjects
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "text/template"
+    "unicode"
+)
+
+const (
+    // DefaultSubject is a default subject of notifications.
+    DefaultSubject string = "LogChecker notification"
+    // MaxSubjectLength is a maximum number of symbols in a subject.
+    MaxSubjectLength int = 120
+)
+
+var rgPlaceholder = regexp.MustCompile(`\{(service|file|count|severity|first_line|[0-9])\}`)
+
+// SubjectData is a data of sender "subject_template".
+type SubjectData struct {
+    Service string
+    File string
+    Found uint64
+    Severity string
+}
+
+// SubjectNotifier is a notifier that supports message subjects.
+type SubjectNotifier interface {
+    Notifier
+    NotifySubject(string, string, []string) error
+}
+
+// notify sends a message with a subject if the notifier supports it,
+// the context cancels a sending of notifiers that support it.
+func notify(ctx context.Context, notifier Notifier, subject, msg string, to []string) error {
+    if sn, ok := notifier.(SubjectNotifier); ok && (len(subject) > 0) {
+        return sn.NotifySubject(subject, msg, to)
+    }
+    if cn, ok := notifier.(ContextNotifier); ok {
+        return cn.NotifyContext(ctx, msg, to)
+    }
+    return notifier.Notify(msg, to)
+}
+
+// notifyAsync sends a notification in background, Stop waits for it.
+// A duplicate of the previous notification is dropped.
+func (logger *LogChecker) notifyAsync(notifier Notifier, subject, msg string, to []string) {
+    if logger.isDuplicate(notifier, subject, msg, to) {
+        LoggerInfo.Printf("duplicate notification is dropped: %v", notifier)
+        return
+    }
+    logger.inflight.Add(1)
+    go func() {
+        defer logger.inflight.Done()
+        if err := logger.send(queuedAlert{notifier: notifier, subject: subject, msg: msg, to: to}); err != nil {
+            LoggerError.Printf("notification error [%v]: %v", notifier, err)
+        }
+    }()
+}
+
+// notifySync sends a notification and returns its delivery error,
+// Stop waits for it as for background notifications. A duplicate
+// of the previous notification is dropped without an error.
+func (logger *LogChecker) notifySync(alert queuedAlert) error {
+    if logger.isDuplicate(alert.notifier, alert.subject, alert.msg, alert.to) {
+        LoggerInfo.Printf("duplicate notification is dropped: %v", alert.notifier)
+        return nil
+    }
+    logger.inflight.Add(1)
+    defer logger.inflight.Done()
+    return logger.send(alert)
+}
+
+// send delivers a notification, a sent one is saved to the audit log.
+// The sending is cancelled after sender "timeout" or by Stop.
+func (logger *LogChecker) send(alert queuedAlert) error {
+    ctx, cancel := logger.notifyContext()
+    defer cancel()
+    if an, ok := alert.notifier.(AttachmentNotifier); ok && (len(alert.attachment) > 0) {
+        if err := an.NotifyAttachment(alert.subject, alert.msg, alert.attachment, alert.to); err != nil {
+            return err
+        }
+    } else if err := notify(ctx, alert.notifier, alert.subject, alert.msg, alert.to); err != nil {
+        return err
+    }
+    logger.audit(alert)
+    return nil
+}
+
+// SanitizeSubject converts a value to a single line without control symbols,
+// its length is limited by MaxSubjectLength.
+func SanitizeSubject(value string) string {
+    value = strings.Map(func(r rune) rune {
+        if unicode.IsControl(r) || unicode.IsSpace(r) {
+            return ' '
+        }
+        return r
+    }, value)
+    value = strings.Join(strings.Fields(value), " ")
+    if runes := []rune(value); len(runes) > MaxSubjectLength {
+        value = string(runes[:MaxSubjectLength-3]) + "..."
+    }
+    return value
+}
+
+// Subject returns a notification subject using File.SubjectTemplate.
+// Placeholders: {service}, {file}, {count}, {severity}, {first_line}
+// and {0}-{9} for pattern's capture groups of the first matched line.
+// Line content is not used in count only mode.
+func (f *File) Subject(firstLine string, count uint64, severity string) string {
+    if len(f.SubjectTemplate) == 0 {
+        return DefaultSubject
+    }
+    var groups []string
+    if f.CountOnly {
+        firstLine = ""
+    } else if f.RgPattern != nil {
+        groups = f.RgPattern.FindStringSubmatch(firstLine)
+    }
+    subject := rgPlaceholder.ReplaceAllStringFunc(f.SubjectTemplate, func(placeholder string) string {
+        name := placeholder[1:len(placeholder)-1]
+        switch name {
+            case "service":
+                if f.service == nil {
+                    return ""
+                }
+                return f.service.String()
+            case "file":
+                return f.Base()
+            case "count":
+                return strconv.FormatUint(count, 10)
+            case "severity":
+                return severity
+            case "first_line":
+                return firstLine
+        }
+        i, _ := strconv.Atoi(name)
+        if i < len(groups) {
+            return groups[i]
+        }
+        return ""
+    })
+    if subject = SanitizeSubject(subject); len(subject) == 0 {
+        return DefaultSubject
+    }
+    return subject
+}
+
+// Host returns the configured hostname or the detected one.
+func (cfg *Config) Host() string {
+    if len(cfg.Hostname) > 0 {
+        return cfg.Hostname
+    }
+    hostname, _ := os.Hostname()
+    return hostname
+}
+
+// HostTag returns the hostname with the environment label if it's set.
+func (cfg *Config) HostTag() string {
+    if len(cfg.Environment) > 0 {
+        return fmt.Sprintf("%v (%v)", cfg.Host(), cfg.Environment)
+    }
+    return cfg.Host()
+}
+
+// defaultSubject returns DefaultSubject with the hostname and the environment,
+// so notifications of the same configuration on several hosts are different.
+func (cfg *Config) defaultSubject() string {
+    return SanitizeSubject(DefaultSubject + ": " + cfg.HostTag())
+}
+
+// senderSubject returns a subject from sender "subject" field, "%s" is
+// replaced by the service name and "%d" by the number of matched lines.
+// DefaultSubject is used if the field is empty.
+func (logger *LogChecker) senderSubject(service string, count uint64) string {
+    format := logger.Cfg.Sender["subject"]
+    if len(format) == 0 {
+        return DefaultSubject
+    }
+    replacer := strings.NewReplacer("%s", service, "%d", strconv.FormatUint(count, 10), "%%", "%")
+    if subject := SanitizeSubject(replacer.Replace(format)); len(subject) > 0 {
+        return subject
+    }
+    return DefaultSubject
+}
+
+// fileSubject returns a subject of the file's notification, File.SubjectTemplate
+// has priority over sender "subject_template" and "subject" fields.
+// DefaultSubject is used if the sender template can't be rendered.
+func (logger *LogChecker) fileSubject(f *File, firstLine string, count uint64, severity string) string {
+    var buf bytes.Buffer
+    text := logger.Cfg.Sender["subject_template"]
+    switch {
+        case len(f.SubjectTemplate) > 0:
+            return f.Subject(firstLine, count, severity)
+        case len(text) == 0:
+            return logger.senderSubject(f.serviceName(), count)
+    }
+    data := SubjectData{Service: f.serviceName(), File: f.Log, Found: count, Severity: severity}
+    tmpl, err := template.New("subject").Parse(text)
+    if err == nil {
+        err = tmpl.Execute(&buf, data)
+    }
+    if err != nil {
+        LoggerError.Printf("subject template error, default subject is used: %v", err)
+        return DefaultSubject
+    }
+    if subject := SanitizeSubject(buf.String()); len(subject) > 0 {
+        return subject
+    }
+    return DefaultSubject
+}
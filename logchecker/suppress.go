@@ -0,0 +1,84 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Suppression of repeated notifications
+//
+package logchecker
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "sort"
+    "time"
+)
+
+// linesHash returns a hash of a set of matched lines fingerprints,
+// so it doesn't depend on line numbers and order.
+func linesHash(fingerprints map[string]uint64) string {
+    keys := make([]string, 0, len(fingerprints))
+    for fp := range fingerprints {
+        keys = append(keys, fp)
+    }
+    sort.Strings(keys)
+    h := sha1.New()
+    for _, fp := range keys {
+        h.Write([]byte(fp))
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// isSuppressed returns true if a notification with the same matched lines
+// was sent during File.SuppressWindow seconds. Otherwise the hash
+// is saved as the last notified one.
+func (f *File) isSuppressed(hash string, t time.Time) bool {
+    if f.SuppressWindow == 0 {
+        return false
+    }
+    window := time.Duration(f.SuppressWindow) * time.Second
+    if (hash == f.lastHash) && (t.Sub(f.lastNotified) < window) {
+        f.Suppressed++
+        return true
+    }
+    f.lastHash, f.lastNotified = hash, t
+    return false
+}
+
+// cooldown returns true and a remaining time if File.Cooldown seconds
+// are not elapsed since the last sent notification.
+func (f *File) cooldown(t time.Time) (time.Duration, bool) {
+    if (f.Cooldown == 0) || f.lastSent.IsZero() {
+        return 0, false
+    }
+    remain := f.lastSent.Add(time.Duration(f.Cooldown) * time.Second).Sub(t)
+    return remain, remain > 0
+}
+
+// resetSuppression forgets the last notified lines, it's called
+// after the file rotation.
+func (f *File) resetSuppression() {
+    f.lastHash, f.lastNotified = "", time.Time{}
+}
+
+// rewind returns the read position to the start of the check and
+// forgets its matched lines, so they are checked again after the
+// suppression. The integrity baseline is updated during the next check.
+func (f *File) rewind(pos uint64, offset int64, counter uint64, severities, fingerprints map[string]uint64) {
+    f.Pos, f.Offset, f.integrity = pos, offset, nil
+    f.Found -= counter
+    for k, v := range severities {
+        if f.Severities[k] <= v {
+            delete(f.Severities, k)
+        } else {
+            f.Severities[k] -= v
+        }
+    }
+    for fp, n := range fingerprints {
+        if f.Fingerprints[fp] <= n {
+            delete(f.Fingerprints, fp)
+        } else {
+            f.Fingerprints[fp] -= n
+        }
+    }
+    LoggerDebug.Printf("position is rewound after suppression [%v]: %v", f.Base(), f.Pos)
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestSuppress(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_suppress.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 100, SuppressWindow: 3600}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    logger.Cfg.DuplicateWindow = -1
+
+    check := func(lines string, sent bool, suppressed uint64) {
+        if err := updateFile(filename, lines); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        msg := notifier.wait(200 * time.Millisecond)
+        if (len(msg) > 0) != sent {
+            t.Errorf("[%v] notification sent=%v, expected %v", lines, len(msg) > 0, sent)
+        }
+        if f.Suppressed != suppressed {
+            t.Errorf("[%v] incorrect suppressed counter: %v", lines, f.Suppressed)
+        }
+    }
+    check("ERROR a\nERROR b", true, 0)
+    // the same lines with other numbers and order
+    check("ERROR b\nERROR a", false, 1)
+    check("ERROR a\nERROR c", true, 1)
+    check("ERROR a\nERROR c", false, 2)
+    // the window is expired
+    f.lastNotified = f.lastNotified.Add(-2 * time.Hour)
+    check("ERROR a\nERROR c", true, 2)
+    // rotation resets the last notified lines
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatal(err)
+    }
+    check("ERROR a\nERROR c", true, 2)
+    check("ERROR a\nERROR c", false, 3)
+}
+
+func TestCooldown(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_cooldown.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 100, Cooldown: 3600}
+    if err := f.Validate(); err != nil {
+        t.Fatal(err)
+    }
+    f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+    logger := New()
+    notifier := newRecordNotifier()
+    logger.notifier = notifier
+    logger.Cfg.DuplicateWindow = -1
+
+    check := func(line string, sent bool, found uint64) {
+        if err := updateFile(filename, line); err != nil {
+            t.Fatal(err)
+        }
+        if err := f.Check(&group, logger); err != nil {
+            t.Fatal(err)
+        }
+        msg := notifier.wait(200 * time.Millisecond)
+        if (len(msg) > 0) != sent {
+            t.Errorf("[%v] notification sent=%v, expected %v", line, len(msg) > 0, sent)
+        }
+        if f.Found != found {
+            t.Errorf("[%v] incorrect found counter: %v", line, f.Found)
+        }
+    }
+    check("ERROR 1", true, 1)
+    check("ERROR 2", false, 2)
+    if d := logger.LastDecision("", filename); d.Action != DecisionCooldown {
+        t.Errorf("incorrect decision: %v", d)
+    }
+    check("ERROR 3", false, 3)
+    if f.Counter != 1 {
+        t.Errorf("incorrect counter: %v", f.Counter)
+    }
+    // the cooldown is elapsed
+    f.lastSent = f.lastSent.Add(-2 * time.Hour)
+    check("ERROR 4", true, 4)
+}
+
+func TestRescanAfterSuppress(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_rescan_suppress.log")
+    defer os.Remove(filename)
+    for _, rescan := range []bool{false, true} {
+        if err := createFile(filename, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]", err)
+        }
+        f := &File{Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 100, Cooldown: 3600, RescanAfterSuppress: rescan}
+        if err := f.Validate(); err != nil {
+            t.Fatal(err)
+        }
+        f.LogStart, f.ExtBoundary = time.Now(), f.Boundary
+        logger := New()
+        notifier := newRecordNotifier()
+        logger.notifier = notifier
+        logger.Cfg.DuplicateWindow = -1
+        check := func(line string) string {
+            if err := updateFile(filename, line); err != nil {
+                t.Fatal(err)
+            }
+            if err := f.Check(&group, logger); err != nil {
+                t.Fatal(err)
+            }
+            return notifier.wait(200 * time.Millisecond)
+        }
+        if msg := check("ERROR 1"); !strings.Contains(msg, "1: ERROR 1") {
+            t.Errorf("[rescan=%v] incorrect message: %v", rescan, msg)
+        }
+        // the file is muted by the cooldown
+        if msg := check("ERROR 2"); len(msg) > 0 {
+            t.Errorf("[rescan=%v] notification is not suppressed: %v", rescan, msg)
+        }
+        expected := uint64(2)
+        if rescan {
+            expected = 1
+        }
+        if (f.Pos != expected) || (f.Found != expected) {
+            t.Errorf("[rescan=%v] incorrect position %v or found %v", rescan, f.Pos, f.Found)
+        }
+        // the cooldown is elapsed
+        f.lastSent = f.lastSent.Add(-2 * time.Hour)
+        msg := check("ERROR 3")
+        if !strings.Contains(msg, "3: ERROR 3") {
+            t.Errorf("[rescan=%v] new line is not reported: %v", rescan, msg)
+        }
+        if reported := strings.Contains(msg, "2: ERROR 2"); reported != rescan {
+            t.Errorf("[rescan=%v] incorrect suppressed line report: %v", rescan, msg)
+        }
+        if (f.Pos != 3) || (f.Found != 3) {
+            t.Errorf("[rescan=%v] incorrect position %v or found %v", rescan, f.Pos, f.Found)
+        }
+    }
+}
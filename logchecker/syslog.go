@@ -0,0 +1,174 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+// Syslog notifier
+//
+package logchecker
+
+import (
+    "fmt"
+    "log/syslog"
+    "strings"
+    "sync"
+)
+
+// SyslogNotifierName is a name of the syslog notifier configured by "syslog" settings.
+const SyslogNotifierName string = "syslog"
+
+var (
+    // SyslogAttempts is a number of syslog write attempts, the connection
+    // is re-created before every next attempt.
+    SyslogAttempts = 3
+
+    syslogFacilities = map[string]syslog.Priority{
+        "kern": syslog.LOG_KERN,
+        "user": syslog.LOG_USER,
+        "mail": syslog.LOG_MAIL,
+        "daemon": syslog.LOG_DAEMON,
+        "auth": syslog.LOG_AUTH,
+        "syslog": syslog.LOG_SYSLOG,
+        "local0": syslog.LOG_LOCAL0,
+        "local1": syslog.LOG_LOCAL1,
+        "local2": syslog.LOG_LOCAL2,
+        "local3": syslog.LOG_LOCAL3,
+        "local4": syslog.LOG_LOCAL4,
+        "local5": syslog.LOG_LOCAL5,
+        "local6": syslog.LOG_LOCAL6,
+        "local7": syslog.LOG_LOCAL7,
+    }
+    syslogSeverities = map[string]syslog.Priority{
+        "emerg": syslog.LOG_EMERG,
+        "alert": syslog.LOG_ALERT,
+        "crit": syslog.LOG_CRIT,
+        "err": syslog.LOG_ERR,
+        "warning": syslog.LOG_WARNING,
+        "notice": syslog.LOG_NOTICE,
+        "info": syslog.LOG_INFO,
+        "debug": syslog.LOG_DEBUG,
+    }
+)
+
+// SyslogNotifier writes notifications to a local or remote syslog daemon.
+type SyslogNotifier struct {
+    Network string
+    Addr string
+    Priority syslog.Priority
+    Tag string
+    writer *syslog.Writer
+    mutex sync.Mutex
+}
+
+// NewSyslogNotifier creates SyslogNotifier from "syslog" config settings:
+// "network" ("udp", "tcp" or empty for the local daemon), "addr",
+// "facility" ("user" by default), "severity" ("warning" by default)
+// and "tag" ("logchecker" by default). The connection is opened
+// during the first notification.
+func NewSyslogNotifier(settings map[string]string) (*SyslogNotifier, error) {
+    sn := &SyslogNotifier{Network: settings["network"], Addr: settings["addr"], Tag: settings["tag"]}
+    switch sn.Network {
+        case "":
+            if len(sn.Addr) > 0 {
+                return nil, fmt.Errorf("syslog network should be set for addr")
+            }
+        case "udp", "tcp":
+            if _, err := SenderAddr(sn.Addr); err != nil {
+                return nil, fmt.Errorf("syslog addr is incorrect: %v", err)
+            }
+        default:
+            return nil, fmt.Errorf("unknown syslog network [%v]", sn.Network)
+    }
+    facility, severity := syslog.LOG_USER, syslog.LOG_WARNING
+    if name := settings["facility"]; len(name) > 0 {
+        value, ok := syslogFacilities[name]
+        if !ok {
+            return nil, fmt.Errorf("unknown syslog facility [%v]", name)
+        }
+        facility = value
+    }
+    if name := settings["severity"]; len(name) > 0 {
+        value, ok := syslogSeverities[name]
+        if !ok {
+            return nil, fmt.Errorf("unknown syslog severity [%v]", name)
+        }
+        severity = value
+    }
+    sn.Priority = facility | severity
+    if len(sn.Tag) == 0 {
+        sn.Tag = "logchecker"
+    }
+    return sn, nil
+}
+
+// String returns a name of the notifier.
+func (sn *SyslogNotifier) String() string {
+    if len(sn.Addr) > 0 {
+        return fmt.Sprintf("syslog (%v://%v)", sn.Network, sn.Addr)
+    }
+    return SyslogNotifierName
+}
+
+// Notify writes a message to syslog as one record, recipients are ignored.
+// The connection is re-created if it was dropped, the error contains
+// the record if all attempts are failed.
+func (sn *SyslogNotifier) Notify(msg string, to []string) error {
+    record := strings.Replace(strings.TrimSpace(truncateReport(msg)), "\n", " | ", -1)
+    sn.mutex.Lock()
+    defer sn.mutex.Unlock()
+    var err error
+    for i := 0; i < SyslogAttempts; i++ {
+        if sn.writer == nil {
+            if sn.writer, err = syslog.Dial(sn.Network, sn.Addr, sn.Priority, sn.Tag); err != nil {
+                sn.writer = nil
+                continue
+            }
+        }
+        if _, err = sn.writer.Write([]byte(record)); err == nil {
+            LoggerDebug.Printf("syslog notification is sent: %v", sn)
+            return nil
+        }
+        sn.writer.Close()
+        sn.writer = nil
+    }
+    return fmt.Errorf("syslog notification is failed (%v): %v", err, record)
+}
+
+// Close closes syslog connection.
+func (sn *SyslogNotifier) Close() error {
+    sn.mutex.Lock()
+    defer sn.mutex.Unlock()
+    if sn.writer == nil {
+        return nil
+    }
+    err := sn.writer.Close()
+    sn.writer = nil
+    return err
+}
+
+// syslogNotifier returns a shared syslog notifier, so its connection
+// is used for all notifications.
+func (logger *LogChecker) syslogNotifier() (*SyslogNotifier, error) {
+    logger.syslogMutex.Lock()
+    defer logger.syslogMutex.Unlock()
+    if logger.syslog == nil {
+        sn, err := NewSyslogNotifier(logger.Cfg.Syslog)
+        if err != nil {
+            return nil, err
+        }
+        logger.syslog = sn
+    }
+    return logger.syslog, nil
+}
+
+// resetSyslog closes a shared syslog connection.
+func (logger *LogChecker) resetSyslog() {
+    logger.syslogMutex.Lock()
+    defer logger.syslogMutex.Unlock()
+    if logger.syslog != nil {
+        logger.syslog.Close()
+        logger.syslog = nil
+    }
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+// Syslog notifier testing methods
+//
+package logchecker
+
+import (
+    "bufio"
+    "net"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestSyslogNotifier(t *testing.T) {
+    for _, settings := range []map[string]string{
+        {"network": "unix", "addr": "/dev/log"},
+        {"addr": "127.0.0.1:514"},
+        {"network": "udp", "addr": "bad host:514"},
+        {"network": "udp", "addr": "127.0.0.1:514", "facility": "unknown"},
+        {"network": "udp", "addr": "127.0.0.1:514", "severity": "unknown"},
+    } {
+        if _, err := NewSyslogNotifier(settings); err == nil {
+            t.Errorf("need settings error: %v", settings)
+        }
+    }
+    // UDP syslog
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    sn, err := NewSyslogNotifier(map[string]string{
+        "network": "udp",
+        "addr": conn.LocalAddr().String(),
+        "facility": "local0",
+        "severity": "info",
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer sn.Close()
+    sn.Notify("Report for \"app\" service:\n1: ERROR 1", nil)
+    buf := make([]byte, 1024)
+    conn.SetReadDeadline(time.Now().Add(time.Second))
+    n, _, err := conn.ReadFrom(buf)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // local0 (16) * 8 + info (6)
+    record := string(buf[:n])
+    if !strings.HasPrefix(record, "<134>") || !strings.Contains(record, "logchecker") || !strings.Contains(record, "service: | 1: ERROR 1") {
+        t.Errorf("incorrect record: %v", record)
+    }
+
+    // TCP syslog, the connection is re-created
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    records := make(chan string, 10)
+    go func() {
+        for {
+            c, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            line, err := bufio.NewReader(c).ReadString('\n')
+            if err == nil {
+                records <- line
+            }
+            c.Close()
+        }
+    }()
+    tcp, err := NewSyslogNotifier(map[string]string{"network": "tcp", "addr": listener.Addr().String(), "tag": "test"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer tcp.Close()
+    tcp.Notify("first", nil)
+    select {
+        case record := <-records:
+            if !strings.Contains(record, "test") || !strings.Contains(record, "first") {
+                t.Errorf("incorrect record: %v", record)
+            }
+        case <-time.After(time.Second):
+            t.Errorf("record is not received")
+    }
+    // the server has closed the connection, a write to a dropped
+    // TCP connection fails only after a reset, so one record can be lost
+    time.Sleep(100 * time.Millisecond)
+    tcp.Notify("second", nil)
+    time.Sleep(100 * time.Millisecond)
+    tcp.Notify("third", nil)
+    received := false
+    for !received {
+        select {
+            case record := <-records:
+                received = strings.Contains(record, "third")
+            case <-time.After(time.Second):
+                t.Fatalf("record is not received after reconnect")
+        }
+    }
+    // all attempts are failed
+    listener.Close()
+    tcp.Notify("lost", nil)
+
+    cfg := Config{Syslog: map[string]string{"network": "udp", "addr": conn.LocalAddr().String()}}
+    if !cfg.hasNotifier(SyslogNotifierName) {
+        t.Errorf("syslog notifier should be available")
+    }
+    if err := RegisterNotifier(SyslogNotifierName, sn); err == nil {
+        t.Errorf("need reserved name error")
+    }
+}
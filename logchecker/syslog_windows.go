@@ -0,0 +1,45 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Syslog notifier stub, log/syslog is not available on Windows
+//
+package logchecker
+
+import (
+    "fmt"
+)
+
+// SyslogNotifierName is a name of the syslog notifier configured by "syslog" settings.
+const SyslogNotifierName string = "syslog"
+
+// SyslogNotifier is not supported on Windows.
+type SyslogNotifier struct{}
+
+// NewSyslogNotifier returns an error, syslog is not supported on Windows.
+func NewSyslogNotifier(settings map[string]string) (*SyslogNotifier, error) {
+    return nil, fmt.Errorf("syslog notifier is not supported on Windows")
+}
+
+// String returns a name of the notifier.
+func (sn *SyslogNotifier) String() string {
+    return SyslogNotifierName
+}
+
+// Notify returns an error, syslog is not supported on Windows.
+func (sn *SyslogNotifier) Notify(msg string, to []string) error {
+    return fmt.Errorf("syslog notifier is not supported on Windows")
+}
+
+// Close does nothing.
+func (sn *SyslogNotifier) Close() error {
+    return nil
+}
+
+// syslogNotifier returns an error, syslog is not supported on Windows.
+func (logger *LogChecker) syslogNotifier() (*SyslogNotifier, error) {
+    return NewSyslogNotifier(logger.Cfg.Syslog)
+}
+
+// resetSyslog does nothing.
+func (logger *LogChecker) resetSyslog() {}
@@ -0,0 +1,88 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Tail of watched files
+//
+package logchecker
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+)
+
+const (
+    // MaxTailLines is a maximum number of lines returned by Tail.
+    MaxTailLines int = 10000
+    tailChunk int64 = 64 * 1024
+)
+
+// IsWatched checks that a file path is in the configuration
+// or it's watched as a file of a glob pattern, a pattern itself isn't a file.
+func (logger *LogChecker) IsWatched(logPath string) bool {
+    logger.mutex.RLock()
+    defer logger.mutex.RUnlock()
+    for _, serv := range logger.Cfg.Observed {
+        for _, f := range serv.Files {
+            if (f.Log == logPath) && !f.IsGlob() {
+                return true
+            }
+        }
+    }
+    return logger.globbed[logPath] > 0
+}
+
+// Tail returns last n lines of a watched file.
+// Only files from the configuration can be read.
+func (logger *LogChecker) Tail(logPath string, n int) ([]string, error) {
+    if (n < 1) || (n > MaxTailLines) {
+        return nil, fmt.Errorf("number of lines should be in range [1, %v]", MaxTailLines)
+    }
+    if !logger.IsWatched(logPath) {
+        return nil, fmt.Errorf("file is not watched [%v]", logPath)
+    }
+    file, err := os.Open(logPath)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+    return tailLines(file, n)
+}
+
+// tailLines reads a file from the end by chunks until n lines are found.
+func tailLines(file *os.File, n int) ([]string, error) {
+    info, err := file.Stat()
+    if err != nil {
+        return nil, err
+    }
+    var data []byte
+    offset := info.Size()
+    // a last new line symbol doesn't start a new line
+    for (offset > 0) && (bytes.Count(data, []byte{'\n'}) <= n) {
+        size := tailChunk
+        if offset < size {
+            size = offset
+        }
+        offset -= size
+        chunk := make([]byte, size)
+        if _, err := file.ReadAt(chunk, offset); (err != nil) && (err != io.EOF) {
+            return nil, err
+        }
+        data = append(chunk, data...)
+    }
+    data = bytes.TrimSuffix(data, []byte{'\n'})
+    if len(data) == 0 {
+        return []string{}, nil
+    }
+    lines := bytes.Split(data, []byte{'\n'})
+    if len(lines) > n {
+        lines = lines[len(lines)-n:]
+    }
+    result := make([]string, len(lines))
+    for i, line := range lines {
+        result[i] = string(line)
+    }
+    return result, nil
+}
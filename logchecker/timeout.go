@@ -0,0 +1,145 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notification timeouts
+//
+package logchecker
+
+import (
+    "context"
+    "crypto/tls"
+    "fmt"
+    "net"
+    "net/smtp"
+    "time"
+)
+
+// DefaultSendTimeout is a default deadline of one notification send attempt.
+const DefaultSendTimeout = 30 * time.Second
+
+// ContextNotifier is a notifier that can cancel a sending
+// when the context is done.
+type ContextNotifier interface {
+    Notifier
+    NotifyContext(context.Context, string, []string) error
+}
+
+// sendTimeout returns a deadline of one send attempt from sender "timeout" field.
+func sendTimeout(sender map[string]string) (time.Duration, error) {
+    value := sender["timeout"]
+    if len(value) == 0 {
+        return DefaultSendTimeout, nil
+    }
+    d, err := time.ParseDuration(value)
+    if (err != nil) || (d <= 0) {
+        return 0, fmt.Errorf("sender timeout should be a positive duration")
+    }
+    return d, nil
+}
+
+// notifyContext returns a context of one send attempt with sender "timeout"
+// deadline, it's cancelled by Stop as well.
+func (logger *LogChecker) notifyContext() (context.Context, context.CancelFunc) {
+    timeout, err := sendTimeout(logger.Cfg.Sender)
+    if err != nil {
+        timeout = DefaultSendTimeout
+    }
+    logger.notifyMutex.Lock()
+    defer logger.notifyMutex.Unlock()
+    if logger.notifyCtx == nil {
+        logger.notifyCtx, logger.notifyCancel = context.WithCancel(context.Background())
+    }
+    return context.WithTimeout(logger.notifyCtx, timeout)
+}
+
+// cancelNotifications cancels contexts of all outstanding notifications
+// and their retries, so Stop is not blocked by a dead server.
+func (logger *LogChecker) cancelNotifications() {
+    logger.notifyMutex.Lock()
+    defer logger.notifyMutex.Unlock()
+    if logger.notifyCancel != nil {
+        logger.notifyCancel()
+    }
+}
+
+// resetNotifications drops a cancelled context, next notifications get a new one.
+func (logger *LogChecker) resetNotifications() {
+    logger.notifyMutex.Lock()
+    defer logger.notifyMutex.Unlock()
+    if logger.notifyCancel != nil {
+        logger.notifyCancel()
+    }
+    logger.notifyCtx, logger.notifyCancel = nil, nil
+}
+
+// dialContext opens TCP or TLS connection, its reads and writes
+// are failed when the context is done.
+func dialContext(ctx context.Context, addr string, tlsConfig *tls.Config) (*contextConn, error) {
+    var (
+        conn net.Conn
+        err error
+    )
+    if tlsConfig != nil {
+        dialer := &tls.Dialer{Config: tlsConfig}
+        conn, err = dialer.DialContext(ctx, "tcp", addr)
+    } else {
+        dialer := &net.Dialer{}
+        conn, err = dialer.DialContext(ctx, "tcp", addr)
+    }
+    if err != nil {
+        return nil, err
+    }
+    c := &contextConn{Conn: conn}
+    c.watch(ctx)
+    return c, nil
+}
+
+// contextConn is a connection that is closed when its context is done.
+type contextConn struct {
+    net.Conn
+    done chan struct{}
+}
+
+// watch sets a deadline of the context and closes the connection
+// when the context is done, a previous context is released.
+func (c *contextConn) watch(ctx context.Context) {
+    c.release()
+    if deadline, ok := ctx.Deadline(); ok {
+        c.SetDeadline(deadline)
+    }
+    done := make(chan struct{})
+    go func() {
+        select {
+            case <-ctx.Done():
+                c.Conn.Close()
+            case <-done:
+        }
+    }()
+    c.done = done
+}
+
+// release stops the context watching and resets the deadline.
+func (c *contextConn) release() {
+    if c.done != nil {
+        close(c.done)
+        c.done = nil
+        c.SetDeadline(time.Time{})
+    }
+}
+
+// Close closes the connection and stops its context watching.
+func (c *contextConn) Close() error {
+    c.release()
+    return c.Conn.Close()
+}
+
+// sendMailContext sends an email like smtp.SendMail does,
+// but the connection is closed when the context is done.
+func sendMailContext(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return err
+    }
+    return (&smtpServer{addr: addr, host: host}).send(ctx, a, from, to, msg)
+}
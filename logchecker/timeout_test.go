@@ -0,0 +1,109 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Notification timeouts testing methods
+//
+package logchecker
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// hungServer accepts TCP connections, but never responds.
+func hungServer(t *testing.T) net.Listener {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    go func() {
+        var conns []net.Conn
+        defer func() {
+            for _, conn := range conns {
+                conn.Close()
+            }
+        }()
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            conns = append(conns, conn)
+        }
+    }()
+    return listener
+}
+
+func TestSendTimeout(t *testing.T) {
+    for _, value := range []string{"0s", "-1s", "30"} {
+        if _, err := sendTimeout(map[string]string{"timeout": value}); err == nil {
+            t.Errorf("incorrect timeout is accepted: %v", value)
+        }
+    }
+    if d, err := sendTimeout(map[string]string{}); (err != nil) || (d != DefaultSendTimeout) {
+        t.Errorf("incorrect default timeout: %v, %v", d, err)
+    }
+    listener := hungServer(t)
+    defer listener.Close()
+    logger := New()
+    logger.Cfg.Sender = map[string]string{
+        "from": "logchecker@host.com", "host": "127.0.0.1", "addr": listener.Addr().String(),
+        "auth": AuthNone, "timeout": "100ms",
+    }
+    start := time.Now()
+    if err := logger.Notify("test message", []string{"user@host.com"}); err == nil {
+        t.Error("need timeout error")
+    }
+    if d := time.Since(start); d > 5 * time.Second {
+        t.Errorf("timeout is not applied: %v", d)
+    }
+    if logger.Delivery.Failed != 1 {
+        t.Errorf("incorrect delivery stats: %v", logger.Delivery.String())
+    }
+    // cancellation of outstanding notifications
+    logger.Cfg.Sender["timeout"] = "1h"
+    result := make(chan error)
+    go func() {
+        result <- logger.Notify("test message", []string{"user@host.com"})
+    }()
+    time.Sleep(100 * time.Millisecond)
+    logger.cancelNotifications()
+    select {
+        case err := <-result:
+            if err == nil {
+                t.Error("need cancellation error")
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatal("notification is not cancelled")
+    }
+    logger.resetNotifications()
+    if ctx, cancel := logger.notifyContext(); ctx.Err() != nil {
+        t.Errorf("context is not reset: %v", ctx.Err())
+    } else {
+        cancel()
+    }
+    // HTTP notifiers
+    release := make(chan bool)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+            case <-r.Context().Done():
+            case <-release:
+        }
+    }))
+    defer server.Close()
+    defer close(release)
+    wn, err := NewWebhookNotifier(&WebhookSettings{URL: server.URL})
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    defer cancel()
+    if err := notify(ctx, wn, "", "test message", nil); err == nil {
+        t.Error("need webhook timeout error")
+    }
+}
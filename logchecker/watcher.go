@@ -0,0 +1,157 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// File system watchers
+//
+package logchecker
+
+import (
+    "github.com/fsnotify/fsnotify"
+    "sync"
+)
+
+// WatchOp is a set of file operations of watch events.
+type WatchOp uint32
+
+const (
+    // WatchWrite means that the file content was modified.
+    WatchWrite WatchOp = 1 << iota
+    // WatchCloseWrite means that the file opened for writing was closed.
+    WatchCloseWrite
+    // WatchAttrib means that the file metadata was changed.
+    WatchAttrib
+    // WatchMove means that the file was moved.
+    WatchMove
+    // WatchRemove means that the file was deleted.
+    WatchRemove
+)
+
+// WatchEvent is an event of a watched file.
+type WatchEvent struct {
+    Name string
+    Op WatchOp
+}
+
+// Has checks that the event contains one of operations.
+func (e WatchEvent) Has(op WatchOp) bool {
+    return (e.Op & op) != 0
+}
+
+// Watcher is a watcher of file system events, only events
+// of operations requested for a file are sent.
+// NewWatcher returns the implementation of the current platform.
+type Watcher interface {
+    Add(name string, op WatchOp) error
+    Remove(name string) error
+    Events() <-chan WatchEvent
+    Errors() <-chan error
+    Close() error
+}
+
+// fsnotifyWatcher is a portable Watcher based on fsnotify package.
+// Write operations are also reported as WatchCloseWrite ones,
+// because close events are not portable.
+type fsnotifyWatcher struct {
+    watcher *fsnotify.Watcher
+    ops map[string]WatchOp
+    events chan WatchEvent
+    done chan bool
+    mutex sync.Mutex
+    once sync.Once
+}
+
+// newFsnotifyWatcher creates a new fsnotify watcher.
+func newFsnotifyWatcher() (Watcher, error) {
+    watcher, err := fsnotify.NewWatcher()
+    if err != nil {
+        return nil, err
+    }
+    w := &fsnotifyWatcher{
+        watcher: watcher,
+        ops: make(map[string]WatchOp),
+        events: make(chan WatchEvent),
+        done: make(chan bool),
+    }
+    go w.readEvents()
+    return w, nil
+}
+
+// Add starts watching of the file, operations are added
+// to already requested ones.
+func (w *fsnotifyWatcher) Add(name string, op WatchOp) error {
+    if err := w.watcher.Add(name); err != nil {
+        return err
+    }
+    w.mutex.Lock()
+    w.ops[name] |= op
+    w.mutex.Unlock()
+    return nil
+}
+
+// Remove stops watching of the file.
+func (w *fsnotifyWatcher) Remove(name string) error {
+    w.mutex.Lock()
+    delete(w.ops, name)
+    w.mutex.Unlock()
+    return w.watcher.Remove(name)
+}
+
+// Events returns a channel of watch events.
+func (w *fsnotifyWatcher) Events() <-chan WatchEvent {
+    return w.events
+}
+
+// Errors returns a channel of watcher errors.
+func (w *fsnotifyWatcher) Errors() <-chan error {
+    return w.watcher.Errors
+}
+
+// Close stops the watcher.
+func (w *fsnotifyWatcher) Close() error {
+    var err error
+    w.once.Do(func() {
+        close(w.done)
+        err = w.watcher.Close()
+    })
+    return err
+}
+
+// readEvents converts fsnotify events, not requested ones are skipped.
+func (w *fsnotifyWatcher) readEvents() {
+    defer close(w.events)
+    for {
+        select {
+            case <-w.done:
+                return
+            case event, ok := <-w.watcher.Events:
+                if !ok {
+                    return
+                }
+                var op WatchOp
+                if event.Has(fsnotify.Write) {
+                    op |= WatchWrite | WatchCloseWrite
+                }
+                if event.Has(fsnotify.Chmod) {
+                    op |= WatchAttrib
+                }
+                if event.Has(fsnotify.Rename) {
+                    op |= WatchMove
+                }
+                if event.Has(fsnotify.Remove) {
+                    op |= WatchRemove
+                }
+                w.mutex.Lock()
+                op &= w.ops[event.Name]
+                w.mutex.Unlock()
+                if op == 0 {
+                    continue
+                }
+                select {
+                    case w.events <- WatchEvent{event.Name, op}:
+                    case <-w.done:
+                        return
+                }
+        }
+    }
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Inotify file system watcher
+//
+package logchecker
+
+import (
+    "golang.org/x/exp/inotify"
+    "sync"
+)
+
+// inotifyOps are inotify masks of watch operations.
+var inotifyOps = []struct {
+    op WatchOp
+    mask uint32
+}{
+    {WatchWrite, inotify.IN_MODIFY},
+    {WatchCloseWrite, inotify.IN_CLOSE_WRITE},
+    {WatchAttrib, inotify.IN_ATTRIB},
+    {WatchMove, inotify.IN_MOVE_SELF},
+    {WatchRemove, inotify.IN_DELETE_SELF},
+}
+
+// inotifyWatcher is a Watcher based on Linux inotify.
+type inotifyWatcher struct {
+    watcher *inotify.Watcher
+    events chan WatchEvent
+    done chan bool
+    once sync.Once
+}
+
+// NewWatcher creates a new file system watcher, inotify is used on Linux.
+func NewWatcher() (Watcher, error) {
+    return newInotifyWatcher()
+}
+
+// newInotifyWatcher creates a new inotify watcher.
+func newInotifyWatcher() (Watcher, error) {
+    watcher, err := inotify.NewWatcher()
+    if err != nil {
+        return nil, err
+    }
+    w := &inotifyWatcher{watcher: watcher, events: make(chan WatchEvent), done: make(chan bool)}
+    go w.readEvents()
+    return w, nil
+}
+
+// Add starts watching of the file, operations are added
+// to already requested ones.
+func (w *inotifyWatcher) Add(name string, op WatchOp) error {
+    var mask uint32
+    for _, item := range inotifyOps {
+        if (op & item.op) != 0 {
+            mask |= item.mask
+        }
+    }
+    return w.watcher.AddWatch(name, mask)
+}
+
+// Remove stops watching of the file.
+func (w *inotifyWatcher) Remove(name string) error {
+    return w.watcher.RemoveWatch(name)
+}
+
+// Events returns a channel of watch events.
+func (w *inotifyWatcher) Events() <-chan WatchEvent {
+    return w.events
+}
+
+// Errors returns a channel of watcher errors.
+func (w *inotifyWatcher) Errors() <-chan error {
+    return w.watcher.Error
+}
+
+// Close stops the watcher.
+func (w *inotifyWatcher) Close() error {
+    var err error
+    w.once.Do(func() {
+        close(w.done)
+        err = w.watcher.Close()
+    })
+    return err
+}
+
+// readEvents converts inotify events.
+func (w *inotifyWatcher) readEvents() {
+    defer close(w.events)
+    for {
+        select {
+            case <-w.done:
+                return
+            case event, ok := <-w.watcher.Event:
+                if !ok {
+                    return
+                }
+                var op WatchOp
+                for _, item := range inotifyOps {
+                    if (event.Mask & item.mask) != 0 {
+                        op |= item.op
+                    }
+                }
+                if op == 0 {
+                    continue
+                }
+                select {
+                    case w.events <- WatchEvent{event.Name, op}:
+                    case <-w.done:
+                        return
+                }
+        }
+    }
+}
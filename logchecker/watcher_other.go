@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+// Portable file system watcher
+//
+package logchecker
+
+// NewWatcher creates a new file system watcher, fsnotify is used
+// on platforms without inotify.
+func NewWatcher() (Watcher, error) {
+    return newFsnotifyWatcher()
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+package logchecker
+
+import (
+    "context"
+    "errors"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "runtime"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestWatcher(t *testing.T) {
+    constructors := map[string]func() (Watcher, error){
+        "platform": NewWatcher,
+        "fsnotify": newFsnotifyWatcher,
+    }
+    filename := filepath.Join(buildDir(), "test_watcher.log")
+    moved := filename + ".1"
+    defer os.Remove(moved)
+    for name, constructor := range constructors {
+        if err := createFile(filename, 0666); err != nil {
+            t.Fatalf("test file preparation error [%v]", err)
+        }
+        watcher, err := constructor()
+        if err != nil {
+            t.Fatalf("[%v] can't create watcher: %v", name, err)
+        }
+        if err := watcher.Add(filename, WatchWrite | WatchMove); err != nil {
+            t.Fatalf("[%v] can't add watch: %v", name, err)
+        }
+        wait := func(op WatchOp) {
+            select {
+                case event := <-watcher.Events():
+                    if !event.Has(op) || (event.Name != filename) {
+                        t.Errorf("[%v] incorrect event: %v %v", name, event.Name, event.Op)
+                    }
+                case err := <-watcher.Errors():
+                    t.Errorf("[%v] watcher error: %v", name, err)
+                case <-time.After(time.Second):
+                    t.Errorf("[%v] event is not received: %v", name, op)
+            }
+        }
+        if err := updateFile(filename, "new line"); err != nil {
+            t.Fatal(err)
+        }
+        wait(WatchWrite)
+        // not requested operations are skipped
+        if err := os.Chmod(filename, 0600); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.Rename(filename, moved); err != nil {
+            t.Fatal(err)
+        }
+        wait(WatchMove)
+        if err := watcher.Close(); err != nil {
+            t.Errorf("[%v] close error: %v", name, err)
+        }
+        if err := watcher.Close(); err != nil {
+            t.Errorf("[%v] repeated close error: %v", name, err)
+        }
+    }
+}
+
+// openFiles returns a number of open descriptors of the process,
+// it's -1 if they are not available.
+func openFiles() int {
+    items, err := ioutil.ReadDir("/proc/self/fd")
+    if err != nil {
+        return -1
+    }
+    return len(items)
+}
+
+func TestWatchersClosed(t *testing.T) {
+    var group sync.WaitGroup
+    filename := filepath.Join(buildDir(), "test_watchers_closed.log")
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    logger := New()
+    logger.notifier = newRecordNotifier()
+    logger.Cfg.Observed = []Service{{Name: "TestSrv", Files: []File{
+        {Log: filename, Pattern: "ERROR", Boundary: 1, Period: 3600, Limit: 10},
+    }}}
+    cycle := func() {
+        if err := logger.Start(context.Background(), &group); err != nil {
+            t.Fatal(err)
+        }
+        time.Sleep(10 * time.Millisecond)
+        if err := logger.Stop(&group); err != nil {
+            t.Fatal(err)
+        }
+    }
+    // closed watchers release descriptors by their goroutines
+    settled := func(files, goroutines int) bool {
+        for i := 0; i < 100; i++ {
+            if (openFiles() <= files) && (runtime.NumGoroutine() <= goroutines) {
+                return true
+            }
+            time.Sleep(10 * time.Millisecond)
+        }
+        return false
+    }
+    cycle()
+    time.Sleep(100 * time.Millisecond)
+    files, goroutines := openFiles(), runtime.NumGoroutine()
+    for i := 0; i < 20; i++ {
+        cycle()
+    }
+    if !settled(files + 2, goroutines + 2) {
+        t.Errorf("watchers are not closed: files %v -> %v, goroutines %v -> %v", files, openFiles(), goroutines, runtime.NumGoroutine())
+    }
+}
+
+// closeWatcher is a test watcher that counts its closing,
+// Add returns err if it's set.
+type closeWatcher struct {
+    silentWatcher
+    err error
+    closed int
+}
+
+func (cw *closeWatcher) Add(name string, op WatchOp) error {
+    return cw.err
+}
+
+func (cw *closeWatcher) Close() error {
+    cw.closed++
+    return nil
+}
+
+func TestIsMovedClose(t *testing.T) {
+    var (
+        created []*closeWatcher
+        addErr error
+    )
+    defer func(wait time.Duration, f func() (Watcher, error)) {
+        MoveWait, newWatcher = wait, f
+    }(MoveWait, newWatcher)
+    MoveWait = 0
+    newWatcher = func() (Watcher, error) {
+        w := &closeWatcher{err: addErr}
+        created = append(created, w)
+        return w, nil
+    }
+    filename := filepath.Join(buildDir(), "test_is_moved_close.log")
+    os.Remove(filename)
+    // the file is absent
+    old := &closeWatcher{}
+    if w, err := IsMoved(filename, old); (w != nil) || !os.IsNotExist(err) || (old.closed != 1) || (len(created) != 0) {
+        t.Errorf("incorrect result for absent file: %v, %v, closed=%v", w, err, old.closed)
+    }
+    if err := createFile(filename, 0666); err != nil {
+        t.Fatalf("test file preparation error [%v]", err)
+    }
+    defer os.Remove(filename)
+    // the new watcher can't be added
+    addErr = errors.New("add error")
+    old = &closeWatcher{}
+    if w, err := IsMoved(filename, old); (w != nil) || (err != addErr) || (old.closed != 1) || (len(created) != 1) || (created[0].closed != 1) {
+        t.Errorf("incorrect result for add error: %v, %v, closed=%v", w, err, old.closed)
+    }
+    // the file is created again
+    addErr = nil
+    old = &closeWatcher{}
+    w, err := IsMoved(filename, old)
+    if (err != nil) || (len(created) != 2) || (w != created[1]) || (old.closed != 1) || (created[1].closed != 0) {
+        t.Errorf("incorrect result for moved file: %v, %v, closed=%v", w, err, old.closed)
+    }
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Generic HTTP webhook notifier
+//
+package logchecker
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "text/template"
+    "time"
+)
+
+const (
+    // WebhookNotifierName is a name of the webhook notifier configured by "webhook" settings.
+    WebhookNotifierName string = "webhook"
+    // DefaultWebhookBody is a default template of webhook requests body.
+    DefaultWebhookBody string = "{{json .}}"
+)
+
+var (
+    // WebhookTimeout is a timeout of webhook requests.
+    WebhookTimeout = 10 * time.Second
+    // WebhookAttempts is a number of webhook request attempts for 5xx responses.
+    WebhookAttempts = 2
+    rgWebhookLine = regexp.MustCompile(`^(\S+:)?\d+: `)
+    webhookFuncs = template.FuncMap{
+        "json": func(value interface{}) (string, error) {
+            data, err := json.Marshal(value)
+            return string(data), err
+        },
+    }
+)
+
+// WebhookSettings is a configuration of the webhook notifier.
+type WebhookSettings struct {
+    URL string                    `json:"url"`
+    Method string                 `json:"method"`
+    Headers map[string]string     `json:"headers"`
+    BodyTemplate string           `json:"body_template"`
+    Batch *WebhookBatch           `json:"batch"`
+}
+
+// WebhookData is a data of the webhook body template.
+type WebhookData struct {
+    Service string
+    File string
+    Count uint64
+    Severity string
+    Lines []string
+}
+
+// WebhookNotifier sends notifications as HTTP requests,
+// the body is rendered by BodyTemplate.
+type WebhookNotifier struct {
+    URL string
+    Method string
+    Headers map[string]string
+    BodyTemplate string
+    body *template.Template
+}
+
+// webhookFileNotifier is a webhook notifier of the file's alert,
+// the alert is added to the batch if it's set.
+type webhookFileNotifier struct {
+    *WebhookNotifier
+    data WebhookData
+    batch *webhookBatcher
+}
+
+// NewWebhookNotifier creates WebhookNotifier from "webhook" config settings,
+// "url" is mandatory, "method" is POST by default. "body_template" is
+// a text/template with WebhookData fields and "json" function, the data
+// is encoded to JSON by default. Notifications are sent together
+// if "batch" is set.
+func NewWebhookNotifier(settings *WebhookSettings) (*WebhookNotifier, error) {
+    if (settings == nil) || (len(settings.URL) == 0) {
+        return nil, fmt.Errorf("webhook url should not be empty")
+    }
+    u, err := url.Parse(settings.URL)
+    if err != nil {
+        return nil, fmt.Errorf("webhook url is incorrect: %v", err)
+    }
+    if ((u.Scheme != "https") && (u.Scheme != "http")) || (len(u.Host) == 0) {
+        return nil, fmt.Errorf("webhook url should be an absolute HTTP(S) URL")
+    }
+    if (settings.Batch != nil) && (settings.Batch.Size < 0) {
+        return nil, fmt.Errorf("webhook batch size can't be negative")
+    }
+    wn := &WebhookNotifier{
+        URL: settings.URL,
+        Method: strings.ToUpper(settings.Method),
+        Headers: settings.Headers,
+        BodyTemplate: settings.BodyTemplate,
+    }
+    if len(wn.Method) == 0 {
+        wn.Method = http.MethodPost
+    }
+    if len(wn.BodyTemplate) == 0 {
+        wn.BodyTemplate = DefaultWebhookBody
+    }
+    wn.body, err = template.New("webhook").Funcs(webhookFuncs).Parse(wn.BodyTemplate)
+    if err != nil {
+        return nil, fmt.Errorf("webhook body_template error: %v", err)
+    }
+    return wn, nil
+}
+
+// String returns a name of the notifier.
+func (wn *WebhookNotifier) String() string {
+    return fmt.Sprintf("webhook (%v)", wn.URL)
+}
+
+// Notify sends a message without alert metadata, recipients are ignored.
+func (wn *WebhookNotifier) Notify(msg string, to []string) error {
+    return wn.Send(WebhookData{}, msg)
+}
+
+// NotifyContext sends a message without alert metadata,
+// the request is cancelled when the context is done.
+func (wn *WebhookNotifier) NotifyContext(ctx context.Context, msg string, to []string) error {
+    return wn.SendContext(ctx, WebhookData{}, msg)
+}
+
+// Send renders the body template and sends the request, reported lines
+// of the message are added to the data. The request is repeated
+// if the server responds with 5xx status.
+func (wn *WebhookNotifier) Send(data WebhookData, msg string) error {
+    return wn.SendContext(context.Background(), data, msg)
+}
+
+// SendContext is Send that cancels the request when the context is done.
+func (wn *WebhookNotifier) SendContext(ctx context.Context, data WebhookData, msg string) error {
+    body, err := wn.render(data, msg)
+    if err != nil {
+        return err
+    }
+    return wn.post(ctx, []byte(body))
+}
+
+// render returns a request body of the notification.
+func (wn *WebhookNotifier) render(data WebhookData, msg string) (string, error) {
+    for _, line := range strings.Split(truncateReport(msg), "\n") {
+        if rgWebhookLine.MatchString(line) || (line == "...") {
+            data.Lines = append(data.Lines, line)
+        }
+    }
+    var body bytes.Buffer
+    if err := wn.body.Execute(&body, data); err != nil {
+        return "", fmt.Errorf("webhook body_template error: %v", err)
+    }
+    return body.String(), nil
+}
+
+// post sends the request body, it's repeated for 5xx responses.
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) error {
+    client := &http.Client{Timeout: WebhookTimeout}
+    var status string
+    for i := 0; i < WebhookAttempts; i++ {
+        req, err := http.NewRequestWithContext(ctx, wn.Method, wn.URL, bytes.NewReader(body))
+        if err != nil {
+            return fmt.Errorf("webhook request error: %v", err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+        for name, value := range wn.Headers {
+            req.Header.Set(name, value)
+        }
+        resp, err := client.Do(req)
+        if err != nil {
+            return fmt.Errorf("webhook request error: %v", err)
+        }
+        resp.Body.Close()
+        status = resp.Status
+        switch {
+            case resp.StatusCode >= 500:
+                LoggerDebug.Printf("webhook response error, attempt %v: %v", i + 1, status)
+                continue
+            case (resp.StatusCode < 200) || (resp.StatusCode > 299):
+                return fmt.Errorf("webhook response error: %v", status)
+        }
+        LoggerDebug.Printf("webhook notification is sent: %v", wn)
+        return nil
+    }
+    return fmt.Errorf("webhook response error: %v", status)
+}
+
+// Notify sends the file's alert metadata or adds it to the batch.
+func (wfn *webhookFileNotifier) Notify(msg string, to []string) error {
+    return wfn.NotifyContext(context.Background(), msg, to)
+}
+
+// NotifyContext is Notify that cancels the request when the context is done.
+func (wfn *webhookFileNotifier) NotifyContext(ctx context.Context, msg string, to []string) error {
+    if wfn.batch != nil {
+        return wfn.batch.Add(wfn.data, msg)
+    }
+    return wfn.SendContext(ctx, wfn.data, msg)
+}
+
+// webhookNotifier returns the webhook notifier for the file's alert.
+func (logger *LogChecker) webhookNotifier(f *File) (Notifier, error) {
+    wn, err := NewWebhookNotifier(logger.Cfg.Webhook)
+    if err != nil {
+        return nil, err
+    }
+    data := WebhookData{File: f.Log, Count: f.Found, Severity: f.LastSeverity}
+    if f.service != nil {
+        data.Service = f.service.Name
+    }
+    wfn := &webhookFileNotifier{WebhookNotifier: wn, data: data}
+    if logger.Cfg.Webhook.Batch != nil {
+        wfn.batch = logger.webhookBatcher(wn)
+    }
+    return wfn, nil
+}
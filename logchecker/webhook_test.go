@@ -0,0 +1,197 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Webhook notifier testing methods
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// webhookRequest is a request received by the test webhook server.
+type webhookRequest struct {
+    method string
+    token string
+    body string
+}
+
+func TestWebhookNotifier(t *testing.T) {
+    requests := make(chan webhookRequest, 10)
+    statuses := make(chan int, 10)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, err := ioutil.ReadAll(r.Body)
+        if err != nil {
+            t.Errorf("request body error: %v", err)
+        }
+        requests <- webhookRequest{r.Method, r.Header.Get("X-Token"), string(body)}
+        status := http.StatusOK
+        select {
+            case status = <-statuses:
+            default:
+        }
+        w.WriteHeader(status)
+    }))
+    defer server.Close()
+
+    for _, settings := range []*WebhookSettings{
+        nil,
+        {},
+        {URL: "incidents.host.com/api"},
+        {URL: server.URL, BodyTemplate: "{{.Count"},
+    } {
+        if _, err := NewWebhookNotifier(settings); err == nil {
+            t.Errorf("need settings error: %v", settings)
+        }
+    }
+    wn, err := NewWebhookNotifier(&WebhookSettings{
+        URL: server.URL,
+        Method: "put",
+        Headers: map[string]string{"X-Token": "secret"},
+        BodyTemplate: `{"service": "{{.Service}}", "file": "{{.File}}", "count": {{.Count}}, "lines": {{json .Lines}}}`,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    data := WebhookData{Service: "app", File: "/var/log/app.log", Count: 2, Severity: SeverityWarning}
+    msg := "Report for \"app\" service (2 new items, severity: warning): /var/log/app.log\n1: ERROR 1\n2: ERROR 2\n\n--\nBR, LogChecker"
+    if err := wn.Send(data, msg); err != nil {
+        t.Fatal(err)
+    }
+    req := <-requests
+    if (req.method != http.MethodPut) || (req.token != "secret") {
+        t.Errorf("incorrect request: %v", req)
+    }
+    expected := `{"service": "app", "file": "/var/log/app.log", "count": 2, "lines": ["1: ERROR 1","2: ERROR 2"]}`
+    if req.body != expected {
+        t.Errorf("incorrect body: %v", req.body)
+    }
+    // one retry after 5xx
+    statuses <- http.StatusBadGateway
+    if err := wn.Send(data, msg); err != nil {
+        t.Errorf("request should be retried: %v", err)
+    }
+    if n := len(requests); n != 2 {
+        t.Errorf("incorrect number of requests: %v", n)
+    }
+    for len(requests) > 0 {
+        <-requests
+    }
+    statuses <- http.StatusServiceUnavailable
+    statuses <- http.StatusServiceUnavailable
+    if err := wn.Send(data, msg); err == nil {
+        t.Errorf("need response error")
+    }
+    if n := len(requests); n != WebhookAttempts {
+        t.Errorf("incorrect number of attempts: %v", n)
+    }
+    for len(requests) > 0 {
+        <-requests
+    }
+    statuses <- http.StatusBadRequest
+    if err := wn.Send(data, msg); err == nil {
+        t.Errorf("need response error")
+    }
+    if n := len(requests); n != 1 {
+        t.Errorf("4xx response should not be retried: %v", n)
+    }
+    <-requests
+
+    // default method and body, file's alert metadata
+    logger := New()
+    logger.Cfg.Webhook = &WebhookSettings{URL: server.URL}
+    f := &File{Log: "/var/log/app.log", Found: 3, LastSeverity: SeverityCritical, Notifiers: []string{WebhookNotifierName}, service: &Service{Name: "app"}}
+    if !logger.Cfg.hasNotifier(WebhookNotifierName) {
+        t.Errorf("webhook notifier is not found")
+    }
+    n, err := logger.notifierByName(WebhookNotifierName, f)
+    if err != nil {
+        t.Fatal(err)
+    }
+    n.Notify("1: ERROR 1", nil)
+    req = <-requests
+    if req.method != http.MethodPost {
+        t.Errorf("incorrect default method: %v", req.method)
+    }
+    var result WebhookData
+    if err := json.Unmarshal([]byte(req.body), &result); err != nil {
+        t.Fatalf("incorrect default body [%v]: %v", req.body, err)
+    }
+    if (result.Service != "app") || (result.Count != 3) || (result.Severity != SeverityCritical) || (len(result.Lines) != 1) {
+        t.Errorf("incorrect default body: %v", req.body)
+    }
+}
+
+func TestWebhookBatch(t *testing.T) {
+    requests := make(chan string, 10)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, err := ioutil.ReadAll(r.Body)
+        if err != nil {
+            t.Errorf("request body error: %v", err)
+        }
+        requests <- string(body)
+    }))
+    defer server.Close()
+    batch := func(body string) []WebhookData {
+        var result []WebhookData
+        if err := json.Unmarshal([]byte(body), &result); err != nil {
+            t.Errorf("incorrect batch body [%v]: %v", body, err)
+        }
+        return result
+    }
+    if _, err := NewWebhookNotifier(&WebhookSettings{URL: server.URL, Batch: &WebhookBatch{Size: -1}}); err == nil {
+        t.Errorf("need batch size error")
+    }
+    logger := New()
+    logger.Cfg.Webhook = &WebhookSettings{URL: server.URL, Batch: &WebhookBatch{Size: 10, Interval: 1}}
+    notify := func(names ...string) {
+        for _, name := range names {
+            f := &File{Log: "/var/log/" + name, Found: 1, LastSeverity: SeverityWarning, service: &Service{Name: "app"}}
+            n, err := logger.notifierByName(WebhookNotifierName, f)
+            if err != nil {
+                t.Fatal(err)
+            }
+            n.Notify("1: ERROR " + name, nil)
+        }
+    }
+    notify("a.log", "b.log", "c.log")
+    select {
+        case body := <-requests:
+            t.Errorf("batch is sent before the interval: %v", body)
+        case <-time.After(500 * time.Millisecond):
+    }
+    select {
+        case body := <-requests:
+            result := batch(body)
+            if len(result) != 3 {
+                t.Fatalf("incorrect batch: %v", body)
+            }
+            for i, name := range []string{"a.log", "b.log", "c.log"} {
+                if (result[i].File != "/var/log/" + name) || (len(result[i].Lines) != 1) {
+                    t.Errorf("incorrect batch item: %v", result[i])
+                }
+            }
+        case <-time.After(2 * time.Second):
+            t.Fatalf("batch is not sent")
+    }
+    // a full batch is sent immediately, the rest one is sent by flush
+    logger.resetWebhook()
+    logger.Cfg.Webhook.Batch = &WebhookBatch{Size: 2, Interval: 60}
+    notify("a.log", "b.log", "c.log")
+    if result := batch(<-requests); len(result) != 2 {
+        t.Errorf("incorrect full batch: %v", result)
+    }
+    logger.flushWebhook()
+    if result := batch(<-requests); (len(result) != 1) || (result[0].File != "/var/log/c.log") {
+        t.Errorf("incorrect flushed batch: %v", result)
+    }
+    if n := len(requests); n != 0 {
+        t.Errorf("incorrect number of requests: %v", n)
+    }
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Batches of webhook notifications
+//
+package logchecker
+
+import (
+    "context"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // DefaultWebhookBatchSize is a default maximum number of notifications in a batch.
+    DefaultWebhookBatchSize int = 100
+    // DefaultWebhookBatchInterval is a default time to collect a batch.
+    DefaultWebhookBatchInterval = 5 * time.Second
+)
+
+// WebhookBatch is a configuration of webhook batches: notifications
+// are collected during Interval seconds or until Size ones are added,
+// then they are sent by one request as a JSON array.
+type WebhookBatch struct {
+    Size int           `json:"size"`
+    Interval uint64    `json:"interval"`
+}
+
+// webhookBatcher collects rendered webhook bodies and sends them together.
+type webhookBatcher struct {
+    *WebhookNotifier
+    Size int
+    Interval time.Duration
+    items []string
+    batch uint64     // number of the collected batch
+    timer *time.Timer
+    mutex sync.Mutex
+    sending sync.WaitGroup
+}
+
+// newWebhookBatcher creates a batcher of the webhook notifier.
+func newWebhookBatcher(wn *WebhookNotifier, settings *WebhookBatch) *webhookBatcher {
+    wb := &webhookBatcher{WebhookNotifier: wn, Size: settings.Size, Interval: DefaultWebhookBatchInterval}
+    if wb.Size == 0 {
+        wb.Size = DefaultWebhookBatchSize
+    }
+    if settings.Interval > 0 {
+        wb.Interval = time.Duration(settings.Interval) * time.Second
+    }
+    return wb
+}
+
+// Add renders the notification body and adds it to the batch,
+// a full batch is sent immediately.
+func (wb *webhookBatcher) Add(data WebhookData, msg string) error {
+    body, err := wb.render(data, msg)
+    if err != nil {
+        return err
+    }
+    wb.mutex.Lock()
+    wb.items = append(wb.items, body)
+    if len(wb.items) == 1 {
+        batch := wb.batch
+        wb.timer = time.AfterFunc(wb.Interval, func() {
+            if err := wb.flush(batch); err != nil {
+                LoggerError.Println(err)
+            }
+        })
+    }
+    var items []string
+    if len(wb.items) >= wb.Size {
+        items = wb.take()
+    }
+    wb.mutex.Unlock()
+    return wb.send(items)
+}
+
+// Flush sends collected notifications.
+func (wb *webhookBatcher) Flush() error {
+    wb.mutex.Lock()
+    items := wb.take()
+    wb.mutex.Unlock()
+    return wb.send(items)
+}
+
+// flush sends collected notifications if they are still the same batch.
+func (wb *webhookBatcher) flush(batch uint64) error {
+    wb.mutex.Lock()
+    if batch != wb.batch {
+        wb.mutex.Unlock()
+        return nil
+    }
+    items := wb.take()
+    wb.mutex.Unlock()
+    return wb.send(items)
+}
+
+// take returns collected notifications and starts a new batch,
+// the mutex should be locked.
+func (wb *webhookBatcher) take() []string {
+    if wb.timer != nil {
+        wb.timer.Stop()
+        wb.timer = nil
+    }
+    items := wb.items
+    wb.items = nil
+    wb.batch++
+    if len(items) > 0 {
+        wb.sending.Add(1)
+    }
+    return items
+}
+
+// send posts notifications as a JSON array.
+func (wb *webhookBatcher) send(items []string) error {
+    if len(items) == 0 {
+        return nil
+    }
+    defer wb.sending.Done()
+    if err := wb.post(context.Background(), []byte("[" + strings.Join(items, ",") + "]")); err != nil {
+        return err
+    }
+    LoggerDebug.Printf("webhook batch is sent: %v notifications", len(items))
+    return nil
+}
+
+// webhookBatcher returns a shared batcher, so notifications
+// of all files are collected together.
+func (logger *LogChecker) webhookBatcher(wn *WebhookNotifier) *webhookBatcher {
+    logger.webhookMutex.Lock()
+    defer logger.webhookMutex.Unlock()
+    if logger.webhookBatch == nil {
+        logger.webhookBatch = newWebhookBatcher(wn, logger.Cfg.Webhook.Batch)
+    }
+    return logger.webhookBatch
+}
+
+// flushWebhook sends a collected webhook batch and waits
+// for all sending batches.
+func (logger *LogChecker) flushWebhook() {
+    logger.webhookMutex.Lock()
+    wb := logger.webhookBatch
+    logger.webhookMutex.Unlock()
+    if wb == nil {
+        return
+    }
+    if err := wb.Flush(); err != nil {
+        LoggerError.Println(err)
+    }
+    wb.sending.Wait()
+}
+
+// resetWebhook sends a collected webhook batch and releases the batcher.
+func (logger *LogChecker) resetWebhook() {
+    logger.flushWebhook()
+    logger.webhookMutex.Lock()
+    logger.webhookBatch = nil
+    logger.webhookMutex.Unlock()
+}
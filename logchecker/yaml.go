@@ -0,0 +1,79 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// YAML configuration
+//
+package logchecker
+
+import (
+    "encoding/json"
+    "fmt"
+    "gopkg.in/yaml.v2"
+    "path/filepath"
+    "strings"
+)
+
+// IsYAML checks that a configuration file has YAML extension.
+func IsYAML(name string) bool {
+    switch strings.ToLower(filepath.Ext(name)) {
+        case ".yaml", ".yml":
+            return true
+    }
+    return false
+}
+
+// ParseConfig parses configuration data of the file, its format
+// is JSON or YAML by the file extension. Values are not validated.
+func ParseConfig(name string, data []byte, cfg *Config) error {
+    if IsYAML(name) {
+        var err error
+        if data, err = yamlToJSON(data); err != nil {
+            return fmt.Errorf("can't parse YAML: %v", err)
+        }
+    }
+    return json.Unmarshal(data, cfg)
+}
+
+// yamlToJSON converts YAML configuration to JSON, so the same
+// struct tags are used for both formats.
+func yamlToJSON(data []byte) ([]byte, error) {
+    var value interface{}
+    if err := yaml.Unmarshal(data, &value); err != nil {
+        return nil, err
+    }
+    value, err := jsonValue(value)
+    if err != nil {
+        return nil, err
+    }
+    return json.Marshal(value)
+}
+
+// jsonValue converts YAML maps with interface keys to JSON objects.
+func jsonValue(value interface{}) (interface{}, error) {
+    switch v := value.(type) {
+        case map[interface{}]interface{}:
+            result := make(map[string]interface{}, len(v))
+            for key, item := range v {
+                name, ok := key.(string)
+                if !ok {
+                    return nil, fmt.Errorf("unsupported YAML key [%v]", key)
+                }
+                converted, err := jsonValue(item)
+                if err != nil {
+                    return nil, err
+                }
+                result[name] = converted
+            }
+            return result, nil
+        case []interface{}:
+            for i, item := range v {
+                converted, err := jsonValue(item)
+                if err != nil {
+                    return nil, err
+                }
+                v[i] = converted
+            }
+    }
+    return value, nil
+}
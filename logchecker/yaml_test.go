@@ -0,0 +1,55 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// YAML configuration testing methods
+//
+package logchecker
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestYAMLConfig(t *testing.T) {
+    testdir := buildDir()
+    newvalues := map[string]string{
+        "/var/log/nginx/error.log": filepath.Join(testdir, "test_yaml_error.log"),
+        "/var/log/nginx/access.log": filepath.Join(testdir, "test_yaml_access.log"),
+        "/var/log/syslog": filepath.Join(testdir, "test_yaml_syslog"),
+    }
+    for _, v := range newvalues {
+        if err := createFile(v, 0666); err != nil {
+            t.Errorf("test file preparation error [%v]: %v", v, err)
+        }
+        defer os.Remove(v)
+    }
+    loggers := make([]*LogChecker, 2)
+    for i, name := range []string{"config.example.json", "config.example.yaml"} {
+        example := filepath.Join(testdir, "config.test" + filepath.Ext(name))
+        if err := prepareConfig(filepath.Join(testdir, name), example, newvalues); err != nil {
+            t.Fatalf("can't prepare test config file [%v]", err)
+        }
+        defer os.Remove(example)
+        loggers[i] = New()
+        if err := InitConfig(loggers[i], example); err != nil {
+            t.Fatalf("config error [%v]: %v", name, err)
+        }
+    }
+    jsonCfg, yamlCfg := loggers[0].Cfg, loggers[1].Cfg
+    if filepath.Ext(yamlCfg.Path) != ".yaml" {
+        t.Errorf("incorrect config path: %v", yamlCfg.Path)
+    }
+    yamlCfg.Path = jsonCfg.Path
+    if !reflect.DeepEqual(jsonCfg, yamlCfg) {
+        t.Errorf("configurations are different:\n%v\n%v", jsonCfg, yamlCfg)
+    }
+    if !IsYAML("config.YML") || IsYAML("config.json") {
+        t.Errorf("incorrect YAML detection")
+    }
+    if _, err := yamlToJSON([]byte("1: value")); err == nil {
+        t.Errorf("need unsupported key error")
+    }
+}
@@ -9,113 +9,243 @@ package main
 import (
     "os"
     "fmt"
+    "io"
+    "io/ioutil"
+    "encoding/json"
     "time"
     "flag"
-    "sync"
+    "errors"
+    "context"
     "syscall"
     "os/signal"
-    "golang.org/x/exp/inotify"
     "github.com/z0rr0/logchecker/logchecker"
 )
 
 const (
     // Config is a configuration file name.
     Config string = "config.json"
-    // Period is time between statistics print
-    Period time.Duration = 60 * time.Minute
+)
+
+// Exit codes of the program.
+const (
+    ExitOK = iota
+    ExitUnexpected
+    ExitUsage
+    ExitConfig
+    ExitStart
+    ExitWatcher
+    ExitNotify
 )
 
 var (
     // Version is program version, it is set during a build.
     Version = "uknown"
+    // output is a writer of command results, it is replaced in tests.
+    output io.Writer = os.Stdout
 )
 
+// exitError is an error with a program exit code.
+type exitError struct {
+    code int
+    err error
+}
+
+func (e *exitError) Error() string {
+    return e.err.Error()
+}
+
+// exitCode returns a program exit code for an error returned by run.
+func exitCode(err error) int {
+    if err == nil {
+        return ExitOK
+    }
+    if e, ok := err.(*exitError); ok {
+        return e.code
+    }
+    return ExitUnexpected
+}
+
 func main() {
-    var group sync.WaitGroup
     defer func() {
         if r := recover(); r != nil {
             logchecker.LoggerError.Println(r)
             fmt.Println("Program is terminated abnormally.")
+            os.Exit(ExitUnexpected)
         }
     }()
+    if err := run(os.Args[1:]); err != nil {
+        logchecker.LoggerError.Println(err)
+        os.Exit(exitCode(err))
+    }
+}
 
-    debug := flag.Bool("debug", false, "debug mode")
-    version := flag.Bool("version", false, "show version")
-    config := flag.String("config", Config, "configuration file")
+// run starts the process with command line arguments and returns an error
+// if it can't be started or was stopped abnormally.
+func run(args []string) error {
+    flags := flag.NewFlagSet("logchecker", flag.ContinueOnError)
+    debug := flags.Bool("debug", false, "debug mode")
+    version := flags.Bool("version", false, "show version")
+    config := flags.String("config", Config, "configuration file")
+    keyfile := flags.String("keyfile", "", "sender key file for encrypt-sender command")
+    dialcheck := flags.Bool("dialcheck", false, "check connection to sender address on start")
+    check := flags.Bool("check", false, "validate the configuration, print its summary and exit")
+    testnotify := flags.Bool("test-notify", false, "send a test notification to emails from arguments or to all configured recipients and exit")
+    metricsaddr := flags.String("metrics-addr", "", "address of Prometheus metrics server, e.g. 127.0.0.1:9100")
+    statinterval := flags.Duration("stat-interval", 0, "statistics logging period, zero or negative disables it")
 
-    flag.Parse()
+    if err := flags.Parse(args); err != nil {
+        return &exitError{ExitUsage, err}
+    }
     if *version {
         fmt.Println(Version)
-        flag.PrintDefaults()
-        return
+        flags.PrintDefaults()
+        return nil
+    }
+    if flags.Arg(0) == "status" {
+        if err := status(flags.Arg(1), *config); err != nil {
+            return &exitError{ExitUsage, err}
+        }
+        return nil
+    }
+    if flags.Arg(0) == "decision" {
+        if err := decision(flags.Arg(1), flags.Arg(2), flags.Arg(3)); err != nil {
+            return &exitError{ExitUsage, err}
+        }
+        return nil
+    }
+    if flags.Arg(0) == "encrypt-sender" {
+        if err := encryptSender(flags.Arg(1), *keyfile); err != nil {
+            return &exitError{ExitUsage, err}
+        }
+        return nil
     }
     logchecker.DebugMode(*debug)
+    logchecker.SenderDialCheck = *dialcheck
+    flags.Visit(func(f *flag.Flag) {
+        if f.Name == "stat-interval" {
+            logchecker.StatsIntervalFlag = statInterval(*statinterval)
+        }
+    })
 
     logger := logchecker.New()
-    if err := logchecker.InitConfig(logger, *config); err != nil {
-        logchecker.LoggerError.Panicln(err)
+    err := logchecker.InitConfig(logger, *config)
+    if *check {
+        fmt.Print(logger.Describe())
+        if err != nil {
+            return &exitError{ExitConfig, fmt.Errorf("incorrect config: %v", err)}
+        }
+        fmt.Println("Config is correct.")
+        return nil
+    }
+    if *testnotify {
+        if err != nil {
+            return &exitError{ExitConfig, fmt.Errorf("can't init config: %v", err)}
+        }
+        if err := logger.SendTest(flags.Args()); err != nil {
+            fmt.Printf("Test notification is failed: %v\n", err)
+            return &exitError{ExitNotify, fmt.Errorf("test notification error: %v", err)}
+        }
+        fmt.Println("Test notification is sent.")
+        return nil
+    }
+    if err != nil {
+        return &exitError{ExitConfig, fmt.Errorf("can't init config: %v", err)}
     }
     logger.Name = "LogChecker"
     logchecker.LoggerDebug.Println(logger.Cfg)
 
-    // process start
-    finish, err := logger.Start(&group)
-    if err != nil {
-        logchecker.LoggerError.Printf("can't start the process: %v\n", err)
-        logchecker.LoggerError.Panicln(err)
+    logger.ListenAPI()
+    if len(*metricsaddr) > 0 {
+        logger.ListenMetrics(*metricsaddr)
     }
-    // config monitoring
-    watcher, err := inotify.NewWatcher()
+    // the process is stopped by signals
+    ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer cancel()
+    if err := logger.Run(ctx); err != nil {
+        return runError(err)
+    }
+    return nil
+}
+
+// statInterval returns a statistics period of the command line flag,
+// zero period is replaced by a negative one to disable the logging.
+func statInterval(period time.Duration) time.Duration {
+    if period <= 0 {
+        return -1
+    }
+    return period
+}
+
+// runError returns an error with an exit code of the failed stage of the process.
+func runError(err error) error {
+    var rerr *logchecker.RunError
+    if !errors.As(err, &rerr) {
+        return &exitError{ExitUnexpected, err}
+    }
+    switch rerr.Stage {
+        case logchecker.RunStart, logchecker.RunReload:
+            return &exitError{ExitStart, err}
+        case logchecker.RunWatcher:
+            return &exitError{ExitWatcher, err}
+    }
+    return &exitError{ExitUnexpected, err}
+}
+
+// status prints a statistics report of a running process,
+// a template is taken from the configuration file if it exists.
+func status(url, config string) error {
+    var cfg logchecker.Config
+    if len(url) == 0 {
+        return fmt.Errorf("usage: logchecker [-config FILE] status http://host:port/status")
+    }
+    stats, err := logchecker.FetchStats(url)
     if err != nil {
-        logchecker.LoggerError.Printf("can't create config watcher: %v\n", err)
-        logchecker.LoggerError.Panicln(err)
-    }
-    if err = watcher.AddWatch(logger.Cfg.Path, inotify.IN_CLOSE_WRITE | inotify.IN_ATTRIB); err != nil {
-        logchecker.LoggerError.Printf("can't activate config watcher: %v\n", err)
-        close(finish)
-        logchecker.LoggerError.Panicln(err)
-    }
-    timestat := time.Tick(Period)
-    sigchan := make(chan os.Signal, 2)
-    signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
-    // process event monitor
-    for {
-        select {
-            case <-sigchan:
-                logchecker.LoggerInfo.Println("process will be stopped")
-                if err = logger.Stop(finish, &group); err != nil {
-                    logchecker.LoggerError.Panicln(err)
-                }
-                os.Exit(0)
-            case event := <-watcher.Event:
-                logchecker.LoggerInfo.Println("process will be restarted due to reconfiguration")
-                if (event.Mask & inotify.IN_DELETE_SELF) != 0 {
-                    watcher, err = logchecker.IsMoved(logger.Cfg.Path, watcher)
-                    if err != nil {
-                        logchecker.LoggerError.Printf("re-creation watcher error: %v\n", err)
-                        logchecker.LoggerError.Panicln(err)
-                    }
-                }
-                if err = logger.Stop(finish, &group); err != nil {
-                    logchecker.LoggerError.Panicln(err)
-                }
-                err = logchecker.InitConfig(logger, logger.Cfg.Path)
-                if err != nil {
-                    logchecker.LoggerError.Panicln(err)
-                }
-                finish, err = logger.Start(&group)
-                if err != nil {
-                    logchecker.LoggerError.Printf("can't start the process: %v\n", err)
-                    logchecker.LoggerError.Panicln(err)
-                }
-            case werr := <-watcher.Error:
-                logchecker.LoggerError.Printf("config watcher error: %v\n", werr)
-                if err = logger.Stop(finish, &group); err != nil {
-                    logchecker.LoggerError.Panicln(err)
-                }
-                logchecker.LoggerError.Panicln(werr)
-            case <- timestat:
-                logchecker.LoggerInfo.Printf("statictics: %v", logger)
+        return err
+    }
+    if data, err := ioutil.ReadFile(config); err == nil {
+        if err := logchecker.ParseConfig(config, data, &cfg); err != nil {
+            logchecker.LoggerError.Printf("can't parse config file, default template is used: %v\n", err)
         }
     }
+    fmt.Fprint(output, logchecker.RenderStats(stats, cfg.StatsTemplate()))
+    return nil
+}
+
+// decision prints why the last check of a file of a running process
+// did or didn't notify.
+func decision(url, service, file string) error {
+    if (len(url) == 0) || (len(file) == 0) {
+        return fmt.Errorf("usage: logchecker decision http://host:port/decision SERVICE FILE")
+    }
+    d, err := logchecker.FetchDecision(url, service, file)
+    if err != nil {
+        return err
+    }
+    fmt.Println(d)
+    return nil
+}
+
+// encryptSender prints an encrypted sender block for a plain sender JSON file.
+func encryptSender(name, keyfile string) error {
+    var sender map[string]string
+    if len(name) == 0 {
+        return fmt.Errorf("usage: logchecker [-keyfile FILE] encrypt-sender SENDER_JSON")
+    }
+    data, err := ioutil.ReadFile(name)
+    if err != nil {
+        return err
+    }
+    if err = json.Unmarshal(data, &sender); err != nil {
+        return fmt.Errorf("can't parse sender file [%v]: %v", name, err)
+    }
+    key, err := logchecker.SenderKey(keyfile)
+    if err != nil {
+        return err
+    }
+    blob, err := logchecker.EncryptSender(sender, key)
+    if err != nil {
+        return err
+    }
+    fmt.Println(blob)
+    return nil
 }
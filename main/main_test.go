@@ -0,0 +1,100 @@
+// Copyright (c) 2015, Alexander Zaytsev. All rights reserved.
+// Use of this source code is governed by a LGPL-style
+// license that can be found in the LICENSE file.
+
+// Main package testing methods
+//
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "github.com/z0rr0/logchecker/logchecker"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestRun(t *testing.T) {
+    defer func() {
+        if r := recover(); r != nil {
+            t.Errorf("run should not panic: %v", r)
+        }
+    }()
+    if err := run([]string{"-config", "invalid_name.json"}); exitCode(err) != ExitConfig {
+        t.Errorf("incorrect config error: %v", err)
+    }
+    if err := run([]string{"-check", "-config", "invalid_name.json"}); exitCode(err) != ExitConfig {
+        t.Errorf("incorrect check error: %v", err)
+    }
+    if err := run([]string{"-test-notify", "-config", "invalid_name.json"}); exitCode(err) != ExitConfig {
+        t.Errorf("incorrect test notification error: %v", err)
+    }
+    if err := run([]string{"-unknown"}); exitCode(err) != ExitUsage {
+        t.Errorf("incorrect usage error: %v", err)
+    }
+    if err := run([]string{"encrypt-sender"}); exitCode(err) != ExitUsage {
+        t.Errorf("incorrect usage error: %v", err)
+    }
+    if err := run([]string{"decision", "http://127.0.0.1:1/decision"}); exitCode(err) != ExitUsage {
+        t.Errorf("incorrect usage error: %v", err)
+    }
+    defer func() {
+        logchecker.StatsIntervalFlag = 0
+    }()
+    if err := run([]string{"-stat-interval", "0", "-config", "invalid_name.json"}); exitCode(err) != ExitConfig {
+        t.Errorf("incorrect config error: %v", err)
+    }
+    if logchecker.StatsIntervalFlag >= 0 {
+        t.Errorf("statistics logging should be disabled: %v", logchecker.StatsIntervalFlag)
+    }
+    if d := statInterval(time.Minute); d != time.Minute {
+        t.Errorf("incorrect statistics interval: %v", d)
+    }
+    if code := exitCode(nil); code != ExitOK {
+        t.Errorf("incorrect exit code: %v", code)
+    }
+    codes := map[string]int{
+        logchecker.RunStart: ExitStart,
+        logchecker.RunReload: ExitStart,
+        logchecker.RunWatcher: ExitWatcher,
+        logchecker.RunStop: ExitUnexpected,
+    }
+    for stage, expected := range codes {
+        err := runError(&logchecker.RunError{Stage: stage, Err: fmt.Errorf("failed")})
+        if code := exitCode(err); code != expected {
+            t.Errorf("incorrect exit code of %v stage: %v", stage, code)
+        }
+    }
+    // status report uses a template of YAML configuration
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(logchecker.Stats{Name: "test-status"})
+    }))
+    defer server.Close()
+    dir, err := ioutil.TempDir("", "logchecker_status")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    config := filepath.Join(dir, "config.yaml")
+    if err := ioutil.WriteFile(config, []byte("stats_template: \"custom {{.Name}}\"\n"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    defer func(w io.Writer) {
+        output = w
+    }(output)
+    var buf bytes.Buffer
+    output = &buf
+    if err := run([]string{"-config", config, "status", server.URL}); err != nil {
+        t.Fatalf("status error: %v", err)
+    }
+    if report := buf.String(); report != "custom test-status" {
+        t.Errorf("incorrect status report: %v", report)
+    }
+}
@@ -26,7 +26,7 @@ else
 fi
 
 cd ${buildDir}/logchecker
-go test -v -cover -coverprofile=coverage.out || exit 1
+go test -v -tags sqlite -cover -coverprofile=coverage.out || exit 1
 
 echo "all tests done"
 exit 0